@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"github.com/RVodassa/FileTransfer/internal/client/app"
 	"github.com/RVodassa/FileTransfer/internal/client/config"
 	"github.com/spf13/cobra"
@@ -26,7 +27,7 @@ func main() {
 		Use:   "file_transfer_client",
 		Short: "File Transfer CLI",
 		PersistentPreRun: func(cmd *cobra.Command, args []string) {
-			if err = newApp.Initialize(); err != nil {
+			if err = newApp.Initialize(cmd.Context()); err != nil {
 				log.Fatalf("did not connect: %v", err)
 			}
 		},
@@ -37,7 +38,7 @@ func main() {
 
 	newApp.AddCommands(rootCmd)
 
-	if err = rootCmd.Execute(); err != nil {
+	if err = rootCmd.ExecuteContext(context.Background()); err != nil {
 		log.Fatalf("command execution failed: %v", err)
 	}
 }
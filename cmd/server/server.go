@@ -1,9 +1,13 @@
 package main
 
 import (
+	"context"
 	"github.com/RVodassa/FileTransfer/internal/server/app"
 	"github.com/RVodassa/FileTransfer/internal/server/config"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 )
 
 // ServerConfigPath путь до файла конфиг.
@@ -16,6 +20,14 @@ func main() {
 		log.Printf("Error loading config: %v", err)
 		return
 	}
-	
-	app.Run(cfg)
+
+	// Ctrl+C или SIGTERM останавливают сервер после завершения текущих передач,
+	// повторный сигнал завершает процесс сразу
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+
+	app.Run(ctx, cfg)
 }
@@ -4,40 +4,99 @@ import (
 	"context"
 	"github.com/RVodassa/FileTransfer/internal/client/config"
 	"github.com/RVodassa/FileTransfer/internal/client/service"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
 	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/ratelimit"
+	"github.com/RVodassa/FileTransfer/pkg/tlsconfig"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
 	"github.com/spf13/cobra"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"log"
+	"os"
+	"os/signal"
 )
 
 type App struct {
 	cfg           *config.Config
 	clientService *service.ClientService
 	conn          *grpc.ClientConn
+	stopReload    context.CancelFunc // останавливает перечитывание сертификатов
 }
 
 func New(cfg *config.Config) *App {
 	return &App{cfg: cfg}
 }
 
-// Initialize установка значений для полей conn и clientService в App
-func (a *App) Initialize() error {
+// Initialize установка значений для полей conn и clientService в App.
+// Фоновое перечитывание сертификатов работает до отмены ctx или Close
+func (a *App) Initialize(ctx context.Context) error {
 	const op = "app.Initialize"
 	var err error
-	a.conn, err = grpc.NewClient(a.cfg.Server.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	creds, err := a.transportCredentials(ctx)
+	if err != nil {
+		log.Printf("%s: failed to load TLS certificates. Error: %v", op, err)
+		return err
+	}
+	opts := []grpc.DialOption{
+		grpc.WithTransportCredentials(creds),
+		// Часть файла максимального размера не помещается в лимит сообщения gRPC по умолчанию
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(transfer.MaxMessageSize)),
+	}
+	if a.cfg.Token != "" {
+		if !a.cfg.Server.TLS.Enabled {
+			log.Printf("%s: warning: sending token over a connection without TLS", op)
+		}
+		opts = append(opts, grpc.WithPerRPCCredentials(tokenCredentials{token: a.cfg.Token, requireTLS: a.cfg.Server.TLS.Enabled}))
+	}
+	if a.cfg.ClientID != "" {
+		opts = append(opts,
+			grpc.WithUnaryInterceptor(clientIDUnaryInterceptor(a.cfg.ClientID)),
+			grpc.WithStreamInterceptor(clientIDStreamInterceptor(a.cfg.ClientID)),
+		)
+	}
+	a.conn, err = grpc.NewClient(a.cfg.Server.Address, opts...)
 	if err != nil {
 		log.Printf("%s: error creating grpc client. Error: %v", op, err)
 		return err
 	}
+	levels := compression.Levels{Gzip: a.cfg.Compression.GzipLevel, Zstd: a.cfg.Compression.ZstdLevel}
+	codec, err := compression.New(levels)
+	if err != nil {
+		log.Printf("%s: failed to create compression codec. Error: %v", op, err)
+		return err
+	}
 	client := pb.NewFileTransferClient(a.conn)
-	a.clientService = service.New(client, a.cfg.ClientDataDir)
+	t := a.cfg.Transfer
+	chunks := transfer.Settings{Size: t.ChunkSize, Adaptive: t.Adaptive, Min: t.MinChunkSize, Max: t.MaxChunkSize}
+	a.clientService = service.New(client, a.cfg.ClientDataDir, codec, chunks)
 	return nil
 }
 
+// transportCredentials возвращает TLS с перечитыванием сертификатов, если он включен, иначе - без шифрования
+func (a *App) transportCredentials(ctx context.Context) (credentials.TransportCredentials, error) {
+	tlsCfg := a.cfg.Server.TLS
+	if !tlsCfg.Enabled {
+		return insecure.NewCredentials(), nil
+	}
+
+	reloader, err := tlsconfig.NewReloader(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.CAFile)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	a.stopReload = cancel
+	go reloader.Watch(ctx, tlsCfg.ReloadInterval)
+	return credentials.NewTLS(reloader.ClientConfig(tlsCfg.ServerName)), nil
+}
+
 // Close закрывает conn в App
 func (a *App) Close() {
 	const op = "app.Close"
+	if a.stopReload != nil {
+		a.stopReload()
+	}
 	if a.conn != nil {
 		err := a.conn.Close()
 		if err != nil {
@@ -49,34 +108,204 @@ func (a *App) Close() {
 
 // AddCommands настройка команд cobra CLI
 func (a *App) AddCommands(rootCmd *cobra.Command) {
+	rootCmd.PersistentFlags().StringVar(&a.cfg.Token, "token", a.cfg.Token, "bearer token for the server (default: token from the config)")
 
+	var uploadDest, uploadOnConflict string
+	var uploadParallel int
+	var uploadCompress, uploadLimitRate string
 	var uploadCmd = &cobra.Command{
 		Use:   "upload [filename]",
 		Short: "Upload a file to the server",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			filename := args[0]
-			_ = a.clientService.UploadFile(context.Background(), filename)
+			policy, err := service.ParseConflictPolicy(uploadOnConflict)
+			if err != nil {
+				log.Printf("upload: %v", err)
+				return
+			}
+			alg, err := compression.Parse(uploadCompress)
+			if err != nil {
+				log.Printf("upload: %v", err)
+				return
+			}
+			limitRate, err := ratelimit.ParseRate(uploadLimitRate)
+			if err != nil {
+				log.Printf("upload: %v", err)
+				return
+			}
+			opts := service.UploadOptions{Dest: uploadDest, OnConflict: policy, Parallel: uploadParallel, Compress: alg, LimitRate: limitRate}
+			_ = a.clientService.UploadFile(context.Background(), filename, opts)
 		},
 	}
+	uploadCmd.Flags().StringVar(&uploadDest, "to", "", "destination path on the server, e.g. reports/2026/q3.csv")
+	uploadCmd.Flags().StringVar(&uploadOnConflict, "on-conflict", "", "what to do if the file exists: overwrite, fail or rename (default: server policy)")
+	uploadCmd.Flags().IntVar(&uploadParallel, "parallel", 1, "upload a large file in N concurrent streams")
+	uploadCmd.Flags().StringVar(&uploadCompress, "compress", a.cfg.Compression.Algorithm, "compress file chunks: gzip, zstd or none (default: algorithm from the config)")
+	uploadCmd.Flags().StringVar(&uploadLimitRate, "limit-rate", "0", "maximum upload speed in bytes per second, e.g. 512K or 10M (0 - unlimited)")
 
+	var listOpts service.ListOptions
+	var listSort, listAfter, listBefore string
+	var listMinSize, listMaxSize int64
 	var listCmd = &cobra.Command{
-		Use:   "list",
+		Use:   "list [directory]",
 		Short: "List files on the server",
+		Args:  cobra.MaximumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			_ = a.clientService.ListFiles(context.Background())
+			var dir string
+			if len(args) > 0 {
+				dir = args[0]
+			}
+			opts, err := listOptions(listOpts, listSort, listAfter, listBefore)
+			if err != nil {
+				log.Printf("list: %v", err)
+				return
+			}
+			if cmd.Flags().Changed("min-size") {
+				opts.MinSize = &listMinSize
+			}
+			if cmd.Flags().Changed("max-size") {
+				opts.MaxSize = &listMaxSize
+			}
+			// Ctrl+C прерывает получение списка, в том числе посреди потока
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer stop()
+			_ = a.clientService.ListFiles(ctx, dir, opts)
 		},
 	}
+	listCmd.Flags().BoolVarP(&listOpts.Recursive, "recursive", "r", false, "list subdirectories recursively")
+	listCmd.Flags().Int32Var(&listOpts.PageSize, "page-size", 0, "entries per request, 0 - server default")
+	listCmd.Flags().StringVar(&listOpts.Pattern, "pattern", "", "glob pattern for the file name, e.g. '*.csv'")
+	listCmd.Flags().StringVar(&listOpts.Prefix, "prefix", "", "path prefix relative to the storage root")
+	listCmd.Flags().StringVar(&listOpts.Regex, "regex", "", "regular expression for the path relative to the storage root")
+	listCmd.Flags().Int64Var(&listMinSize, "min-size", 0, "minimum file size in bytes")
+	listCmd.Flags().Int64Var(&listMaxSize, "max-size", 0, "maximum file size in bytes")
+	listCmd.Flags().StringVar(&listAfter, "modified-after", "", "only files modified at or after this time (RFC 3339 or YYYY-MM-DD)")
+	listCmd.Flags().StringVar(&listBefore, "modified-before", "", "only files modified before this time (RFC 3339 or YYYY-MM-DD)")
+	listCmd.Flags().StringVar(&listSort, "sort", "name", "sort by name, size or mtime")
+	listCmd.Flags().BoolVar(&listOpts.Descending, "desc", false, "sort in descending order")
+	listCmd.Flags().BoolVar(&listOpts.Stream, "stream", false, "print entries as the server walks the directory (unsorted, filters only)")
 
+	var getVersion string
+	var getParallel int
+	var getCompress, getLimitRate string
 	var getCmd = &cobra.Command{
 		Use:   "get [filename]",
 		Short: "Download a file from the server",
 		Args:  cobra.ExactArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
 			filename := args[0]
-			_ = a.clientService.GetFile(context.Background(), filename)
+			alg, err := compression.Parse(getCompress)
+			if err != nil {
+				log.Printf("get: %v", err)
+				return
+			}
+			limitRate, err := ratelimit.ParseRate(getLimitRate)
+			if err != nil {
+				log.Printf("get: %v", err)
+				return
+			}
+			opts := service.DownloadOptions{Version: getVersion, Parallel: getParallel, Compress: alg, LimitRate: limitRate}
+			_ = a.clientService.GetFile(context.Background(), filename, opts)
+		},
+	}
+	getCmd.Flags().StringVar(&getVersion, "version", "", "download a previous version from the versions command")
+	getCmd.Flags().IntVar(&getParallel, "parallel", 1, "download a large file in N concurrent streams")
+	getCmd.Flags().StringVar(&getCompress, "compress", a.cfg.Compression.Algorithm, "ask the server to compress file chunks: gzip, zstd or none (default: algorithm from the config)")
+	getCmd.Flags().StringVar(&getLimitRate, "limit-rate", "0", "maximum download speed in bytes per second, e.g. 512K or 10M (0 - unlimited)")
+
+	var deleteCmd = &cobra.Command{
+		Use:   "delete [filename]",
+		Short: "Delete a file on the server",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			filename := args[0]
+			_ = a.clientService.DeleteFile(context.Background(), filename)
+		},
+	}
+
+	var mvCmd = &cobra.Command{
+		Use:   "mv [old_filename] [new_filename]",
+		Short: "Rename a file on the server",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = a.clientService.RenameFile(context.Background(), args[0], args[1])
+		},
+	}
+
+	var statCmd = &cobra.Command{
+		Use:   "stat [filename]",
+		Short: "Show information about a file on the server",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			filename := args[0]
+			_ = a.clientService.StatFile(context.Background(), filename)
+		},
+	}
+
+	var mkdirParents bool
+	var mkdirCmd = &cobra.Command{
+		Use:   "mkdir [path]",
+		Short: "Create a directory on the server",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = a.clientService.MakeDir(context.Background(), args[0], mkdirParents)
+		},
+	}
+	mkdirCmd.Flags().BoolVarP(&mkdirParents, "parents", "p", false, "create parent directories as needed")
+
+	var rmdirRecursive bool
+	var rmdirCmd = &cobra.Command{
+		Use:   "rmdir [path]",
+		Short: "Remove a directory on the server",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = a.clientService.RemoveDir(context.Background(), args[0], rmdirRecursive)
 		},
 	}
+	rmdirCmd.Flags().BoolVarP(&rmdirRecursive, "recursive", "r", false, "remove the directory with its contents")
 
-	rootCmd.AddCommand(uploadCmd, listCmd, getCmd)
+	var versionsCmd = &cobra.Command{
+		Use:   "versions [filename]",
+		Short: "List previous versions of a file on the server",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = a.clientService.ListVersions(context.Background(), args[0])
+		},
+	}
+
+	var restoreCmd = &cobra.Command{
+		Use:   "restore [filename] [version]",
+		Short: "Restore a previous version of a file on the server",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = a.clientService.RestoreVersion(context.Background(), args[0], args[1])
+		},
+	}
+
+	var usageCmd = &cobra.Command{
+		Use:   "usage",
+		Short: "Show storage usage and quotas",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			_ = a.clientService.GetUsage(context.Background())
+		},
+	}
+
+	rootCmd.AddCommand(uploadCmd, listCmd, getCmd, deleteCmd, mvCmd, statCmd, mkdirCmd, rmdirCmd, versionsCmd, restoreCmd, usageCmd)
+}
+
+// listOptions дополняет параметры list разобранными значениями флагов сортировки и времени
+func listOptions(opts service.ListOptions, sortBy, after, before string) (service.ListOptions, error) {
+	var err error
+	if opts.SortBy, err = service.ParseSortField(sortBy); err != nil {
+		return opts, err
+	}
+	if opts.ModifiedAfter, err = service.ParseTime(after); err != nil {
+		return opts, err
+	}
+	if opts.ModifiedBefore, err = service.ParseTime(before); err != nil {
+		return opts, err
+	}
+	return opts, nil
 }
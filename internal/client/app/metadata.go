@@ -0,0 +1,43 @@
+package app
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// clientIDHeader заголовок метаданных запроса с идентификатором клиента
+const clientIDHeader = "x-client-id"
+
+// clientIDUnaryInterceptor добавляет идентификатор клиента в метаданные запросов
+func clientIDUnaryInterceptor(clientID string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx = metadata.AppendToOutgoingContext(ctx, clientIDHeader, clientID)
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// clientIDStreamInterceptor добавляет идентификатор клиента в метаданные потоков
+func clientIDStreamInterceptor(clientID string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx = metadata.AppendToOutgoingContext(ctx, clientIDHeader, clientID)
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// tokenCredentials передает bearer-токен в метаданных каждого запроса
+type tokenCredentials struct {
+	token      string
+	requireTLS bool
+}
+
+// GetRequestMetadata возвращает заголовок authorization
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{"authorization": "Bearer " + t.token}, nil
+}
+
+// RequireTransportSecurity запрещает отправку токена без TLS, если TLS включен в конфиге
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return t.requireTLS
+}
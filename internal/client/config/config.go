@@ -1,15 +1,51 @@
 package config
 
 import (
+	"fmt"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
 	"gopkg.in/yaml.v3"
 	"os"
+	"time"
 )
 
 type Config struct {
 	Server struct {
 		Address string `yaml:"address"`
+		// TLS шифрование соединения, cert_file и key_file - сертификат клиента для mTLS
+		TLS struct {
+			Enabled bool `yaml:"enabled"`
+			// CAFile CA для проверки сертификата сервера, пусто - системные корневые сертификаты
+			CAFile   string `yaml:"ca_file"`
+			CertFile string `yaml:"cert_file"`
+			KeyFile  string `yaml:"key_file"`
+			// ServerName имя в сертификате сервера, по умолчанию - хост из address
+			ServerName string `yaml:"server_name"`
+			// ReloadInterval как часто проверять файлы сертификатов на изменение
+			ReloadInterval time.Duration `yaml:"reload_interval"`
+		} `yaml:"tls"`
 	} `yaml:"server"`
 	ClientDataDir string `yaml:"client_data_dir"`
+	// ClientID идентификатор клиента, который сервер сохраняет как автора загрузки
+	ClientID string `yaml:"client_id"`
+	// Token bearer-токен для сервера с включенной проверкой токенов
+	Token string `yaml:"token"`
+	// Compression сжатие частей файла при передаче, если его поддерживает сервер
+	Compression struct {
+		// Algorithm gzip, zstd или none, можно заменить флагом --compress
+		Algorithm string `yaml:"algorithm"`
+		// GzipLevel от 1 до 9, ZstdLevel от 1 до 22, 0 - уровень по умолчанию
+		GzipLevel int `yaml:"gzip_level"`
+		ZstdLevel int `yaml:"zstd_level"`
+	} `yaml:"compression"`
+	// Transfer размер частей, на которые делится файл при загрузке, 0 - значение по умолчанию
+	Transfer struct {
+		ChunkSize int `yaml:"chunk_size"`
+		// Adaptive подбирать размер части по скорости отправки и RTT, от min_chunk_size до max_chunk_size
+		Adaptive     bool `yaml:"adaptive"`
+		MinChunkSize int  `yaml:"min_chunk_size"`
+		MaxChunkSize int  `yaml:"max_chunk_size"`
+	} `yaml:"transfer"`
 }
 
 func LoadConfig(filePath string) (*Config, error) {
@@ -23,5 +59,26 @@ func LoadConfig(filePath string) (*Config, error) {
 		return nil, err
 	}
 
+	if config.Server.TLS.ReloadInterval <= 0 {
+		config.Server.TLS.ReloadInterval = 30 * time.Second
+	}
+
+	c := &config.Compression
+	if _, err = compression.Parse(c.Algorithm); err != nil {
+		return nil, fmt.Errorf("compression: %w", err)
+	}
+	levels := compression.Levels{Gzip: c.GzipLevel, Zstd: c.ZstdLevel}
+	if err = levels.Validate(); err != nil {
+		return nil, fmt.Errorf("compression: %w", err)
+	}
+	c.GzipLevel, c.ZstdLevel = levels.Gzip, levels.Zstd
+
+	t := &config.Transfer
+	chunks := transfer.Settings{Size: t.ChunkSize, Adaptive: t.Adaptive, Min: t.MinChunkSize, Max: t.MaxChunkSize}
+	if err = chunks.Validate(); err != nil {
+		return nil, fmt.Errorf("transfer: %w", err)
+	}
+	t.ChunkSize, t.MinChunkSize, t.MaxChunkSize = chunks.Size, chunks.Min, chunks.Max
+
 	return &config, nil
 }
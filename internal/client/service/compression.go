@@ -0,0 +1,99 @@
+package service
+
+import (
+	"io"
+	"log"
+	"os"
+
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
+	"google.golang.org/grpc"
+)
+
+// transferCompression сжатие одной передачи файла и сколько удалось сэкономить
+type transferCompression struct {
+	alg   pb.Compression // алгоритм, который предлагает клиент
+	stats compression.Stats
+}
+
+// uploadCompression выбирает алгоритм сжатия для загрузки файла. Уже сжатые файлы передаются как есть
+func uploadCompression(alg pb.Compression, file *os.File, filename string) *transferCompression {
+	const op = "client.service.uploadCompression"
+
+	if alg != pb.Compression_COMPRESSION_NONE {
+		head := make([]byte, 512)
+		n, err := file.ReadAt(head, 0)
+		if err != nil && err != io.EOF {
+			log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		}
+		if !compression.Compressible(filename, head[:n]) {
+			log.Printf("%s: filename:%s. content is already compressed, sending as is", op, filename)
+			alg = pb.Compression_COMPRESSION_NONE
+		}
+	}
+	return &transferCompression{alg: alg}
+}
+
+// accept вернет алгоритмы, которые клиент предлагает серверу
+func (tc *transferCompression) accept() []pb.Compression {
+	if tc.alg == pb.Compression_COMPRESSION_NONE {
+		return nil
+	}
+	return []pb.Compression{tc.alg}
+}
+
+// negotiate вернет алгоритм, который сервер выбрал для потока загрузки
+func (tc *transferCompression) negotiate(stream grpc.ClientStream) (pb.Compression, error) {
+	if tc.alg == pb.Compression_COMPRESSION_NONE {
+		return tc.alg, nil
+	}
+	md, err := stream.Header()
+	if err != nil {
+		return 0, err
+	}
+	return compression.FromHeader(md), nil
+}
+
+// report выводит степень сжатия в конце передачи
+func (tc *transferCompression) report(op, filename string) {
+	if tc.alg == pb.Compression_COMPRESSION_NONE {
+		return
+	}
+	log.Printf("%s: filename:%s. compression %s: %s", op, filename, compression.Name(tc.alg), &tc.stats)
+}
+
+// chunkRequest сжимает часть файла алгоритмом alg в out для отправки на сервер.
+// Запрос действителен до следующего вызова с тем же out
+func (c *ClientService) chunkRequest(tc *transferCompression, alg pb.Compression, chunk []byte, out *transfer.Buffer) (*pb.UploadFileRequest, error) {
+	var dst []byte
+	if alg != pb.Compression_COMPRESSION_NONE {
+		dst = out.Bytes()
+	}
+	content, used, err := c.codec.Encode(alg, chunk, dst)
+	if err != nil {
+		return nil, err
+	}
+	tc.stats.Add(len(chunk), len(content))
+	crc := checksum.Chunk(content)
+	return &pb.UploadFileRequest{Content: content, Crc32C: &crc, Compression: used}, nil
+}
+
+// chunkContent проверяет CRC32C полученной части файла и распаковывает ее в buf.
+// Распакованная часть действительна до следующего вызова с тем же buf
+func (c *ClientService) chunkContent(tc *transferCompression, resp *pb.GetFileResponse, buf *transfer.Buffer) ([]byte, error) {
+	if err := checksum.VerifyChunk(resp.Content, resp.Crc32C); err != nil {
+		return nil, err
+	}
+	var dst []byte
+	if resp.Compression != pb.Compression_COMPRESSION_NONE {
+		dst = buf.Bytes()
+	}
+	content, err := c.codec.Decode(resp.Compression, resp.Content, dst)
+	if err != nil {
+		return nil, err
+	}
+	tc.stats.Add(len(content), len(resp.Content))
+	return content, nil
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"time"
+
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+)
+
+// downloadState части параллельного скачивания и сколько байт каждой уже записано
+// во временный файл. Хранится рядом с временным файлом, чтобы продолжить скачивание после обрыва
+type downloadState struct {
+	Size    int64       `json:"size"`
+	Sha256  []byte      `json:"sha256,omitempty"`
+	ModTime time.Time   `json:"mod_time"`
+	Parts   []partState `json:"parts"`
+}
+
+// partState часть файла и скачанные байты от ее начала
+type partState struct {
+	Offset  int64 `json:"offset"`
+	Length  int64 `json:"length"`
+	Written int64 `json:"written"`
+}
+
+// newDownloadState делит файл info на n частей, ничего еще не скачано
+func newDownloadState(info *pb.FileInfo, n int) *downloadState {
+	st := &downloadState{Size: info.Size, Sha256: info.Sha256, ModTime: info.ModificationTime.AsTime()}
+	for _, part := range splitRanges([]byteRange{{offset: 0, length: info.Size}}, n) {
+		st.Parts = append(st.Parts, partState{Offset: part.offset, Length: part.length})
+	}
+	return st
+}
+
+// loadDownloadState вернет сохраненное состояние, если файл на сервере с тех пор не менялся
+// и части покрывают его целиком
+func loadDownloadState(path string, info *pb.FileInfo) *downloadState {
+	const op = "client.service.loadDownloadState"
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("%s: path:%s. Err: %v", op, path, err)
+		}
+		return nil
+	}
+	var st downloadState
+	if err = json.Unmarshal(data, &st); err != nil {
+		log.Printf("%s: path:%s. Err: %v", op, path, err)
+		return nil
+	}
+	if st.Size != info.Size || !bytes.Equal(st.Sha256, info.Sha256) || !st.ModTime.Equal(info.ModificationTime.AsTime()) {
+		log.Printf("%s: path:%s. file changed on the server since last download, starting over", op, path)
+		return nil
+	}
+	var pos int64
+	for _, p := range st.Parts {
+		if p.Offset != pos || p.Length <= 0 || p.Written < 0 || p.Written > p.Length {
+			log.Printf("%s: path:%s. invalid parts, starting over", op, path)
+			return nil
+		}
+		pos += p.Length
+	}
+	if pos != st.Size {
+		log.Printf("%s: path:%s. invalid parts, starting over", op, path)
+		return nil
+	}
+	return &st
+}
+
+// save сохраняет состояние на диск. Записанное меньше скачанного безопасно: лишнее скачается заново
+func (st *downloadState) save(path string) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".tmp"
+	if err = os.WriteFile(tmpPath, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// remaining вернет кол-во еще не скачанных байт
+func (st *downloadState) remaining() int64 {
+	var n int64
+	for _, p := range st.Parts {
+		n += p.Length - p.Written
+	}
+	return n
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"fmt"
+	"time"
+
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+)
+
+// UploadOptions параметры загрузки файла на сервер
+type UploadOptions struct {
+	// Dest путь файла на сервере, по умолчанию - имя локального файла
+	Dest string
+	// OnConflict политика при совпадении имен, по умолчанию - политика сервера
+	OnConflict pb.ConflictPolicy
+	// Parallel кол-во потоков для загрузки большого файла частями, 0 или 1 - один поток
+	Parallel int
+	// Compress алгоритм сжатия частей файла, если его поддерживает сервер
+	Compress pb.Compression
+	// LimitRate скорость загрузки в байтах в секунду на все потоки, 0 - без ограничения
+	LimitRate int64
+}
+
+// DownloadOptions параметры скачивания файла с сервера
+type DownloadOptions struct {
+	// Version версия файла из ListVersions, по умолчанию - текущая
+	Version string
+	// Parallel кол-во потоков для скачивания большого файла частями, 0 или 1 - один поток
+	Parallel int
+	// Compress алгоритм сжатия частей файла, если его поддерживает сервер
+	Compress pb.Compression
+	// LimitRate скорость скачивания в байтах в секунду на все потоки, 0 - без ограничения
+	LimitRate int64
+}
+
+// ListOptions параметры получения списка файлов
+type ListOptions struct {
+	// Recursive включить содержимое вложенных директорий
+	Recursive bool
+	// PageSize размер страницы, по умолчанию - размер сервера
+	PageSize int32
+	// Pattern glob-шаблон для имени файла, Prefix и Regex - для пути от корня хранилища
+	Pattern string
+	Prefix  string
+	Regex   string
+	// MinSize, MaxSize диапазон размеров в байтах, nil - без ограничения
+	MinSize *int64
+	MaxSize *int64
+	// ModifiedAfter, ModifiedBefore диапазон времени изменения, нулевое время - без ограничения
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	SortBy         pb.SortField
+	Descending     bool
+	// Stream получать список потоком StreamListFiles без сортировки и страниц
+	Stream bool
+}
+
+// ParseSortField разбирает значение флага --sort
+func ParseSortField(value string) (pb.SortField, error) {
+	switch value {
+	case "", "name":
+		return pb.SortField_SORT_FIELD_NAME, nil
+	case "size":
+		return pb.SortField_SORT_FIELD_SIZE, nil
+	case "mtime":
+		return pb.SortField_SORT_FIELD_MODIFICATION_TIME, nil
+	default:
+		return 0, fmt.Errorf("invalid sort field %q: want name, size or mtime", value)
+	}
+}
+
+// ParseTime разбирает время в формате RFC 3339 или дату вида 2006-01-02 (в локальной зоне)
+func ParseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q: want RFC 3339 or YYYY-MM-DD", value)
+	}
+	return t, nil
+}
+
+// ParseConflictPolicy разбирает значение флага --on-conflict
+func ParseConflictPolicy(value string) (pb.ConflictPolicy, error) {
+	switch value {
+	case "":
+		return pb.ConflictPolicy_CONFLICT_POLICY_UNSPECIFIED, nil
+	case "overwrite":
+		return pb.ConflictPolicy_CONFLICT_POLICY_OVERWRITE, nil
+	case "fail":
+		return pb.ConflictPolicy_CONFLICT_POLICY_FAIL, nil
+	case "rename":
+		return pb.ConflictPolicy_CONFLICT_POLICY_RENAME, nil
+	default:
+		return 0, fmt.Errorf("invalid conflict policy %q: want overwrite, fail or rename", value)
+	}
+}
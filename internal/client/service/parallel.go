@@ -0,0 +1,338 @@
+package service
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/ratelimit"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
+	"golang.org/x/sync/errgroup"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	minPartSize     = 4 << 20         // меньшие части не окупают отдельный поток
+	minParallelSize = 2 * minPartSize // файлы меньше передаются одним потоком
+)
+
+// byteRange диапазон байт файла
+type byteRange struct {
+	offset int64
+	length int64
+}
+
+// missingRanges вернет диапазоны файла размером size, которых нет среди принятых сервером.
+// Принятые диапазоны могут идти в любом порядке и пересекаться
+func missingRanges(size int64, received []*pb.ByteRange) []byteRange {
+	sorted := slices.Clone(received)
+	slices.SortFunc(sorted, func(a, b *pb.ByteRange) int { return cmp.Compare(a.Offset, b.Offset) })
+
+	var missing []byteRange
+	var pos int64
+	for _, r := range sorted {
+		if pos >= size {
+			break
+		}
+		if r.Offset > pos {
+			missing = append(missing, byteRange{offset: pos, length: min(r.Offset, size) - pos})
+		}
+		pos = max(pos, r.Offset+r.Length)
+	}
+	if pos < size {
+		missing = append(missing, byteRange{offset: pos, length: size - pos})
+	}
+	return missing
+}
+
+// splitRanges делит диапазоны на части примерно по 1/n от их общего размера, но не меньше minPartSize
+func splitRanges(ranges []byteRange, n int) []byteRange {
+	var total int64
+	for _, r := range ranges {
+		total += r.length
+	}
+	n = max(n, 1)
+	partSize := max((total+int64(n)-1)/int64(n), minPartSize)
+
+	var parts []byteRange
+	for _, r := range ranges {
+		for off := r.offset; off < r.offset+r.length; off += partSize {
+			parts = append(parts, byteRange{offset: off, length: min(partSize, r.offset+r.length-off)})
+		}
+	}
+	return parts
+}
+
+// parallelUploadAttempt передает недостающие части файла в n потоков и собирает файл на сервере
+func (c *ClientService) parallelUploadAttempt(ctx context.Context, file *os.File, absPath string, info os.FileInfo, filename string, policy pb.ConflictPolicy, n int, tc *transferCompression, limit *ratelimit.Limiter) (*pb.UploadFileResponse, error) {
+	const op = "client.service.parallelUploadAttempt"
+
+	started := time.Now()
+	sess, err := c.resumeSession(ctx, absPath, info, filename, policy, true)
+	rtt := time.Since(started)
+	if err != nil {
+		return nil, err
+	}
+	if sess.Offset > 0 {
+		log.Printf("%s: filename:%s. resuming, %d of %d bytes already uploaded", op, filename, sess.Offset, info.Size())
+	}
+
+	g, gctx := errgroup.WithContext(ctx)
+	g.SetLimit(n)
+	for _, part := range splitRanges(missingRanges(info.Size(), sess.Received), n) {
+		g.Go(func() error {
+			return c.uploadPart(gctx, file, sess.SessionId, filename, part, rtt, tc, limit)
+		})
+	}
+	if err = g.Wait(); err != nil {
+		return nil, err
+	}
+
+	// SHA-256 считается по всему файлу, сервер сверяет его с собранным из частей
+	h := checksum.New()
+	if _, err = io.Copy(h, io.NewSectionReader(file, 0, info.Size())); err != nil {
+		return nil, err
+	}
+	sum := h.Sum(nil)
+
+	resp, err := c.client.CompleteUploadSession(ctx, &pb.CompleteUploadSessionRequest{SessionId: sess.SessionId, Sha256: sum})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.Sha256) > 0 && !bytes.Equal(resp.Sha256, sum) {
+		return nil, checksum.ErrMismatch
+	}
+	log.Printf("%s: filename:%s. sha256 %s", op, filename, checksum.Hex(sum))
+	return resp, nil
+}
+
+// uploadPart передает часть файла отдельным потоком, rtt - время ответа сервера для подбора размера частей
+func (c *ClientService) uploadPart(ctx context.Context, file *os.File, sessionID, filename string, part byteRange, rtt time.Duration, tc *transferCompression, limit *ratelimit.Limiter) error {
+	const op = "client.service.uploadPart"
+
+	stream, err := c.client.UploadFile(ctx)
+	if err != nil {
+		return err
+	}
+	first := &pb.UploadFileRequest{
+		SessionId:         sessionID,
+		Offset:            part.offset,
+		PartLength:        part.length,
+		AcceptCompression: tc.accept(),
+	}
+	if err = stream.Send(first); err != nil {
+		return closeStreamError(stream, err)
+	}
+	alg, err := tc.negotiate(stream)
+	if err != nil {
+		return err
+	}
+
+	sizer := transfer.NewSizer(c.chunks)
+	sizer.SetRTT(rtt)
+	chunks := transfer.NewReader(io.NewSectionReader(file, part.offset, part.length), sizer)
+	defer chunks.Release()
+	var out transfer.Buffer
+	defer out.Release()
+	for {
+		chunk, err := chunks.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		req, err := c.chunkRequest(tc, alg, chunk, &out)
+		if err != nil {
+			return err
+		}
+		if err = limit.Wait(ctx, len(req.Content)); err != nil {
+			return err
+		}
+		if err = stream.Send(req); err != nil {
+			return closeStreamError(stream, err)
+		}
+	}
+
+	if _, err = stream.CloseAndRecv(); err != nil {
+		return err
+	}
+	log.Printf("%s: filename:%s. Sent part %d+%d", op, filename, part.offset, part.length)
+	return nil
+}
+
+// parallelDownload скачивает файл частями в n потоков во временный файл заранее известного размера.
+// Скачанные байты каждой части сохраняются рядом с временным файлом: после обрыва,
+// в том числе после перезапуска клиента, скачиваются только недостающие данные частей
+func (c *ClientService) parallelDownload(ctx context.Context, filename, localDir, baseName string, info *pb.FileInfo, n int, tc *transferCompression, limit *ratelimit.Limiter) error {
+	const op = "client.service.parallelDownload"
+
+	tmpFilePath := filepath.Join(localDir, "downloaded_"+baseName+".parallel.tmp")
+	statePath := tmpFilePath + ".json"
+	st := loadDownloadState(statePath, info)
+	flags := os.O_CREATE | os.O_RDWR
+	if st == nil {
+		st = newDownloadState(info, n)
+		flags |= os.O_TRUNC
+	} else {
+		log.Printf("%s: filename:%s. resuming, %d of %d bytes left", op, filename, st.remaining(), st.Size)
+	}
+	f, err := os.OpenFile(tmpFilePath, flags, 0o644)
+	if err != nil {
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+	}
+
+	// Временный файл удаляется, только если продолжить скачивание нельзя
+	var discard bool
+	defer func() {
+		if err = f.Close(); err != nil {
+			log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		}
+		if !discard {
+			return
+		}
+		for _, path := range []string{tmpFilePath, statePath} {
+			if err = os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+			}
+		}
+	}()
+
+	if err = f.Truncate(info.Size); err == nil {
+		err = st.save(statePath)
+	}
+	if err != nil {
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+	}
+
+	for attempt := 1; ; attempt++ {
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(n)
+		for i := range st.Parts {
+			part := &st.Parts[i]
+			if part.Written == part.Length {
+				continue
+			}
+			g.Go(func() error {
+				return c.downloadPart(gctx, f, filename, byteRange{offset: part.Offset, length: part.Length}, &part.Written, tc, limit)
+			})
+		}
+		err = g.Wait()
+		if saveErr := st.save(statePath); saveErr != nil {
+			log.Printf("%s: filename:%s. failed to save download state: %v", op, filename, saveErr)
+		}
+		if err == nil {
+			break
+		}
+
+		if _, ok := status.FromError(err); !ok {
+			log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+			return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+		}
+		switch status.Code(err) {
+		case codes.NotFound, codes.OutOfRange:
+			// файла нет или он стал меньше, чем при начале скачивания
+			discard = true
+			return c.handleGRPCError(op, err)
+		}
+		if !isRetryable(err) || attempt >= maxRetryAttempts {
+			return c.handleGRPCError(op, err)
+		}
+
+		log.Printf("%s: filename:%s. attempt %d failed, resuming: %v", op, filename, attempt, err)
+		select {
+		case <-ctx.Done():
+			return c.handleGRPCError(op, status.FromContextError(ctx.Err()).Err())
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		}
+	}
+	log.Printf("%s: filename:%s. Download completed", op, filename)
+	tc.report(op, filename)
+
+	// Проверяем целостность до переименования
+	h := checksum.New()
+	if _, err = io.Copy(h, io.NewSectionReader(f, 0, info.Size)); err != nil {
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+	}
+	if len(info.Sha256) == 0 {
+		log.Printf("%s: filename:%s. server did not send checksum, skipping verification", op, filename)
+	} else if err = checksum.Verify(h, info.Sha256); err != nil {
+		discard = true
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+	}
+
+	// Переименовываем временный файл в целевой
+	targetFilename := filepath.Join(localDir, "downloaded_"+baseName)
+	if err = os.Rename(tmpFilePath, targetFilename); err != nil {
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+	}
+	if err = os.Remove(statePath); err != nil {
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+	}
+
+	log.Printf("%s: file %s downloaded successfully", op, filename)
+	return nil
+}
+
+// downloadPart скачивает недостающие данные части и пишет их в f по смещению.
+// written - сколько байт части уже скачано, обновляется по мере записи
+func (c *ClientService) downloadPart(ctx context.Context, f *os.File, filename string, part byteRange, written *int64, tc *transferCompression, limit *ratelimit.Limiter) error {
+	req := &pb.GetFileRequest{
+		Filename:          filename,
+		Offset:            part.offset + *written,
+		Length:            part.length - *written,
+		AcceptCompression: tc.accept(),
+	}
+	stream, err := c.client.GetFile(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	var buf transfer.Buffer // для распаковки частей
+	defer buf.Release()
+	for {
+		resp, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if err = limit.Wait(ctx, len(resp.Content)); err != nil {
+			return err
+		}
+		content, err := c.chunkContent(tc, resp, &buf)
+		if err != nil {
+			return err
+		}
+		if *written+int64(len(content)) > part.length {
+			return status.Error(codes.OutOfRange, "server sent more data than requested")
+		}
+		if _, err = f.WriteAt(content, part.offset+*written); err != nil {
+			return err
+		}
+		*written += int64(len(content))
+	}
+
+	// файл на сервере стал меньше, чем при начале скачивания
+	if *written != part.length {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
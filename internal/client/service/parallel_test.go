@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/pkg/compression"
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// discardLog отключает вывод журнала до конца теста
+func discardLog(t *testing.T) {
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+}
+
+func TestMissingRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int64
+		received []*pb.ByteRange
+		want     []byteRange
+	}{
+		{name: "empty file", size: 0, want: nil},
+		{name: "nothing received", size: 10, want: []byteRange{{0, 10}}},
+		{name: "all received", size: 10, received: []*pb.ByteRange{{Offset: 0, Length: 10}}, want: nil},
+		{
+			name:     "gaps",
+			size:     10,
+			received: []*pb.ByteRange{{Offset: 2, Length: 3}, {Offset: 7, Length: 1}},
+			want:     []byteRange{{0, 2}, {5, 2}, {8, 2}},
+		},
+		{
+			name:     "unsorted",
+			size:     10,
+			received: []*pb.ByteRange{{Offset: 7, Length: 1}, {Offset: 2, Length: 3}},
+			want:     []byteRange{{0, 2}, {5, 2}, {8, 2}},
+		},
+		{
+			name:     "overlapping",
+			size:     10,
+			received: []*pb.ByteRange{{Offset: 3, Length: 2}, {Offset: 0, Length: 4}, {Offset: 1, Length: 1}},
+			want:     []byteRange{{5, 5}},
+		},
+		{
+			name:     "past the end",
+			size:     10,
+			received: []*pb.ByteRange{{Offset: 12, Length: 4}, {Offset: 0, Length: 4}},
+			want:     []byteRange{{4, 6}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := missingRanges(tt.size, tt.received); !slices.Equal(got, tt.want) {
+				t.Errorf("missingRanges(%d) = %v, want %v", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRanges(t *testing.T) {
+	tests := []struct {
+		name   string
+		ranges []byteRange
+		n      int
+		want   []byteRange
+	}{
+		{name: "empty", ranges: nil, n: 4, want: nil},
+		{name: "smaller than min part", ranges: []byteRange{{0, 10}}, n: 4, want: []byteRange{{0, 10}}},
+		{name: "n greater than bytes", ranges: []byteRange{{0, 3}}, n: 100, want: []byteRange{{0, 3}}},
+		{name: "zero n", ranges: []byteRange{{0, 3 * minPartSize}}, n: 0, want: []byteRange{{0, 3 * minPartSize}}},
+		{
+			name:   "even",
+			ranges: []byteRange{{0, 4 * minPartSize}},
+			n:      2,
+			want:   []byteRange{{0, 2 * minPartSize}, {2 * minPartSize, 2 * minPartSize}},
+		},
+		{
+			name:   "not divisible",
+			ranges: []byteRange{{0, 2*minPartSize + 1}},
+			n:      2,
+			want:   []byteRange{{0, minPartSize + 1}, {minPartSize + 1, minPartSize}},
+		},
+		{
+			name:   "several ranges",
+			ranges: []byteRange{{0, minPartSize}, {2 * minPartSize, 3 * minPartSize}},
+			n:      4,
+			want:   []byteRange{{0, minPartSize}, {2 * minPartSize, minPartSize}, {3 * minPartSize, minPartSize}, {4 * minPartSize, minPartSize}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitRanges(tt.ranges, tt.n)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("splitRanges(%v, %d) = %v, want %v", tt.ranges, tt.n, got, tt.want)
+			}
+			var total, want int64
+			for _, r := range got {
+				total += r.length
+			}
+			for _, r := range tt.ranges {
+				want += r.length
+			}
+			if total != want {
+				t.Errorf("parts cover %d bytes, want %d", total, want)
+			}
+		})
+	}
+}
+
+// Состояние скачивания отбрасывается, если файл на сервере изменился или части повреждены
+func TestDownloadState(t *testing.T) {
+	discardLog(t)
+	path := filepath.Join(t.TempDir(), "state.json")
+	info := &pb.FileInfo{Size: 3 * minPartSize, Sha256: []byte{1, 2, 3}, ModificationTime: timestamppb.New(time.Unix(1700000000, 5))}
+
+	st := newDownloadState(info, 3)
+	st.Parts[1].Written = 100
+	if err := st.save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded := loadDownloadState(path, info)
+	if loaded == nil || !slices.Equal(loaded.Parts, st.Parts) {
+		t.Fatalf("loadDownloadState = %+v, want %+v", loaded, st)
+	}
+	if got := loaded.remaining(); got != info.Size-100 {
+		t.Errorf("remaining = %d, want %d", got, info.Size-100)
+	}
+
+	changed := []*pb.FileInfo{
+		{Size: info.Size + 1, Sha256: info.Sha256, ModificationTime: info.ModificationTime},
+		{Size: info.Size, Sha256: []byte{4}, ModificationTime: info.ModificationTime},
+		{Size: info.Size, Sha256: info.Sha256, ModificationTime: timestamppb.New(time.Unix(1700000001, 0))},
+	}
+	for _, other := range changed {
+		if got := loadDownloadState(path, other); got != nil {
+			t.Errorf("loadDownloadState for changed file %+v = %+v, want nil", other, got)
+		}
+	}
+
+	st.Parts[1].Written = st.Parts[1].Length + 1
+	if err := st.save(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := loadDownloadState(path, info); got != nil {
+		t.Errorf("loadDownloadState with invalid parts = %+v, want nil", got)
+	}
+	if got := loadDownloadState(filepath.Join(t.TempDir(), "missing.json"), info); got != nil {
+		t.Errorf("loadDownloadState without state = %+v, want nil", got)
+	}
+}
+
+// fakeDownloadClient отдает content по запросам GetFile и обрывает поток,
+// когда всего отдано больше failAfter байт
+type fakeDownloadClient struct {
+	pb.FileTransferClient
+	content   []byte
+	failAfter int64 // 0 - не обрывать
+
+	sent      atomic.Int64 // отдано байт
+	mu        sync.Mutex
+	requested int64 // запрошено байт
+}
+
+func (c *fakeDownloadClient) GetFile(ctx context.Context, req *pb.GetFileRequest, _ ...grpc.CallOption) (grpc.ServerStreamingClient[pb.GetFileResponse], error) {
+	c.mu.Lock()
+	c.requested += req.Length
+	c.mu.Unlock()
+	return &fakeDownloadStream{ctx: ctx, client: c, data: c.content[req.Offset : req.Offset+req.Length]}, nil
+}
+
+type fakeDownloadStream struct {
+	grpc.ClientStream
+	ctx    context.Context
+	client *fakeDownloadClient
+	data   []byte
+}
+
+func (s *fakeDownloadStream) Recv() (*pb.GetFileResponse, error) {
+	if err := s.ctx.Err(); err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	if len(s.data) == 0 {
+		return nil, io.EOF
+	}
+	chunk := s.data[:min(len(s.data), 64<<10)]
+	if c := s.client; c.failAfter > 0 && c.sent.Load() >= c.failAfter {
+		return nil, status.Error(codes.PermissionDenied, "connection lost")
+	}
+	s.data = s.data[len(chunk):]
+	s.client.sent.Add(int64(len(chunk)))
+	return &pb.GetFileResponse{Content: chunk}, nil
+}
+
+// Прерванное параллельное скачивание продолжается с недостающих байт
+func TestParallelDownloadResume(t *testing.T) {
+	discardLog(t)
+	codec, err := compression.New(compression.Levels{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := make([]byte, 3*minPartSize+12345)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	sum := sha256.Sum256(content)
+	info := &pb.FileInfo{Name: "big.bin", Size: int64(len(content)), Sha256: sum[:], ModificationTime: timestamppb.New(time.Unix(1700000000, 0))}
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	first := &fakeDownloadClient{content: content, failAfter: minPartSize}
+	err = New(first, dir, codec, transfer.Settings{}).parallelDownload(ctx, "big.bin", dir, "big.bin", info, 4, &transferCompression{}, nil)
+	if err == nil {
+		t.Fatal("interrupted download succeeded")
+	}
+	tmpPath := filepath.Join(dir, "downloaded_big.bin.parallel.tmp")
+	st := loadDownloadState(tmpPath+".json", info)
+	if st == nil {
+		t.Fatal("download state was not kept after interruption")
+	}
+	if got, want := st.remaining(), info.Size-first.sent.Load(); got != want {
+		t.Fatalf("remaining = %d, want %d", got, want)
+	}
+
+	second := &fakeDownloadClient{content: content}
+	err = New(second, dir, codec, transfer.Settings{}).parallelDownload(ctx, "big.bin", dir, "big.bin", info, 4, &transferCompression{}, nil)
+	if err != nil {
+		t.Fatalf("resumed download: %v", err)
+	}
+	if second.requested != st.remaining() {
+		t.Errorf("resumed download requested %d bytes, want %d", second.requested, st.remaining())
+	}
+	got, err := os.ReadFile(filepath.Join(dir, "downloaded_big.bin"))
+	if err != nil || !bytes.Equal(got, content) {
+		t.Fatalf("downloaded file differs: %v", err)
+	}
+	for _, path := range []string{tmpPath, tmpPath + ".json"} {
+		if _, err = os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s left after download: %v", path, err)
+		}
+	}
+}
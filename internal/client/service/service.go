@@ -1,37 +1,56 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
 	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/ratelimit"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"hash"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 type ClientService struct {
 	client  pb.FileTransferClient
 	dataDir string
+	codec   *compression.Codec
+	chunks  transfer.Settings // размер частей при загрузке
 }
 
-func New(client pb.FileTransferClient, dataDir string) *ClientService {
+func New(client pb.FileTransferClient, dataDir string, codec *compression.Codec, chunks transfer.Settings) *ClientService {
 	return &ClientService{
 		client:  client,
 		dataDir: dataDir,
+		codec:   codec,
+		chunks:  chunks,
 	}
 }
 
 var ErrNotFound = errors.New("file not found")
 var ErrInternalServer = errors.New("internal server error")
 
-const defaultBufSize = 1024 * 1024 // 1 MB буфер для чтения/записи файлов
+const (
+	maxRetryAttempts = 5               // кол-во попыток продолжить передачу
+	retryDelay       = 2 * time.Second // задержка перед повторной попыткой
+)
 
-// UploadFile загружает файл на сервер
-func (c *ClientService) UploadFile(ctx context.Context, filePath string) error {
+// UploadFile загружает файл на сервер.
+// При обрыве соединения загрузка продолжается с последнего сохраненного сервером байта.
+func (c *ClientService) UploadFile(ctx context.Context, filePath string, opts UploadOptions) error {
 	const op = "client.service.UploadFile"
 
 	if filePath == "" {
@@ -54,95 +73,504 @@ func (c *ClientService) UploadFile(ctx context.Context, filePath string) error {
 		}
 	}()
 
+	info, err := file.Stat()
+	if err != nil {
+		log.Printf("%s: filePath:%s. Err: %v", op, filePath, err)
+		return fmt.Errorf("%s: filePath:%s. Err: %w", op, filePath, err)
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		log.Printf("%s: filePath:%s. Err: %v", op, filePath, err)
+		return fmt.Errorf("%s: filePath:%s. Err: %w", op, filePath, err)
+	}
+	filename := opts.Dest
+	if filename == "" {
+		filename = filepath.Base(filePath)
+	}
+
+	// Большой файл передается частями в несколько потоков
+	parallel := opts.Parallel > 1 && info.Size() >= minParallelSize
+	tc := uploadCompression(opts.Compress, file, filename)
+	// Ограничение скорости общее для всех потоков и попыток загрузки
+	limit := ratelimit.New(ratelimit.NewBucket(opts.LimitRate))
+
+	// Повторяет загрузку, продолжая сессию
+	for attempt := 1; ; attempt++ {
+		var resp *pb.UploadFileResponse
+		if parallel {
+			resp, err = c.parallelUploadAttempt(ctx, file, absPath, info, filename, opts.OnConflict, opts.Parallel, tc, limit)
+		} else {
+			resp, err = c.uploadAttempt(ctx, file, absPath, info, filename, opts.OnConflict, tc, limit)
+		}
+		if err == nil {
+			c.removeUploadState(absPath)
+			if resp.Filename != "" && resp.Filename != filename {
+				log.Printf("%s: filename:%s. saved as %s", op, filename, resp.Filename)
+			}
+			tc.report(op, filename)
+			log.Printf("%s: filename:%s. %s", op, filename, resp.Message)
+			return nil
+		}
+
+		if errors.Is(err, checksum.ErrMismatch) || status.Code(err) == codes.DataLoss {
+			// сервер удалил поврежденные данные, сессию продолжить нельзя
+			c.removeUploadState(absPath)
+		}
+		if _, ok := status.FromError(err); !ok {
+			log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+			return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+		}
+		if !isRetryable(err) || attempt >= maxRetryAttempts {
+			return c.handleGRPCError(op, err)
+		}
+
+		log.Printf("%s: filename:%s. attempt %d failed, resuming: %v", op, filename, attempt, err)
+		select {
+		case <-ctx.Done():
+			return c.handleGRPCError(op, status.FromContextError(ctx.Err()).Err())
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		}
+	}
+}
+
+// uploadAttempt передает файл в сессию загрузки с последнего сохраненного сервером байта
+func (c *ClientService) uploadAttempt(ctx context.Context, file *os.File, absPath string, info os.FileInfo, filename string, policy pb.ConflictPolicy, tc *transferCompression, limit *ratelimit.Limiter) (*pb.UploadFileResponse, error) {
+	const op = "client.service.uploadAttempt"
+
+	started := time.Now()
+	sess, err := c.resumeSession(ctx, absPath, info, filename, policy, false)
+	rtt := time.Since(started)
+	if err != nil {
+		return nil, err
+	}
+	sessionID, offset := sess.SessionId, sess.Offset
+
+	// SHA-256 считается по всему файлу, включая уже принятую сервером часть
+	h := checksum.New()
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err = io.CopyN(h, file, offset); err != nil {
+		return nil, err
+	}
+	if offset > 0 {
+		log.Printf("%s: filename:%s. resuming from %d of %d bytes", op, filename, offset, info.Size())
+	}
+
 	// Поток для загрузки файла
 	stream, err := c.client.UploadFile(ctx)
 	if err != nil {
-		return c.handleGRPCError(op, err)
+		return nil, err
 	}
 
-	// Отправляет имя файла
-	filename := filepath.Base(filePath)
-	if err = stream.Send(&pb.UploadFileRequest{Filename: filepath.Base(filename)}); err != nil {
-		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
-		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+	// Отправляет имя файла, сессию и предлагает алгоритм сжатия
+	first := &pb.UploadFileRequest{
+		Filename:          filename,
+		SessionId:         sessionID,
+		Offset:            offset,
+		ConflictPolicy:    policy,
+		Size:              proto.Int64(info.Size()),
+		AcceptCompression: tc.accept(),
+	}
+	if err = stream.Send(first); err != nil {
+		return nil, closeStreamError(stream, err)
+	}
+	alg, err := tc.negotiate(stream)
+	if err != nil {
+		return nil, err
 	}
 
-	// Передача данных
-	var n int
-	buf := make([]byte, defaultBufSize)
+	// Передача данных. Отправляется ровно заявленный размер, даже если файл дописывают
+	sizer := transfer.NewSizer(c.chunks)
+	sizer.SetRTT(rtt)
+	chunks := transfer.NewReader(io.LimitReader(file, info.Size()-offset), sizer)
+	defer chunks.Release()
+	var out transfer.Buffer
+	defer out.Release()
 	for {
-		n, err = file.Read(buf)
+		chunk, err := chunks.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
-			log.Printf("%s: filename:%s. Err: %v", op, filename, err)
-			return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+			return nil, err
 		}
 
-		if n > 0 {
-			if err = stream.Send(&pb.UploadFileRequest{Content: buf[:n]}); err != nil {
-				log.Printf("%s: filename:%s. Err: %v", op, filename, err)
-				return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
-			}
-			log.Printf("%s: filename:%s. Sent %d bytes", op, filename, n) // Лог отправленных байт
+		h.Write(chunk)
+		req, err := c.chunkRequest(tc, alg, chunk, &out)
+		if err != nil {
+			return nil, err
 		}
+		if err = limit.Wait(ctx, len(req.Content)); err != nil {
+			return nil, err
+		}
+		if err = stream.Send(req); err != nil {
+			return nil, closeStreamError(stream, err)
+		}
+		log.Printf("%s: filename:%s. Sent %d bytes", op, filename, len(chunk)) // Лог отправленных байт
+	}
+
+	// Отправляет SHA-256 файла для проверки на сервере
+	sum := h.Sum(nil)
+	if err = stream.Send(&pb.UploadFileRequest{Sha256: sum}); err != nil {
+		return nil, closeStreamError(stream, err)
 	}
 
 	// Завершение потока и ответ
 	resp, err := stream.CloseAndRecv()
 	if err != nil {
-		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
-		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+		return nil, err
+	}
+	if len(resp.Sha256) > 0 && !bytes.Equal(resp.Sha256, sum) {
+		return nil, checksum.ErrMismatch
+	}
+	log.Printf("%s: filename:%s. sha256 %s", op, filename, checksum.Hex(sum))
+	return resp, nil
+}
+
+// resumeSession вернет сохраненную сессию загрузки или создаст новую
+func (c *ClientService) resumeSession(ctx context.Context, absPath string, info os.FileInfo, filename string, policy pb.ConflictPolicy, parallel bool) (*pb.UploadSession, error) {
+	if st := c.loadUploadState(absPath, info, filename, policy, parallel); st != nil {
+		resp, err := c.client.GetUploadSession(ctx, &pb.GetUploadSessionRequest{SessionId: st.SessionID})
+		if err == nil {
+			return resp, nil
+		}
+		if status.Code(err) != codes.NotFound {
+			return nil, err
+		}
+	}
+
+	req := &pb.StartUploadSessionRequest{
+		Filename:       filename,
+		ConflictPolicy: policy,
+		Size:           proto.Int64(info.Size()),
+		Parallel:       parallel,
+	}
+	resp, err := c.client.StartUploadSession(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	st := &uploadState{
+		SessionID:  resp.SessionId,
+		Filename:   filename,
+		OnConflict: int32(policy),
+		Size:       info.Size(),
+		ModTime:    info.ModTime(),
+		Parallel:   parallel,
+	}
+	if err = c.saveUploadState(absPath, st); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// closeStreamError вернет статус сервера, если отправка прервана сервером
+func closeStreamError(stream grpc.ClientStream, err error) error {
+	if err != io.EOF {
+		return err
+	}
+	if recvErr := stream.RecvMsg(&pb.UploadFileResponse{}); recvErr != nil {
+		return recvErr
+	}
+	return err
+}
+
+// isRetryable ошибки, после которых передачу можно продолжить
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// ListFiles вернет список доступных на сервере файлов в директории dir,
+// запрашивая страницы, пока сервер не вернет пустой next_page_token
+func (c *ClientService) ListFiles(ctx context.Context, dir string, opts ListOptions) error {
+	const op = "client.service.ListFiles"
+
+	req := &pb.ListFilesRequest{
+		Directory:  dir,
+		Recursive:  opts.Recursive,
+		PageSize:   opts.PageSize,
+		Pattern:    opts.Pattern,
+		Prefix:     opts.Prefix,
+		Regex:      opts.Regex,
+		MinSize:    opts.MinSize,
+		MaxSize:    opts.MaxSize,
+		SortBy:     opts.SortBy,
+		Descending: opts.Descending,
+	}
+	if !opts.ModifiedAfter.IsZero() {
+		req.ModifiedAfter = timestamppb.New(opts.ModifiedAfter)
+	}
+	if !opts.ModifiedBefore.IsZero() {
+		req.ModifiedBefore = timestamppb.New(opts.ModifiedBefore)
+	}
+
+	if opts.Stream {
+		return c.streamListFiles(ctx, req)
+	}
+
+	for {
+		resp, err := c.client.ListFiles(ctx, req)
+		if err != nil {
+			return c.handleGRPCError(op, err)
+		}
+		if req.PageToken == "" {
+			fmt.Println("Files in the upload directory:")
+		}
+		for _, fileInfo := range resp.Files {
+			printFileInfo(fileInfo)
+		}
+		if resp.NextPageToken == "" {
+			return nil
+		}
+		req.PageToken = resp.NextPageToken
+	}
+}
+
+// streamListFiles печатает файлы по мере получения от сервера, пока не закончится поток или не отменят ctx
+func (c *ClientService) streamListFiles(ctx context.Context, req *pb.ListFilesRequest) error {
+	const op = "client.service.StreamListFiles"
+
+	stream, err := c.client.StreamListFiles(ctx, req)
+	if err != nil {
+		return c.handleGRPCError(op, err)
+	}
+
+	header := false
+	for {
+		fileInfo, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			if !header {
+				fmt.Println("Files in the upload directory:")
+			}
+			return nil
+		}
+		if err != nil {
+			if status.Code(err) == codes.Canceled || ctx.Err() != nil {
+				log.Printf("%s: listing canceled", op)
+				return ctx.Err()
+			}
+			return c.handleGRPCError(op, err)
+		}
+		if !header {
+			fmt.Println("Files in the upload directory:")
+			header = true
+		}
+		printFileInfo(fileInfo)
+	}
+}
+
+// GetUsage печатает занятое место и лимиты клиента и сервера
+func (c *ClientService) GetUsage(ctx context.Context) error {
+	const op = "client.service.GetUsage"
+
+	resp, err := c.client.GetUsage(ctx, &pb.GetUsageRequest{})
+	if err != nil {
+		return c.handleGRPCError(op, err)
+	}
+
+	fmt.Printf("Identity: %s\n", orDash(resp.Identity))
+	printUsage("Client", resp.Client)
+	printUsage("Server", resp.Server)
+	return nil
+}
+
+// printUsage печатает занятое место и лимит, 0 в лимите - без ограничения
+func printUsage(title string, u *pb.Usage) {
+	limit := func(v int64) string {
+		if v == 0 {
+			return "unlimited"
+		}
+		return fmt.Sprint(v)
+	}
+	fmt.Printf("%s: %d of %s bytes, %d of %s files\n",
+		title, u.GetUsedBytes(), limit(u.GetMaxBytes()), u.GetUsedFiles(), limit(u.GetMaxFiles()))
+}
+
+// DeleteFile удаляет файл на сервере
+func (c *ClientService) DeleteFile(ctx context.Context, filename string) error {
+	const op = "client.service.DeleteFile"
+
+	if filename == "" {
+		log.Printf("%s: filename is required", op)
+		return fmt.Errorf("filename is required")
+	}
+
+	resp, err := c.client.DeleteFile(ctx, &pb.DeleteFileRequest{Filename: filename})
+	if err != nil {
+		return c.handleGRPCError(op, err)
 	}
 
 	log.Printf("%s: filename:%s. %s", op, filename, resp.Message)
 	return nil
 }
 
-// ListFiles вернет список доступных на сервере файлов
-func (c *ClientService) ListFiles(ctx context.Context) error {
-	const op = "client.service.ListFiles"
+// RenameFile переименовывает файл на сервере
+func (c *ClientService) RenameFile(ctx context.Context, oldFilename, newFilename string) error {
+	const op = "client.service.RenameFile"
 
-	resp, err := c.client.ListFiles(ctx, &pb.Empty{})
+	if oldFilename == "" || newFilename == "" {
+		log.Printf("%s: filename is required", op)
+		return fmt.Errorf("filename is required")
+	}
+
+	req := &pb.RenameFileRequest{OldFilename: oldFilename, NewFilename: newFilename}
+	resp, err := c.client.RenameFile(ctx, req)
 	if err != nil {
 		return c.handleGRPCError(op, err)
 	}
 
-	fmt.Println("Files in the upload directory:")
-	for _, fileInfo := range resp.Files {
-		fmt.Printf("Name: %s, Creation Time: %s, Modification Time: %s\n",
-			fileInfo.Name, fileInfo.CreationTime, fileInfo.ModificationTime)
+	log.Printf("%s: filename:%s. %s", op, oldFilename, resp.Message)
+	return nil
+}
+
+// StatFile выводит информацию о файле на сервере
+func (c *ClientService) StatFile(ctx context.Context, filename string) error {
+	const op = "client.service.StatFile"
+
+	if filename == "" {
+		log.Printf("%s: filename is required", op)
+		return fmt.Errorf("filename is required")
 	}
+
+	fileInfo, err := c.client.StatFile(ctx, &pb.StatFileRequest{Filename: filename})
+	if err != nil {
+		return c.handleGRPCError(op, err)
+	}
+
+	fmt.Printf("Name: %s\nType: %s\nSize: %d\nMode: %s\nContent Type: %s\n"+
+		"Creation Time: %s\nModification Time: %s\nSHA-256: %s\nUploader: %s\n",
+		fileInfo.Name, fileType(fileInfo), fileInfo.Size, fs.FileMode(fileInfo.Mode), orDash(fileInfo.ContentType),
+		formatTime(fileInfo.CreationTime), formatTime(fileInfo.ModificationTime),
+		orDash(checksum.Hex(fileInfo.Sha256)), orDash(fileInfo.Uploader))
 	return nil
 }
 
-// GetFile скачивает файл с сервера
-func (c *ClientService) GetFile(ctx context.Context, filename string) error {
-	const op = "client.service.GetFile"
+// MakeDir создает директорию на сервере
+func (c *ClientService) MakeDir(ctx context.Context, dir string, parents bool) error {
+	const op = "client.service.MakeDir"
+
+	if dir == "" {
+		log.Printf("%s: path is required", op)
+		return fmt.Errorf("path is required")
+	}
+
+	resp, err := c.client.MakeDir(ctx, &pb.MakeDirRequest{Path: dir, Parents: parents})
+	if err != nil {
+		return c.handleGRPCError(op, err)
+	}
+
+	log.Printf("%s: dir:%s. %s", op, dir, resp.Message)
+	return nil
+}
+
+// RemoveDir удаляет директорию на сервере
+func (c *ClientService) RemoveDir(ctx context.Context, dir string, recursive bool) error {
+	const op = "client.service.RemoveDir"
+
+	if dir == "" {
+		log.Printf("%s: path is required", op)
+		return fmt.Errorf("path is required")
+	}
+
+	resp, err := c.client.RemoveDir(ctx, &pb.RemoveDirRequest{Path: dir, Recursive: recursive})
+	if err != nil {
+		return c.handleGRPCError(op, err)
+	}
+
+	log.Printf("%s: dir:%s. %s", op, dir, resp.Message)
+	return nil
+}
+
+// ListVersions выводит предыдущие версии файла на сервере
+func (c *ClientService) ListVersions(ctx context.Context, filename string) error {
+	const op = "client.service.ListVersions"
 
 	if filename == "" {
 		log.Printf("%s: filename is required", op)
 		return fmt.Errorf("filename is required")
 	}
 
-	req := &pb.GetFileRequest{Filename: filename}
-	stream, err := c.client.GetFile(ctx, req)
+	resp, err := c.client.ListVersions(ctx, &pb.ListVersionsRequest{Filename: filename})
 	if err != nil {
 		return c.handleGRPCError(op, err)
 	}
 
-	// Директория для хранения файлов клиента
-	if err = os.MkdirAll(c.dataDir, os.ModePerm); err != nil {
+	fmt.Printf("Versions of %s:\n", filename)
+	for _, v := range resp.Versions {
+		fmt.Printf("Version: %s, Size: %d, Archived Time: %s\n", v.VersionId, v.Size, formatTime(v.ArchivedTime))
+	}
+	return nil
+}
+
+// RestoreVersion делает версию файла на сервере текущей
+func (c *ClientService) RestoreVersion(ctx context.Context, filename, version string) error {
+	const op = "client.service.RestoreVersion"
+
+	if filename == "" || version == "" {
+		log.Printf("%s: filename and version are required", op)
+		return fmt.Errorf("filename and version are required")
+	}
+
+	req := &pb.RestoreVersionRequest{Filename: filename, VersionId: version}
+	resp, err := c.client.RestoreVersion(ctx, req)
+	if err != nil {
+		return c.handleGRPCError(op, err)
+	}
+
+	log.Printf("%s: filename:%s. %s", op, filename, resp.Message)
+	return nil
+}
+
+// GetFile скачивает файл с сервера.
+// Если временный файл остался от прошлой попытки, скачивание продолжается с его размера.
+func (c *ClientService) GetFile(ctx context.Context, filename string, opts DownloadOptions) error {
+	const op = "client.service.GetFile"
+
+	if filename == "" {
+		log.Printf("%s: filename is required", op)
+		return fmt.Errorf("filename is required")
+	}
+
+	// Директория для хранения файлов клиента повторяет путь файла на сервере
+	localDir := filepath.Join(c.dataDir, filepath.Dir(filepath.FromSlash(filename)))
+	baseName := filepath.Base(filepath.FromSlash(filename))
+	if err := os.MkdirAll(localDir, os.ModePerm); err != nil {
 		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
 		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
 	}
 
-	// Создаем временный файл
-	tmpFilename := "downloaded_" + filename + ".tmp"
-	tmpFilePath := filepath.Join(c.dataDir, tmpFilename)
+	tc := &transferCompression{alg: opts.Compress}
+	// Ограничение скорости общее для всех потоков и попыток скачивания
+	limit := ratelimit.New(ratelimit.NewBucket(opts.LimitRate))
 
-	f, err := os.Create(tmpFilePath)
+	// Большой файл скачивается частями в несколько потоков
+	if opts.Parallel > 1 {
+		if opts.Version != "" {
+			log.Printf("%s: filename:%s. versions are downloaded in a single stream", op, filename)
+		} else {
+			fileInfo, err := c.client.StatFile(ctx, &pb.StatFileRequest{Filename: filename})
+			if err != nil {
+				return c.handleGRPCError(op, err)
+			}
+			if fileInfo.Size >= minParallelSize {
+				return c.parallelDownload(ctx, filename, localDir, baseName, fileInfo, opts.Parallel, tc, limit)
+			}
+		}
+	}
+
+	// Открываем временный файл для дозаписи, у каждой версии свой
+	tmpFilename := "downloaded_" + baseName + ".tmp"
+	if opts.Version != "" {
+		tmpFilename = "downloaded_" + baseName + "." + opts.Version + ".tmp"
+	}
+	tmpFilePath := filepath.Join(localDir, tmpFilename)
+
+	f, err := os.OpenFile(tmpFilePath, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0o644)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			log.Printf("%s: filepath:%s. Err: %v", op, fmt.Sprintf(c.dataDir+filename), ErrNotFound)
@@ -152,52 +580,164 @@ func (c *ClientService) GetFile(ctx context.Context, filename string) error {
 		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
 	}
 
-	// Удаляем временный файл в случае ошибки
-	var success bool
+	// Удаляем временный файл, если продолжить скачивание нельзя.
+	// При обрыве соединения файл остается для следующей попытки.
+	var discard bool
 	defer func() {
 		if err = f.Close(); err != nil {
 			log.Printf("%s: filename:%s. Err: %v", op, filename, err)
 			return
 		}
-		if !success {
+		if discard {
 			if err = os.Remove(tmpFilePath); err != nil {
 				log.Printf("%s: filename:%s. Err: %v", op, filename, err)
 			}
 		}
 	}()
 
-	// Записываем данные во временный файл
-	var resp *pb.GetFileResponse
-	for {
-		resp, err = stream.Recv()
-		if err != nil {
-			if err == io.EOF {
-				log.Printf("%s: filename:%s. Download completed", op, filename)
-				break
-			}
-			return c.handleGRPCError(op, err)
+	// SHA-256 считается по всему файлу, включая скачанную ранее часть
+	h := checksum.New()
+	if _, err = io.Copy(h, f); err != nil {
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
+	}
+
+	// Записываем данные во временный файл, продолжая после обрывов
+	var expected []byte
+	for attempt := 1; ; attempt++ {
+		expected, err = c.downloadAttempt(ctx, f, filename, opts.Version, h, tc, limit)
+		if err == nil {
+			break
 		}
 
-		if _, err = f.Write(resp.Content); err != nil {
+		if errors.Is(err, checksum.ErrMismatch) {
+			discard = true
+		}
+		if _, ok := status.FromError(err); !ok {
 			log.Printf("%s: filename:%s. Err: %v", op, filename, err)
-			return fmt.Errorf("%s: filename:%s. Err: %v", op, filename, err)
+			return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
 		}
+		switch status.Code(err) {
+		case codes.NotFound, codes.OutOfRange:
+			// файла нет или он стал меньше скачанной части
+			discard = true
+			return c.handleGRPCError(op, err)
+		}
+		if !isRetryable(err) || attempt >= maxRetryAttempts {
+			return c.handleGRPCError(op, err)
+		}
+
+		log.Printf("%s: filename:%s. attempt %d failed, resuming: %v", op, filename, attempt, err)
+		select {
+		case <-ctx.Done():
+			return c.handleGRPCError(op, status.FromContextError(ctx.Err()).Err())
+		case <-time.After(time.Duration(attempt) * retryDelay):
+		}
+	}
+	log.Printf("%s: filename:%s. Download completed", op, filename)
+	tc.report(op, filename)
+
+	// Проверяем целостность до переименования
+	if len(expected) == 0 {
+		log.Printf("%s: filename:%s. server did not send checksum, skipping verification", op, filename)
+	} else if err = checksum.Verify(h, expected); err != nil {
+		discard = true
+		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
+		return fmt.Errorf("%s: filename:%s. Err: %w", op, filename, err)
 	}
 
 	// Переименовываем временный файл в целевой
-	targetFilename := filepath.Join(c.dataDir, "downloaded_"+filename)
+	targetFilename := filepath.Join(localDir, "downloaded_"+baseName)
 	if err = os.Rename(tmpFilePath, targetFilename); err != nil {
 		log.Printf("%s: filename:%s. Err: %v", op, filename, err)
 		return fmt.Errorf("%s: filename:%s. Err: %v", op, filename, err)
 	}
 
-	// Устанавливаем флаг успешного завершения
-	success = true
-
 	log.Printf("%s: file %s downloaded successfully", op, filename)
 	return nil
 }
 
+// downloadAttempt дописывает в f данные файла, начиная с текущего размера f.
+// Вернет SHA-256 файла, если сервер его прислал.
+func (c *ClientService) downloadAttempt(ctx context.Context, f *os.File, filename, version string, h hash.Hash, tc *transferCompression, limit *ratelimit.Limiter) ([]byte, error) {
+	const op = "client.service.downloadAttempt"
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	offset := info.Size()
+	if offset > 0 {
+		log.Printf("%s: filename:%s. resuming from %d bytes", op, filename, offset)
+	}
+
+	req := &pb.GetFileRequest{Filename: filename, Offset: offset, VersionId: version, AcceptCompression: tc.accept()}
+	stream, err := c.client.GetFile(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var expected []byte
+	var resp *pb.GetFileResponse
+	var buf transfer.Buffer // для распаковки частей
+	defer buf.Release()
+	for {
+		resp, err = stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				return expected, nil
+			}
+			return nil, err
+		}
+
+		if err = limit.Wait(ctx, len(resp.Content)); err != nil {
+			return nil, err
+		}
+		content, err := c.chunkContent(tc, resp, &buf)
+		if err != nil {
+			return nil, err
+		}
+		if len(resp.Sha256) > 0 {
+			expected = resp.Sha256
+		}
+		if _, err = f.Write(content); err != nil {
+			return nil, err
+		}
+		h.Write(content)
+	}
+}
+
+// printFileInfo выводит информацию о файле одной строкой
+func printFileInfo(fileInfo *pb.FileInfo) {
+	fmt.Printf("Name: %s, Type: %s, Size: %d, Mode: %s, Content Type: %s, "+
+		"Creation Time: %s, Modification Time: %s, SHA-256: %s, Uploader: %s\n",
+		fileInfo.Name, fileType(fileInfo), fileInfo.Size, fs.FileMode(fileInfo.Mode), orDash(fileInfo.ContentType),
+		formatTime(fileInfo.CreationTime), formatTime(fileInfo.ModificationTime),
+		orDash(checksum.Hex(fileInfo.Sha256)), orDash(fileInfo.Uploader))
+}
+
+func fileType(fileInfo *pb.FileInfo) string {
+	if fileInfo.IsDir {
+		return "dir"
+	}
+	return "file"
+}
+
+// formatTime форматирует время в локальном часовом поясе, "-" если сервер его не знает
+func formatTime(ts *timestamppb.Timestamp) string {
+	if ts == nil {
+		return "-"
+	}
+	return ts.AsTime().Local().Format("2006-01-02 15:04:05")
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
 func (c *ClientService) handleGRPCError(op string, err error) error {
 	if err == nil {
 		return nil
@@ -213,7 +753,11 @@ func (c *ClientService) handleGRPCError(op string, err error) error {
 	case codes.NotFound:
 		log.Printf("%s: %v", op, errorDesc)
 		return fmt.Errorf("%v", ErrNotFound)
-	case codes.ResourceExhausted:
+	case codes.DataLoss:
+		log.Printf("%s: %v", op, errorDesc)
+		return fmt.Errorf("%s: Err: %w", op, checksum.ErrMismatch)
+	case codes.ResourceExhausted, codes.OutOfRange, codes.AlreadyExists, codes.InvalidArgument, codes.FailedPrecondition,
+		codes.Unauthenticated, codes.PermissionDenied:
 		log.Printf("%s: %v", op, errorDesc)
 		return fmt.Errorf("%v", errorDesc)
 	default:
@@ -0,0 +1,79 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+)
+
+// uploadStateDir директория в client_data_dir с незавершенными сессиями загрузки
+const uploadStateDir = ".upload_sessions"
+
+// uploadState сессия загрузки, сохраненная для продолжения после перезапуска клиента
+type uploadState struct {
+	SessionID  string    `json:"session_id"`
+	Filename   string    `json:"filename"`
+	OnConflict int32     `json:"on_conflict"`
+	Size       int64     `json:"size"`
+	ModTime    time.Time `json:"mod_time"`
+	Parallel   bool      `json:"parallel,omitempty"` // сессия принимает файл частями
+}
+
+// loadUploadState вернет сохраненную сессию, если локальный файл с тех пор не менялся
+// и загружается по тому же пути на сервере с той же политикой и тем же способом
+func (c *ClientService) loadUploadState(absPath string, info os.FileInfo, filename string, policy pb.ConflictPolicy, parallel bool) *uploadState {
+	const op = "client.service.loadUploadState"
+
+	data, err := os.ReadFile(c.uploadStatePath(absPath))
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("%s: filePath:%s. Err: %v", op, absPath, err)
+		}
+		return nil
+	}
+
+	var st uploadState
+	if err = json.Unmarshal(data, &st); err != nil {
+		log.Printf("%s: filePath:%s. Err: %v", op, absPath, err)
+		return nil
+	}
+	if st.Filename != filename || st.OnConflict != int32(policy) || st.Parallel != parallel ||
+		st.Size != info.Size() || !st.ModTime.Equal(info.ModTime()) {
+		log.Printf("%s: filePath:%s. file or destination changed since last upload, starting over", op, absPath)
+		return nil
+	}
+	return &st
+}
+
+// saveUploadState сохраняет сессию загрузки на диск
+func (c *ClientService) saveUploadState(absPath string, st *uploadState) error {
+	path := c.uploadStatePath(absPath)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// removeUploadState удаляет сохраненную сессию загрузки
+func (c *ClientService) removeUploadState(absPath string) {
+	const op = "client.service.removeUploadState"
+	if err := os.Remove(c.uploadStatePath(absPath)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s: filePath:%s. Err: %v", op, absPath, err)
+	}
+}
+
+func (c *ClientService) uploadStatePath(absPath string) string {
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(c.dataDir, uploadStateDir, hex.EncodeToString(sum[:])+".json")
+}
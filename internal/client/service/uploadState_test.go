@@ -0,0 +1,66 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+)
+
+// Сохраненная сессия загрузки продолжается, только пока файл и место назначения те же
+func TestUploadState(t *testing.T) {
+	discardLog(t)
+	c := &ClientService{dataDir: t.TempDir()}
+	absPath := filepath.Join(t.TempDir(), "report.csv")
+	if err := os.WriteFile(absPath, []byte("0123456789"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(absPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := pb.ConflictPolicy_CONFLICT_POLICY_RENAME
+
+	if st := c.loadUploadState(absPath, info, "docs/report.csv", policy, false); st != nil {
+		t.Fatalf("loadUploadState before save = %+v, want nil", st)
+	}
+	saved := &uploadState{SessionID: "0123456789abcdef0123456789abcdef", Filename: "docs/report.csv", OnConflict: int32(policy), Size: info.Size(), ModTime: info.ModTime()}
+	if err = c.saveUploadState(absPath, saved); err != nil {
+		t.Fatal(err)
+	}
+	st := c.loadUploadState(absPath, info, "docs/report.csv", policy, false)
+	if st == nil || st.SessionID != saved.SessionID {
+		t.Fatalf("loadUploadState = %+v, want %+v", st, saved)
+	}
+
+	// другой путь на сервере, политика или способ загрузки начинают загрузку заново
+	if st = c.loadUploadState(absPath, info, "other.csv", policy, false); st != nil {
+		t.Errorf("loadUploadState for other filename = %+v, want nil", st)
+	}
+	if st = c.loadUploadState(absPath, info, "docs/report.csv", pb.ConflictPolicy_CONFLICT_POLICY_OVERWRITE, false); st != nil {
+		t.Errorf("loadUploadState for other policy = %+v, want nil", st)
+	}
+	if st = c.loadUploadState(absPath, info, "docs/report.csv", policy, true); st != nil {
+		t.Errorf("loadUploadState for parallel upload = %+v, want nil", st)
+	}
+
+	// локальный файл изменился
+	modTime := info.ModTime().Add(time.Second)
+	if err = os.Chtimes(absPath, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if info, err = os.Stat(absPath); err != nil {
+		t.Fatal(err)
+	}
+	if st = c.loadUploadState(absPath, info, "docs/report.csv", policy, false); st != nil {
+		t.Errorf("loadUploadState for modified file = %+v, want nil", st)
+	}
+
+	c.removeUploadState(absPath)
+	if _, err = os.Stat(c.uploadStatePath(absPath)); !os.IsNotExist(err) {
+		t.Errorf("upload state left after remove: %v", err)
+	}
+	c.removeUploadState(absPath) // повторное удаление не ошибка
+}
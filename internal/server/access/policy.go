@@ -0,0 +1,140 @@
+package access
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Permission право доступа к файлу или директории
+type Permission string
+
+const (
+	Read   Permission = "read"   // скачивание файлов, информация о файле и его версиях
+	Write  Permission = "write"  // загрузка, создание директорий, перенос и восстановление версий
+	Delete Permission = "delete" // удаление файлов и директорий, перенос из исходного места
+	List   Permission = "list"   // просмотр содержимого директорий
+)
+
+// IdentityPlaceholder подставляется в шаблон home вместо идентификатора клиента
+const IdentityPlaceholder = "{identity}"
+
+var ErrInvalidIdentity = errors.New("identity cannot be used as a home directory name")
+
+// Subjects клиенты, к которым относится правило
+type Subjects struct {
+	// Identities идентификаторы клиентов, "*" - любой клиент
+	Identities []string `yaml:"identities"`
+	// Groups группы клиентов из токена
+	Groups []string `yaml:"groups"`
+}
+
+// Match проверяет, относится ли клиент к Subjects
+func (s Subjects) Match(identity string, groups []string) bool {
+	if slices.Contains(s.Identities, "*") || slices.Contains(s.Identities, identity) {
+		return true
+	}
+	for _, g := range groups {
+		if slices.Contains(s.Groups, g) {
+			return true
+		}
+	}
+	return false
+}
+
+// Rule разрешает клиентам действия с путем и всем, что внутри него
+type Rule struct {
+	// Path путь от корня хранилища, пусто или "/" - все хранилище
+	Path     string `yaml:"path"`
+	Subjects `yaml:",inline"`
+	Allow    []Permission `yaml:"allow"`
+}
+
+// Policy правила доступа к хранилищу. Все, что не разрешено правилами, запрещено
+type Policy struct {
+	// Home шаблон домашней директории клиента от корня хранилища, например "home/{identity}".
+	// Пути в запросах клиента отсчитываются от его домашней директории, в ней ему разрешено все.
+	// Пусто - все клиенты видят хранилище целиком
+	Home string `yaml:"home"`
+	// Global клиенты, которые видят хранилище целиком даже при заданном Home
+	Global Subjects `yaml:"global"`
+	Rules  []Rule   `yaml:"rules"`
+}
+
+// Load читает политику из YAML-файла и проверяет ее
+func Load(filePath string) (*Policy, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var p Policy
+	if err = yaml.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("parse policy file: %w", err)
+	}
+
+	if p.Home != "" {
+		if !strings.Contains(p.Home, IdentityPlaceholder) {
+			return nil, fmt.Errorf("policy: home must contain %s", IdentityPlaceholder)
+		}
+		p.Home = strings.Trim(path.Clean(p.Home), "/")
+	}
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		rule.Path = cleanRulePath(rule.Path)
+		for _, perm := range rule.Allow {
+			switch perm {
+			case Read, Write, Delete, List:
+			default:
+				return nil, fmt.Errorf("policy: rule %d: unknown permission %q", i, perm)
+			}
+		}
+	}
+	return &p, nil
+}
+
+// cleanRulePath приводит путь правила к виду путей хранилища: без "/" по краям, "" - корень
+func cleanRulePath(p string) string {
+	p = strings.Trim(path.Clean("/"+p), "/")
+	return p
+}
+
+// HomeDir возвращает домашнюю директорию клиента от корня хранилища,
+// пусто - клиент видит хранилище целиком
+func (p *Policy) HomeDir(identity string, groups []string) (string, error) {
+	if p.Home == "" || p.Global.Match(identity, groups) {
+		return "", nil
+	}
+	if identity == "" || identity == "." || identity == ".." ||
+		strings.HasPrefix(identity, ".") || strings.ContainsAny(identity, "/\\\x00") {
+		return "", fmt.Errorf("%w: %q", ErrInvalidIdentity, identity)
+	}
+	return strings.ReplaceAll(p.Home, IdentityPlaceholder, identity), nil
+}
+
+// Allowed проверяет право клиента на путь rel от корня хранилища
+func (p *Policy) Allowed(identity string, groups []string, home, rel string, perm Permission) bool {
+	if home != "" && Within(home, rel) {
+		return true
+	}
+	for _, rule := range p.Rules {
+		if Within(rule.Path, rel) && slices.Contains(rule.Allow, perm) && rule.Match(identity, groups) {
+			return true
+		}
+	}
+	return false
+}
+
+// Within проверяет, что путь rel совпадает с dir или лежит внутри него.
+// Пути сравниваются как строки, поэтому неочищенный rel (с "..", "." или "/" в начале) не подходит
+func Within(dir, rel string) bool {
+	if rel != "" && (path.Clean(rel) != rel || rel == ".." || strings.HasPrefix(rel, "../") || strings.HasPrefix(rel, "/")) {
+		return false
+	}
+	return dir == "" || rel == dir || strings.HasPrefix(rel, dir+"/")
+}
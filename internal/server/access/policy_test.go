@@ -0,0 +1,157 @@
+package access
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithin(t *testing.T) {
+	tests := []struct {
+		dir, rel string
+		want     bool
+	}{
+		{dir: "", rel: "a.txt", want: true},
+		{dir: "", rel: "", want: true},
+		{dir: "home/alice", rel: "home/alice", want: true},
+		{dir: "home/alice", rel: "home/alice/a.txt", want: true},
+		{dir: "home/alice", rel: "home/alice/docs/a.txt", want: true},
+		{dir: "home/alice", rel: "home/alice2/a.txt"},
+		{dir: "home/alice", rel: "home/alic"},
+		{dir: "home/alice", rel: "home"},
+		{dir: "home/alice", rel: ""},
+		{dir: "home/alice", rel: "home/alice/../bob"},
+		{dir: "home/alice", rel: "home/alice/./a.txt"},
+		{dir: "", rel: "../etc/passwd"},
+		{dir: "", rel: ".."},
+		{dir: "", rel: "/etc/passwd"},
+	}
+	for _, tt := range tests {
+		if got := Within(tt.dir, tt.rel); got != tt.want {
+			t.Errorf("Within(%q, %q) = %v, want %v", tt.dir, tt.rel, got, tt.want)
+		}
+	}
+}
+
+func TestHomeDir(t *testing.T) {
+	p := &Policy{Home: "home/{identity}", Global: Subjects{Identities: []string{"admin"}, Groups: []string{"admins"}}}
+
+	tests := []struct {
+		name     string
+		identity string
+		groups   []string
+		want     string
+		wantErr  bool
+	}{
+		{name: "client", identity: "alice", want: "home/alice"},
+		{name: "address", identity: "127.0.0.1", want: "home/127.0.0.1"},
+		{name: "dots inside name", identity: "a..b", want: "home/a..b"},
+		{name: "global identity", identity: "admin", want: ""},
+		{name: "global group", identity: "bob", groups: []string{"admins"}, want: ""},
+		{name: "empty", identity: "", wantErr: true},
+		{name: "dot", identity: ".", wantErr: true},
+		{name: "parent", identity: "..", wantErr: true},
+		{name: "hidden", identity: ".staging", wantErr: true},
+		{name: "slash", identity: "alice/../bob", wantErr: true},
+		{name: "traversal", identity: "../shared", wantErr: true},
+		{name: "absolute", identity: "/etc", wantErr: true},
+		{name: "backslash", identity: `..\bob`, wantErr: true},
+		{name: "NUL byte", identity: "alice\x00", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := p.HomeDir(tt.identity, tt.groups)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidIdentity) {
+					t.Fatalf("HomeDir(%q) error = %v, want ErrInvalidIdentity", tt.identity, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("HomeDir(%q) = %q, %v, want %q", tt.identity, got, err, tt.want)
+			}
+		})
+	}
+
+	// без шаблона все клиенты видят хранилище целиком
+	if got, err := (&Policy{}).HomeDir("..", nil); err != nil || got != "" {
+		t.Errorf("HomeDir without template = %q, %v, want whole storage", got, err)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	p := &Policy{Rules: []Rule{
+		{Path: "shared", Subjects: Subjects{Identities: []string{"*"}}, Allow: []Permission{Read, List}},
+		{Path: "shared/uploads", Subjects: Subjects{Groups: []string{"writers"}}, Allow: []Permission{Write}},
+		{Path: "", Subjects: Subjects{Identities: []string{"admin"}}, Allow: []Permission{Read, Write, Delete, List}},
+	}}
+
+	tests := []struct {
+		name     string
+		identity string
+		groups   []string
+		home     string
+		rel      string
+		perm     Permission
+		want     bool
+	}{
+		{name: "own home", identity: "alice", home: "home/alice", rel: "home/alice/a.txt", perm: Delete, want: true},
+		{name: "home itself", identity: "alice", home: "home/alice", rel: "home/alice", perm: List, want: true},
+		{name: "other home", identity: "alice", home: "home/alice", rel: "home/bob/a.txt", perm: Read},
+		{name: "home with same prefix", identity: "alice", home: "home/alice", rel: "home/alice2/a.txt", perm: Read},
+		{name: "parent of home", identity: "alice", home: "home/alice", rel: "home", perm: List},
+		{name: "storage root", identity: "alice", home: "home/alice", rel: "", perm: List},
+		{name: "rule for anyone", identity: "alice", rel: "shared/docs/a.txt", perm: Read, want: true},
+		{name: "permission not in rule", identity: "alice", rel: "shared/a.txt", perm: Write},
+		{name: "nested rule by group", identity: "bob", groups: []string{"writers"}, rel: "shared/uploads/b.txt", perm: Write, want: true},
+		{name: "nested rule outside its path", identity: "bob", groups: []string{"writers"}, rel: "shared/b.txt", perm: Write},
+		{name: "group of other client", identity: "bob", groups: []string{"readers"}, rel: "shared/uploads/b.txt", perm: Write},
+		{name: "name with rule prefix", identity: "alice", rel: "shared2/a.txt", perm: Read},
+		{name: "root rule", identity: "admin", home: "", rel: "home/bob/a.txt", perm: Delete, want: true},
+		{name: "identity like path", identity: "../admin", rel: "home/bob/a.txt", perm: Read},
+		{name: "empty identity", identity: "", rel: "home/bob/a.txt", perm: Read},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Allowed(tt.identity, tt.groups, tt.home, tt.rel, tt.perm); got != tt.want {
+				t.Fatalf("Allowed(%q, %q, %q, %s) = %v, want %v", tt.identity, tt.home, tt.rel, tt.perm, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	write := func(t *testing.T, data string) string {
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	p, err := Load(write(t, "home: \"/home//{identity}/\"\nrules:\n  - path: \"/shared/../docs/\"\n    identities: [\"*\"]\n    allow: [\"read\"]\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Home != "home/{identity}" || p.Rules[0].Path != "docs" {
+		t.Errorf("home %q, rule path %q, want cleaned paths", p.Home, p.Rules[0].Path)
+	}
+	if p, err = Load(write(t, "rules:\n  - path: \"../../etc\"\n    identities: [\"*\"]\n    allow: [\"read\"]\n")); err != nil || p.Rules[0].Path != "etc" {
+		t.Errorf("rule path above root = %q, %v, want clamped to etc", p.Rules[0].Path, err)
+	}
+
+	for name, data := range map[string]string{
+		"home without placeholder": "home: \"home/shared\"\n",
+		"unknown permission":       "rules:\n  - path: \"/\"\n    allow: [\"admin\"]\n",
+		"not yaml":                 "rules: [",
+	} {
+		if _, err := Load(write(t, data)); err == nil {
+			t.Errorf("%s: Load succeeded", name)
+		}
+	}
+
+	if _, err = Load("../../../configs/policy.yaml"); err != nil {
+		t.Errorf("example policy: %v", err)
+	}
+}
@@ -1,15 +1,61 @@
 package app
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/RVodassa/FileTransfer/internal/server/access"
+	"github.com/RVodassa/FileTransfer/internal/server/auth"
 	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
 	"github.com/RVodassa/FileTransfer/internal/server/service"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/internal/server/versions"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
 	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/tlsconfig"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"log"
 	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
 )
 
-func Run(cfg *config.ServerConfig) {
+// Option дополнительные параметры запуска сервера
+type Option func(*options)
+
+type options struct {
+	verifier auth.Verifier
+	storage  storage.Storage
+}
+
+// WithVerifier задает внешнюю проверку токенов вместо verifier из конфига
+func WithVerifier(v auth.Verifier) Option {
+	return func(o *options) {
+		o.verifier = v
+	}
+}
+
+// WithStorage задает свое хранилище файлов вместо storage.backend из конфига
+func WithStorage(st storage.Storage) Option {
+	return func(o *options) {
+		o.storage = st
+	}
+}
+
+// Run запускает сервер и обслуживает запросы до отмены ctx. Фоновые задачи
+// (перечитывание сертификатов, очистка версий и чанков) останавливаются вместе с ним
+func Run(ctx context.Context, cfg *config.ServerConfig, opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
 
 	lis, err := net.Listen("tcp", cfg.Server.Address)
 	if err != nil {
@@ -17,9 +63,96 @@ func Run(cfg *config.ServerConfig) {
 		return
 	}
 
-	s := grpc.NewServer()
-	serviceServer := service.NewServiceServer(cfg)
+	// Хранилище версий и фоновая очистка по правилам хранения
+	var versionStore *versions.Store
+	if cfg.Versioning.Enabled {
+		versionStore = versions.NewStore(cfg.Versioning.Dir)
+		maxAge := time.Duration(cfg.Versioning.KeepDays) * 24 * time.Hour
+		go versionStore.RunPruner(ctx, cfg.Versioning.PruneInterval, cfg.Versioning.KeepLast, maxAge)
+	}
+
+	// Часть файла максимального размера не помещается в лимит сообщения gRPC по умолчанию
+	serverOpts := []grpc.ServerOption{grpc.MaxRecvMsgSize(transfer.MaxMessageSize)}
+	if cfg.Server.TLS.Enabled {
+		creds, err := serverCredentials(ctx, cfg)
+		if err != nil {
+			log.Printf("failed to load TLS certificates: %v", err)
+			return
+		}
+		serverOpts = append(serverOpts, grpc.Creds(creds))
+	}
+	if cfg.Auth.Enabled || o.verifier != nil {
+		verifier := o.verifier
+		if verifier == nil {
+			if verifier, err = newVerifier(cfg); err != nil {
+				log.Printf("failed to create token verifier: %v", err)
+				return
+			}
+		}
+		serverOpts = append(serverOpts,
+			grpc.ChainUnaryInterceptor(auth.UnaryServerInterceptor(verifier)),
+			grpc.ChainStreamInterceptor(auth.StreamServerInterceptor(verifier)),
+		)
+	}
+
+	// Политика доступа: домашние директории и права клиентов
+	var policy *access.Policy
+	if cfg.Access.Enabled {
+		if policy, err = access.Load(cfg.Access.PolicyFile); err != nil {
+			log.Printf("failed to load access policy: %v", err)
+			return
+		}
+	}
+
+	store := o.storage
+	if store == nil {
+		if store, err = newStorage(cfg); err != nil {
+			log.Printf("failed to create storage: %v", err)
+			return
+		}
+		if cfg.Storage.Dedup.Enabled {
+			dedup, err := newDedupStorage(cfg, store)
+			if err != nil {
+				log.Printf("failed to create chunk storage: %v", err)
+				return
+			}
+			go dedup.RunGC(ctx, cfg.Storage.Dedup.GCInterval)
+			store = dedup
+		}
+	}
+
+	// Квоты: учитывает уже загруженные файлы
+	var quotaTracker *quota.Tracker
+	if cfg.Quota.Enabled {
+		quotaTracker = newQuotaTracker(cfg)
+		if err = quotaTracker.Scan(context.Background(), store); err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("failed to calculate storage usage: %v", err)
+			return
+		}
+	}
+
+	var codec *compression.Codec
+	if cfg.Compression.Enabled {
+		levels := compression.Levels{Gzip: cfg.Compression.GzipLevel, Zstd: cfg.Compression.ZstdLevel}
+		if codec, err = compression.New(levels); err != nil {
+			log.Printf("failed to create compression codec: %v", err)
+			return
+		}
+	}
+
+	s := grpc.NewServer(serverOpts...)
+	serviceServer := service.NewServiceServer(cfg, store, versionStore, policy, quotaTracker, codec)
 	pb.RegisterFileTransferServer(s, serviceServer)
+	// Незавершенные сессии занимают место в квотах и после перезапуска
+	serviceServer.RestoreSessionQuota(ctx)
+	go serviceServer.RunSessionSweeper(ctx)
+
+	// Новые запросы не принимаются, текущие передачи завершаются
+	go func() {
+		<-ctx.Done()
+		log.Printf("shutting down server")
+		s.GracefulStop()
+	}()
 
 	log.Printf("Server is running on port %s", cfg.Server.Address)
 	if err = s.Serve(lis); err != nil {
@@ -27,3 +160,121 @@ func Run(cfg *config.ServerConfig) {
 		return
 	}
 }
+
+// serverCredentials загружает сертификаты и запускает их перечитывание при изменении файлов
+func serverCredentials(ctx context.Context, cfg *config.ServerConfig) (credentials.TransportCredentials, error) {
+	tlsCfg := cfg.Server.TLS
+	reloader, err := tlsconfig.NewReloader(tlsCfg.CertFile, tlsCfg.KeyFile, tlsCfg.ClientCAFile)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.Watch(ctx, tlsCfg.ReloadInterval)
+
+	clientAuth := tls.NoClientCert
+	switch {
+	case tlsCfg.RequireClientCert:
+		clientAuth = tls.RequireAndVerifyClientCert
+	case tlsCfg.ClientCAFile != "":
+		clientAuth = tls.VerifyClientCertIfGiven
+	}
+	return credentials.NewTLS(reloader.ServerConfig(clientAuth)), nil
+}
+
+// newVerifier создает проверку токенов, выбранную в конфиге
+func newVerifier(cfg *config.ServerConfig) (auth.Verifier, error) {
+	switch cfg.Auth.Verifier {
+	case config.AuthStatic:
+		return auth.NewStaticVerifier(cfg.Auth.TokenFile)
+	case config.AuthJWT:
+		return auth.NewJWTVerifier(cfg.Auth.JWT.SecretFile, cfg.Auth.JWT.Issuer, cfg.Auth.JWT.Audience)
+	default:
+		return nil, fmt.Errorf("auth verifier is not set")
+	}
+}
+
+// newStorage создает хранилище файлов, выбранное в конфиге
+func newStorage(cfg *config.ServerConfig) (storage.Storage, error) {
+	switch cfg.Storage.Backend {
+	case config.StorageLocal:
+		return storage.NewLocal(cfg.ServerDataDir), nil
+	case config.StorageMemory:
+		log.Printf("using in-memory storage, files will be lost on shutdown")
+		return storage.NewMemory(), nil
+	case config.StorageS3:
+		return newS3Storage(cfg, cfg.Storage.S3.Prefix)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", cfg.Storage.Backend)
+	}
+}
+
+// newDedupStorage включает дедупликацию поверх files. Чанки хранятся в том же бэкенде
+func newDedupStorage(cfg *config.ServerConfig, files storage.Storage) (*storage.Dedup, error) {
+	var chunks storage.Storage
+	switch cfg.Storage.Backend {
+	case config.StorageLocal:
+		// манифесты файлов помечаются в расширенных атрибутах
+		if err := os.MkdirAll(cfg.ServerDataDir, os.ModePerm); err != nil {
+			return nil, err
+		}
+		if err := meta.CheckSupport(cfg.ServerDataDir); err != nil {
+			return nil, fmt.Errorf("deduplication needs extended attributes in %s: %w", cfg.ServerDataDir, err)
+		}
+		chunks = storage.NewLocal(cfg.Storage.Dedup.ChunkDir)
+	case config.StorageMemory:
+		chunks = storage.NewMemory()
+	case config.StorageS3:
+		var err error
+		if chunks, err = newS3Storage(cfg, path.Join(cfg.Storage.S3.Prefix, ".chunks")); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %q", cfg.Storage.Backend)
+	}
+
+	dedupCfg := cfg.Storage.Dedup
+	opts := storage.DedupOptions{
+		MinChunkSize: dedupCfg.MinChunkSize,
+		AvgChunkSize: dedupCfg.AvgChunkSize,
+		MaxChunkSize: dedupCfg.MaxChunkSize,
+	}
+	return storage.NewDedup(context.Background(), files, chunks, opts)
+}
+
+// newS3Storage подключается к S3-совместимому хранилищу из конфига, ключи объектов - под prefix
+func newS3Storage(cfg *config.ServerConfig, prefix string) (storage.Storage, error) {
+	s3Cfg := cfg.Storage.S3
+	opts := storage.S3Options{
+		Endpoint:    s3Cfg.Endpoint,
+		Region:      s3Cfg.Region,
+		Bucket:      s3Cfg.Bucket,
+		Prefix:      prefix,
+		AccessKeyID: s3Cfg.AccessKeyID,
+		DisableTLS:  s3Cfg.DisableTLS,
+		PathStyle:   s3Cfg.PathStyle,
+		PartSize:    s3Cfg.PartSize,
+		MaxPartSize: s3Cfg.MaxPartSize,
+	}
+	if s3Cfg.SecretAccessKeyFile != "" {
+		secret, err := os.ReadFile(s3Cfg.SecretAccessKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("read secret access key: %w", err)
+		}
+		opts.SecretAccessKey = strings.TrimSpace(string(secret))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return storage.NewS3(ctx, opts)
+}
+
+// newQuotaTracker создает учет места с лимитами из конфига
+func newQuotaTracker(cfg *config.ServerConfig) *quota.Tracker {
+	limits := func(l config.QuotaLimits) quota.Limits {
+		return quota.Limits{MaxBytes: l.MaxBytes, MaxFiles: l.MaxFiles}
+	}
+	identities := make(map[string]quota.Limits, len(cfg.Quota.Identities))
+	for identity, l := range cfg.Quota.Identities {
+		identities[identity] = limits(l)
+	}
+	return quota.NewTracker(limits(cfg.Quota.Global), limits(cfg.Quota.PerIdentity), identities)
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+var ErrMissingToken = errors.New("missing bearer token")
+var ErrInvalidToken = errors.New("invalid token")
+var ErrTokenExpired = errors.New("token expired")
+
+// Identity клиент, которому принадлежит токен
+type Identity struct {
+	// Subject имя клиента, сохраняется как автор загрузки
+	Subject string
+	// Groups группы клиента
+	Groups []string
+}
+
+// Verifier проверяет bearer-токен и возвращает его владельца.
+// Ошибки со статусом gRPC передаются клиенту как есть, остальные - как Unauthenticated.
+// Реализацию можно передать в app.Run через app.WithVerifier
+type Verifier interface {
+	Verify(ctx context.Context, token string) (*Identity, error)
+}
+
+// VerifierFunc позволяет использовать функцию как Verifier
+type VerifierFunc func(ctx context.Context, token string) (*Identity, error)
+
+// Verify вызывает f(ctx, token)
+func (f VerifierFunc) Verify(ctx context.Context, token string) (*Identity, error) {
+	return f(ctx, token)
+}
+
+type identityKey struct{}
+
+// NewContext возвращает контекст с владельцем токена
+func NewContext(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext возвращает владельца токена, если запрос прошел проверку
+func FromContext(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(*Identity)
+	return id, ok
+}
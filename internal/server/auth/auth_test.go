@@ -0,0 +1,281 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+// signJWT собирает JWT с заголовком header и полями claims, подписанный secret
+func signJWT(t *testing.T, header, claims map[string]any, newHash func() hash.Hash, secret []byte) string {
+	t.Helper()
+	segment := func(v any) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	unsigned := segment(header) + "." + segment(claims)
+	if newHash == nil {
+		return unsigned + "."
+	}
+	mac := hmac.New(newHash, secret)
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTVerifier(t *testing.T) {
+	v := &JWTVerifier{secret: testSecret, issuer: "filetransfer", audience: "storage"}
+	now := time.Now()
+	claims := func(change func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"sub":    "alice",
+			"iss":    "filetransfer",
+			"aud":    "storage",
+			"exp":    now.Add(time.Hour).Unix(),
+			"groups": []string{"admins"},
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	hs256 := map[string]any{"alg": "HS256", "typ": "JWT"}
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error // nil - токен принимается
+	}{
+		{name: "valid", token: signJWT(t, hs256, claims(nil), sha256.New, testSecret)},
+		{name: "HS512", token: signJWT(t, map[string]any{"alg": "HS512"}, claims(nil), sha512.New, testSecret)},
+		{name: "audience list", token: signJWT(t, hs256, claims(func(c map[string]any) {
+			c["aud"] = []string{"other", "storage"}
+		}), sha256.New, testSecret)},
+		{name: "alg none", token: signJWT(t, map[string]any{"alg": "none"}, claims(nil), nil, nil), wantErr: ErrInvalidToken},
+		{name: "alg none with HS256 signature", token: func() string {
+			signed := signJWT(t, hs256, claims(nil), sha256.New, testSecret)
+			none := signJWT(t, map[string]any{"alg": "none"}, claims(nil), nil, nil)
+			return none + signed[len(signed)-43:]
+		}(), wantErr: ErrInvalidToken},
+		{name: "RS256", token: signJWT(t, map[string]any{"alg": "RS256"}, claims(nil), sha256.New, testSecret), wantErr: ErrInvalidToken},
+		{name: "header alg differs from signature", token: signJWT(t, map[string]any{"alg": "HS384"}, claims(nil), sha256.New, testSecret), wantErr: ErrInvalidToken},
+		{name: "wrong secret", token: signJWT(t, hs256, claims(nil), sha256.New, []byte("another secret of thirty-two bytes")), wantErr: ErrInvalidToken},
+		{name: "tampered claims", token: func() string {
+			signed := signJWT(t, hs256, claims(nil), sha256.New, testSecret)
+			forged := signJWT(t, hs256, claims(func(c map[string]any) { c["sub"] = "admin" }), sha256.New, []byte("x"))
+			return forged[:len(forged)-43] + signed[len(signed)-43:]
+		}(), wantErr: ErrInvalidToken},
+		{name: "malformed", token: "not.a.jwt.at.all", wantErr: ErrInvalidToken},
+		{name: "bad base64 signature", token: signJWT(t, hs256, claims(nil), nil, nil) + "!!!", wantErr: ErrInvalidToken},
+		{name: "missing sub", token: signJWT(t, hs256, claims(func(c map[string]any) { delete(c, "sub") }), sha256.New, testSecret), wantErr: ErrInvalidToken},
+		{name: "missing exp", token: signJWT(t, hs256, claims(func(c map[string]any) { delete(c, "exp") }), sha256.New, testSecret), wantErr: ErrInvalidToken},
+		{name: "expired within leeway", token: signJWT(t, hs256, claims(func(c map[string]any) {
+			c["exp"] = now.Add(-jwtLeeway / 2).Unix()
+		}), sha256.New, testSecret)},
+		{name: "expired", token: signJWT(t, hs256, claims(func(c map[string]any) {
+			c["exp"] = now.Add(-2 * jwtLeeway).Unix()
+		}), sha256.New, testSecret), wantErr: ErrTokenExpired},
+		{name: "not before within leeway", token: signJWT(t, hs256, claims(func(c map[string]any) {
+			c["nbf"] = now.Add(jwtLeeway / 2).Unix()
+		}), sha256.New, testSecret)},
+		{name: "not valid yet", token: signJWT(t, hs256, claims(func(c map[string]any) {
+			c["nbf"] = now.Add(2 * jwtLeeway).Unix()
+		}), sha256.New, testSecret), wantErr: ErrInvalidToken},
+		{name: "wrong issuer", token: signJWT(t, hs256, claims(func(c map[string]any) { c["iss"] = "evil" }), sha256.New, testSecret), wantErr: ErrInvalidToken},
+		{name: "wrong audience", token: signJWT(t, hs256, claims(func(c map[string]any) { c["aud"] = "other" }), sha256.New, testSecret), wantErr: ErrInvalidToken},
+		{name: "missing audience", token: signJWT(t, hs256, claims(func(c map[string]any) { delete(c, "aud") }), sha256.New, testSecret), wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := v.Verify(context.Background(), tt.token)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("Verify error = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Verify: %v", err)
+			}
+			if id.Subject != "alice" || len(id.Groups) != 1 || id.Groups[0] != "admins" {
+				t.Fatalf("identity = %+v, want alice in admins", id)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifier(t *testing.T) {
+	dir := t.TempDir()
+	short := filepath.Join(dir, "short")
+	if err := os.WriteFile(short, []byte("too short\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJWTVerifier(short, "", ""); err == nil {
+		t.Error("short secret accepted")
+	}
+	good := filepath.Join(dir, "good")
+	if err := os.WriteFile(good, append(testSecret, '\n'), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewJWTVerifier(good, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// без issuer и audience в конфиге они не проверяются
+	token := signJWT(t, map[string]any{"alg": "HS256"}, map[string]any{
+		"sub": "bob", "iss": "any", "aud": "any", "exp": time.Now().Add(time.Hour).Unix(),
+	}, sha256.New, testSecret)
+	if _, err = v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestStaticVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		wantErr bool
+	}{
+		{name: "valid", file: "tokens:\n  - token: \"f3a9c1\"\n    subject: \"alice\"\n    groups: [\"admins\"]\n"},
+		{name: "empty list", file: "tokens: []\n"},
+		{name: "placeholder", file: "tokens:\n  - token: \"change-me\"\n    subject: \"admin\"\n", wantErr: true},
+		{name: "placeholder in other case", file: "tokens:\n  - token: \"CHANGE-ME\"\n    subject: \"admin\"\n", wantErr: true},
+		{name: "missing subject", file: "tokens:\n  - token: \"f3a9c1\"\n", wantErr: true},
+		{name: "duplicate", file: "tokens:\n  - token: \"f3a9c1\"\n    subject: \"a\"\n  - token: \"f3a9c1\"\n    subject: \"b\"\n", wantErr: true},
+		{name: "not yaml", file: "tokens: [", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tokens.yaml")
+			if err := os.WriteFile(path, []byte(tt.file), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			_, err := NewStaticVerifier(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewStaticVerifier error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// файл из примеров не содержит рабочих токенов
+	if v, err := NewStaticVerifier("../../../configs/tokens.yaml"); err != nil || len(v.tokens) != 0 {
+		t.Errorf("example token file: %d tokens, %v, want none", len(v.tokens), err)
+	}
+
+	path := filepath.Join(t.TempDir(), "tokens.yaml")
+	if err := os.WriteFile(path, []byte("tokens:\n  - token: \"f3a9c1\"\n    subject: \"alice\"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewStaticVerifier(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := v.Verify(context.Background(), "f3a9c1"); err != nil || id.Subject != "alice" {
+		t.Errorf("Verify = %+v, %v, want alice", id, err)
+	}
+	if _, err = v.Verify(context.Background(), "f3a9c2"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify unknown token error = %v, want ErrInvalidToken", err)
+	}
+}
+
+// testStream поток с контекстом запроса
+type testStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *testStream) Context() context.Context { return s.ctx }
+
+func TestInterceptors(t *testing.T) {
+	v := VerifierFunc(func(_ context.Context, token string) (*Identity, error) {
+		switch token {
+		case "good":
+			return &Identity{Subject: "alice"}, nil
+		case "expired":
+			return nil, ErrTokenExpired
+		case "denied":
+			return nil, status.Error(codes.PermissionDenied, "denied by verifier")
+		}
+		return nil, errors.New("unknown token")
+	})
+	unary := UnaryServerInterceptor(v)
+	stream := StreamServerInterceptor(v)
+
+	tests := []struct {
+		name     string
+		md       metadata.MD // nil - запрос без метаданных
+		wantCode codes.Code
+		wantMsg  string
+	}{
+		{name: "valid", md: metadata.Pairs(AuthorizationHeader, "Bearer good"), wantCode: codes.OK},
+		{name: "scheme in other case", md: metadata.Pairs(AuthorizationHeader, "bearer  good "), wantCode: codes.OK},
+		{name: "second header value", md: metadata.Pairs(AuthorizationHeader, "Basic Zm9v", AuthorizationHeader, "Bearer good"), wantCode: codes.OK},
+		{name: "no metadata", wantCode: codes.Unauthenticated, wantMsg: ErrMissingToken.Error()},
+		{name: "no header", md: metadata.Pairs("x-client-id", "admin"), wantCode: codes.Unauthenticated, wantMsg: ErrMissingToken.Error()},
+		{name: "other scheme", md: metadata.Pairs(AuthorizationHeader, "Basic Zm9vOmJhcg=="), wantCode: codes.Unauthenticated, wantMsg: ErrMissingToken.Error()},
+		{name: "scheme without token", md: metadata.Pairs(AuthorizationHeader, "Bearer "), wantCode: codes.Unauthenticated, wantMsg: ErrMissingToken.Error()},
+		{name: "token without scheme", md: metadata.Pairs(AuthorizationHeader, "good"), wantCode: codes.Unauthenticated, wantMsg: ErrMissingToken.Error()},
+		{name: "invalid token", md: metadata.Pairs(AuthorizationHeader, "Bearer bad"), wantCode: codes.Unauthenticated, wantMsg: ErrInvalidToken.Error()},
+		{name: "expired token", md: metadata.Pairs(AuthorizationHeader, "Bearer expired"), wantCode: codes.Unauthenticated, wantMsg: ErrTokenExpired.Error()},
+		{name: "verifier status", md: metadata.Pairs(AuthorizationHeader, "Bearer denied"), wantCode: codes.PermissionDenied, wantMsg: "denied by verifier"},
+	}
+	for _, tt := range tests {
+		ctx := context.Background()
+		if tt.md != nil {
+			ctx = metadata.NewIncomingContext(ctx, tt.md)
+		}
+		check := func(t *testing.T, err error, handlerCtx context.Context) {
+			t.Helper()
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v (%v), want %v", got, err, tt.wantCode)
+			}
+			if tt.wantCode != codes.OK {
+				if s, _ := status.FromError(err); s.Message() != tt.wantMsg {
+					t.Fatalf("message = %q, want %q", s.Message(), tt.wantMsg)
+				}
+				if handlerCtx != nil {
+					t.Fatal("handler called for rejected request")
+				}
+				return
+			}
+			if id, ok := FromContext(handlerCtx); !ok || id.Subject != "alice" {
+				t.Fatalf("handler identity = %+v, want alice", id)
+			}
+		}
+
+		t.Run("unary/"+tt.name, func(t *testing.T) {
+			var handlerCtx context.Context
+			_, err := unary(ctx, nil, &grpc.UnaryServerInfo{FullMethod: "/test/Unary"}, func(ctx context.Context, _ any) (any, error) {
+				handlerCtx = ctx
+				return nil, nil
+			})
+			check(t, err, handlerCtx)
+		})
+		t.Run("stream/"+tt.name, func(t *testing.T) {
+			var handlerCtx context.Context
+			err := stream(nil, &testStream{ctx: ctx}, &grpc.StreamServerInfo{FullMethod: "/test/Stream"}, func(_ any, ss grpc.ServerStream) error {
+				handlerCtx = ss.Context()
+				return nil
+			})
+			check(t, err, handlerCtx)
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AuthorizationHeader заголовок метаданных с токеном вида "Bearer <token>"
+const AuthorizationHeader = "authorization"
+
+const bearerScheme = "bearer "
+
+// UnaryServerInterceptor проверяет токен перед обработкой unary-запроса
+func UnaryServerInterceptor(v Verifier) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := authenticate(ctx, v, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor проверяет токен перед обработкой потока
+func StreamServerInterceptor(v Verifier) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), v, info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &authStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// authStream подменяет контекст потока на контекст с владельцем токена
+type authStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate достает токен из метаданных и проверяет его
+func authenticate(ctx context.Context, v Verifier, method string) (context.Context, error) {
+	const op = "server.auth.authenticate"
+
+	token, ok := bearerToken(ctx)
+	if !ok {
+		log.Printf("%s: %s: %v", op, method, ErrMissingToken)
+		return nil, status.Error(codes.Unauthenticated, ErrMissingToken.Error())
+	}
+
+	id, err := v.Verify(ctx, token)
+	if err != nil {
+		log.Printf("%s: %s: token rejected: %v", op, method, err)
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		if errors.Is(err, ErrTokenExpired) {
+			return nil, status.Error(codes.Unauthenticated, ErrTokenExpired.Error())
+		}
+		return nil, status.Error(codes.Unauthenticated, ErrInvalidToken.Error())
+	}
+	return NewContext(ctx, id), nil
+}
+
+// bearerToken возвращает токен из заголовка authorization
+func bearerToken(ctx context.Context) (string, bool) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", false
+	}
+	for _, value := range md.Get(AuthorizationHeader) {
+		if len(value) > len(bearerScheme) && strings.EqualFold(value[:len(bearerScheme)], bearerScheme) {
+			if token := strings.TrimSpace(value[len(bearerScheme):]); token != "" {
+				return token, true
+			}
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+// jwtLeeway допустимое расхождение часов при проверке exp и nbf
+const jwtLeeway = time.Minute
+
+// jwtAlgorithms поддерживаемые алгоритмы подписи
+var jwtAlgorithms = map[string]func() hash.Hash{
+	"HS256": sha256.New,
+	"HS384": sha512.New384,
+	"HS512": sha512.New,
+}
+
+// JWTVerifier проверяет JWT, подписанные общим секретом (HS256, HS384, HS512)
+type JWTVerifier struct {
+	secret   []byte
+	issuer   string // пусто - не проверяется
+	audience string // пусто - не проверяется
+}
+
+// NewJWTVerifier читает секрет из файла. Пробельные символы по краям секрета отбрасываются
+func NewJWTVerifier(secretFile, issuer, audience string) (*JWTVerifier, error) {
+	data, err := os.ReadFile(secretFile)
+	if err != nil {
+		return nil, err
+	}
+	secret := bytes.TrimSpace(data)
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("jwt secret must be at least 32 bytes")
+	}
+	return &JWTVerifier{secret: secret, issuer: issuer, audience: audience}, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+}
+
+type jwtClaims struct {
+	Subject   string       `json:"sub"`
+	Issuer    string       `json:"iss"`
+	Audience  jwtAudience  `json:"aud"`
+	ExpiresAt *json.Number `json:"exp"`
+	NotBefore *json.Number `json:"nbf"`
+	Groups    []string     `json:"groups"`
+}
+
+// jwtAudience поле aud, которое может быть строкой или массивом строк
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var one string
+	if err := json.Unmarshal(data, &one); err == nil {
+		*a = jwtAudience{one}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return err
+	}
+	*a = many
+	return nil
+}
+
+// Verify проверяет подпись, срок действия, издателя и получателя токена.
+// Поле exp обязательно, владелец токена берется из sub, группы - из groups
+func (v *JWTVerifier) Verify(_ context.Context, token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed jwt", ErrInvalidToken)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	newHash, ok := jwtAlgorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	mac := hmac.New(newHash, v.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	if err := v.validate(&claims); err != nil {
+		return nil, err
+	}
+	return &Identity{Subject: claims.Subject, Groups: claims.Groups}, nil
+}
+
+// validate проверяет поля токена после проверки подписи
+func (v *JWTVerifier) validate(claims *jwtClaims) error {
+	now := time.Now()
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: missing sub", ErrInvalidToken)
+	}
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing exp", ErrInvalidToken)
+	}
+	exp, err := numericDate(*claims.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("%w: exp: %v", ErrInvalidToken, err)
+	}
+	if now.After(exp.Add(jwtLeeway)) {
+		return ErrTokenExpired
+	}
+	if claims.NotBefore != nil {
+		nbf, err := numericDate(*claims.NotBefore)
+		if err != nil {
+			return fmt.Errorf("%w: nbf: %v", ErrInvalidToken, err)
+		}
+		if now.Add(jwtLeeway).Before(nbf) {
+			return fmt.Errorf("%w: token is not valid yet", ErrInvalidToken)
+		}
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected issuer %q", ErrInvalidToken, claims.Issuer)
+	}
+	if v.audience != "" && !slices.Contains(claims.Audience, v.audience) {
+		return fmt.Errorf("%w: token is not intended for %q", ErrInvalidToken, v.audience)
+	}
+	return nil
+}
+
+// decodeSegment декодирует часть JWT в base64url без дополнения
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+// numericDate переводит NumericDate (секунды от начала эпохи, возможно дробные) во время
+func numericDate(n json.Number) (time.Time, error) {
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*1e9)), nil
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// tokenFile формат файла со статическими токенами
+type tokenFile struct {
+	Tokens []struct {
+		Token   string   `yaml:"token"`
+		Subject string   `yaml:"subject"`
+		Groups  []string `yaml:"groups"`
+	} `yaml:"tokens"`
+}
+
+// placeholderTokens токены-заглушки из примеров, с ними сервер не запускается
+var placeholderTokens = []string{"change-me", "changeme", "token", "secret"}
+
+// StaticVerifier проверяет токены по списку из файла
+type StaticVerifier struct {
+	tokens map[[sha256.Size]byte]*Identity // ключ - хэш токена
+}
+
+// NewStaticVerifier загружает токены из YAML-файла
+func NewStaticVerifier(path string) (*StaticVerifier, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file tokenFile
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parse token file: %w", err)
+	}
+
+	v := &StaticVerifier{tokens: make(map[[sha256.Size]byte]*Identity, len(file.Tokens))}
+	for i, t := range file.Tokens {
+		if t.Token == "" || t.Subject == "" {
+			return nil, fmt.Errorf("token file: entry %d: token and subject are required", i)
+		}
+		if slices.ContainsFunc(placeholderTokens, func(p string) bool { return strings.EqualFold(t.Token, p) }) {
+			return nil, fmt.Errorf("token file: entry %d: placeholder token %q, generate a random one", i, t.Token)
+		}
+		key := sha256.Sum256([]byte(t.Token))
+		if _, ok := v.tokens[key]; ok {
+			return nil, fmt.Errorf("token file: entry %d: duplicate token", i)
+		}
+		v.tokens[key] = &Identity{Subject: t.Subject, Groups: t.Groups}
+	}
+	return v, nil
+}
+
+// Verify ищет токен в списке
+func (v *StaticVerifier) Verify(_ context.Context, token string) (*Identity, error) {
+	id, ok := v.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+	return id, nil
+}
@@ -1,11 +1,43 @@
 package config
 
 import (
+	"fmt"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
 	"gopkg.in/yaml.v3"
 	"log"
 	"os"
+	"path/filepath"
+	"time"
 )
 
+// Способы проверки токенов
+const (
+	AuthStatic = "static" // список токенов из token_file
+	AuthJWT    = "jwt"    // JWT, подписанные секретом из jwt.secret_file
+)
+
+// Хранилища файлов
+const (
+	StorageLocal  = "local"  // директория server_data_dir на диске
+	StorageMemory = "memory" // память процесса, данные теряются при остановке
+	StorageS3     = "s3"     // бакет S3-совместимого хранилища
+)
+
+// Политики при загрузке файла с уже существующим именем
+const (
+	ConflictOverwrite = "overwrite" // перезаписать файл
+	ConflictFail      = "fail"      // вернуть AlreadyExists
+	ConflictRename    = "rename"    // сохранить как "name (1).ext"
+)
+
+// QuotaLimits лимиты места в хранилище, 0 - без ограничения
+type QuotaLimits struct {
+	MaxBytes int64 `yaml:"max_bytes"`
+	MaxFiles int64 `yaml:"max_files"`
+}
+
 type ServerConfig struct {
 	Server struct {
 		Address string `yaml:"address"`
@@ -13,9 +45,138 @@ type ServerConfig struct {
 			UploadRequests   int `yaml:"upload_requests"`
 			DownloadRequests int `yaml:"download_requests"`
 			ListRequests     int `yaml:"list_requests"`
+			ManageRequests   int `yaml:"manage_requests"`
+			// MaxUploadBytes максимальный размер загружаемого файла, 0 - без ограничения
+			MaxUploadBytes int64 `yaml:"max_upload_bytes"`
+			// Rate скорость загрузок и скачиваний в байтах в секунду, 0 - без ограничения
+			Rate struct {
+				// Global на все передачи сервера вместе
+				Global int64 `yaml:"global"`
+				// PerClient на все передачи одного клиента (владельца токена, сертификата или client_id)
+				PerClient int64 `yaml:"per_client"`
+				// PerIP на все передачи с одного IP-адреса
+				PerIP int64 `yaml:"per_ip"`
+			} `yaml:"rate"`
 		} `yaml:"limits"`
+		// TLS шифрование соединений, при client_ca_file - проверка сертификатов клиентов (mTLS)
+		TLS struct {
+			Enabled  bool   `yaml:"enabled"`
+			CertFile string `yaml:"cert_file"`
+			KeyFile  string `yaml:"key_file"`
+			// ClientCAFile CA для проверки сертификатов клиентов
+			ClientCAFile string `yaml:"client_ca_file"`
+			// RequireClientCert отклонять клиентов без сертификата, требует client_ca_file
+			RequireClientCert bool `yaml:"require_client_cert"`
+			// ReloadInterval как часто проверять файлы сертификатов на изменение
+			ReloadInterval time.Duration `yaml:"reload_interval"`
+		} `yaml:"tls"`
 	} `yaml:"server"`
+	// Auth проверка bearer-токенов из метаданных запроса
+	Auth struct {
+		Enabled bool `yaml:"enabled"`
+		// Verifier способ проверки: static или jwt
+		Verifier string `yaml:"verifier"`
+		// TokenFile YAML-файл со списком токенов для static
+		TokenFile string `yaml:"token_file"`
+		JWT       struct {
+			SecretFile string `yaml:"secret_file"`
+			// Issuer и Audience ожидаемые iss и aud, пусто - не проверяются
+			Issuer   string `yaml:"issuer"`
+			Audience string `yaml:"audience"`
+		} `yaml:"jwt"`
+	} `yaml:"auth"`
+	// Access домашние директории клиентов и права доступа из файла политики
+	Access struct {
+		Enabled    bool   `yaml:"enabled"`
+		PolicyFile string `yaml:"policy_file"`
+	} `yaml:"access"`
+	// Quota лимиты места для всего сервера и для каждого клиента
+	Quota struct {
+		Enabled     bool        `yaml:"enabled"`
+		Global      QuotaLimits `yaml:"global"`
+		PerIdentity QuotaLimits `yaml:"per_identity"`
+		// Identities лимиты отдельных клиентов вместо per_identity
+		Identities map[string]QuotaLimits `yaml:"identities"`
+	} `yaml:"quota"`
+	// Storage хранилище файлов: local, memory или s3
+	Storage struct {
+		Backend string `yaml:"backend"`
+		S3      struct {
+			// Endpoint адрес хранилища host:port без схемы
+			Endpoint string `yaml:"endpoint"`
+			Region   string `yaml:"region"`
+			Bucket   string `yaml:"bucket"`
+			// Prefix префикс ключей объектов, пусто - корень бакета
+			Prefix string `yaml:"prefix"`
+			// AccessKeyID и SecretAccessKeyFile ключи доступа, без них ключи берутся
+			// из переменных окружения AWS_ACCESS_KEY_ID и AWS_SECRET_ACCESS_KEY
+			AccessKeyID         string `yaml:"access_key_id"`
+			SecretAccessKeyFile string `yaml:"secret_access_key_file"`
+			// DisableTLS подключаться по HTTP, например к локальному MinIO
+			DisableTLS bool `yaml:"disable_tls"`
+			// PathStyle адреса вида endpoint/bucket, нужны большинству хранилищ кроме AWS
+			PathStyle bool `yaml:"path_style"`
+			// PartSize размер части multipart-загрузки в байтах, не меньше 5 МиБ
+			PartSize int64 `yaml:"part_size"`
+			// MaxPartSize наибольший размер части в байтах для больших файлов. Часть лежит в памяти,
+			// в maxPartSize*10000 байт ограничен размер файла. По умолчанию 128 МиБ
+			MaxPartSize int64 `yaml:"max_part_size"`
+		} `yaml:"s3"`
+		// Dedup хранение файлов чанками: одинаковые части разных файлов хранятся один раз
+		Dedup struct {
+			Enabled bool `yaml:"enabled"`
+			// ChunkDir директория чанков для local. По умолчанию server_data_dir/.chunks,
+			// для s3 чанки лежат в бакете под prefix/.chunks
+			ChunkDir string `yaml:"chunk_dir"`
+			// Размеры чанков в байтах, avg_chunk_size - степень двойки
+			MinChunkSize int `yaml:"min_chunk_size"`
+			AvgChunkSize int `yaml:"avg_chunk_size"`
+			MaxChunkSize int `yaml:"max_chunk_size"`
+			// GCInterval как часто удалять чанки, на которые не ссылается ни один файл
+			GCInterval time.Duration `yaml:"gc_interval"`
+		} `yaml:"dedup"`
+	} `yaml:"storage"`
 	ServerDataDir string `yaml:"server_data_dir"`
+	// UploadStagingDir директория для незавершенных загрузок.
+	// По умолчанию server_data_dir/.staging
+	UploadStagingDir string `yaml:"upload_staging_dir"`
+	// UploadSessions сколько хранятся брошенные сессии загрузки
+	UploadSessions struct {
+		// TTL сессия без новых данных дольше удаляется вместе с принятыми данными
+		TTL time.Duration `yaml:"ttl"`
+		// SweepInterval как часто искать брошенные сессии
+		SweepInterval time.Duration `yaml:"sweep_interval"`
+	} `yaml:"upload_sessions"`
+	// OnConflict политика по умолчанию, если клиент ее не указал: overwrite, fail или rename
+	OnConflict string `yaml:"on_conflict"`
+	// Compression сжатие частей файла при передаче, алгоритм (gzip или zstd) предлагает клиент
+	Compression struct {
+		Enabled bool `yaml:"enabled"`
+		// GzipLevel от 1 до 9, ZstdLevel от 1 до 22, 0 - уровень по умолчанию
+		GzipLevel int `yaml:"gzip_level"`
+		ZstdLevel int `yaml:"zstd_level"`
+	} `yaml:"compression"`
+	// Transfer размер частей, на которые делится файл при скачивании, 0 - значение по умолчанию
+	Transfer struct {
+		ChunkSize int `yaml:"chunk_size"`
+		// Adaptive подбирать размер части по скорости отправки, от min_chunk_size до max_chunk_size
+		Adaptive     bool `yaml:"adaptive"`
+		MinChunkSize int  `yaml:"min_chunk_size"`
+		MaxChunkSize int  `yaml:"max_chunk_size"`
+	} `yaml:"transfer"`
+	// Versioning хранение предыдущих версий файлов
+	Versioning struct {
+		Enabled bool `yaml:"enabled"`
+		// Dir директория с версиями. По умолчанию server_data_dir/.versions
+		Dir string `yaml:"dir"`
+		// KeepLast сколько последних версий хранить, 0 - без ограничения.
+		// Версии не учитываются в квотах, их объем ограничивают только KeepLast и KeepDays
+		KeepLast int `yaml:"keep_last"`
+		// KeepDays сколько дней хранить версию, 0 - без ограничения
+		KeepDays int `yaml:"keep_days"`
+		// PruneInterval как часто удалять лишние версии
+		PruneInterval time.Duration `yaml:"prune_interval"`
+	} `yaml:"versioning"`
 }
 
 func LoadConfig(filePath string) (*ServerConfig, error) {
@@ -31,5 +192,145 @@ func LoadConfig(filePath string) (*ServerConfig, error) {
 		return nil, err
 	}
 
+	if config.UploadStagingDir == "" {
+		config.UploadStagingDir = filepath.Join(config.ServerDataDir, ".staging")
+	}
+
+	if config.UploadSessions.TTL <= 0 {
+		config.UploadSessions.TTL = 24 * time.Hour
+	}
+	if config.UploadSessions.SweepInterval <= 0 {
+		config.UploadSessions.SweepInterval = time.Hour
+	}
+
+	if config.Versioning.Dir == "" {
+		config.Versioning.Dir = filepath.Join(config.ServerDataDir, ".versions")
+	}
+	if config.Versioning.PruneInterval <= 0 {
+		config.Versioning.PruneInterval = time.Hour
+	}
+
+	if config.Server.Limits.MaxUploadBytes < 0 {
+		log.Printf("invalid max_upload_bytes value: %d", config.Server.Limits.MaxUploadBytes)
+		return nil, fmt.Errorf("invalid max_upload_bytes value: %d", config.Server.Limits.MaxUploadBytes)
+	}
+
+	if r := config.Server.Limits.Rate; r.Global < 0 || r.PerClient < 0 || r.PerIP < 0 {
+		log.Printf("invalid rate limit: global %d, per_client %d, per_ip %d", r.Global, r.PerClient, r.PerIP)
+		return nil, fmt.Errorf("invalid rate limit: global %d, per_client %d, per_ip %d", r.Global, r.PerClient, r.PerIP)
+	}
+
+	if tlsCfg := &config.Server.TLS; tlsCfg.Enabled {
+		if tlsCfg.CertFile == "" || tlsCfg.KeyFile == "" {
+			log.Printf("tls: cert_file and key_file are required")
+			return nil, fmt.Errorf("tls: cert_file and key_file are required")
+		}
+		if tlsCfg.RequireClientCert && tlsCfg.ClientCAFile == "" {
+			log.Printf("tls: require_client_cert needs client_ca_file")
+			return nil, fmt.Errorf("tls: require_client_cert needs client_ca_file")
+		}
+		if tlsCfg.ReloadInterval <= 0 {
+			tlsCfg.ReloadInterval = 30 * time.Second
+		}
+	}
+
+	if config.Auth.Enabled {
+		switch config.Auth.Verifier {
+		case AuthStatic, AuthJWT:
+		case "":
+			// Verifier передается в app.Run через app.WithVerifier
+		default:
+			log.Printf("invalid auth verifier: %q", config.Auth.Verifier)
+			return nil, fmt.Errorf("invalid auth verifier: %q", config.Auth.Verifier)
+		}
+	}
+
+	// Без токенов и mTLS клиент определяется по заголовку x-client-id, который подставляет сам
+	if config.Access.Enabled && !config.Auth.Enabled && !(config.Server.TLS.Enabled && config.Server.TLS.RequireClientCert) {
+		log.Printf("access: enabled needs auth or tls.require_client_cert")
+		return nil, fmt.Errorf("access: enabled needs auth or tls.require_client_cert")
+	}
+
+	switch config.Storage.Backend {
+	case "":
+		config.Storage.Backend = StorageLocal
+	case StorageLocal, StorageMemory:
+	case StorageS3:
+		s3Cfg := &config.Storage.S3
+		if s3Cfg.Endpoint == "" || s3Cfg.Bucket == "" {
+			log.Printf("storage.s3: endpoint and bucket are required")
+			return nil, fmt.Errorf("storage.s3: endpoint and bucket are required")
+		}
+		if s3Cfg.AccessKeyID != "" && s3Cfg.SecretAccessKeyFile == "" {
+			log.Printf("storage.s3: access_key_id needs secret_access_key_file")
+			return nil, fmt.Errorf("storage.s3: access_key_id needs secret_access_key_file")
+		}
+		if s3Cfg.PartSize == 0 {
+			s3Cfg.PartSize = storage.DefaultS3PartSize
+		}
+		if s3Cfg.PartSize < storage.MinS3PartSize {
+			log.Printf("storage.s3: part_size must be at least %d bytes", storage.MinS3PartSize)
+			return nil, fmt.Errorf("storage.s3: part_size must be at least %d bytes", storage.MinS3PartSize)
+		}
+		if s3Cfg.MaxPartSize == 0 {
+			s3Cfg.MaxPartSize = max(storage.DefaultS3MaxPartSize, s3Cfg.PartSize)
+		}
+		if s3Cfg.MaxPartSize < s3Cfg.PartSize || s3Cfg.MaxPartSize > storage.MaxS3PartSize {
+			log.Printf("storage.s3: max_part_size must be between part_size and %d bytes", storage.MaxS3PartSize)
+			return nil, fmt.Errorf("storage.s3: max_part_size must be between part_size and %d bytes", storage.MaxS3PartSize)
+		}
+	default:
+		log.Printf("invalid storage backend: %q", config.Storage.Backend)
+		return nil, fmt.Errorf("invalid storage backend: %q", config.Storage.Backend)
+	}
+
+	if dedup := &config.Storage.Dedup; dedup.Enabled {
+		if dedup.ChunkDir == "" {
+			dedup.ChunkDir = filepath.Join(config.ServerDataDir, ".chunks")
+		}
+		if dedup.MinChunkSize == 0 {
+			dedup.MinChunkSize = storage.DefaultMinChunkSize
+		}
+		if dedup.AvgChunkSize == 0 {
+			dedup.AvgChunkSize = storage.DefaultAvgChunkSize
+		}
+		if dedup.MaxChunkSize == 0 {
+			dedup.MaxChunkSize = storage.DefaultMaxChunkSize
+		}
+		if err = storage.ValidateChunkSizes(dedup.MinChunkSize, dedup.AvgChunkSize, dedup.MaxChunkSize); err != nil {
+			log.Printf("storage.dedup: %v", err)
+			return nil, fmt.Errorf("storage.dedup: %w", err)
+		}
+		if dedup.GCInterval <= 0 {
+			dedup.GCInterval = time.Hour
+		}
+	}
+
+	if c := &config.Compression; c.Enabled {
+		levels := compression.Levels{Gzip: c.GzipLevel, Zstd: c.ZstdLevel}
+		if err = levels.Validate(); err != nil {
+			log.Printf("compression: %v", err)
+			return nil, fmt.Errorf("compression: %w", err)
+		}
+		c.GzipLevel, c.ZstdLevel = levels.Gzip, levels.Zstd
+	}
+
+	t := &config.Transfer
+	chunks := transfer.Settings{Size: t.ChunkSize, Adaptive: t.Adaptive, Min: t.MinChunkSize, Max: t.MaxChunkSize}
+	if err = chunks.Validate(); err != nil {
+		log.Printf("transfer: %v", err)
+		return nil, fmt.Errorf("transfer: %w", err)
+	}
+	t.ChunkSize, t.MinChunkSize, t.MaxChunkSize = chunks.Size, chunks.Min, chunks.Max
+
+	switch config.OnConflict {
+	case "":
+		config.OnConflict = ConflictOverwrite
+	case ConflictOverwrite, ConflictFail, ConflictRename:
+	default:
+		log.Printf("invalid on_conflict value: %q", config.OnConflict)
+		return nil, fmt.Errorf("invalid on_conflict value: %q", config.OnConflict)
+	}
+
 	return &config, nil
 }
@@ -0,0 +1,100 @@
+package meta
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// Префикс расширенных атрибутов файла, в которых хранятся метаданные
+const attrPrefix = "user.filetransfer."
+
+const (
+	attrSHA256      = attrPrefix + "sha256"
+	attrUploader    = attrPrefix + "uploader"
+	attrContentType = attrPrefix + "content_type"
+	attrChunked     = attrPrefix + "chunked"
+)
+
+// SniffLen кол-во первых байт файла, по которым определяется тип содержимого
+const SniffLen = 512
+
+// defaultContentType тип содержимого, если его не удалось определить
+const defaultContentType = "application/octet-stream"
+
+var ErrUnsupported = errors.New("file metadata is not supported on this platform")
+
+// Meta метаданные файла, сохраненные при загрузке.
+// Хранятся в расширенных атрибутах файла и поэтому переживают
+// переименование и архивацию версий жесткой ссылкой.
+type Meta struct {
+	SHA256      []byte
+	Uploader    string
+	ContentType string
+	// Chunked содержимое файла - манифест хранилища с дедупликацией, а не данные.
+	// Ставит только хранилище с дедупликацией, по содержимому манифест не определяется
+	Chunked bool
+}
+
+// ContentType определяет тип содержимого по расширению имени name,
+// а если не вышло - по первым байтам файла path
+func ContentType(name, path string) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return defaultContentType
+	}
+	defer f.Close()
+	return FileContentType(name, f)
+}
+
+// FileContentType как ContentType, но читает начало уже открытого файла f
+func FileContentType(name string, f io.ReaderAt) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+
+	head := make([]byte, SniffLen)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return defaultContentType
+	}
+	return DetectContentType(name, head[:n])
+}
+
+// DetectContentType определяет тип содержимого по расширению имени name,
+// а если не вышло - по первым SniffLen байтам файла head
+func DetectContentType(name string, head []byte) string {
+	if ct := mime.TypeByExtension(filepath.Ext(name)); ct != "" {
+		return ct
+	}
+	if len(head) == 0 {
+		return defaultContentType
+	}
+	return http.DetectContentType(head)
+}
+
+// CheckSupport проверяет, что файловая система директории dir хранит метаданные файлов
+func CheckSupport(dir string) error {
+	f, err := os.CreateTemp(dir, ".meta-check.*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if err = f.Close(); err != nil {
+		return err
+	}
+	if err = Write(f.Name(), Meta{Chunked: true}); err != nil {
+		return err
+	}
+	if !Read(f.Name()).Chunked {
+		return ErrUnsupported
+	}
+	return nil
+}
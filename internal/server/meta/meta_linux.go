@@ -0,0 +1,106 @@
+//go:build linux
+
+package meta
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// Write сохраняет метаданные в расширенных атрибутах файла
+func Write(path string, m Meta) error {
+	return write(m, func(name string, value []byte) error {
+		return unix.Lsetxattr(path, name, value, 0)
+	})
+}
+
+// WriteFile как Write, но для открытого файла f
+func WriteFile(f *os.File, m Meta) error {
+	return write(m, func(name string, value []byte) error {
+		return unix.Fsetxattr(int(f.Fd()), name, value, 0)
+	})
+}
+
+func write(m Meta, set func(name string, value []byte) error) error {
+	attrs := map[string][]byte{
+		attrSHA256:      m.SHA256,
+		attrUploader:    []byte(m.Uploader),
+		attrContentType: []byte(m.ContentType),
+	}
+	if m.Chunked {
+		attrs[attrChunked] = []byte("1")
+	}
+	for name, value := range attrs {
+		if len(value) == 0 {
+			continue
+		}
+		if err := set(name, value); err != nil {
+			if errors.Is(err, unix.ENOTSUP) {
+				return ErrUnsupported
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Read читает метаданные файла. Отсутствующие атрибуты остаются пустыми.
+func Read(path string) Meta {
+	return read(func(name string, buf []byte) (int, error) {
+		return unix.Lgetxattr(path, name, buf)
+	})
+}
+
+// ReadFile как Read, но для открытого файла f
+func ReadFile(f *os.File) Meta {
+	return read(func(name string, buf []byte) (int, error) {
+		return unix.Fgetxattr(int(f.Fd()), name, buf)
+	})
+}
+
+func read(get func(name string, buf []byte) (int, error)) Meta {
+	return Meta{
+		SHA256:      getAttr(get, attrSHA256),
+		Uploader:    string(getAttr(get, attrUploader)),
+		ContentType: string(getAttr(get, attrContentType)),
+		Chunked:     string(getAttr(get, attrChunked)) == "1",
+	}
+}
+
+// BirthTime возвращает время создания файла, если файловая система его хранит
+func BirthTime(path string) (time.Time, bool) {
+	return birthTime(unix.AT_FDCWD, path, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// FileBirthTime как BirthTime, но для открытого файла f
+func FileBirthTime(f *os.File) (time.Time, bool) {
+	return birthTime(int(f.Fd()), "", unix.AT_EMPTY_PATH)
+}
+
+func birthTime(dirfd int, path string, flags int) (time.Time, bool) {
+	var stx unix.Statx_t
+	err := unix.Statx(dirfd, path, flags, unix.STATX_BTIME, &stx)
+	if err != nil || stx.Mask&unix.STATX_BTIME == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(stx.Btime.Sec, int64(stx.Btime.Nsec)), true
+}
+
+func getAttr(get func(name string, buf []byte) (int, error), name string) []byte {
+	buf := make([]byte, 256)
+	n, err := get(name, buf)
+	if errors.Is(err, unix.ERANGE) {
+		if n, err = get(name, nil); err != nil {
+			return nil
+		}
+		buf = make([]byte, n)
+		n, err = get(name, buf)
+	}
+	if err != nil {
+		return nil
+	}
+	return buf[:n]
+}
@@ -0,0 +1,101 @@
+//go:build linux
+
+package meta
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Метаданные переживают переименование и жесткую ссылку, длинные значения читаются целиком
+func TestWriteRead(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	if err := os.WriteFile(path, []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if m := Read(path); m.SHA256 != nil || m.Uploader != "" || m.ContentType != "" {
+		t.Fatalf("Read without metadata = %+v, want empty", m)
+	}
+
+	want := Meta{SHA256: bytes.Repeat([]byte{0xab}, 32), Uploader: strings.Repeat("алиса", 40), ContentType: "text/plain", Chunked: true}
+	if err := Write(path, want); errors.Is(err, ErrUnsupported) {
+		t.Skip("file system does not support extended attributes")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := filepath.Join(dir, "b.txt")
+	if err := os.Rename(path, renamed); err != nil {
+		t.Fatal(err)
+	}
+	linked := filepath.Join(dir, "c.txt")
+	if err := os.Link(renamed, linked); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{renamed, linked} {
+		got := Read(p)
+		if !bytes.Equal(got.SHA256, want.SHA256) || got.Uploader != want.Uploader || got.ContentType != want.ContentType || !got.Chunked {
+			t.Errorf("Read(%s) = %+v, want %+v", filepath.Base(p), got, want)
+		}
+	}
+
+	// пустые поля не затирают записанные
+	if err := Write(renamed, Meta{ContentType: "application/json"}); err != nil {
+		t.Fatal(err)
+	}
+	if got := Read(renamed); got.Uploader != want.Uploader || got.ContentType != "application/json" {
+		t.Errorf("Read after partial Write = %+v, want uploader kept and new content type", got)
+	}
+}
+
+func TestBirthTime(t *testing.T) {
+	before := time.Now().Add(-time.Second)
+	path := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(path, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now().Add(time.Second)
+
+	birth, ok := BirthTime(path)
+	if !ok {
+		t.Skip("file system does not report birth time")
+	}
+	if birth.Before(before) || birth.After(after) {
+		t.Errorf("BirthTime = %v, want between %v and %v", birth, before, after)
+	}
+
+	// изменение файла не меняет время создания
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := BirthTime(path); !got.Equal(birth) {
+		t.Errorf("BirthTime after Chtimes = %v, want %v", got, birth)
+	}
+
+	if _, ok = BirthTime(filepath.Join(t.TempDir(), "missing")); ok {
+		t.Error("BirthTime of missing file reported ok")
+	}
+}
+
+func TestCheckSupport(t *testing.T) {
+	dir := t.TempDir()
+	if err := CheckSupport(dir); errors.Is(err, ErrUnsupported) {
+		t.Skip("file system does not support extended attributes")
+	} else if err != nil {
+		t.Fatal(err)
+	}
+	// проверочный файл удаляется
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 0 {
+		t.Errorf("dir after CheckSupport = %v, %v, want empty", entries, err)
+	}
+	if err := CheckSupport(filepath.Join(dir, "missing")); err == nil {
+		t.Error("CheckSupport of missing dir succeeded")
+	}
+}
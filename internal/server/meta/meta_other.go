@@ -0,0 +1,38 @@
+//go:build !linux
+
+package meta
+
+import (
+	"os"
+	"time"
+)
+
+// Write сохраняет метаданные файла. На этой платформе не поддерживается.
+func Write(path string, m Meta) error {
+	return ErrUnsupported
+}
+
+// WriteFile как Write, но для открытого файла f
+func WriteFile(f *os.File, m Meta) error {
+	return ErrUnsupported
+}
+
+// Read читает метаданные файла. На этой платформе метаданные не хранятся.
+func Read(path string) Meta {
+	return Meta{}
+}
+
+// ReadFile как Read, но для открытого файла f
+func ReadFile(f *os.File) Meta {
+	return Meta{}
+}
+
+// BirthTime возвращает время создания файла. На этой платформе недоступно.
+func BirthTime(path string) (time.Time, bool) {
+	return time.Time{}, false
+}
+
+// FileBirthTime как BirthTime, но для открытого файла f
+func FileBirthTime(f *os.File) (time.Time, bool) {
+	return time.Time{}, false
+}
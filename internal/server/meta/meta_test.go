@@ -0,0 +1,50 @@
+package meta
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestContentType(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	png := "\x89PNG\r\n\x1a\n" + strings.Repeat("\x00", 16)
+
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{name: "report.json", path: write("a", "not json"), want: "application/json"},
+		{name: "photo.PNG", path: write("b", "text"), want: "image/png"},
+		{name: "noext", path: write("c", png), want: "image/png"},
+		{name: "notes", path: write("d", "plain text"), want: "text/plain; charset=utf-8"},
+		{name: "empty", path: write("e", ""), want: defaultContentType},
+		{name: "missing", path: filepath.Join(dir, "missing"), want: defaultContentType},
+		{name: "unknown.zzz", path: write("f", png), want: "image/png"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ContentType(tt.name, tt.path); got != tt.want {
+				t.Errorf("ContentType(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+
+	// по первым байтам без файла, как при загрузке в S3
+	if got := DetectContentType("noext", []byte(png)); got != "image/png" {
+		t.Errorf("DetectContentType = %q, want image/png", got)
+	}
+	if got := DetectContentType("noext", nil); got != defaultContentType {
+		t.Errorf("DetectContentType of empty head = %q, want %q", got, defaultContentType)
+	}
+}
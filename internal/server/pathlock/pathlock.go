@@ -0,0 +1,210 @@
+package pathlock
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// Manager блокировки путей хранилища на чтение и запись. Блокировка пути
+// распространяется на все, что внутри него: запись в директорию (удаление,
+// переименование) ждет все блокировки файлов в ней и наоборот.
+// Блокировки разных файлов друг другу не мешают. Ожидающая запись имеет приоритет:
+// новые блокировки на чтение ее пути ждут, пока она не выполнится, поэтому
+// поток скачиваний не может бесконечно откладывать загрузку файла
+type Manager struct {
+	mu      sync.Mutex
+	nodes   map[string]*node // по пути, только пути с блокировками и их родительские
+	changed chan struct{}    // закрывается при каждом освобождении блокировки
+}
+
+type node struct {
+	readers, writers       int // блокировки самого пути
+	subReaders, subWriters int // блокировки путей внутри него
+	waiting, subWaiting    int // ожидающие блокировки на запись самого пути и путей внутри него
+}
+
+// Unlock освобождает взятую блокировку
+type Unlock func()
+
+// New возвращает Manager без блокировок
+func New() *Manager {
+	return &Manager{nodes: make(map[string]*node), changed: make(chan struct{})}
+}
+
+// Lock блокирует пути names на запись. Пути блокируются все сразу, поэтому
+// взаимная блокировка двух запросов с одинаковыми путями невозможна.
+// Ждет, пока блокировки не станут свободны или не будет отменен ctx
+func (m *Manager) Lock(ctx context.Context, names ...string) (Unlock, error) {
+	return m.acquire(ctx, true, names)
+}
+
+// RLock блокирует путь name на чтение. Одновременных читателей может быть сколько угодно
+func (m *Manager) RLock(ctx context.Context, name string) (Unlock, error) {
+	return m.acquire(ctx, false, []string{name})
+}
+
+// TryLock блокирует пути names на запись, только если они свободны, не дожидаясь
+func (m *Manager) TryLock(names ...string) (Unlock, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.free(true, names) {
+		return nil, false
+	}
+	return m.take(true, names), true
+}
+
+func (m *Manager) acquire(ctx context.Context, write bool, names []string) (Unlock, error) {
+	waiting := false
+	for {
+		m.mu.Lock()
+		if m.free(write, names) {
+			if waiting {
+				m.wait(names, -1)
+			}
+			unlock := m.take(write, names)
+			m.mu.Unlock()
+			return unlock, nil
+		}
+		// Запись встает в очередь, чтобы новые читатели ее пропустили
+		if write && !waiting {
+			m.wait(names, 1)
+			waiting = true
+		}
+		changed := m.changed
+		m.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			if waiting {
+				m.mu.Lock()
+				m.wait(names, -1)
+				m.broadcast()
+				m.mu.Unlock()
+			}
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// take берет блокировки names и возвращает функцию их освобождения. Вызывается под m.mu
+func (m *Manager) take(write bool, names []string) Unlock {
+	for _, name := range names {
+		m.update(name, write, 1)
+	}
+	var once sync.Once
+	return func() { once.Do(func() { m.release(write, names) }) }
+}
+
+func (m *Manager) release(write bool, names []string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range names {
+		m.update(name, write, -1)
+	}
+	m.broadcast()
+}
+
+// broadcast будит всех ожидающих блокировки. Вызывается под m.mu
+func (m *Manager) broadcast() {
+	close(m.changed)
+	m.changed = make(chan struct{})
+}
+
+// free проверяет, что пути можно заблокировать. Вызывается под m.mu
+func (m *Manager) free(write bool, names []string) bool {
+	for _, name := range names {
+		// Запись в родительскую директорию блокирует все внутри нее,
+		// ожидающая запись - новых читателей
+		for _, parent := range parents(name) {
+			if n := m.nodes[parent]; n != nil && (n.writers > 0 || !write && n.waiting > 0) {
+				return false
+			}
+		}
+		n := m.nodes[name]
+		if n == nil {
+			continue
+		}
+		if n.writers > 0 || n.subWriters > 0 {
+			return false
+		}
+		if write && (n.readers > 0 || n.subReaders > 0) {
+			return false
+		}
+		if !write && (n.waiting > 0 || n.subWaiting > 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// update учитывает взятие (delta 1) или освобождение (delta -1) блокировки пути name
+// в нем самом и в родительских директориях. Вызывается под m.mu
+func (m *Manager) update(name string, write bool, delta int) {
+	n := m.node(name)
+	if write {
+		n.writers += delta
+	} else {
+		n.readers += delta
+	}
+	m.drop(name, n)
+
+	for _, parent := range parents(name) {
+		p := m.node(parent)
+		if write {
+			p.subWriters += delta
+		} else {
+			p.subReaders += delta
+		}
+		m.drop(parent, p)
+	}
+}
+
+// wait учитывает постановку в очередь (delta 1) или выход из очереди (delta -1)
+// записи путей names. Вызывается под m.mu
+func (m *Manager) wait(names []string, delta int) {
+	for _, name := range names {
+		n := m.node(name)
+		n.waiting += delta
+		m.drop(name, n)
+
+		for _, parent := range parents(name) {
+			p := m.node(parent)
+			p.subWaiting += delta
+			m.drop(parent, p)
+		}
+	}
+}
+
+func (m *Manager) node(name string) *node {
+	n := m.nodes[name]
+	if n == nil {
+		n = &node{}
+		m.nodes[name] = n
+	}
+	return n
+}
+
+// drop удаляет узел без блокировок, чтобы карта не росла с кол-вом путей
+func (m *Manager) drop(name string, n *node) {
+	if *n == (node{}) {
+		delete(m.nodes, name)
+	}
+}
+
+// parents возвращает родительские директории name от ближайшей до корня ("")
+func parents(name string) []string {
+	if name == "" {
+		return nil
+	}
+	var dirs []string
+	for {
+		i := strings.LastIndexByte(name, '/')
+		if i < 0 {
+			return append(dirs, "")
+		}
+		name = name[:i]
+		dirs = append(dirs, name)
+	}
+}
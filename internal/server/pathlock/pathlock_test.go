@@ -0,0 +1,195 @@
+package pathlock
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// tryLock возвращает ошибку, если блокировку не удалось взять сразу
+func tryLock(m *Manager, write bool, names ...string) (Unlock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if write {
+		return m.Lock(ctx, names...)
+	}
+	return m.RLock(ctx, names[0])
+}
+
+func TestManager(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	unlockFile, err := m.Lock(ctx, "reports/2026/q3.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		write bool
+		paths []string
+		free  bool
+	}{
+		{name: "other file", write: true, paths: []string{"reports/2026/q4.csv"}, free: true},
+		{name: "same file", write: true, paths: []string{"reports/2026/q3.csv"}},
+		{name: "read same file", paths: []string{"reports/2026/q3.csv"}},
+		{name: "parent directory", write: true, paths: []string{"reports"}},
+		{name: "root", write: true, paths: []string{""}},
+		{name: "sibling directory", write: true, paths: []string{"images"}, free: true},
+		{name: "name with same prefix", write: true, paths: []string{"reports/2026/q3.csv.bak"}, free: true},
+		{name: "one of several paths", write: true, paths: []string{"a.txt", "reports/2026/q3.csv"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			unlock, err := tryLock(m, tt.write, tt.paths...)
+			if tt.free {
+				if err != nil {
+					t.Fatalf("lock %v: %v, want free", tt.paths, err)
+				}
+				unlock()
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("lock %v error = %v, want busy", tt.paths, err)
+			}
+		})
+	}
+
+	// Несколько путей не блокируются частично
+	unlock, err := tryLock(m, true, "a.txt")
+	if err != nil {
+		t.Fatalf("a.txt locked after failed Lock of several paths: %v", err)
+	}
+	unlock()
+
+	unlockFile()
+	unlockFile() // повторный вызов ничего не делает
+	if len(m.nodes) != 0 {
+		t.Errorf("nodes after unlock = %v, want none", m.nodes)
+	}
+}
+
+func TestReaders(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	unlock1, err := m.RLock(ctx, "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlock2, err := tryLock(m, false, "image.png")
+	if err != nil {
+		t.Fatalf("second reader: %v", err)
+	}
+	if _, err = tryLock(m, true, "image.png"); err == nil {
+		t.Fatal("writer got lock held by readers")
+	}
+
+	// Писатель получает блокировку, когда уходит последний читатель
+	locked := make(chan error, 1)
+	go func() {
+		unlock, err := m.Lock(ctx, "image.png")
+		if err == nil {
+			unlock()
+		}
+		locked <- err
+	}()
+	unlock1()
+	unlock2()
+	select {
+	case err = <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("writer still waiting after readers unlocked")
+	}
+}
+
+func TestWriterPriority(t *testing.T) {
+	m := New()
+	ctx := context.Background()
+
+	unlockReader, err := m.RLock(ctx, "reports/q3.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := make(chan error, 1)
+	go func() {
+		unlock, err := m.Lock(ctx, "reports/q3.csv")
+		if err == nil {
+			unlock()
+		}
+		locked <- err
+	}()
+	// Дожидаемся, пока запись встанет в очередь
+	for deadline := time.Now().Add(time.Second); ; {
+		m.mu.Lock()
+		n := m.nodes["reports/q3.csv"]
+		queued := n != nil && n.waiting > 0
+		m.mu.Unlock()
+		if queued {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("writer is not queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	// Новые читатели файла и записи внутри него ждут записи, другие файлы свободны
+	if _, err = tryLock(m, false, "reports/q3.csv"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("reader error = %v, want to wait for queued writer", err)
+	}
+	if _, err = tryLock(m, false, "reports"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("directory reader error = %v, want to wait for queued writer", err)
+	}
+	unlock, err := tryLock(m, false, "reports/q4.csv")
+	if err != nil {
+		t.Fatalf("reader of other file: %v", err)
+	}
+	unlock()
+
+	unlockReader()
+	select {
+	case err = <-locked:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("writer still waiting after reader unlocked")
+	}
+
+	// Отмененная запись уходит из очереди и не мешает читателям
+	unlockReader, err = m.RLock(ctx, "a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tryLock(m, true, "a.txt"); err == nil {
+		t.Fatal("writer got lock held by reader")
+	}
+	unlock, err = tryLock(m, false, "a.txt")
+	if err != nil {
+		t.Fatalf("reader after canceled writer: %v", err)
+	}
+	unlock()
+	unlockReader()
+	if len(m.nodes) != 0 {
+		t.Errorf("nodes after unlock = %v, want none", m.nodes)
+	}
+}
+
+func TestParents(t *testing.T) {
+	got := parents("a/b/c.txt")
+	want := []string{"a/b", "a", ""}
+	if len(got) != len(want) {
+		t.Fatalf("parents = %q, want %q", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("parents = %q, want %q", got, want)
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+)
+
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Limits ограничения на объем и кол-во файлов, 0 - без ограничения
+type Limits struct {
+	MaxBytes int64 `yaml:"max_bytes"`
+	MaxFiles int64 `yaml:"max_files"`
+}
+
+// Usage занятое место: сохраненные файлы и загрузки, которые еще идут
+type Usage struct {
+	Bytes int64
+	Files int64
+}
+
+// Tracker считает занятое место по всему серверу и по клиентам. Учитываются только текущие файлы:
+// версии файлов ограничивают правила хранения versioning, а не квоты
+type Tracker struct {
+	global      Limits
+	perIdentity Limits
+	identities  map[string]Limits // лимиты отдельных клиентов вместо perIdentity
+
+	mu    sync.Mutex
+	total Usage
+	used  map[string]Usage
+}
+
+// NewTracker возвращает пустой Tracker
+func NewTracker(global, perIdentity Limits, identities map[string]Limits) *Tracker {
+	return &Tracker{
+		global:      global,
+		perIdentity: perIdentity,
+		identities:  identities,
+		used:        make(map[string]Usage),
+	}
+}
+
+// Scan учитывает файлы, уже лежащие в хранилище. Файл учитывается за клиентом, загрузившим его
+func (t *Tracker) Scan(ctx context.Context, st storage.Storage) error {
+	return storage.Walk(ctx, st, "", func(info storage.Info) error {
+		if info.IsDir {
+			return nil
+		}
+		info, err := storage.WithMeta(ctx, st, info)
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil // файл удалили во время обхода
+		}
+		if err != nil {
+			return err
+		}
+		t.Add(info.Meta.Uploader, info.Size, 1)
+		return nil
+	})
+}
+
+// Add изменяет занятое клиентом место, отрицательные значения освобождают его
+func (t *Tracker) Add(identity string, bytes, files int64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.add(identity, bytes, files)
+}
+
+func (t *Tracker) add(identity string, bytes, files int64) {
+	t.total.Bytes += bytes
+	t.total.Files += files
+	u := t.used[identity]
+	u.Bytes += bytes
+	u.Files += files
+	if u == (Usage{}) {
+		delete(t.used, identity)
+		return
+	}
+	t.used[identity] = u
+}
+
+// Limits возвращает лимиты клиента
+func (t *Tracker) Limits(identity string) Limits {
+	if l, ok := t.identities[identity]; ok {
+		return l
+	}
+	return t.perIdentity
+}
+
+// Usage возвращает занятое клиентом место и его лимиты, занятое на сервере место и лимиты сервера
+func (t *Tracker) Usage(identity string) (Usage, Limits, Usage, Limits) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.used[identity], t.Limits(identity), t.total, t.global
+}
+
+// check проверяет, что после добавления bytes и files лимиты не будут превышены. Вызывается под t.mu
+func (t *Tracker) check(identity string, bytes, files int64) error {
+	if err := exceeds("server", t.total, t.global, bytes, files); err != nil {
+		return err
+	}
+	return exceeds("client "+identity, t.used[identity], t.Limits(identity), bytes, files)
+}
+
+func exceeds(who string, u Usage, l Limits, bytes, files int64) error {
+	if l.MaxBytes > 0 && u.Bytes+bytes > l.MaxBytes {
+		return fmt.Errorf("%w: %s storage limit is %d bytes, %d used", ErrQuotaExceeded, who, l.MaxBytes, u.Bytes)
+	}
+	if l.MaxFiles > 0 && u.Files+files > l.MaxFiles {
+		return fmt.Errorf("%w: %s file limit is %d, %d used", ErrQuotaExceeded, who, l.MaxFiles, u.Files)
+	}
+	return nil
+}
+
+// Reserve резервирует место под загрузку: bytes - заявленный размер или уже принятые данные,
+// newFile - у клиента появится файл, а не заменит его же файл. Резерв учитывается в занятом месте
+// до Commit или Release
+func (t *Tracker) Reserve(identity string, bytes int64, newFile bool) (*Reservation, error) {
+	var files int64
+	if newFile {
+		files = 1
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := t.check(identity, bytes, files); err != nil {
+		return nil, err
+	}
+	t.add(identity, bytes, files)
+	return &Reservation{t: t, identity: identity, bytes: bytes, files: files}, nil
+}
+
+// Reservation место, зарезервированное под одну загрузку. Методы допускают nil - квоты отключены
+type Reservation struct {
+	t        *Tracker
+	identity string
+	bytes    int64
+	files    int64
+	done     bool
+}
+
+// Grow увеличивает резерв до size байт, если загрузка оказалась больше заявленного размера
+func (r *Reservation) Grow(size int64) error {
+	if r == nil || size <= r.bytes {
+		return nil
+	}
+
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	if err := r.t.check(r.identity, size-r.bytes, 0); err != nil {
+		return err
+	}
+	r.t.add(r.identity, size-r.bytes, 0)
+	r.bytes = size
+	return nil
+}
+
+// Settle пересчитывает файл резерва по итогу загрузки, когда известно, какой файл она заменит:
+// replaced - заменит файл клиента owner. Новым файлом не считается только замена своего файла.
+// Загрузка могла сохраниться под другим именем или заменить файл другого клиента, поэтому
+// прежняя оценка Reserve не годится. Возвращает ErrQuotaExceeded, если новый файл не помещается в лимит
+func (r *Reservation) Settle(replaced bool, owner string) error {
+	if r == nil {
+		return nil
+	}
+	var files int64
+	if !replaced || owner != r.identity {
+		files = 1
+	}
+
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	if r.done || files == r.files {
+		return nil
+	}
+	if files > r.files {
+		if err := r.t.check(r.identity, 0, files-r.files); err != nil {
+			return err
+		}
+	}
+	r.t.add(r.identity, 0, files-r.files)
+	r.files = files
+	return nil
+}
+
+// Commit переводит резерв в занятое место сохраненного файла размером size.
+// Перед Commit кол-во файлов уточняется через Settle, место заменяемого файла
+// освобождает вызывающий через Add
+func (r *Reservation) Commit(size int64) {
+	if r == nil {
+		return
+	}
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.t.add(r.identity, size-r.bytes, 1-r.files)
+	r.done = true
+}
+
+// Release освобождает резерв незавершенной загрузки, после Commit ничего не делает
+func (r *Reservation) Release() {
+	if r == nil {
+		return
+	}
+	r.t.mu.Lock()
+	defer r.t.mu.Unlock()
+	if r.done {
+		return
+	}
+	r.t.add(r.identity, -r.bytes, -r.files)
+	r.done = true
+}
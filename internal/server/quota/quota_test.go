@@ -0,0 +1,125 @@
+package quota
+
+import (
+	"errors"
+	"testing"
+)
+
+// assertUsage проверяет занятое клиентом identity место
+func assertUsage(t *testing.T, tr *Tracker, identity string, want Usage) {
+	t.Helper()
+	if got, _, _, _ := tr.Usage(identity); got != want {
+		t.Fatalf("usage of %s = %+v, want %+v", identity, got, want)
+	}
+}
+
+func TestReservation(t *testing.T) {
+	tr := NewTracker(Limits{}, Limits{MaxBytes: 100, MaxFiles: 2}, nil)
+
+	r, err := tr.Reserve("alice", 60, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(t, tr, "alice", Usage{Bytes: 60, Files: 1})
+	if _, err = tr.Reserve("alice", 50, true); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("reserve over byte limit error = %v, want ErrQuotaExceeded", err)
+	}
+	// лимиты одного клиента не касаются другого
+	other, err := tr.Reserve("bob", 100, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Release()
+
+	if err = r.Grow(90); err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Grow(40); err != nil {
+		t.Fatal(err)
+	}
+	assertUsage(t, tr, "alice", Usage{Bytes: 90, Files: 1})
+	if err = r.Grow(101); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("grow over limit error = %v, want ErrQuotaExceeded", err)
+	}
+
+	// сохраненный файл меньше резерва
+	r.Commit(70)
+	assertUsage(t, tr, "alice", Usage{Bytes: 70, Files: 1})
+	r.Release()
+	r.Commit(10)
+	assertUsage(t, tr, "alice", Usage{Bytes: 70, Files: 1})
+
+	r, err = tr.Reserve("alice", 30, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Release()
+	r.Release()
+	assertUsage(t, tr, "alice", Usage{Bytes: 70, Files: 1})
+	assertUsage(t, tr, "bob", Usage{})
+
+	// без квот резерв nil
+	var none *Reservation
+	if err = none.Grow(1); err != nil {
+		t.Fatal(err)
+	}
+	if err = none.Settle(false, ""); err != nil {
+		t.Fatal(err)
+	}
+	none.Commit(1)
+	none.Release()
+}
+
+func TestSettle(t *testing.T) {
+	tests := []struct {
+		name     string
+		newFile  bool   // оценка Reserve
+		replaced bool   // загрузка заменит файл размером 7
+		owner    string // владелец заменяемого файла
+		settled  Usage  // место alice до сохранения файла
+	}{
+		{name: "new file", newFile: true, settled: Usage{Bytes: 10, Files: 1}},
+		{name: "own file", replaced: true, owner: "alice", settled: Usage{Bytes: 17, Files: 1}},
+		// файл alice удалили или загрузку сохранили под другим именем
+		{name: "own file gone", settled: Usage{Bytes: 10, Files: 1}},
+		{name: "file of another client", replaced: true, owner: "bob", settled: Usage{Bytes: 10, Files: 1}},
+		{name: "own file appeared", newFile: true, replaced: true, owner: "alice", settled: Usage{Bytes: 17, Files: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewTracker(Limits{}, Limits{}, nil)
+			r, err := tr.Reserve("alice", 10, tt.newFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.replaced {
+				tr.Add(tt.owner, 7, 1)
+			}
+			if err = r.Settle(tt.replaced, tt.owner); err != nil {
+				t.Fatal(err)
+			}
+			assertUsage(t, tr, "alice", tt.settled)
+
+			// заменяемый файл освобождает вызывающий
+			if tt.replaced {
+				tr.Add(tt.owner, -7, -1)
+			}
+			r.Commit(10)
+			assertUsage(t, tr, "alice", Usage{Bytes: 10, Files: 1})
+			assertUsage(t, tr, "bob", Usage{})
+		})
+	}
+
+	// новый файл не помещается в лимит файлов
+	tr := NewTracker(Limits{}, Limits{MaxFiles: 1}, nil)
+	tr.Add("alice", 5, 1)
+	r, err := tr.Reserve("alice", 10, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Settle(true, "bob"); !errors.Is(err, ErrQuotaExceeded) {
+		t.Fatalf("settle over file limit error = %v, want ErrQuotaExceeded", err)
+	}
+	r.Release()
+	assertUsage(t, tr, "alice", Usage{Bytes: 5, Files: 1})
+}
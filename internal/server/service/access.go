@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"path"
+	"strings"
+
+	"github.com/RVodassa/FileTransfer/internal/server/access"
+	"github.com/RVodassa/FileTransfer/internal/server/auth"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrPermissionDenied = errors.New("permission denied")
+var ErrUnverifiedIdentity = errors.New("client identity is not verified by a token or certificate")
+
+// caller клиент запроса и видимая ему часть хранилища
+type caller struct {
+	identity string
+	groups   []string
+	home     string // домашняя директория от корня хранилища, пусто - все хранилище
+}
+
+// caller определяет клиента запроса. Домашняя директория создается при первом обращении.
+// Права проверяются только для клиента с токеном или сертификатом: x-client-id клиент подставляет сам
+func (s *FileServiceServer) caller(ctx context.Context) (*caller, error) {
+	const op = "server.service.caller"
+
+	c := &caller{identity: callerIdentity(ctx)}
+	if id, ok := auth.FromContext(ctx); ok {
+		c.groups = id.Groups
+	}
+	if s.policy == nil {
+		return c, nil
+	}
+	identity, ok := verifiedIdentity(ctx)
+	if !ok {
+		log.Printf("%s: identity:%s. %v", op, c.identity, ErrUnverifiedIdentity)
+		return nil, status.Error(codes.PermissionDenied, ErrUnverifiedIdentity.Error())
+	}
+	c.identity = identity
+
+	home, err := s.policy.HomeDir(c.identity, c.groups)
+	if err != nil {
+		log.Printf("%s: %v", op, err)
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	}
+	if home != "" {
+		if err = s.storage.MakeDir(ctx, home, true); err != nil {
+			log.Printf("%s: identity:%s. failed to create home directory: %v", op, c.identity, err)
+			return nil, status.Errorf(codes.Internal, "failed to create home directory: %v", err)
+		}
+	}
+	c.home = home
+	return c, nil
+}
+
+// storagePath переводит путь клиента в путь от корня хранилища.
+// Клиент с домашней директорией указывает пути от нее, а пути от корня хранилища - с "/" в начале
+func (c *caller) storagePath(name string) (string, error) {
+	if c.home == "" {
+		return name, nil
+	}
+	root := c.home
+	if strings.HasPrefix(name, "/") {
+		root, name = "", strings.TrimLeft(name, "/")
+	}
+	if name == "" || path.Clean(name) == "." {
+		return root, nil
+	}
+	rel, err := storage.CleanPath(name)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%v: %v", ErrInvalidPath, err)
+	}
+	if root == "" {
+		return rel, nil
+	}
+	return root + "/" + rel, nil
+}
+
+// display переводит путь от корня хранилища в путь, который видит клиент
+func (c *caller) display(rel string) string {
+	if c.home == "" {
+		return rel
+	}
+	if access.Within(c.home, rel) {
+		return strings.TrimPrefix(strings.TrimPrefix(rel, c.home), "/")
+	}
+	return "/" + rel
+}
+
+// authorize проверяет путь файла клиента и право perm на него.
+// Возвращает клиента и путь от корня хранилища
+func (s *FileServiceServer) authorize(ctx context.Context, name string, perm access.Permission) (*caller, string, error) {
+	if name == "" {
+		return nil, "", status.Error(codes.InvalidArgument, ErrInvalidFilename.Error())
+	}
+	return s.authorizePath(ctx, name, perm, resolvePath)
+}
+
+// authorizeDir как authorize, но пустой путь означает корень видимой клиенту части хранилища
+func (s *FileServiceServer) authorizeDir(ctx context.Context, name string, perm access.Permission) (*caller, string, error) {
+	return s.authorizePath(ctx, name, perm, resolveDir)
+}
+
+func (s *FileServiceServer) authorizePath(ctx context.Context, name string, perm access.Permission,
+	resolve func(string) (string, error)) (*caller, string, error) {
+	c, err := s.caller(ctx)
+	if err != nil {
+		return nil, "", err
+	}
+	if name, err = c.storagePath(name); err != nil {
+		return nil, "", err
+	}
+	rel, err := resolve(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if err = s.checkAccess(c, rel, perm); err != nil {
+		return nil, "", err
+	}
+	return c, rel, nil
+}
+
+// checkAccess проверяет право клиента на путь rel от корня хранилища
+func (s *FileServiceServer) checkAccess(c *caller, rel string, perm access.Permission) error {
+	const op = "server.service.checkAccess"
+
+	if s.policy == nil || s.policy.Allowed(c.identity, c.groups, c.home, rel, perm) {
+		return nil
+	}
+	log.Printf("%s: identity:%s. %s denied for %q", op, c.identity, perm, rel)
+	return status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+}
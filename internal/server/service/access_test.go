@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/access"
+	"github.com/RVodassa/FileTransfer/internal/server/auth"
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestStoragePath(t *testing.T) {
+	alice := &caller{identity: "alice", home: "home/alice"}
+	global := &caller{identity: "admin"}
+
+	tests := []struct {
+		name    string
+		c       *caller
+		input   string
+		want    string
+		wantErr codes.Code
+	}{
+		{name: "home file", c: alice, input: "a.txt", want: "home/alice/a.txt"},
+		{name: "home nested", c: alice, input: "docs//2026/./a.txt", want: "home/alice/docs/2026/a.txt"},
+		{name: "home itself", c: alice, input: "", want: "home/alice"},
+		{name: "home dot", c: alice, input: "./", want: "home/alice"},
+		{name: "from storage root", c: alice, input: "/shared/a.txt", want: "shared/a.txt"},
+		{name: "storage root", c: alice, input: "/", want: ""},
+		{name: "escape home", c: alice, input: "../bob/a.txt", wantErr: codes.InvalidArgument},
+		{name: "escape home in the middle", c: alice, input: "docs/../../bob/a.txt", wantErr: codes.InvalidArgument},
+		{name: "escape storage root", c: alice, input: "/../etc/passwd", wantErr: codes.InvalidArgument},
+		{name: "many slashes then parent", c: alice, input: "///../etc", wantErr: codes.InvalidArgument},
+		{name: "hidden name", c: alice, input: ".staging/x.part", wantErr: codes.InvalidArgument},
+		// без домашней директории путь проверяет resolvePath
+		{name: "global client", c: global, input: "home/bob/a.txt", want: "home/bob/a.txt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.c.storagePath(tt.input)
+			if tt.wantErr != codes.OK {
+				if status.Code(err) != tt.wantErr {
+					t.Fatalf("storagePath(%q) error = %v, want code %v", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("storagePath(%q) = %q, %v, want %q", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	alice := &caller{identity: "alice", home: "home/alice"}
+	tests := []struct {
+		c    *caller
+		rel  string
+		want string
+	}{
+		{c: alice, rel: "home/alice/a.txt", want: "a.txt"},
+		{c: alice, rel: "home/alice", want: ""},
+		{c: alice, rel: "home/alice2/a.txt", want: "/home/alice2/a.txt"},
+		{c: alice, rel: "shared/a.txt", want: "/shared/a.txt"},
+		{c: alice, rel: "", want: "/"},
+		{c: &caller{identity: "admin"}, rel: "home/alice/a.txt", want: "home/alice/a.txt"},
+	}
+	for _, tt := range tests {
+		got := tt.c.display(tt.rel)
+		if got != tt.want {
+			t.Errorf("display(%q) with home %q = %q, want %q", tt.rel, tt.c.home, got, tt.want)
+		}
+		// путь, который видит клиент, ведет обратно к тому же файлу
+		if back, err := tt.c.storagePath(got); err != nil || back != tt.rel {
+			t.Errorf("storagePath(display(%q)) = %q, %v", tt.rel, back, err)
+		}
+	}
+}
+
+// Права проверяются только для клиента с токеном или сертификатом
+func TestCallerIdentity(t *testing.T) {
+	var cfg config.ServerConfig
+	policy := &access.Policy{Home: "home/{identity}", Global: access.Subjects{Identities: []string{"admin"}}}
+	s := NewServiceServer(&cfg, storage.NewMemory(), nil, policy, nil, nil)
+
+	spoofed := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ClientIDHeader, "admin"))
+	if _, err := s.caller(spoofed); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("caller with only x-client-id error = %v, want PermissionDenied", err)
+	}
+
+	// заголовок не подменяет владельца токена
+	ctx := auth.NewContext(spoofed, &auth.Identity{Subject: "alice"})
+	c, err := s.caller(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.identity != "alice" || c.home != "home/alice" {
+		t.Fatalf("caller = %+v, want alice in home/alice", c)
+	}
+
+	for _, identity := range []string{"..", "../admin", "alice/../admin", ".staging"} {
+		ctx = auth.NewContext(context.Background(), &auth.Identity{Subject: identity})
+		if _, err = s.caller(ctx); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("caller %q error = %v, want PermissionDenied", identity, err)
+		}
+	}
+
+	// без политики заголовок только подписывает загрузки
+	s = NewServiceServer(&cfg, storage.NewMemory(), nil, nil, nil, nil)
+	if c, err = s.caller(spoofed); err != nil || c.identity != "admin" || c.home != "" {
+		t.Fatalf("caller without policy = %+v, %v", c, err)
+	}
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"errors"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var ErrCompressionDisabled = errors.New("compression is disabled on the server")
+
+// negotiateUpload выбирает алгоритм сжатия загрузки из предложенных клиентом
+// и сообщает его в заголовке ответа. Клиент ждет заголовок, только если что-то предложил
+func (s *FileServiceServer) negotiateUpload(op string, stream grpc.ServerStream, accept []file_transfer.Compression) error {
+	if len(accept) == 0 {
+		return nil
+	}
+	alg := file_transfer.Compression_COMPRESSION_NONE
+	if s.codec != nil {
+		alg = compression.Negotiate(accept)
+	}
+	if err := stream.SendHeader(metadata.Pairs(compression.Header, compression.Name(alg))); err != nil {
+		log.Printf("%s: failed to send header: %v", op, err)
+		return status.Errorf(codes.Internal, "failed to send header: %v", err)
+	}
+	return nil
+}
+
+// decodeChunk проверяет CRC32C части файла и распаковывает ее в buf.
+// Распакованная часть действительна до следующего вызова с тем же buf
+func (s *FileServiceServer) decodeChunk(content []byte, crc *uint32, alg file_transfer.Compression, buf *transfer.Buffer) ([]byte, codes.Code, error) {
+	if err := checksum.VerifyChunk(content, crc); err != nil {
+		return nil, codes.DataLoss, err
+	}
+	if alg == file_transfer.Compression_COMPRESSION_NONE {
+		return content, codes.OK, nil
+	}
+	if s.codec == nil {
+		return nil, codes.InvalidArgument, ErrCompressionDisabled
+	}
+	data, err := s.codec.Decode(alg, content, buf.Bytes())
+	switch {
+	case errors.Is(err, compression.ErrUnsupported), errors.Is(err, compression.ErrChunkTooLarge):
+		return nil, codes.InvalidArgument, err
+	case err != nil:
+		return nil, codes.DataLoss, err
+	}
+	return data, codes.OK, nil
+}
+
+// downloadCompression выбирает алгоритм сжатия скачивания из предложенных клиентом.
+// Уже сжатые файлы (архивы, изображения, видео) передаются как есть
+func (s *FileServiceServer) downloadCompression(accept []file_transfer.Compression, filename string, head []byte) file_transfer.Compression {
+	if s.codec == nil || !compression.Compressible(filename, head) {
+		return file_transfer.Compression_COMPRESSION_NONE
+	}
+	return compression.Negotiate(accept)
+}
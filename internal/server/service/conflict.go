@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/pathlock"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxRenameAttempts ограничивает перебор имен вида "name (N).ext"
+const maxRenameAttempts = 10000
+
+// conflictPolicy переводит политику из запроса в значение конфига.
+// Если клиент политику не указал, используется политика сервера.
+func (s *FileServiceServer) conflictPolicy(p file_transfer.ConflictPolicy) string {
+	switch p {
+	case file_transfer.ConflictPolicy_CONFLICT_POLICY_OVERWRITE:
+		return config.ConflictOverwrite
+	case file_transfer.ConflictPolicy_CONFLICT_POLICY_FAIL:
+		return config.ConflictFail
+	case file_transfer.ConflictPolicy_CONFLICT_POLICY_RENAME:
+		return config.ConflictRename
+	default:
+		return s.onConflict
+	}
+}
+
+// checkConflict отклоняет загрузку до приема данных, если файл уже есть и политика fail.
+// Окончательное решение принимает resolveConflict перед сохранением файла.
+func (s *FileServiceServer) checkConflict(ctx context.Context, name, policy string) error {
+	if policy != config.ConflictFail {
+		return nil
+	}
+	if _, err := s.storage.Stat(ctx, name); err == nil {
+		return status.Error(codes.AlreadyExists, ErrAlreadyExists.Error())
+	}
+	return nil
+}
+
+// resolveConflict блокирует на запись имя, под которым нужно сохранить файл с учетом политики,
+// и возвращает его. Блокировка держится до сохранения файла, поэтому имя не займут другие загрузки.
+func (s *FileServiceServer) resolveConflict(ctx context.Context, name, policy string) (string, pathlock.Unlock, error) {
+	const op = "server.service.resolveConflict"
+
+	// Имя, которое сейчас загружают, при rename сразу заменяется свободным
+	var unlock pathlock.Unlock
+	var err error
+	if policy == config.ConflictRename {
+		var ok bool
+		if unlock, ok = s.locks.TryLock(name); !ok {
+			return s.freeName(ctx, name)
+		}
+	} else if unlock, err = s.lockPaths(ctx, name); err != nil {
+		return "", nil, err
+	}
+	info, err := s.storage.Stat(ctx, name)
+	if errors.Is(err, storage.ErrNotFound) {
+		return name, unlock, nil
+	}
+	if err != nil {
+		unlock()
+		return "", nil, storageError(op, err)
+	}
+
+	switch policy {
+	case config.ConflictFail:
+		unlock()
+		return "", nil, status.Error(codes.AlreadyExists, ErrAlreadyExists.Error())
+	case config.ConflictRename:
+		unlock()
+		return s.freeName(ctx, name)
+	default:
+		if info.IsDir {
+			unlock()
+			return "", nil, status.Error(codes.FailedPrecondition, ErrIsDirectory.Error())
+		}
+		return name, unlock, nil
+	}
+}
+
+// freeName подбирает и блокирует свободное имя вида "name (1).ext".
+// Имена, заблокированные другими загрузками, пропускаются
+func (s *FileServiceServer) freeName(ctx context.Context, name string) (string, pathlock.Unlock, error) {
+	const op = "server.service.freeName"
+
+	dir, base := path.Split(name)
+	ext := path.Ext(base)
+	base = strings.TrimSuffix(base, ext)
+
+	for i := 1; i <= maxRenameAttempts; i++ {
+		candidate := dir + fmt.Sprintf("%s (%d)%s", base, i, ext)
+		unlock, ok := s.locks.TryLock(candidate)
+		if !ok {
+			continue
+		}
+		_, err := s.storage.Stat(ctx, candidate)
+		if errors.Is(err, storage.ErrNotFound) {
+			return candidate, unlock, nil
+		}
+		unlock()
+		if err != nil {
+			return "", nil, storageError(op, err)
+		}
+	}
+	return "", nil, status.Error(codes.AlreadyExists, ErrAlreadyExists.Error())
+}
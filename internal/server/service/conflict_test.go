@@ -0,0 +1,78 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUploadConflict(t *testing.T) {
+	tests := []struct {
+		name       string
+		onConflict string // политика сервера
+		policy     file_transfer.ConflictPolicy
+		filename   string
+		locked     string // имя, которое сейчас загружает другой клиент
+		wantName   string
+		wantCode   codes.Code
+	}{
+		{name: "new file", onConflict: config.ConflictFail, filename: "new.txt", wantName: "new.txt"},
+		{name: "overwrite", policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_OVERWRITE, filename: "a.txt", wantName: "a.txt"},
+		{name: "fail", policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_FAIL, filename: "a.txt", wantCode: codes.AlreadyExists},
+		{name: "server default", onConflict: config.ConflictFail, filename: "a.txt", wantCode: codes.AlreadyExists},
+		{name: "request overrides server", onConflict: config.ConflictFail, policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_OVERWRITE, filename: "a.txt", wantName: "a.txt"},
+		{name: "rename skips taken names", policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_RENAME, filename: "a.txt", wantName: "a (2).txt"},
+		{name: "rename skips uploading names", policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_RENAME, filename: "a.txt", locked: "a (2).txt", wantName: "a (3).txt"},
+		{name: "rename without extension", policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_RENAME, filename: "docs/report", wantName: "docs/report (1)"},
+		{name: "rename keeps last extension", policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_RENAME, filename: "docs/data.tar.gz", wantName: "docs/data.tar (1).gz"},
+		{name: "overwrite directory", policy: file_transfer.ConflictPolicy_CONFLICT_POLICY_OVERWRITE, filename: "docs", wantCode: codes.FailedPrecondition},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newQuotaServer(t, 0)
+			s.onConflict = config.ConflictOverwrite
+			ctx := clientContext("alice")
+			for _, name := range []string{"a.txt", "a (1).txt", "docs/report", "docs/data.tar.gz"} {
+				if err := upload(t, s, ctx, name, "old"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.locked != "" {
+				unlock, ok := s.locks.TryLock(tt.locked)
+				if !ok {
+					t.Fatalf("failed to lock %s", tt.locked)
+				}
+				defer unlock()
+			}
+			if tt.onConflict != "" {
+				s.onConflict = tt.onConflict
+			}
+
+			stream := newUploadStream(tt.filename, []byte("new"), 1)
+			stream.ctx = ctx
+			stream.reqs[0].ConflictPolicy = tt.policy
+			err := s.UploadFile(stream)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("UploadFile error = %v, want %v", err, tt.wantCode)
+			}
+			if tt.wantCode != codes.OK {
+				if tt.filename != "docs" && get(t, s, tt.filename) != "old" {
+					t.Errorf("rejected upload changed %s", tt.filename)
+				}
+				return
+			}
+			if stream.resp.Filename != tt.wantName {
+				t.Errorf("saved as %q, want %q", stream.resp.Filename, tt.wantName)
+			}
+			if got := get(t, s, tt.wantName); got != "new" {
+				t.Errorf("%s = %q, want %q", tt.wantName, got, "new")
+			}
+			if tt.wantName != tt.filename && get(t, s, tt.filename) != "old" {
+				t.Errorf("renamed upload changed %s", tt.filename)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// collectStream поток скачивания, который сохраняет полученные данные и контрольную сумму
+type collectStream struct {
+	grpc.ServerStream
+	ctx     context.Context
+	content []byte
+	sha256  []byte
+}
+
+func (s *collectStream) Context() context.Context { return s.ctx }
+
+func (s *collectStream) Send(resp *file_transfer.GetFileResponse) error {
+	s.content = append(s.content, resp.Content...)
+	if len(resp.Sha256) > 0 {
+		s.sha256 = resp.Sha256
+	}
+	return nil
+}
+
+// Диапазон файла передается без контрольной суммы, хвост от offset - с суммой всего файла
+func TestGetFileRange(t *testing.T) {
+	s, _ := newQuotaServer(t, 0)
+	ctx := clientContext("alice")
+	content := "0123456789"
+	if err := upload(t, s, ctx, "a.txt", content); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256([]byte(content))
+
+	tests := []struct {
+		name       string
+		offset     int64
+		length     int64
+		want       string
+		wantSha256 []byte
+		code       codes.Code
+	}{
+		{name: "whole file", want: content, wantSha256: sum[:]},
+		{name: "range", offset: 2, length: 3, want: "234"},
+		{name: "range past the end", offset: 8, length: 5, want: "89"},
+		{name: "tail", offset: 4, want: "456789", wantSha256: sum[:]},
+		{name: "at the end", offset: 10, want: "", wantSha256: sum[:]},
+		{name: "beyond the end", offset: 11, code: codes.OutOfRange},
+		{name: "negative offset", offset: -1, code: codes.InvalidArgument},
+		{name: "negative length", length: -1, code: codes.InvalidArgument},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := &collectStream{ctx: ctx}
+			err := s.GetFile(&file_transfer.GetFileRequest{Filename: "a.txt", Offset: tt.offset, Length: tt.length}, stream)
+			if status.Code(err) != tt.code {
+				t.Fatalf("GetFile error = %v, want %v", err, tt.code)
+			}
+			if err != nil {
+				return
+			}
+			if string(stream.content) != tt.want {
+				t.Errorf("content = %q, want %q", stream.content, tt.want)
+			}
+			if !bytes.Equal(stream.sha256, tt.wantSha256) {
+				t.Errorf("sha256 = %x, want %x", stream.sha256, tt.wantSha256)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"context"
+	"net"
+
+	"github.com/RVodassa/FileTransfer/internal/server/auth"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// ClientIDHeader заголовок метаданных запроса с идентификатором клиента
+const ClientIDHeader = "x-client-id"
+
+// callerIdentity возвращает владельца проверенного токена, иначе CN проверенного
+// сертификата клиента (mTLS), иначе идентификатор из метаданных запроса,
+// а если его нет - адрес клиента
+func callerIdentity(ctx context.Context) string {
+	if id, ok := verifiedIdentity(ctx); ok {
+		return id
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(ClientIDHeader); len(values) > 0 && values[0] != "" {
+			return values[0]
+		}
+	}
+
+	return peerAddress(ctx)
+}
+
+// verifiedIdentity возвращает владельца проверенного токена или CN проверенного
+// сертификата клиента. Заголовок x-client-id клиент подставляет сам, поэтому он не учитывается
+func verifiedIdentity(ctx context.Context) (string, bool) {
+	if id, ok := auth.FromContext(ctx); ok && id.Subject != "" {
+		return id.Subject, true
+	}
+
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok && len(tlsInfo.State.VerifiedChains) > 0 {
+			if cn := tlsInfo.State.VerifiedChains[0][0].Subject.CommonName; cn != "" {
+				return cn, true
+			}
+		}
+	}
+	return "", false
+}
+
+// peerAddress возвращает IP-адрес клиента без порта
+func peerAddress(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+		return host
+	}
+	return p.Addr.String()
+}
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"cmp"
+	"container/heap"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	defaultPageSize = 1000 // размер страницы, если клиент его не указал
+	maxPageSize     = 5000 // больший размер страницы урезается до этого значения
+)
+
+var ErrInvalidPageToken = errors.New("invalid page token")
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// listEntry элемент списка файлов до формирования ответа
+type listEntry struct {
+	name string // путь, который видит клиент
+	info storage.Info
+	key  *listCursor // ключ сортировки
+}
+
+// listCursor позиция последнего отданного элемента, из нее собирается page_token
+type listCursor struct {
+	Query   string `json:"q"`
+	Name    string `json:"n"`
+	Size    int64  `json:"s,omitempty"`
+	ModTime int64  `json:"t,omitempty"`
+}
+
+// listQuery разобранные параметры ListFilesRequest
+type listQuery struct {
+	pattern    string
+	prefix     string
+	re         *regexp.Regexp
+	minSize    *int64
+	maxSize    *int64
+	after      time.Time
+	before     time.Time
+	sortBy     file_transfer.SortField
+	descending bool
+	pageSize   int
+	query      string      // отпечаток параметров запроса, не меняется между страницами
+	cursor     *listCursor // nil для первой страницы
+}
+
+// newListQuery проверяет параметры запроса и декодирует page_token
+func newListQuery(req *file_transfer.ListFilesRequest) (*listQuery, error) {
+	q := &listQuery{
+		pattern:    req.Pattern,
+		prefix:     req.Prefix,
+		minSize:    req.MinSize,
+		maxSize:    req.MaxSize,
+		sortBy:     req.SortBy,
+		descending: req.Descending,
+		pageSize:   int(req.PageSize),
+	}
+
+	if q.pattern != "" {
+		if _, err := path.Match(q.pattern, ""); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: pattern: %v", ErrInvalidFilter, err)
+		}
+	}
+	if req.Regex != "" {
+		re, err := regexp.Compile(req.Regex)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%s: regex: %v", ErrInvalidFilter, err)
+		}
+		q.re = re
+	}
+	if q.minSize != nil && q.maxSize != nil && *q.minSize > *q.maxSize {
+		return nil, status.Errorf(codes.InvalidArgument, "%s: min_size is greater than max_size", ErrInvalidFilter)
+	}
+	if req.ModifiedAfter != nil {
+		q.after = req.ModifiedAfter.AsTime()
+	}
+	if req.ModifiedBefore != nil {
+		q.before = req.ModifiedBefore.AsTime()
+	}
+	if _, ok := file_transfer.SortField_name[int32(q.sortBy)]; !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "%s: unknown sort field %d", ErrInvalidFilter, q.sortBy)
+	}
+
+	switch {
+	case q.pageSize < 0:
+		return nil, status.Error(codes.InvalidArgument, "page size must not be negative")
+	case q.pageSize == 0:
+		q.pageSize = defaultPageSize
+	case q.pageSize > maxPageSize:
+		q.pageSize = maxPageSize
+	}
+
+	q.query = queryFingerprint(req)
+	if req.PageToken != "" {
+		cursor, err := decodePageToken(req.PageToken)
+		if err != nil || cursor.Query != q.query {
+			return nil, status.Error(codes.InvalidArgument, ErrInvalidPageToken.Error())
+		}
+		q.cursor = cursor
+	}
+	return q, nil
+}
+
+// queryFingerprint хэш параметров запроса без полей пагинации.
+// Не дает продолжить выдачу токеном от запроса с другими фильтрами или сортировкой
+func queryFingerprint(req *file_transfer.ListFilesRequest) string {
+	r := proto.Clone(req).(*file_transfer.ListFilesRequest)
+	r.PageToken = ""
+	r.PageSize = 0
+	data, _ := proto.MarshalOptions{Deterministic: true}.Marshal(r)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// decodePageToken разбирает page_token, выданный pageToken
+func decodePageToken(token string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, err
+	}
+	var cursor listCursor
+	if err := json.Unmarshal(data, &cursor); err != nil {
+		return nil, err
+	}
+	return &cursor, nil
+}
+
+// pageToken возвращает токен страницы, следующей за элементом e
+func (q *listQuery) pageToken(e listEntry) string {
+	data, _ := json.Marshal(e.key)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// cursorOf возвращает ключ сортировки элемента
+func (q *listQuery) cursorOf(e listEntry) *listCursor {
+	cursor := &listCursor{Query: q.query, Name: e.name}
+	switch q.sortBy {
+	case file_transfer.SortField_SORT_FIELD_SIZE:
+		cursor.Size = e.info.Size
+	case file_transfer.SortField_SORT_FIELD_MODIFICATION_TIME:
+		cursor.ModTime = e.info.ModTime.UnixNano()
+	}
+	return cursor
+}
+
+// match проверяет, подходит ли элемент под фильтры запроса
+func (q *listQuery) match(e listEntry) bool {
+	if q.prefix != "" && !strings.HasPrefix(e.name, q.prefix) {
+		return false
+	}
+	if q.pattern != "" {
+		if ok, _ := path.Match(q.pattern, path.Base(e.name)); !ok {
+			return false
+		}
+	}
+	if q.re != nil && !q.re.MatchString(e.name) {
+		return false
+	}
+	if q.minSize != nil || q.maxSize != nil {
+		if e.info.IsDir {
+			return false
+		}
+		if q.minSize != nil && e.info.Size < *q.minSize {
+			return false
+		}
+		if q.maxSize != nil && e.info.Size > *q.maxSize {
+			return false
+		}
+	}
+	modTime := e.info.ModTime
+	if !q.after.IsZero() && modTime.Before(q.after) {
+		return false
+	}
+	if !q.before.IsZero() && !modTime.Before(q.before) {
+		return false
+	}
+	return true
+}
+
+// afterCursor проверяет, что элемент идет после последнего элемента предыдущей страницы
+func (q *listQuery) afterCursor(e listEntry) bool {
+	return q.cursor == nil || q.compare(e.key, q.cursor) > 0
+}
+
+// compare задает порядок выдачи: по полю сортировки, при равенстве - по пути
+func (q *listQuery) compare(a, b *listCursor) int {
+	var c int
+	switch q.sortBy {
+	case file_transfer.SortField_SORT_FIELD_SIZE:
+		c = cmp.Compare(a.Size, b.Size)
+	case file_transfer.SortField_SORT_FIELD_MODIFICATION_TIME:
+		c = cmp.Compare(a.ModTime, b.ModTime)
+	}
+	if c == 0 {
+		c = strings.Compare(a.Name, b.Name)
+	}
+	if q.descending {
+		return -c
+	}
+	return c
+}
+
+// listPage первые limit элементов в порядке выдачи. Хранит не больше limit элементов
+// в куче, на вершине которой последний из них, поэтому память не зависит от размера директории
+type listPage struct {
+	q       *listQuery
+	limit   int
+	entries []listEntry
+}
+
+// newListPage возвращает страницу запроса q с одним лишним элементом:
+// по нему видно, есть ли следующая страница
+func newListPage(q *listQuery) *listPage {
+	return &listPage{q: q, limit: q.pageSize + 1}
+}
+
+// add добавляет элемент, если он входит в первые limit элементов
+func (p *listPage) add(e listEntry) {
+	if len(p.entries) < p.limit {
+		heap.Push(p, e)
+		return
+	}
+	if p.q.compare(e.key, p.entries[0].key) < 0 {
+		p.entries[0] = e
+		heap.Fix(p, 0)
+	}
+}
+
+// sorted возвращает собранные элементы в порядке выдачи
+func (p *listPage) sorted() []listEntry {
+	slices.SortFunc(p.entries, func(a, b listEntry) int { return p.q.compare(a.key, b.key) })
+	return p.entries
+}
+
+func (p *listPage) Len() int { return len(p.entries) }
+
+func (p *listPage) Less(i, j int) bool {
+	return p.q.compare(p.entries[i].key, p.entries[j].key) > 0
+}
+
+func (p *listPage) Swap(i, j int) { p.entries[i], p.entries[j] = p.entries[j], p.entries[i] }
+
+func (p *listPage) Push(x any) { p.entries = append(p.entries, x.(listEntry)) }
+
+func (p *listPage) Pop() any {
+	e := p.entries[len(p.entries)-1]
+	p.entries = p.entries[:len(p.entries)-1]
+	return e
+}
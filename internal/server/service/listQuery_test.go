@@ -0,0 +1,64 @@
+package service
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+)
+
+// Страница из кучи совпадает с началом полностью отсортированного списка
+func TestListPage(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	base := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	infos := make([]storage.Info, 500)
+	for i := range infos {
+		infos[i] = storage.Info{
+			Name:    fmt.Sprintf("f%03d", rnd.Intn(1000)),
+			Size:    rnd.Int63n(20), // одинаковые размеры упорядочиваются по пути
+			ModTime: base.Add(time.Duration(rnd.Intn(50)) * time.Second),
+		}
+	}
+
+	for _, sortBy := range []file_transfer.SortField{
+		file_transfer.SortField_SORT_FIELD_NAME,
+		file_transfer.SortField_SORT_FIELD_SIZE,
+		file_transfer.SortField_SORT_FIELD_MODIFICATION_TIME,
+	} {
+		for _, descending := range []bool{false, true} {
+			for _, pageSize := range []int32{1, 7, 499, 500, 1000} {
+				name := fmt.Sprintf("%s/descending=%t/%d", sortBy, descending, pageSize)
+				t.Run(name, func(t *testing.T) {
+					q, err := newListQuery(&file_transfer.ListFilesRequest{SortBy: sortBy, Descending: descending, PageSize: pageSize})
+					if err != nil {
+						t.Fatal(err)
+					}
+					page := newListPage(q)
+					all := make([]listEntry, 0, len(infos))
+					for _, info := range infos {
+						e := listEntry{name: info.Name, info: info}
+						e.key = q.cursorOf(e)
+						page.add(e)
+						all = append(all, e)
+					}
+					slices.SortFunc(all, func(a, b listEntry) int { return q.compare(a.key, b.key) })
+
+					got := page.sorted()
+					want := all[:min(len(all), q.pageSize+1)]
+					if len(got) != len(want) {
+						t.Fatalf("page has %d entries, want %d", len(got), len(want))
+					}
+					for i := range want {
+						if q.compare(got[i].key, want[i].key) != 0 {
+							t.Fatalf("entry %d = %+v, want %+v", i, got[i].key, want[i].key)
+						}
+					}
+				})
+			}
+		}
+	}
+}
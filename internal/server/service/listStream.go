@@ -0,0 +1,68 @@
+package service
+
+import (
+	"errors"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrStreamUnsupported = errors.New("sorting and pagination are not supported by StreamListFiles")
+
+// StreamListFiles отправляет клиенту информацию о файлах по мере обхода директорий.
+// Хранилище отдает записи директории по одной, поэтому ответ не собирается в памяти
+func (s *FileServiceServer) StreamListFiles(req *file_transfer.ListFilesRequest, stream file_transfer.FileTransfer_StreamListFilesServer) error {
+	const op = "server.service.StreamListFiles"
+	ctx := stream.Context()
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.listFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return status.Errorf(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.listFilesSemaphore.Release(1)
+
+	if req.PageToken != "" || req.Descending ||
+		(req.SortBy != file_transfer.SortField_SORT_FIELD_UNSPECIFIED && req.SortBy != file_transfer.SortField_SORT_FIELD_NAME) {
+		return status.Error(codes.InvalidArgument, ErrStreamUnsupported.Error())
+	}
+	q, err := newListQuery(req)
+	if err != nil {
+		return err
+	}
+	c, dir, err := s.listDir(ctx, op, req.Directory)
+	if err != nil {
+		return err
+	}
+
+	err = storage.Walk(ctx, s.storage, dir, func(info storage.Info) error {
+		e := listEntry{name: c.display(info.Name), info: info}
+		if q.match(e) {
+			info, err := s.withMeta(ctx, op, info)
+			if err != nil {
+				return err
+			}
+			if err = stream.Send(fileInfo(e.name, &info)); err != nil {
+				return err
+			}
+		}
+		if info.IsDir && !req.Recursive {
+			return storage.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			log.Printf("%s: listing canceled: %v", op, ctx.Err())
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		if _, ok := status.FromError(err); ok {
+			return err
+		}
+		log.Printf("%s: failed to read directory: %v", op, err)
+		return status.Errorf(codes.Internal, "failed to read directory: %v", err)
+	}
+	return nil
+}
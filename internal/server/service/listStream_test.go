@@ -0,0 +1,95 @@
+package service
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// listStream поток списка файлов, сохраняет имена и отменяет контекст после cancelAfter записей
+type listStream struct {
+	grpc.ServerStream
+	ctx         context.Context
+	cancel      context.CancelFunc
+	cancelAfter int
+	names       []string
+}
+
+func (s *listStream) Context() context.Context { return s.ctx }
+
+func (s *listStream) Send(info *file_transfer.FileInfo) error {
+	s.names = append(s.names, info.Name)
+	if s.cancelAfter > 0 && len(s.names) == s.cancelAfter {
+		s.cancel()
+	}
+	return nil
+}
+
+func newListStream(ctx context.Context, cancelAfter int) *listStream {
+	ctx, cancel := context.WithCancel(ctx)
+	return &listStream{ctx: ctx, cancel: cancel, cancelAfter: cancelAfter}
+}
+
+func TestStreamListFiles(t *testing.T) {
+	s, _ := newQuotaServer(t, 0)
+	ctx := clientContext("alice")
+	for _, name := range []string{"a.txt", "b.csv", "docs/c.txt", "docs/2026/d.txt"} {
+		if err := upload(t, s, ctx, name, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		req      *file_transfer.ListFilesRequest
+		want     []string
+		wantCode codes.Code
+	}{
+		{name: "root", req: &file_transfer.ListFilesRequest{}, want: []string{"a.txt", "b.csv", "docs"}},
+		{
+			name: "recursive",
+			req:  &file_transfer.ListFilesRequest{Recursive: true},
+			want: []string{"a.txt", "b.csv", "docs", "docs/2026", "docs/2026/d.txt", "docs/c.txt"},
+		},
+		{name: "directory", req: &file_transfer.ListFilesRequest{Directory: "docs"}, want: []string{"docs/2026", "docs/c.txt"}},
+		{
+			name: "recursive pattern",
+			req:  &file_transfer.ListFilesRequest{Recursive: true, Pattern: "*.txt"},
+			want: []string{"a.txt", "docs/2026/d.txt", "docs/c.txt"},
+		},
+		{name: "sort by name", req: &file_transfer.ListFilesRequest{SortBy: file_transfer.SortField_SORT_FIELD_NAME}, want: []string{"a.txt", "b.csv", "docs"}},
+		{name: "sort by size", req: &file_transfer.ListFilesRequest{SortBy: file_transfer.SortField_SORT_FIELD_SIZE}, wantCode: codes.InvalidArgument},
+		{name: "descending", req: &file_transfer.ListFilesRequest{Descending: true}, wantCode: codes.InvalidArgument},
+		{name: "page token", req: &file_transfer.ListFilesRequest{PageToken: "token"}, wantCode: codes.InvalidArgument},
+		{name: "missing directory", req: &file_transfer.ListFilesRequest{Directory: "missing"}, wantCode: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream := newListStream(ctx, 0)
+			err := s.StreamListFiles(tt.req, stream)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("StreamListFiles error = %v, want %v", err, tt.wantCode)
+			}
+			// порядок обхода зависит от хранилища
+			slices.Sort(stream.names)
+			if !slices.Equal(stream.names, tt.want) {
+				t.Errorf("listed %v, want %v", stream.names, tt.want)
+			}
+		})
+	}
+
+	// отмена клиентом прерывает обход
+	stream := newListStream(ctx, 2)
+	err := s.StreamListFiles(&file_transfer.ListFilesRequest{Recursive: true}, stream)
+	if status.Code(err) != codes.Canceled {
+		t.Fatalf("StreamListFiles after cancel error = %v, want Canceled", err)
+	}
+	if len(stream.names) != 2 {
+		t.Errorf("listed %d entries after cancel", len(stream.names))
+	}
+}
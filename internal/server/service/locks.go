@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+
+	"github.com/RVodassa/FileTransfer/internal/server/pathlock"
+	"google.golang.org/grpc/status"
+)
+
+// lockPaths блокирует пути хранилища на запись. Запросы к другим путям выполняются параллельно
+func (s *FileServiceServer) lockPaths(ctx context.Context, names ...string) (pathlock.Unlock, error) {
+	unlock, err := s.locks.Lock(ctx, names...)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return unlock, nil
+}
+
+// rlockPath блокирует путь хранилища на чтение: файл не заменят и не удалят, пока блокировка держится
+func (s *FileServiceServer) rlockPath(ctx context.Context, name string) (pathlock.Unlock, error) {
+	unlock, err := s.locks.RLock(ctx, name)
+	if err != nil {
+		return nil, status.FromContextError(err).Err()
+	}
+	return unlock, nil
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc"
+)
+
+// uploadStream поток загрузки файла из заранее подготовленных частей.
+// После частей возвращает err или io.EOF
+type uploadStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqs []*file_transfer.UploadFileRequest
+	err  error
+	resp *file_transfer.UploadFileResponse // ответ сервера после успешной загрузки
+}
+
+func newUploadStream(name string, content []byte, chunks int) *uploadStream {
+	size := int64(len(content) * chunks)
+	crc := checksum.Chunk(content)
+	reqs := []*file_transfer.UploadFileRequest{{Filename: name, Size: &size}}
+	for i := 0; i < chunks; i++ {
+		reqs = append(reqs, &file_transfer.UploadFileRequest{Content: content, Crc32C: &crc})
+	}
+	return &uploadStream{reqs: reqs}
+}
+
+func (s *uploadStream) Context() context.Context {
+	if s.ctx != nil {
+		return s.ctx
+	}
+	return context.Background()
+}
+
+func (s *uploadStream) Recv() (*file_transfer.UploadFileRequest, error) {
+	if len(s.reqs) == 0 {
+		if s.err != nil {
+			return nil, s.err
+		}
+		return nil, io.EOF
+	}
+	req := s.reqs[0]
+	s.reqs = s.reqs[1:]
+	return req, nil
+}
+
+func (s *uploadStream) SendAndClose(resp *file_transfer.UploadFileResponse) error {
+	s.resp = resp
+	return nil
+}
+
+// slowStorage имитирует задержку диска или сети на каждую запись
+type slowStorage struct {
+	storage.Storage
+	delay time.Duration
+}
+
+func (s slowStorage) Put(ctx context.Context, name string) (storage.Writer, error) {
+	w, err := s.Storage.Put(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	return slowWriter{Writer: w, delay: s.delay}, nil
+}
+
+type slowWriter struct {
+	storage.Writer
+	delay time.Duration
+}
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.Writer.Write(p)
+}
+
+func newBenchServer(b *testing.B) *FileServiceServer {
+	var cfg config.ServerConfig
+	cfg.Server.Limits.UploadRequests = 1024
+	cfg.UploadStagingDir = b.TempDir()
+	cfg.OnConflict = config.ConflictOverwrite
+	return NewServiceServer(&cfg, slowStorage{Storage: storage.NewMemory(), delay: time.Millisecond}, nil, nil, nil, nil)
+}
+
+// Загрузки разных файлов идут параллельно, загрузки одного файла - по очереди
+func BenchmarkParallelUpload(b *testing.B) {
+	const chunks = 4
+	content := bytes.Repeat([]byte("x"), 64<<10)
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	for _, bc := range []struct {
+		name string
+		same bool
+	}{
+		{name: "distinct-files"},
+		{name: "same-file", same: true},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s := newBenchServer(b)
+			var n atomic.Int64
+			b.SetBytes(int64(len(content) * chunks))
+			b.SetParallelism(8)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					name := "same.bin"
+					if !bc.same {
+						name = fmt.Sprintf("file-%d.bin", n.Add(1))
+					}
+					if err := s.UploadFile(newUploadStream(name, content, chunks)); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
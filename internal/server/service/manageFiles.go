@@ -0,0 +1,169 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/internal/server/access"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DeleteFile удаляет файл из хранилища
+func (s *FileServiceServer) DeleteFile(ctx context.Context, req *file_transfer.DeleteFileRequest) (*file_transfer.DeleteFileResponse, error) {
+	const op = "server.service.DeleteFile"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.manageFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.manageFilesSemaphore.Release(1)
+
+	_, filename, err := s.authorize(ctx, req.Filename, access.Delete)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.lockPaths(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	// директории удаляются через RemoveDir
+	if info, statErr := s.storage.Stat(ctx, filename); statErr == nil && info.IsDir {
+		return nil, status.Error(codes.FailedPrecondition, ErrIsDirectory.Error())
+	}
+	// удаленный файл можно восстановить из версий
+	if err = s.archiveVersion(ctx, filename); err != nil {
+		return nil, err
+	}
+	usage, counted := s.usageOf(ctx, filename)
+	if err = s.storage.Delete(ctx, filename); err != nil {
+		return nil, storageError(op, err)
+	}
+	if counted {
+		s.releaseUsage(usage)
+	}
+
+	log.Printf("%s: filename:%s. File deleted", op, filename)
+	return &file_transfer.DeleteFileResponse{Message: "File deleted successfully!"}, nil
+}
+
+// RenameFile переименовывает файл в хранилище. Существующий файл не перезаписывается.
+func (s *FileServiceServer) RenameFile(ctx context.Context, req *file_transfer.RenameFileRequest) (*file_transfer.RenameFileResponse, error) {
+	const op = "server.service.RenameFile"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.manageFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.manageFilesSemaphore.Release(1)
+
+	_, oldName, err := s.authorize(ctx, req.OldFilename, access.Delete)
+	if err != nil {
+		return nil, err
+	}
+	_, newName, err := s.authorize(ctx, req.NewFilename, access.Write)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.lockPaths(ctx, oldName, newName)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if err = s.storage.Rename(ctx, oldName, newName); err != nil {
+		return nil, storageError(op, err)
+	}
+
+	log.Printf("%s: filename:%s. File renamed to %s", op, oldName, newName)
+	return &file_transfer.RenameFileResponse{Message: "File renamed successfully!"}, nil
+}
+
+// StatFile возвращает информацию о файле
+func (s *FileServiceServer) StatFile(ctx context.Context, req *file_transfer.StatFileRequest) (*file_transfer.FileInfo, error) {
+	const op = "server.service.StatFile"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.manageFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.manageFilesSemaphore.Release(1)
+
+	c, filename, err := s.authorize(ctx, req.Filename, access.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := s.storage.Stat(ctx, filename)
+	if err != nil {
+		return nil, storageError(op, err)
+	}
+	return fileInfo(c.display(filename), info), nil
+}
+
+// MakeDir создает директорию в хранилище
+func (s *FileServiceServer) MakeDir(ctx context.Context, req *file_transfer.MakeDirRequest) (*file_transfer.MakeDirResponse, error) {
+	const op = "server.service.MakeDir"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.manageFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.manageFilesSemaphore.Release(1)
+
+	_, dir, err := s.authorize(ctx, req.Path, access.Write)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.storage.MakeDir(ctx, dir, req.Parents); err != nil {
+		return nil, storageError(op, err)
+	}
+
+	log.Printf("%s: dir:%s. Directory created", op, dir)
+	return &file_transfer.MakeDirResponse{Message: "Directory created successfully!"}, nil
+}
+
+// RemoveDir удаляет директорию из хранилища. Непустая директория удаляется только при recursive.
+func (s *FileServiceServer) RemoveDir(ctx context.Context, req *file_transfer.RemoveDirRequest) (*file_transfer.RemoveDirResponse, error) {
+	const op = "server.service.RemoveDir"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.manageFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.manageFilesSemaphore.Release(1)
+
+	c, dir, err := s.authorize(ctx, req.Path, access.Delete)
+	if err != nil {
+		return nil, err
+	}
+	// домашнюю директорию клиент удалить не может
+	if c.home != "" && dir == c.home {
+		return nil, status.Error(codes.PermissionDenied, ErrPermissionDenied.Error())
+	}
+
+	// Ждет загрузки и скачивания файлов внутри директории
+	unlock, err := s.lockPaths(ctx, dir)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var usages []fileUsage
+	if req.Recursive {
+		usages = s.usageUnder(ctx, dir)
+	}
+	if err = s.storage.RemoveDir(ctx, dir, req.Recursive); err != nil {
+		return nil, storageError(op, err)
+	}
+	s.releaseUsage(usages...)
+
+	log.Printf("%s: dir:%s. Directory removed", op, dir)
+	return &file_transfer.RemoveDirResponse{Message: "Directory removed successfully!"}, nil
+}
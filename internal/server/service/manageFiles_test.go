@@ -0,0 +1,140 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestManageFilesErrors(t *testing.T) {
+	s, _ := newQuotaServer(t, 0)
+	ctx := clientContext("alice")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := upload(t, s, ctx, name, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := s.MakeDir(ctx, &file_transfer.MakeDirRequest{Path: "docs"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{name: "delete missing", call: func() error {
+			_, err := s.DeleteFile(ctx, &file_transfer.DeleteFileRequest{Filename: "missing.txt"})
+			return err
+		}, want: codes.NotFound},
+		{name: "delete directory", call: func() error {
+			_, err := s.DeleteFile(ctx, &file_transfer.DeleteFileRequest{Filename: "docs"})
+			return err
+		}, want: codes.FailedPrecondition},
+		{name: "delete invalid name", call: func() error {
+			_, err := s.DeleteFile(ctx, &file_transfer.DeleteFileRequest{Filename: "../a.txt"})
+			return err
+		}, want: codes.InvalidArgument},
+		{name: "rename missing", call: func() error {
+			_, err := s.RenameFile(ctx, &file_transfer.RenameFileRequest{OldFilename: "missing.txt", NewFilename: "c.txt"})
+			return err
+		}, want: codes.NotFound},
+		{name: "rename onto existing", call: func() error {
+			_, err := s.RenameFile(ctx, &file_transfer.RenameFileRequest{OldFilename: "a.txt", NewFilename: "b.txt"})
+			return err
+		}, want: codes.AlreadyExists},
+		{name: "rename directory onto file", call: func() error {
+			_, err := s.RenameFile(ctx, &file_transfer.RenameFileRequest{OldFilename: "docs", NewFilename: "a.txt"})
+			return err
+		}, want: codes.AlreadyExists},
+		{name: "stat missing", call: func() error {
+			_, err := s.StatFile(ctx, &file_transfer.StatFileRequest{Filename: "missing.txt"})
+			return err
+		}, want: codes.NotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); status.Code(err) != tt.want {
+				t.Fatalf("error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	// неудачные вызовы не меняют файлы
+	if got := get(t, s, "a.txt"); got != "a.txt" {
+		t.Errorf("a.txt = %q after failed calls", got)
+	}
+	if got := get(t, s, "b.txt"); got != "b.txt" {
+		t.Errorf("b.txt = %q after failed calls", got)
+	}
+}
+
+func TestRenameAndDelete(t *testing.T) {
+	s, _ := newQuotaServer(t, 0)
+	ctx := clientContext("alice")
+	if err := upload(t, s, ctx, "a.txt", "content"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RenameFile(ctx, &file_transfer.RenameFileRequest{OldFilename: "a.txt", NewFilename: "c.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := s.StatFile(ctx, &file_transfer.StatFileRequest{Filename: "c.txt"})
+	if err != nil || info.Name != "c.txt" || info.Size != 7 {
+		t.Fatalf("StatFile after rename = %v, %v, want 7 bytes", info, err)
+	}
+	if _, err = s.storage.Stat(context.Background(), "a.txt"); err == nil {
+		t.Error("old name exists after rename")
+	}
+
+	if _, err = s.DeleteFile(ctx, &file_transfer.DeleteFileRequest{Filename: "c.txt"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.StatFile(ctx, &file_transfer.StatFileRequest{Filename: "c.txt"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("StatFile after delete error = %v, want NotFound", err)
+	}
+}
+
+// Непустая директория удаляется только с recursive, место ее файлов освобождается в квоте
+func TestRemoveDir(t *testing.T) {
+	s, tracker := newQuotaServer(t, 100)
+	ctx := clientContext("alice")
+	if _, err := s.MakeDir(ctx, &file_transfer.MakeDirRequest{Path: "docs/2026"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("MakeDir without parents error = %v, want NotFound", err)
+	}
+	if _, err := s.MakeDir(ctx, &file_transfer.MakeDirRequest{Path: "docs/2026", Parents: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.MakeDir(ctx, &file_transfer.MakeDirRequest{Path: "docs"}); status.Code(err) != codes.AlreadyExists {
+		t.Fatalf("MakeDir of existing dir error = %v, want AlreadyExists", err)
+	}
+	if err := upload(t, s, ctx, "docs/2026/q3.csv", "12345678"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.RemoveDir(ctx, &file_transfer.RemoveDirRequest{Path: "docs"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("RemoveDir of non-empty dir error = %v, want FailedPrecondition", err)
+	}
+	if got := get(t, s, "docs/2026/q3.csv"); got != "12345678" {
+		t.Fatalf("file after failed RemoveDir = %q", got)
+	}
+	if _, err := s.RemoveDir(ctx, &file_transfer.RemoveDirRequest{Path: "docs/2026/q3.csv"}); status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("RemoveDir of file error = %v, want FailedPrecondition", err)
+	}
+
+	if _, err := s.RemoveDir(ctx, &file_transfer.RemoveDirRequest{Path: "docs", Recursive: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.StatFile(ctx, &file_transfer.StatFileRequest{Filename: "docs"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("StatFile after RemoveDir error = %v, want NotFound", err)
+	}
+	if u, _, _, _ := tracker.Usage("alice"); u.Bytes != 0 || u.Files != 0 {
+		t.Fatalf("usage after RemoveDir = %+v, want empty", u)
+	}
+	if _, err := s.RemoveDir(ctx, &file_transfer.RemoveDirRequest{Path: "docs"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("RemoveDir of missing dir error = %v, want NotFound", err)
+	}
+}
@@ -0,0 +1,40 @@
+package service
+
+import (
+	"errors"
+	"path"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrInvalidPath = errors.New("invalid path")
+
+// resolvePath проверяет путь клиента вида "reports/2026/q3.csv" и возвращает
+// его очищенную форму от корня хранилища. Используется всеми RPC.
+// Отклоняет пустые и абсолютные пути, "..", NUL и управляющие символы
+// и скрытые имена (зарезервированы под незавершенные загрузки).
+// Символические ссылки за пределы хранилища отклоняет само хранилище.
+func resolvePath(name string) (string, error) {
+	if name == "" {
+		return "", status.Error(codes.InvalidArgument, ErrInvalidFilename.Error())
+	}
+	return resolve(name)
+}
+
+// resolveDir как resolvePath, но пустой путь означает корень хранилища
+func resolveDir(name string) (string, error) {
+	if name == "" || name == "/" || path.Clean(name) == "." {
+		return "", nil
+	}
+	return resolve(name)
+}
+
+func resolve(name string) (string, error) {
+	rel, err := storage.CleanPath(name)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "%v: %v", ErrInvalidPath, err)
+	}
+	return rel, nil
+}
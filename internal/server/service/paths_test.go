@@ -0,0 +1,109 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestResolvePath(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantRel string
+		wantErr codes.Code
+	}{
+		{name: "plain file", input: "image.png", wantRel: "image.png"},
+		{name: "nested file", input: "reports/2026/q3.csv", wantRel: "reports/2026/q3.csv"},
+		{name: "redundant separators", input: "reports//2026/./q3.csv", wantRel: "reports/2026/q3.csv"},
+		{name: "trailing slash", input: "reports/", wantRel: "reports"},
+		{name: "missing parents", input: "new/dir/file.txt", wantRel: "new/dir/file.txt"},
+		{name: "unicode name", input: "отчеты/файл.txt", wantRel: "отчеты/файл.txt"},
+		{name: "empty", input: "", wantErr: codes.InvalidArgument},
+		{name: "dot", input: ".", wantErr: codes.InvalidArgument},
+		{name: "parent", input: "..", wantErr: codes.InvalidArgument},
+		{name: "traversal", input: "../../etc/passwd", wantErr: codes.InvalidArgument},
+		{name: "traversal in the middle", input: "reports/../../etc/passwd", wantErr: codes.InvalidArgument},
+		{name: "traversal that stays inside", input: "reports/../image.png", wantErr: codes.InvalidArgument},
+		{name: "absolute", input: "/etc/passwd", wantErr: codes.InvalidArgument},
+		{name: "backslash traversal", input: `..\..\etc\passwd`, wantErr: codes.InvalidArgument},
+		{name: "NUL byte", input: "image.png\x00.txt", wantErr: codes.InvalidArgument},
+		{name: "newline", input: "image\n.png", wantErr: codes.InvalidArgument},
+		{name: "escape char", input: "image\x1b[31m.png", wantErr: codes.InvalidArgument},
+		{name: "DEL char", input: "image\x7f.png", wantErr: codes.InvalidArgument},
+		{name: "invalid UTF-8", input: "image\xff.png", wantErr: codes.InvalidArgument},
+		{name: "hidden name", input: ".staging/abc.part", wantErr: codes.InvalidArgument},
+		{name: "hidden nested name", input: "reports/.q3.csv.123.tmp", wantErr: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rel, err := resolvePath(tt.input)
+			if tt.wantErr != codes.OK {
+				if status.Code(err) != tt.wantErr {
+					t.Fatalf("resolvePath(%q) error = %v, want code %v", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolvePath(%q) unexpected error: %v", tt.input, err)
+			}
+			if rel != tt.wantRel {
+				t.Errorf("resolvePath(%q) rel = %q, want %q", tt.input, rel, tt.wantRel)
+			}
+		})
+	}
+}
+
+func TestResolveDir(t *testing.T) {
+	for _, input := range []string{"", ".", "/", "./"} {
+		rel, err := resolveDir(input)
+		if err != nil {
+			t.Fatalf("resolveDir(%q) unexpected error: %v", input, err)
+		}
+		if rel != "" {
+			t.Errorf("resolveDir(%q) = %q, want storage root", input, rel)
+		}
+	}
+
+	if _, err := resolveDir("../other"); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("resolveDir(../other) error = %v, want InvalidArgument", err)
+	}
+}
+
+func FuzzResolvePath(f *testing.F) {
+	for _, seed := range []string{
+		"image.png", "reports/2026/q3.csv", "../../etc/passwd", "/etc/passwd",
+		"a/./b/../c", `..\..\x`, "a\x00b", ".staging/x", "a//b/", "..",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, name string) {
+		rel, err := resolvePath(name)
+		if err != nil {
+			if code := status.Code(err); code != codes.InvalidArgument {
+				t.Fatalf("resolvePath(%q) error code = %v, want InvalidArgument", name, code)
+			}
+			return
+		}
+
+		// Принятый путь всегда остается внутри хранилища
+		if rel == "" || strings.HasPrefix(rel, "/") {
+			t.Fatalf("resolvePath(%q) = %q escapes storage root", name, rel)
+		}
+		if strings.Contains(rel, "..") && strings.Contains("/"+rel+"/", "/../") {
+			t.Fatalf("resolvePath(%q) rel = %q contains parent reference", name, rel)
+		}
+		for _, r := range rel {
+			if r < 0x20 || r == 0x7f {
+				t.Fatalf("resolvePath(%q) rel = %q contains control character", name, rel)
+			}
+		}
+		if again, err := resolvePath(rel); err != nil || again != rel {
+			t.Fatalf("resolvePath(%q) is not idempotent: %q, %v", rel, again, err)
+		}
+	})
+}
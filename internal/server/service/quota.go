@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrQuotaDisabled = errors.New("quotas are disabled")
+
+// GetUsage возвращает занятое клиентом и сервером место и лимиты
+func (s *FileServiceServer) GetUsage(ctx context.Context, _ *file_transfer.GetUsageRequest) (*file_transfer.GetUsageResponse, error) {
+	// Ограничивает кол-во одновременных запросов
+	if err := s.listFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.listFilesSemaphore.Release(1)
+
+	if s.quota == nil {
+		return nil, status.Error(codes.FailedPrecondition, ErrQuotaDisabled.Error())
+	}
+	c, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	used, limits, total, global := s.quota.Usage(c.identity)
+	return &file_transfer.GetUsageResponse{
+		Identity: c.identity,
+		Client:   usageMessage(used, limits),
+		Server:   usageMessage(total, global),
+	}, nil
+}
+
+func usageMessage(u quota.Usage, l quota.Limits) *file_transfer.Usage {
+	return &file_transfer.Usage{UsedBytes: u.Bytes, UsedFiles: u.Files, MaxBytes: l.MaxBytes, MaxFiles: l.MaxFiles}
+}
+
+// reserveQuota резервирует место под загрузку в файл name. size - заявленный размер
+// или уже принятые данные. Без квот возвращает nil, методы Reservation его допускают.
+// Файл не учитывается, только если загрузка заменит файл самого клиента
+func (s *FileServiceServer) reserveQuota(ctx context.Context, op string, c *caller, name string, size int64) (*quota.Reservation, error) {
+	if s.quota == nil {
+		return nil, nil
+	}
+	existing, exists := s.usageOf(ctx, name)
+	r, err := s.quota.Reserve(c.identity, size, !exists || existing.owner != c.identity)
+	if err != nil {
+		return nil, quotaError(op, c, err)
+	}
+	return r, nil
+}
+
+// quotaError переводит превышение квоты в ResourceExhausted
+func quotaError(op string, c *caller, err error) error {
+	log.Printf("%s: identity:%s. %v", op, c.identity, err)
+	return status.Error(codes.ResourceExhausted, err.Error())
+}
+
+// fileUsage место, которое файл занимает в квоте загрузившего его клиента
+type fileUsage struct {
+	owner string
+	size  int64
+}
+
+// usageOf возвращает место, занятое файлом name, если это файл
+func (s *FileServiceServer) usageOf(ctx context.Context, name string) (fileUsage, bool) {
+	if s.quota == nil {
+		return fileUsage{}, false
+	}
+	info, err := s.storage.Stat(ctx, name)
+	if err != nil || info.IsDir {
+		return fileUsage{}, false
+	}
+	return fileUsage{owner: info.Meta.Uploader, size: info.Size}, true
+}
+
+// usageUnder возвращает место, занятое файлами в директории dir
+func (s *FileServiceServer) usageUnder(ctx context.Context, dir string) []fileUsage {
+	if s.quota == nil {
+		return nil
+	}
+	var usages []fileUsage
+	_ = storage.Walk(ctx, s.storage, dir, func(info storage.Info) error {
+		if info.IsDir {
+			return nil
+		}
+		info, _ = storage.WithMeta(ctx, s.storage, info)
+		usages = append(usages, fileUsage{owner: info.Meta.Uploader, size: info.Size})
+		return nil
+	})
+	return usages
+}
+
+// releaseUsage освобождает место удаленных или замененных файлов
+func (s *FileServiceServer) releaseUsage(usages ...fileUsage) {
+	if s.quota == nil {
+		return
+	}
+	for _, u := range usages {
+		s.quota.Add(u.owner, -u.size, -1)
+	}
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/internal/server/versions"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// newQuotaServer возвращает сервис с квотой клиента maxBytes и хранением версий
+func newQuotaServer(t *testing.T, maxBytes int64) (*FileServiceServer, *quota.Tracker) {
+	t.Helper()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+
+	var cfg config.ServerConfig
+	cfg.Server.Limits.UploadRequests = 1
+	cfg.Server.Limits.DownloadRequests = 1
+	cfg.Server.Limits.ListRequests = 1
+	cfg.Server.Limits.ManageRequests = 1
+	cfg.UploadStagingDir = t.TempDir()
+	cfg.OnConflict = config.ConflictOverwrite
+	tracker := quota.NewTracker(quota.Limits{}, quota.Limits{MaxBytes: maxBytes}, nil)
+	s := NewServiceServer(&cfg, storage.NewMemory(), versions.NewStore(t.TempDir()), nil, tracker, nil)
+	return s, tracker
+}
+
+// clientContext контекст запроса клиента identity без токена
+func clientContext(identity string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(ClientIDHeader, identity))
+}
+
+// upload загружает content в файл name от имени клиента ctx
+func upload(t *testing.T, s *FileServiceServer, ctx context.Context, name, content string) error {
+	t.Helper()
+	stream := newUploadStream(name, []byte(content), 1)
+	stream.ctx = ctx
+	return s.UploadFile(stream)
+}
+
+// Версии перезаписанных файлов не учитываются в квоте: их ограничивают правила хранения
+func TestVersionsExemptFromQuota(t *testing.T) {
+	s, tracker := newQuotaServer(t, 20)
+	ctx := clientContext("alice")
+
+	for _, content := range []string{"12345678", "abcdefgh", "ABCDEFGH"} {
+		if err := upload(t, s, ctx, "a.txt", content); err != nil {
+			t.Fatalf("upload %q: %v", content, err)
+		}
+	}
+	list, err := s.versions.List("a.txt")
+	if err != nil || len(list) != 2 {
+		t.Fatalf("versions = %v, %v, want 2", list, err)
+	}
+	if u, _, _, _ := tracker.Usage("alice"); u != (quota.Usage{Bytes: 8, Files: 1}) {
+		t.Fatalf("usage = %+v, want only the current file", u)
+	}
+	resp, err := s.GetUsage(ctx, &file_transfer.GetUsageRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Client.UsedBytes != 8 || resp.Client.UsedFiles != 1 {
+		t.Fatalf("GetUsage = %+v, want 8 bytes and 1 file", resp.Client)
+	}
+}
+
+// Восстановленная версия учитывается в квоте клиента, который ее восстановил
+func TestRestoreVersionQuota(t *testing.T) {
+	s, tracker := newQuotaServer(t, 20)
+	alice, bob := clientContext("alice"), clientContext("bob")
+
+	for _, content := range []string{"12345678", "abcd"} {
+		if err := upload(t, s, alice, "a.txt", content); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list, err := s.versions.List("a.txt")
+	if err != nil || len(list) != 1 {
+		t.Fatalf("versions = %v, %v, want 1", list, err)
+	}
+	req := &file_transfer.RestoreVersionRequest{Filename: "a.txt", VersionId: list[0].ID}
+
+	// bob не может восстановить файл сверх своей квоты
+	tracker.Add("bob", 15, 1)
+	if _, err = s.RestoreVersion(bob, req); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("restore over quota error = %v, want ResourceExhausted", err)
+	}
+	if got := get(t, s, "a.txt"); got != "abcd" {
+		t.Fatalf("file after rejected restore = %q, want abcd", got)
+	}
+	tracker.Add("bob", -15, -1)
+
+	if _, err = s.RestoreVersion(bob, req); err != nil {
+		t.Fatal(err)
+	}
+	if u, _, _, _ := tracker.Usage("alice"); u != (quota.Usage{}) {
+		t.Errorf("alice usage = %+v, want nothing after her file was replaced", u)
+	}
+	if u, _, _, _ := tracker.Usage("bob"); u != (quota.Usage{Bytes: 8, Files: 1}) {
+		t.Errorf("bob usage = %+v, want the restored 8 bytes", u)
+	}
+	info, err := s.storage.Stat(context.Background(), "a.txt")
+	if err != nil || info.Meta.Uploader != "bob" || info.Size != 8 {
+		t.Fatalf("restored file = %+v, %v, want 8 bytes uploaded by bob", info, err)
+	}
+}
+
+// get возвращает содержимое файла name в хранилище сервиса
+func get(t *testing.T, s *FileServiceServer, name string) string {
+	t.Helper()
+	r, err := s.storage.Get(context.Background(), name, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
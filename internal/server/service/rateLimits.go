@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/pkg/ratelimit"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// throttle вернет ограничение скорости передачи для клиента запроса: общее, на клиента и на его IP-адрес.
+// Ограничения клиента и адреса общие для всех их одновременных передач, после передачи их нужно освободить.
+// Клиент определяется только по токену или сертификату: сменой x-client-id ограничение не обойти,
+// клиенты без них ограничиваются по IP-адресу
+func (s *FileServiceServer) throttle(ctx context.Context) (*ratelimit.Limiter, ratelimit.Release) {
+	clientKey, ok := verifiedIdentity(ctx)
+	if !ok {
+		clientKey = peerAddress(ctx)
+	}
+	client, releaseClient := s.clientRates.Acquire(clientKey)
+	ip, releaseIP := s.ipRates.Acquire(peerAddress(ctx))
+	return ratelimit.New(s.globalRate, client, ip), func() {
+		releaseClient()
+		releaseIP()
+	}
+}
+
+// waitRate ждет, пока ограничение скорости позволит передать n байт
+func waitRate(ctx context.Context, op string, limit *ratelimit.Limiter, n int) error {
+	err := limit.Wait(ctx, n)
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return status.FromContextError(ctxErr).Err()
+	}
+	// запрос не успеет до своего дедлайна с такой скоростью
+	log.Printf("%s: rate limit: %v", op, err)
+	return status.Error(codes.DeadlineExceeded, err.Error())
+}
@@ -3,102 +3,263 @@ package service
 import (
 	"context"
 	"errors"
-	"github.com/RVodassa/FileTransfer/pkg/file"
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"hash"
 	"io"
 	"log"
-	"os"
-	"path/filepath"
-	"sync"
+	"time"
 
+	"github.com/RVodassa/FileTransfer/internal/server/access"
 	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/internal/server/pathlock"
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
+	"github.com/RVodassa/FileTransfer/internal/server/session"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/internal/server/versions"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
 	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/ratelimit"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
 	"golang.org/x/sync/semaphore"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
-)
-
-const (
-	defaultBufSize = 1024 * 1024 // 1 MB буфер для чтения/записи файлов
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 var ErrNotFound = errors.New("file not found")
 var ErrLimitRequest = errors.New("too many requests")
 var ErrFilesNotFound = errors.New("file not found")
+var ErrInvalidRange = errors.New("requested range is not satisfiable")
+var ErrInvalidFilename = errors.New("invalid filename")
+var ErrAlreadyExists = errors.New("file already exists")
+var ErrNotDirectory = errors.New("not a directory")
+var ErrIsDirectory = errors.New("is a directory")
+var ErrDirNotEmpty = errors.New("directory is not empty")
 
 type FileServiceServer struct {
 	file_transfer.UnimplementedFileTransferServer
-	dataDir               string
+	storage               storage.Storage
 	fileUploadSemaphore   *semaphore.Weighted
 	fileDownloadSemaphore *semaphore.Weighted
 	listFilesSemaphore    *semaphore.Weighted
-	mu                    sync.Mutex
+	manageFilesSemaphore  *semaphore.Weighted
+	sessions              *session.Store
+	sessionQuota          sessionQuota  // резервы места незавершенных сессий
+	sessionTTL            time.Duration // брошенные сессии загрузки удаляются
+	sessionSweepInterval  time.Duration
+	onConflict            string
+	versions              *versions.Store // nil, если версии не хранятся
+	policy                *access.Policy  // nil, если доступ не ограничен
+	quota                 *quota.Tracker  // nil, если квоты отключены
+	maxUploadBytes        int64           // 0 - без ограничения, не больше предела хранилища
+	locks                 *pathlock.Manager
+	codec                 *compression.Codec // nil, если сжатие отключено
+	chunks                transfer.Settings  // размер частей при скачивании
+	globalRate            *rate.Limiter      // nil, если общая скорость не ограничена
+	clientRates           *ratelimit.Group   // nil, если скорость клиента не ограничена
+	ipRates               *ratelimit.Group   // nil, если скорость с одного IP не ограничена
 }
 
 // NewServiceServer возвращает новый инстанс сервиса
-func NewServiceServer(cfg *config.ServerConfig) *FileServiceServer {
+func NewServiceServer(cfg *config.ServerConfig, store storage.Storage, versionStore *versions.Store, policy *access.Policy, quotaTracker *quota.Tracker, codec *compression.Codec) *FileServiceServer {
 	return &FileServiceServer{
-		dataDir:               cfg.ServerDataDir,
+		storage:               store,
 		fileUploadSemaphore:   semaphore.NewWeighted(int64(cfg.Server.Limits.UploadRequests)),
 		fileDownloadSemaphore: semaphore.NewWeighted(int64(cfg.Server.Limits.DownloadRequests)),
 		listFilesSemaphore:    semaphore.NewWeighted(int64(cfg.Server.Limits.ListRequests)),
+		manageFilesSemaphore:  semaphore.NewWeighted(int64(cfg.Server.Limits.ManageRequests)),
+		sessions:              session.NewStore(cfg.UploadStagingDir),
+		sessionQuota:          sessionQuota{reservations: make(map[string]*quota.Reservation)},
+		sessionTTL:            cfg.UploadSessions.TTL,
+		sessionSweepInterval:  cfg.UploadSessions.SweepInterval,
+		onConflict:            cfg.OnConflict,
+		versions:              versionStore,
+		policy:                policy,
+		quota:                 quotaTracker,
+		maxUploadBytes:        uploadLimit(cfg.Server.Limits.MaxUploadBytes, store),
+		locks:                 pathlock.New(),
+		codec:                 codec,
+		chunks: transfer.Settings{
+			Size:     cfg.Transfer.ChunkSize,
+			Adaptive: cfg.Transfer.Adaptive,
+			Min:      cfg.Transfer.MinChunkSize,
+			Max:      cfg.Transfer.MaxChunkSize,
+		},
+		globalRate:  ratelimit.NewBucket(cfg.Server.Limits.Rate.Global),
+		clientRates: ratelimit.NewGroup(cfg.Server.Limits.Rate.PerClient),
+		ipRates:     ratelimit.NewGroup(cfg.Server.Limits.Rate.PerIP),
 	}
 }
 
 // UploadFile загружает файл клиента на сервер
 func (s *FileServiceServer) UploadFile(stream file_transfer.FileTransfer_UploadFileServer) error {
 	const op = "server.service.UploadFile"
+	ctx := stream.Context()
 
 	// Ограничивает кол-во одновременных запросов
-	if err := s.fileUploadSemaphore.Acquire(stream.Context(), 1); err != nil {
+	if err := s.fileUploadSemaphore.Acquire(ctx, 1); err != nil {
 		return status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
 	}
 	defer s.fileUploadSemaphore.Release(1)
 
 	// обработка данных
 	var filename string
-	var f *file.File
+	var c *caller
+	var w storage.Writer
+	var expected []byte
+	var head []byte // начало файла для определения типа содержимого
+	var reservation *quota.Reservation
+	var received int64
+	var buf transfer.Buffer // для распаковки частей
+	defer buf.Release()
+	limit, release := s.throttle(ctx)
+	defer release()
+	var declared *int64
+	h := checksum.New()
 
 	for {
 		req, err := stream.Recv()
 		if err != nil {
 			if err == io.EOF {
-				log.Printf("%s: filename:%s. Upload completed", op, filename)
-				return stream.SendAndClose(&file_transfer.UploadFileResponse{Message: "File uploaded successfully!"})
+				if w != nil {
+					// Проверяет, что принят весь заявленный файл
+					if err = checkComplete(received, declared); err != nil {
+						return discardFile(op, filename, w, codes.InvalidArgument, err)
+					}
+					// Проверяет целостность файла до подтверждения загрузки
+					if err = checksum.Verify(h, expected); err != nil {
+						return discardFile(op, filename, w, codes.DataLoss, err)
+					}
+					// Уточняет квоту по файлу, который заменит загрузка
+					replaced, isReplaced := s.usageOf(ctx, filename)
+					if err = reservation.Settle(isReplaced, replaced.owner); err != nil {
+						return discardFile(op, filename, w, codes.ResourceExhausted, err)
+					}
+					// Сохраняет заменяемый файл как версию
+					if err = s.archiveVersion(ctx, filename); err != nil {
+						return err
+					}
+					// Заменяет итоговый файл только после успешного приема всех данных
+					m := meta.Meta{SHA256: h.Sum(nil), Uploader: c.identity, ContentType: meta.DetectContentType(filename, head)}
+					if err = w.Commit(m); err != nil {
+						log.Printf("%s: failed to commit file: %v", op, err)
+						return status.Errorf(codes.Internal, "failed to commit file: %v", err)
+					}
+					if isReplaced {
+						s.releaseUsage(replaced)
+					}
+					reservation.Commit(received)
+					filename = c.display(filename)
+				}
+				log.Printf("%s: filename:%s. Upload completed, sha256 %s", op, filename, checksum.Hex(h.Sum(nil)))
+				return stream.SendAndClose(&file_transfer.UploadFileResponse{
+					Message:  "File uploaded successfully!",
+					Sha256:   h.Sum(nil),
+					Filename: filename,
+				})
 			}
 			log.Printf("%s: filename:%s. failed to receive data: %v", op, filename, err)
 			return status.Errorf(codes.Internal, "filename:%s. failed to receive data: %v", filename, err)
 		}
 
-		//  создает файл в первом цикле for
+		// алгоритм сжатия выбирается по первому сообщению на весь поток
 		if filename == "" {
-			s.mu.Lock()
-			defer s.mu.Unlock()
+			if err = s.negotiateUpload(op, stream, req.AcceptCompression); err != nil {
+				return err
+			}
+		}
 
-			f = file.NewFile()
-			filename = filepath.Base(req.Filename)
+		// продолжение сессии загрузки
+		if filename == "" && req.SessionId != "" {
+			return s.uploadSession(stream, req)
+		}
 
-			err = f.SetFile(filename, s.dataDir)
+		//  создает файл в первом цикле for
+		if filename == "" {
+			c, filename, err = s.authorize(ctx, req.Filename, access.Write)
 			if err != nil {
-				log.Printf("%s: failed to set file: %v", op, err)
-				return status.Errorf(codes.Internal, "failed to set file: %v", err)
+				return err
+			}
+			// Отклоняет слишком большой файл до приема данных
+			declared = req.Size
+			if err = s.checkDeclaredSize(declared); err != nil {
+				return err
 			}
+			// Выбирает итоговое имя с учетом политики при совпадении имен.
+			// Файл заблокирован до конца загрузки: другие загрузки и скачивания этого файла ждут
+			var unlock pathlock.Unlock
+			if filename, unlock, err = s.resolveConflict(ctx, filename, s.conflictPolicy(req.ConflictPolicy)); err != nil {
+				return err
+			}
+			defer unlock()
+			// Проверяет квоты по заявленному размеру до приема данных
+			if reservation, err = s.reserveQuota(ctx, op, c, filename, req.GetSize()); err != nil {
+				return err
+			}
+			defer reservation.Release()
+
+			if w, err = s.storage.Put(ctx, filename); err != nil {
+				return storageError(op, err)
+			}
+			storage.SetSizeHint(w, req.GetSize())
+			// удаляет принятые данные, если загрузка не завершилась
+			defer func() {
+				if abortErr := w.Abort(); abortErr != nil {
+					log.Printf("%s: failed to remove staging file: %v", op, abortErr)
+				}
+			}()
+		}
+
+		if err = waitRate(ctx, op, limit, len(req.Content)); err != nil {
+			return err
+		}
+		// проверяет целостность части файла и распаковывает ее
+		content, code, err := s.decodeChunk(req.Content, req.Crc32C, req.Compression, &buf)
+		if err != nil {
+			return discardFile(op, filename, w, code, err)
+		}
+		if len(req.Sha256) > 0 {
+			expected = req.Sha256
 		}
 
 		// записывает данные в файл
-		if len(req.Content) > 0 {
-			log.Printf("%s: received %d bytes for file: %s", op, len(req.Content), filename)
-			if err = f.Write(req.Content); err != nil {
+		if len(content) > 0 {
+			log.Printf("%s: received %d bytes for file: %s", op, len(content), filename)
+			if _, err = w.Write(content); err != nil {
 				log.Printf("%s: failed to write data: %v", op, err)
 				return status.Errorf(codes.Internal, "failed to write data: %v", err)
 			}
+			h.Write(content)
+			if len(head) < meta.SniffLen {
+				head = append(head, content[:min(len(content), meta.SniffLen-len(head))]...)
+			}
+			// Проверяет квоты по мере приема, если файл больше заявленного
+			received += int64(len(content))
+			if code, sizeErr := s.checkReceived(received, declared); sizeErr != nil {
+				return discardFile(op, filename, w, code, sizeErr)
+			}
+			if err = reservation.Grow(received); err != nil {
+				return discardFile(op, filename, w, codes.ResourceExhausted, err)
+			}
 		} else {
 			log.Printf("%s: received empty content for file: %s", op, filename)
 		}
 	}
 }
 
-// ListFiles возвращает клиенту информацию о файлах
-func (s *FileServiceServer) ListFiles(ctx context.Context, req *file_transfer.Empty) (*file_transfer.ListFilesResponse, error) {
+// discardFile удаляет недокачанный файл, поврежденный при передаче или превысивший лимиты
+func discardFile(op, filename string, w storage.Writer, code codes.Code, err error) error {
+	if abortErr := w.Abort(); abortErr != nil {
+		log.Printf("%s: failed to remove staging file for %s: %v", op, filename, abortErr)
+	}
+	log.Printf("%s: file %s discarded: %v", op, filename, err)
+	return status.Error(code, err.Error())
+}
+
+// ListFiles возвращает клиенту информацию о файлах в директории
+func (s *FileServiceServer) ListFiles(ctx context.Context, req *file_transfer.ListFilesRequest) (*file_transfer.ListFilesResponse, error) {
 	const op = "server.service.ListFiles"
 
 	// Ограничивает кол-во одновременных запросов
@@ -107,75 +268,156 @@ func (s *FileServiceServer) ListFiles(ctx context.Context, req *file_transfer.Em
 	}
 	defer s.listFilesSemaphore.Release(1)
 
-	// читает директорию с файлами
-	files, err := os.ReadDir(s.dataDir)
+	q, err := newListQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	c, dir, err := s.listDir(ctx, op, req.Directory)
+	if err != nil {
+		return nil, err
+	}
+
+	// Собирает первые подходящие под фильтры файлы после курсора,
+	// во вложенные директории заходит только при recursive
+	page := newListPage(q)
+	err = storage.Walk(ctx, s.storage, dir, func(info storage.Info) error {
+		e := listEntry{name: c.display(info.Name), info: info}
+		if q.match(e) {
+			e.key = q.cursorOf(e)
+			if q.afterCursor(e) {
+				page.add(e)
+			}
+		}
+
+		if info.IsDir && !req.Recursive {
+			return storage.SkipDir
+		}
+		return nil
+	})
 	if err != nil {
-		if errors.Is(err, os.ErrNotExist) {
-			return nil, status.Errorf(codes.NotFound, ErrFilesNotFound.Error())
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
 		}
 		log.Printf("%s: failed to read directory: %v", op, err)
 		return nil, status.Errorf(codes.Internal, "failed to read directory: %v", err)
 	}
 
-	// Читает информацию о файлах
-	var fileInfos []*file_transfer.FileInfo
-	var fileStat os.FileInfo
-	for _, f := range files {
-		if !f.IsDir() {
-			filePath := filepath.Join(s.dataDir, f.Name())
-			fileStat, err = os.Stat(filePath)
-			if err != nil {
-				log.Printf("%s: failed to get file info: %v", op, err)
-				continue // Пропускаем файл, если не удалось получить информацию
-			}
+	entries := page.sorted()
+	resp := &file_transfer.ListFilesResponse{}
+	if len(entries) > q.pageSize {
+		entries = entries[:q.pageSize]
+		resp.NextPageToken = q.pageToken(entries[len(entries)-1])
+	}
+	resp.Files = make([]*file_transfer.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		if e.info, err = s.withMeta(ctx, op, e.info); err != nil {
+			return nil, err
+		}
+		resp.Files = append(resp.Files, fileInfo(e.name, &e.info))
+	}
+	return resp, nil
+}
 
-			fileInfos = append(fileInfos, &file_transfer.FileInfo{
-				Name:             f.Name(),
-				CreationTime:     fileStat.ModTime().Format("2006-01-02 15:04:05"),
-				ModificationTime: fileStat.ModTime().Format("2006-01-02 15:04:05"),
-			})
+// listDir проверяет право на просмотр директории и что она существует, возвращает клиента и путь от корня хранилища
+func (s *FileServiceServer) listDir(ctx context.Context, op, dir string) (*caller, string, error) {
+	c, dir, err := s.authorizeDir(ctx, dir, access.List)
+	if err != nil {
+		return nil, "", err
+	}
+
+	info, err := s.storage.Stat(ctx, dir)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return nil, "", status.Errorf(codes.NotFound, ErrFilesNotFound.Error())
 		}
+		return nil, "", storageError(op, err)
+	}
+	if !info.IsDir {
+		return nil, "", status.Error(codes.InvalidArgument, ErrNotDirectory.Error())
+	}
+	return c, dir, nil
+}
+
+// withMeta дополняет метаданными загрузки файл из списка. Файл, удаленный после обхода,
+// отдается со сведениями из списка
+func (s *FileServiceServer) withMeta(ctx context.Context, op string, info storage.Info) (storage.Info, error) {
+	full, err := storage.WithMeta(ctx, s.storage, info)
+	if err != nil && !errors.Is(err, storage.ErrNotFound) {
+		return info, storageError(op, err)
+	}
+	return full, nil
+}
+
+// fileInfo собирает информацию о файле, name - путь, который видит клиент
+func fileInfo(name string, info *storage.Info) *file_transfer.FileInfo {
+	fi := &file_transfer.FileInfo{
+		Name:  name,
+		Size:  info.Size,
+		IsDir: info.IsDir,
+		Mode:  uint32(info.Mode),
+	}
+	// у директорий в S3 времени изменения нет
+	if !info.ModTime.IsZero() {
+		fi.ModificationTime = timestamppb.New(info.ModTime)
+	}
+	if !info.CreationTime.IsZero() {
+		fi.CreationTime = timestamppb.New(info.CreationTime)
+	}
+	if info.IsDir {
+		return fi
 	}
 
-	return &file_transfer.ListFilesResponse{Files: fileInfos}, nil
+	fi.Sha256 = info.Meta.SHA256
+	fi.Uploader = info.Meta.Uploader
+	fi.ContentType = info.Meta.ContentType
+	if fi.ContentType == "" {
+		fi.ContentType = meta.DetectContentType(info.Name, nil)
+	}
+	return fi
 }
 
 // GetFile отправляет файл клиенту
 func (s *FileServiceServer) GetFile(req *file_transfer.GetFileRequest, stream file_transfer.FileTransfer_GetFileServer) error {
 	const op = "server.service.GetFile"
+	ctx := stream.Context()
 
 	// Ограничиваем кол-во одновременных скачиваний
-	if err := s.fileDownloadSemaphore.Acquire(stream.Context(), 1); err != nil {
+	if err := s.fileDownloadSemaphore.Acquire(ctx, 1); err != nil {
 		return status.Errorf(codes.ResourceExhausted, ErrLimitRequest.Error())
 	}
 	defer s.fileDownloadSemaphore.Release(1)
 
-	filePath := filepath.Join(s.dataDir, req.Filename)
+	_, filename, err := s.authorize(ctx, req.Filename, access.Read)
+	if err != nil {
+		return err
+	}
 
-	// Проверяет, существует ли директория с файлами
-	if _, err := os.Stat(filepath.Dir(filePath)); err != nil {
-		if os.IsNotExist(err) {
-			log.Printf("%s: directory does not exist: %v", op, err)
-			return status.Error(codes.NotFound, ErrFilesNotFound.Error())
-		}
-		log.Printf("%s: failed to stat directory: %v", op, err)
-		return status.Errorf(codes.Internal, "failed to stat directory: %v", err)
+	// Проверяет запрошенный диапазон
+	if req.Offset < 0 || req.Length < 0 {
+		return status.Error(codes.InvalidArgument, ErrInvalidRange.Error())
+	}
+	// SHA-256 всего файла отправляется, если передача идет до конца файла.
+	// Начало файла до offset хешируется без отправки.
+	start := req.Offset
+	if req.Length == 0 {
+		start = 0
 	}
 
-	// Проверяем, существует ли файл
-	if _, err := os.Stat(filePath); os.IsNotExist(err) {
-		log.Printf("%s: file not found: %v", op, err)
-		return status.Error(codes.NotFound, ErrNotFound.Error())
-	} else if err != nil {
-		log.Printf("%s: failed to stat file: %v", op, err)
-		return status.Errorf(codes.Internal, "failed to stat file: %v", err)
+	// Файл и его версии не заменят и не удалят до конца передачи
+	unlock, err := s.rlockPath(ctx, filename)
+	if err != nil {
+		return err
 	}
+	defer unlock()
 
-	// Отправляет файл клиенту частями
-	f, err := os.Open(filePath)
+	var f io.ReadCloser
+	if req.VersionId != "" {
+		f, err = s.openVersion(op, filename, req.VersionId, req.Offset, start, req.Length)
+	} else {
+		f, err = s.openFile(ctx, op, filename, req.Offset, start, req.Length)
+	}
 	if err != nil {
-		log.Printf("%s: failed to open file: %v", op, err)
-		return status.Errorf(codes.Internal, "failed to open file: %v", err)
+		return err
 	}
 	defer func() {
 		if closeErr := f.Close(); closeErr != nil {
@@ -183,21 +425,98 @@ func (s *FileServiceServer) GetFile(req *file_transfer.GetFileRequest, stream fi
 		}
 	}()
 
-	buf := make([]byte, defaultBufSize)
-	var n int
-	for {
-		n, err = f.Read(buf)
+	var h hash.Hash
+	if req.Length == 0 {
+		h = checksum.New()
+		if _, err = io.CopyN(h, f, req.Offset); err != nil {
+			log.Printf("%s: failed to read file: %v", op, err)
+			return status.Errorf(codes.Internal, "failed to read file: %v", err)
+		}
+	}
+
+	// Отправляет файл клиенту частями, алгоритм сжатия выбирается по первой части
+	limit, release := s.throttle(ctx)
+	defer release()
+	chunks := transfer.NewReader(f, transfer.NewSizer(s.chunks))
+	defer chunks.Release()
+	var out transfer.Buffer
+	defer out.Release()
+	var alg file_transfer.Compression
+	var stats compression.Stats
+	for first := true; ; first = false {
+		chunk, err := chunks.Next()
+		if err == io.EOF {
+			break
+		}
 		if err != nil {
-			if err == io.EOF {
-				break
-			}
 			log.Printf("%s: failed to read file: %v", op, err)
 			return status.Errorf(codes.Internal, "failed to read file: %v", err)
 		}
-		if err = stream.Send(&file_transfer.GetFileResponse{Content: buf[:n]}); err != nil {
+		if h != nil {
+			h.Write(chunk)
+		}
+		if first {
+			alg = s.downloadCompression(req.AcceptCompression, filename, chunk)
+		}
+		var dst []byte
+		if alg != file_transfer.Compression_COMPRESSION_NONE {
+			dst = out.Bytes()
+		}
+		content, used, err := s.codec.Encode(alg, chunk, dst)
+		if err != nil {
+			log.Printf("%s: failed to compress file chunk: %v", op, err)
+			return status.Errorf(codes.Internal, "failed to compress file chunk: %v", err)
+		}
+		stats.Add(len(chunk), len(content))
+		if err = waitRate(ctx, op, limit, len(content)); err != nil {
+			return err
+		}
+		crc := checksum.Chunk(content)
+		resp := &file_transfer.GetFileResponse{Content: content, Crc32C: &crc, Compression: used}
+		if err = stream.Send(resp); err != nil {
 			log.Printf("%s: failed to send file chunk: %v", op, err)
 			return status.Errorf(codes.Internal, "failed to send file chunk: %v", err)
 		}
 	}
+
+	if h != nil {
+		if err = stream.Send(&file_transfer.GetFileResponse{Sha256: h.Sum(nil)}); err != nil {
+			log.Printf("%s: failed to send checksum: %v", op, err)
+			return status.Errorf(codes.Internal, "failed to send checksum: %v", err)
+		}
+	}
+	if alg != file_transfer.Compression_COMPRESSION_NONE {
+		log.Printf("%s: filename:%s. compression %s: %s", op, filename, compression.Name(alg), &stats)
+	}
+	return nil
+}
+
+// openFile открывает файл хранилища на чтение с позиции start после проверки,
+// что offset не выходит за конец файла
+func (s *FileServiceServer) openFile(ctx context.Context, op, filename string, offset, start, length int64) (io.ReadCloser, error) {
+	info, err := s.storage.Stat(ctx, filename)
+	if err != nil {
+		return nil, storageError(op, err)
+	}
+	if info.IsDir {
+		return nil, status.Error(codes.FailedPrecondition, ErrIsDirectory.Error())
+	}
+	if err = checkRange(op, offset, info.Size); err != nil {
+		return nil, err
+	}
+
+	f, err := s.storage.Get(ctx, filename, start, length)
+	if err != nil {
+		return nil, storageError(op, err)
+	}
+	return f, nil
+}
+
+// checkRange проверяет, что offset не выходит за конец файла
+func checkRange(op string, offset, size int64) error {
+	if offset > size {
+		log.Printf("%s: offset %d is beyond file size %d", op, offset, size)
+		return status.Error(codes.OutOfRange, ErrInvalidRange.Error())
+	}
 	return nil
 }
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Прерванная загрузка удаляет staging файл и не трогает прежнюю версию файла
+func TestUploadAbortRemovesStaging(t *testing.T) {
+	content := []byte("new content")
+	crc := checksum.Chunk(content)
+	wrongCRC := crc ^ 1
+
+	tests := []struct {
+		name     string
+		last     *file_transfer.UploadFileRequest // последнее сообщение потока
+		err      error                            // ошибка потока после всех сообщений
+		wantCode codes.Code
+	}{
+		{name: "client disconnected", err: errDisconnected, wantCode: codes.Internal},
+		{name: "corrupted chunk", last: &file_transfer.UploadFileRequest{Content: content, Crc32C: &wrongCRC}, wantCode: codes.DataLoss},
+		{name: "checksum mismatch", last: &file_transfer.UploadFileRequest{Content: content, Crc32C: &crc, Sha256: make([]byte, 32)}, wantCode: codes.DataLoss},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newQuotaServer(t, 0)
+			dir := t.TempDir()
+			s.storage = storage.NewLocal(dir)
+			if err := upload(t, s, clientContext("alice"), "a.txt", "old"); err != nil {
+				t.Fatal(err)
+			}
+
+			stream := newUploadStream("a.txt", content, 2)
+			if tt.last != nil {
+				stream.reqs[len(stream.reqs)-1] = tt.last
+			}
+			stream.err = tt.err
+			if err := s.UploadFile(stream); status.Code(err) != tt.wantCode {
+				t.Fatalf("UploadFile error = %v, want %v", err, tt.wantCode)
+			}
+
+			if got := get(t, s, "a.txt"); got != "old" {
+				t.Errorf("file after failed upload = %q, want %q", got, "old")
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if e.Name() != "a.txt" {
+					t.Errorf("unexpected file %q left after failed upload", e.Name())
+				}
+			}
+		})
+	}
+}
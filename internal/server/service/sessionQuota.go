@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
+	"github.com/RVodassa/FileTransfer/internal/server/session"
+)
+
+// sessionQuota резервы места сессий загрузки по идентификатору сессии. Резерв держится
+// от создания сессии до ее завершения или удаления, в том числе пока клиент не передает данные:
+// иначе принятые в staging директорию данные не учитываются в квоте
+type sessionQuota struct {
+	mu           sync.Mutex
+	reservations map[string]*quota.Reservation
+}
+
+// sessionReservation возвращает резерв сессии. Если его нет (сервер перезапускался),
+// резервирует место под received уже принятых байт или заявленный размер, если он больше
+func (s *FileServiceServer) sessionReservation(ctx context.Context, op string, c *caller, sess *session.Session, received int64) (*quota.Reservation, error) {
+	if s.quota == nil {
+		return nil, nil
+	}
+	s.sessionQuota.mu.Lock()
+	r, ok := s.sessionQuota.reservations[sess.ID]
+	s.sessionQuota.mu.Unlock()
+	if ok {
+		return r, nil
+	}
+
+	if sess.Owner != "" {
+		c = &caller{identity: sess.Owner}
+	}
+	reserve := received
+	if sess.Size != nil && *sess.Size > reserve {
+		reserve = *sess.Size
+	}
+	r, err := s.reserveQuota(ctx, op, c, sess.Filename, reserve)
+	if err != nil {
+		return nil, err
+	}
+	s.holdSessionQuota(sess.ID, r)
+	return r, nil
+}
+
+// holdSessionQuota сохраняет резерв сессии id до ее завершения
+func (s *FileServiceServer) holdSessionQuota(id string, r *quota.Reservation) {
+	if r == nil {
+		return
+	}
+	s.sessionQuota.mu.Lock()
+	defer s.sessionQuota.mu.Unlock()
+	if old, ok := s.sessionQuota.reservations[id]; ok && old != r {
+		old.Release()
+	}
+	s.sessionQuota.reservations[id] = r
+}
+
+// releaseSessionQuota освобождает резерв завершенной или удаленной сессии id.
+// После Commit резерв только забывается
+func (s *FileServiceServer) releaseSessionQuota(id string) {
+	s.sessionQuota.mu.Lock()
+	r := s.sessionQuota.reservations[id]
+	delete(s.sessionQuota.reservations, id)
+	s.sessionQuota.mu.Unlock()
+	r.Release()
+}
+
+// RestoreSessionQuota резервирует место под сессии, оставшиеся в staging директории
+// после перезапуска сервера. Сессия, которая не помещается в квоту, резервируется
+// заново при продолжении и отклоняется
+func (s *FileServiceServer) RestoreSessionQuota(ctx context.Context) {
+	const op = "server.service.RestoreSessionQuota"
+
+	if s.quota == nil {
+		return
+	}
+	ids, err := s.sessions.IDs()
+	if err != nil {
+		log.Printf("%s: failed to list upload sessions: %v", op, err)
+		return
+	}
+	for _, id := range ids {
+		sess, received, err := s.sessions.Get(id)
+		if err != nil || sess.Owner == "" {
+			continue
+		}
+		if _, err = s.sessionReservation(ctx, op, &caller{identity: sess.Owner}, sess, received); err != nil {
+			log.Printf("%s: session %s: %v", op, id, err)
+		}
+	}
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var errDisconnected = errors.New("client disconnected")
+
+// Приостановленная сессия держит заявленный размер в квоте до завершения или удаления
+func TestSessionQuota(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var cfg config.ServerConfig
+	cfg.Server.Limits.UploadRequests = 1
+	cfg.Server.Limits.ManageRequests = 1
+	cfg.UploadStagingDir = t.TempDir()
+	cfg.OnConflict = config.ConflictOverwrite
+	tracker := quota.NewTracker(quota.Limits{}, quota.Limits{MaxBytes: 10}, nil)
+	s := NewServiceServer(&cfg, storage.NewMemory(), nil, nil, tracker, nil)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ClientIDHeader, "alice"))
+
+	start := func(name string, size int64) (*file_transfer.UploadSession, error) {
+		return s.StartUploadSession(ctx, &file_transfer.StartUploadSessionRequest{Filename: name, Size: &size})
+	}
+	usage := func() quota.Usage {
+		u, _, _, _ := tracker.Usage("alice")
+		return u
+	}
+
+	sess, err := start("a.bin", 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := usage(); u != (quota.Usage{Bytes: 8, Files: 1}) {
+		t.Fatalf("usage after start = %+v, want 8 bytes and 1 file", u)
+	}
+
+	// поток обрывается после половины файла
+	stream := &uploadStream{ctx: ctx, err: errDisconnected, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: sess.SessionId, Content: []byte("0123")},
+	}}
+	if err = s.UploadFile(stream); status.Code(err) != codes.Internal {
+		t.Fatalf("interrupted upload error = %v, want Internal", err)
+	}
+	if u := usage(); u != (quota.Usage{Bytes: 8, Files: 1}) {
+		t.Fatalf("usage of paused session = %+v, want 8 bytes and 1 file", u)
+	}
+	if _, err = start("b.bin", 4); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("start over quota while session paused error = %v, want ResourceExhausted", err)
+	}
+
+	// продолжение сессии не резервирует место второй раз
+	stream = &uploadStream{ctx: ctx, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: sess.SessionId, Offset: 4, Content: []byte("4567")},
+	}}
+	if err = s.UploadFile(stream); err != nil {
+		t.Fatal(err)
+	}
+	if u := usage(); u != (quota.Usage{Bytes: 8, Files: 1}) {
+		t.Fatalf("usage after completed session = %+v, want 8 bytes and 1 file", u)
+	}
+
+	// брошенная сессия освобождает место при удалении
+	sess, err = start("b.bin", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	removed, err := s.sessions.Sweep(-time.Second)
+	if err != nil || len(removed) != 1 || removed[0] != sess.SessionId {
+		t.Fatalf("sweep removed %v, %v, want %s", removed, err, sess.SessionId)
+	}
+	s.releaseSessionQuota(sess.SessionId)
+	if u := usage(); u != (quota.Usage{Bytes: 8, Files: 1}) {
+		t.Fatalf("usage after expired session = %+v, want 8 bytes and 1 file", u)
+	}
+
+	// после перезапуска сервера место сессии резервируется заново
+	if _, err = start("c.bin", 2); err != nil {
+		t.Fatal(err)
+	}
+	restarted := NewServiceServer(&cfg, s.storage, nil, nil, quota.NewTracker(quota.Limits{}, quota.Limits{}, nil), nil)
+	restarted.RestoreSessionQuota(context.Background())
+	if u, _, _, _ := restarted.quota.Usage("alice"); u != (quota.Usage{Bytes: 2, Files: 1}) {
+		t.Fatalf("usage after restart = %+v, want 2 bytes and 1 file", u)
+	}
+}
+
+// Продолжить и завершить сессию может только создавший ее клиент, файл записывается за ним
+func TestSessionOwner(t *testing.T) {
+	s, tracker := newQuotaServer(t, 100)
+	alice, bob := clientContext("alice"), clientContext("bob")
+
+	size := int64(8)
+	sess, err := s.StartUploadSession(alice, &file_transfer.StartUploadSessionRequest{Filename: "a.bin", Size: &size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream := &uploadStream{ctx: bob, reqs: []*file_transfer.UploadFileRequest{{SessionId: sess.SessionId, Content: []byte("01234567")}}}
+	if err = s.UploadFile(stream); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("upload to another client's session error = %v, want PermissionDenied", err)
+	}
+	if _, err = s.CompleteUploadSession(bob, &file_transfer.CompleteUploadSessionRequest{SessionId: sess.SessionId}); status.Code(err) != codes.PermissionDenied {
+		t.Fatalf("complete of another client's session error = %v, want PermissionDenied", err)
+	}
+
+	stream = &uploadStream{ctx: alice, reqs: []*file_transfer.UploadFileRequest{{SessionId: sess.SessionId, Content: []byte("01234567")}}}
+	if err = s.UploadFile(stream); err != nil {
+		t.Fatal(err)
+	}
+	info, err := s.storage.Stat(context.Background(), "a.bin")
+	if err != nil || info.Meta.Uploader != "alice" {
+		t.Fatalf("file = %+v, %v, want uploaded by alice", info, err)
+	}
+	if u, _, _, _ := tracker.Usage("alice"); u != (quota.Usage{Bytes: 8, Files: 1}) {
+		t.Errorf("alice usage = %+v, want 8 bytes and 1 file", u)
+	}
+	if u, _, _, _ := tracker.Usage("bob"); u != (quota.Usage{}) {
+		t.Errorf("bob usage = %+v, want nothing", u)
+	}
+}
@@ -0,0 +1,34 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// storageError переводит ошибки хранилища файлов в gRPC статусы
+func storageError(op string, err error) error {
+	switch {
+	case errors.Is(err, storage.ErrNotFound):
+		return status.Error(codes.NotFound, ErrNotFound.Error())
+	case errors.Is(err, storage.ErrExist):
+		return status.Error(codes.AlreadyExists, ErrAlreadyExists.Error())
+	case errors.Is(err, storage.ErrIsDir):
+		return status.Error(codes.FailedPrecondition, ErrIsDirectory.Error())
+	case errors.Is(err, storage.ErrNotDir):
+		return status.Error(codes.FailedPrecondition, ErrNotDirectory.Error())
+	case errors.Is(err, storage.ErrNotEmpty):
+		return status.Error(codes.FailedPrecondition, ErrDirNotEmpty.Error())
+	case errors.Is(err, storage.ErrInvalidPath):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	default:
+		log.Printf("%s: storage error: %v", op, err)
+		return status.Errorf(codes.Internal, "storage error: %v", err)
+	}
+}
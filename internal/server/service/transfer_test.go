@@ -0,0 +1,95 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/compression"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc"
+)
+
+// downloadStream поток скачивания, который отбрасывает полученные части
+type downloadStream struct {
+	grpc.ServerStream
+	received int
+}
+
+func (s *downloadStream) Context() context.Context { return context.Background() }
+
+func (s *downloadStream) Send(resp *file_transfer.GetFileResponse) error {
+	s.received += len(resp.Content)
+	return nil
+}
+
+// Выделения памяти на одно скачивание файла 16 MB при разных размерах частей и сжатии.
+// Буферы частей и сжатия берутся из общего пула, поэтому не растут с размером файла
+func BenchmarkGetFile(b *testing.B) {
+	const size = 16 << 20
+	content := bytes.Repeat([]byte("id,name,size\n1,report.csv,1024\n"), size/32)
+
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	store := storage.NewMemory()
+	w, err := store.Put(context.Background(), "report.csv")
+	if err != nil {
+		b.Fatal(err)
+	}
+	if _, err = w.Write(content); err != nil {
+		b.Fatal(err)
+	}
+	if err = w.Commit(meta.Meta{}); err != nil {
+		b.Fatal(err)
+	}
+	codec, err := compression.New(compression.Levels{})
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bc := range []struct {
+		name      string
+		chunkSize int
+		adaptive  bool
+		alg       file_transfer.Compression
+	}{
+		{name: "64KB", chunkSize: 64 << 10},
+		{name: "1MB", chunkSize: 1 << 20},
+		{name: "4MB", chunkSize: 4 << 20},
+		{name: "adaptive", chunkSize: 1 << 20, adaptive: true},
+		{name: "1MB-zstd", chunkSize: 1 << 20, alg: file_transfer.Compression_COMPRESSION_ZSTD},
+		{name: "1MB-gzip", chunkSize: 1 << 20, alg: file_transfer.Compression_COMPRESSION_GZIP},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			var cfg config.ServerConfig
+			cfg.Server.Limits.DownloadRequests = 1
+			cfg.Transfer.ChunkSize = bc.chunkSize
+			cfg.Transfer.Adaptive = bc.adaptive
+			s := NewServiceServer(&cfg, store, nil, nil, nil, codec)
+
+			req := &file_transfer.GetFileRequest{Filename: "report.csv"}
+			if bc.alg != file_transfer.Compression_COMPRESSION_NONE {
+				req.AcceptCompression = []file_transfer.Compression{bc.alg}
+			}
+			b.SetBytes(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				stream := &downloadStream{}
+				if err := s.GetFile(req, stream); err != nil {
+					b.Fatal(err)
+				}
+				if stream.received == 0 {
+					b.Fatal("nothing was sent")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrUploadTooLarge = errors.New("upload exceeds maximum size")
+var ErrSizeMismatch = errors.New("received size does not match declared size")
+
+// uploadLimit возвращает наибольший размер загрузки: лимит из конфига, но не больше файла,
+// который может сохранить хранилище (S3 - maxS3Parts частей). 0 - без ограничения
+func uploadLimit(configured int64, st storage.Storage) int64 {
+	limit := storage.MaxFileSize(st)
+	if configured > 0 && (limit == 0 || configured < limit) {
+		return configured
+	}
+	return limit
+}
+
+// checkDeclaredSize проверяет заявленный клиентом размер до приема данных
+func (s *FileServiceServer) checkDeclaredSize(size *int64) error {
+	if size == nil {
+		return nil
+	}
+	if *size < 0 {
+		return status.Errorf(codes.InvalidArgument, "invalid declared size %d", *size)
+	}
+	if s.maxUploadBytes > 0 && *size > s.maxUploadBytes {
+		return status.Errorf(codes.ResourceExhausted, "%v: declared %d bytes, limit is %d", ErrUploadTooLarge, *size, s.maxUploadBytes)
+	}
+	return nil
+}
+
+// checkReceived проверяет принятые байты по мере записи: данных не больше лимита
+// сервера и не больше заявленного размера
+func (s *FileServiceServer) checkReceived(received int64, size *int64) (codes.Code, error) {
+	if s.maxUploadBytes > 0 && received > s.maxUploadBytes {
+		return codes.ResourceExhausted, fmt.Errorf("%w: received more than %d bytes", ErrUploadTooLarge, s.maxUploadBytes)
+	}
+	if size != nil && received > *size {
+		return codes.InvalidArgument, fmt.Errorf("%w: received more than %d bytes", ErrSizeMismatch, *size)
+	}
+	return codes.OK, nil
+}
+
+// checkComplete сверяет кол-во принятых байт с заявленным размером в конце потока
+func checkComplete(received int64, size *int64) error {
+	if size != nil && received != *size {
+		return fmt.Errorf("%w: received %d bytes, declared %d", ErrSizeMismatch, received, *size)
+	}
+	return nil
+}
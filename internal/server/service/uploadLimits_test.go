@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+	"os"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/config"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// limitedStorage хранилище с пределом размера файла, считает вызовы Put
+type limitedStorage struct {
+	storage.Storage
+	maxFileSize int64
+	puts        int
+}
+
+func (s *limitedStorage) MaxFileSize() int64 { return s.maxFileSize }
+
+func (s *limitedStorage) Put(ctx context.Context, name string) (storage.Writer, error) {
+	s.puts++
+	return s.Storage.Put(ctx, name)
+}
+
+func TestUploadLimit(t *testing.T) {
+	tests := []struct {
+		configured, storage, want int64
+	}{
+		{configured: 0, storage: 0, want: 0},
+		{configured: 100, storage: 0, want: 100},
+		{configured: 0, storage: 50, want: 50},
+		{configured: 100, storage: 50, want: 50},
+		{configured: 10, storage: 50, want: 10},
+	}
+	for _, tt := range tests {
+		st := &limitedStorage{Storage: storage.NewMemory(), maxFileSize: tt.storage}
+		if got := uploadLimit(tt.configured, st); got != tt.want {
+			t.Errorf("uploadLimit(%d) with storage limit %d = %d, want %d", tt.configured, tt.storage, got, tt.want)
+		}
+	}
+}
+
+// Файл больше предела хранилища отклоняется до Put, даже если max_upload_bytes не задан
+func TestDeclaredSizeOverStorageLimit(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	var cfg config.ServerConfig
+	cfg.Server.Limits.UploadRequests = 1
+	cfg.UploadStagingDir = t.TempDir()
+	cfg.OnConflict = config.ConflictOverwrite
+	st := &limitedStorage{Storage: storage.NewMemory(), maxFileSize: 1 << 20}
+	s := NewServiceServer(&cfg, st, nil, nil, nil, nil)
+
+	size := int64(1 << 40)
+	stream := &uploadStream{reqs: []*file_transfer.UploadFileRequest{{Filename: "huge.bin", Size: &size}}}
+	if err := s.UploadFile(stream); status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("upload of %d bytes error = %v, want ResourceExhausted", size, err)
+	}
+	if st.puts != 0 {
+		t.Fatalf("Put called %d times for rejected upload", st.puts)
+	}
+}
+
+func TestUploadSize(t *testing.T) {
+	sizeOf := func(n int64) *int64 { return &n }
+	tests := []struct {
+		name     string
+		declared *int64
+		chunks   int // части по 4 байта
+		wantCode codes.Code
+	}{
+		{name: "within limit", declared: sizeOf(8), chunks: 2},
+		{name: "declared at limit without data", declared: sizeOf(10), chunks: 0, wantCode: codes.InvalidArgument},
+		{name: "declared over limit", declared: sizeOf(11), chunks: 1, wantCode: codes.ResourceExhausted},
+		{name: "negative declared size", declared: sizeOf(-1), chunks: 1, wantCode: codes.InvalidArgument},
+		{name: "more than declared", declared: sizeOf(6), chunks: 2, wantCode: codes.InvalidArgument},
+		{name: "less than declared", declared: sizeOf(9), chunks: 2, wantCode: codes.InvalidArgument},
+		{name: "undeclared over limit", chunks: 3, wantCode: codes.ResourceExhausted},
+		{name: "undeclared within limit", chunks: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, tracker := newQuotaServer(t, 0)
+			s.maxUploadBytes = 10
+			ctx := clientContext("alice")
+
+			stream := newUploadStream("a.txt", []byte("data"), tt.chunks)
+			stream.ctx = ctx
+			stream.reqs[0].Size = tt.declared
+			if err := s.UploadFile(stream); status.Code(err) != tt.wantCode {
+				t.Fatalf("UploadFile error = %v, want %v", err, tt.wantCode)
+			}
+			_, err := s.storage.Stat(ctx, "a.txt")
+			if saved := err == nil; saved != (tt.wantCode == codes.OK) {
+				t.Errorf("file saved = %v, want %v", saved, tt.wantCode == codes.OK)
+			}
+			// отклоненная загрузка не занимает место в квоте
+			if u, _, _, _ := tracker.Usage("alice"); tt.wantCode != codes.OK && u.Bytes != 0 {
+				t.Errorf("usage after rejected upload = %+v", u)
+			}
+		})
+	}
+}
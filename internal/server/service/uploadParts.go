@@ -0,0 +1,134 @@
+package service
+
+import (
+	"context"
+	"io"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// uploadPart записывает часть файла параллельной сессии по смещению first.Offset.
+// Части разных потоков не должны пересекаться, файл собирается в CompleteUploadSession
+func (s *FileServiceServer) uploadPart(stream file_transfer.FileTransfer_UploadFileServer, first *file_transfer.UploadFileRequest) error {
+	const op = "server.service.uploadPart"
+	ctx := stream.Context()
+
+	part, err := s.sessions.OpenPart(first.SessionId, first.Offset, first.PartLength)
+	if err != nil {
+		return sessionError(op, err)
+	}
+	filename := part.Session.Filename
+
+	done := false
+	defer func() {
+		if done {
+			return
+		}
+		if closeErr := part.Close(); closeErr != nil {
+			log.Printf("%s: filename:%s. failed to close part: %v", op, filename, closeErr)
+		}
+	}()
+
+	var buf transfer.Buffer // для распаковки частей
+	defer buf.Release()
+	limit, release := s.throttle(ctx)
+	defer release()
+	req := first
+	for {
+		if err = waitRate(ctx, op, limit, len(req.Content)); err != nil {
+			return err
+		}
+		content, code, err := s.decodeChunk(req.Content, req.Crc32C, req.Compression, &buf)
+		if err != nil {
+			// поврежденные данные части не сохраняются, часть можно отправить заново
+			done = true
+			if discardErr := part.Discard(); discardErr != nil {
+				log.Printf("%s: filename:%s. failed to discard part: %v", op, filename, discardErr)
+			}
+			return status.Error(code, err.Error())
+		}
+		if len(content) > 0 {
+			if err = part.Write(content); err != nil {
+				return sessionError(op, err)
+			}
+		}
+
+		req, err = stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			log.Printf("%s: filename:%s. failed to receive data: %v", op, filename, err)
+			return status.Errorf(codes.Internal, "filename:%s. failed to receive data: %v", filename, err)
+		}
+	}
+
+	done = true
+	if err = part.Close(); err != nil {
+		log.Printf("%s: filename:%s. failed to save part: %v", op, filename, err)
+		return status.Errorf(codes.Internal, "failed to save part: %v", err)
+	}
+	if err = checkComplete(part.Written, &part.Range.Length); err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	log.Printf("%s: filename:%s. session %s received part %d+%d", op, filename, part.Session.ID, part.Range.Offset, part.Range.Length)
+	return stream.SendAndClose(&file_transfer.UploadFileResponse{Message: "Part uploaded successfully!"})
+}
+
+// CompleteUploadSession собирает файл параллельной сессии из принятых частей и сохраняет его
+func (s *FileServiceServer) CompleteUploadSession(ctx context.Context, req *file_transfer.CompleteUploadSessionRequest) (*file_transfer.UploadFileResponse, error) {
+	const op = "server.service.CompleteUploadSession"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.fileUploadSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.fileUploadSemaphore.Release(1)
+
+	sess, _, err := s.sessions.Get(req.SessionId)
+	if err != nil {
+		return nil, sessionError(op, err)
+	}
+	c, err := s.sessionCaller(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	up, err := s.sessions.Complete(req.SessionId)
+	if err != nil {
+		return nil, sessionError(op, err)
+	}
+	filename := up.Session.Filename
+
+	// discard удаляет собранный файл, если он поврежден или превышает квоты
+	discard := func(code codes.Code, err error) error {
+		if discardErr := up.Discard(); discardErr != nil {
+			log.Printf("%s: filename:%s. failed to discard session: %v", op, filename, discardErr)
+		}
+		s.releaseSessionQuota(up.Session.ID)
+		log.Printf("%s: filename:%s. session %s discarded: %v", op, filename, up.Session.ID, err)
+		return status.Error(code, err.Error())
+	}
+
+	// Проверяет целостность собранного файла до подтверждения загрузки
+	if err = checksum.Verify(up.Hash(), req.Sha256); err != nil {
+		return nil, discard(codes.DataLoss, err)
+	}
+	sum := up.Hash().Sum(nil)
+
+	reservation, err := s.sessionReservation(ctx, op, c, up.Session, up.Offset)
+	if err != nil {
+		return nil, discard(codes.ResourceExhausted, err)
+	}
+	if err = reservation.Grow(up.Offset); err != nil {
+		return nil, discard(codes.ResourceExhausted, err)
+	}
+
+	return s.finishSession(ctx, op, c, up, sum, reservation)
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+
+	"github.com/RVodassa/FileTransfer/internal/server/access"
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
+	"github.com/RVodassa/FileTransfer/internal/server/session"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/RVodassa/FileTransfer/pkg/transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ErrNotSessionOwner = errors.New("upload session belongs to another client")
+
+// StartUploadSession создает сессию загрузки, которую можно продолжить после обрыва
+func (s *FileServiceServer) StartUploadSession(ctx context.Context, req *file_transfer.StartUploadSessionRequest) (*file_transfer.UploadSession, error) {
+	const op = "server.service.StartUploadSession"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.manageFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.manageFilesSemaphore.Release(1)
+
+	c, filename, err := s.authorize(ctx, req.Filename, access.Write)
+	if err != nil {
+		return nil, err
+	}
+	if err = s.checkDeclaredSize(req.Size); err != nil {
+		return nil, err
+	}
+	policy := s.conflictPolicy(req.ConflictPolicy)
+	if err = s.checkConflict(ctx, filename, policy); err != nil {
+		return nil, err
+	}
+	// Резервирует заявленный размер до завершения или удаления сессии
+	reservation, err := s.reserveQuota(ctx, op, c, filename, req.GetSize())
+	if err != nil {
+		return nil, err
+	}
+
+	sess, err := s.sessions.Create(filename, c.identity, policy, req.Size, req.Parallel)
+	if err != nil {
+		reservation.Release()
+		if errors.Is(err, session.ErrSizeRequired) {
+			return nil, sessionError(op, err)
+		}
+		log.Printf("%s: filename:%s. failed to create session: %v", op, filename, err)
+		return nil, status.Errorf(codes.Internal, "failed to create session: %v", err)
+	}
+	s.holdSessionQuota(sess.ID, reservation)
+
+	log.Printf("%s: filename:%s. session %s started", op, filename, sess.ID)
+	return &file_transfer.UploadSession{SessionId: sess.ID, Filename: c.display(sess.Filename)}, nil
+}
+
+// GetUploadSession возвращает кол-во байт, сохраненных в сессии
+func (s *FileServiceServer) GetUploadSession(ctx context.Context, req *file_transfer.GetUploadSessionRequest) (*file_transfer.UploadSession, error) {
+	const op = "server.service.GetUploadSession"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.listFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.listFilesSemaphore.Release(1)
+
+	sess, offset, err := s.sessions.Get(req.SessionId)
+	if err != nil {
+		return nil, sessionError(op, err)
+	}
+	c, err := s.sessionCaller(ctx, sess)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &file_transfer.UploadSession{SessionId: sess.ID, Filename: c.display(sess.Filename), Offset: offset}
+	if sess.Parallel {
+		ranges, err := s.sessions.Ranges(sess.ID)
+		if err != nil {
+			return nil, sessionError(op, err)
+		}
+		for _, r := range ranges {
+			resp.Received = append(resp.Received, &file_transfer.ByteRange{Offset: r.Offset, Length: r.Length})
+		}
+	}
+	return resp, nil
+}
+
+// RunSessionSweeper удаляет сессии загрузки, брошенные клиентами, пока ctx не отменен
+func (s *FileServiceServer) RunSessionSweeper(ctx context.Context) {
+	s.sessions.RunSweeper(ctx, s.sessionSweepInterval, s.sessionTTL, s.releaseSessionQuota)
+}
+
+// sessionCaller проверяет, что клиент создал сессию и может писать в ее файл.
+// Место сессии зарезервировано за создавшим ее клиентом, поэтому продолжить ее может только он
+func (s *FileServiceServer) sessionCaller(ctx context.Context, sess *session.Session) (*caller, error) {
+	const op = "server.service.sessionCaller"
+
+	c, err := s.caller(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if sess.Owner != "" && c.identity != sess.Owner {
+		log.Printf("%s: identity:%s. %v: session %s", op, c.identity, ErrNotSessionOwner, sess.ID)
+		return nil, status.Error(codes.PermissionDenied, ErrNotSessionOwner.Error())
+	}
+	if err = s.checkAccess(c, sess.Filename, access.Write); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// uploadSession дописывает данные потока в сессию загрузки.
+// При обрыве потока принятые данные остаются в staging директории.
+func (s *FileServiceServer) uploadSession(stream file_transfer.FileTransfer_UploadFileServer, first *file_transfer.UploadFileRequest) error {
+	const op = "server.service.uploadSession"
+	ctx := stream.Context()
+
+	sess, _, err := s.sessions.Get(first.SessionId)
+	if err != nil {
+		return sessionError(op, err)
+	}
+	c, err := s.sessionCaller(ctx, sess)
+	if err != nil {
+		return err
+	}
+	if sess.Parallel {
+		return s.uploadPart(stream, first)
+	}
+
+	up, err := s.sessions.Open(first.SessionId, first.Offset)
+	if err != nil {
+		return sessionError(op, err)
+	}
+	filename := up.Session.Filename
+
+	done := false
+	defer func() {
+		if done {
+			return
+		}
+		if closeErr := up.Close(); closeErr != nil {
+			log.Printf("%s: filename:%s. failed to close session: %v", op, filename, closeErr)
+		}
+		log.Printf("%s: filename:%s. session %s paused at offset %d", op, filename, up.Session.ID, up.Offset)
+	}()
+
+	// discard удаляет принятые данные, если они повреждены или превышают лимиты
+	discard := func(code codes.Code, err error) error {
+		done = true
+		if discardErr := up.Discard(); discardErr != nil {
+			log.Printf("%s: filename:%s. failed to discard session: %v", op, filename, discardErr)
+		}
+		s.releaseSessionQuota(up.Session.ID)
+		log.Printf("%s: filename:%s. session %s discarded: %v", op, filename, up.Session.ID, err)
+		return status.Error(code, err.Error())
+	}
+
+	// Резерв сессии держится и после обрыва: принятые данные остаются в staging директории
+	reservation, err := s.sessionReservation(ctx, op, c, up.Session, up.Offset)
+	if err != nil {
+		return discard(codes.ResourceExhausted, err)
+	}
+
+	var expected []byte
+	var buf transfer.Buffer // для распаковки частей
+	defer buf.Release()
+	limit, release := s.throttle(ctx)
+	defer release()
+	req := first
+	for {
+		if err = waitRate(ctx, op, limit, len(req.Content)); err != nil {
+			return err
+		}
+		content, code, err := s.decodeChunk(req.Content, req.Crc32C, req.Compression, &buf)
+		if err != nil {
+			return discard(code, err)
+		}
+		if len(req.Sha256) > 0 {
+			expected = req.Sha256
+		}
+		if len(content) > 0 {
+			if err = up.Write(content); err != nil {
+				log.Printf("%s: filename:%s. failed to write data: %v", op, filename, err)
+				return status.Errorf(codes.Internal, "failed to write data: %v", err)
+			}
+			if code, sizeErr := s.checkReceived(up.Offset, up.Session.Size); sizeErr != nil {
+				return discard(code, sizeErr)
+			}
+			if err = reservation.Grow(up.Offset); err != nil {
+				return discard(codes.ResourceExhausted, err)
+			}
+		}
+
+		req, err = stream.Recv()
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			log.Printf("%s: filename:%s. failed to receive data: %v", op, filename, err)
+			return status.Errorf(codes.Internal, "filename:%s. failed to receive data: %v", filename, err)
+		}
+	}
+
+	// Проверяет, что принят весь заявленный файл
+	if err = checkComplete(up.Offset, up.Session.Size); err != nil {
+		return discard(codes.InvalidArgument, err)
+	}
+	// Проверяет целостность файла до подтверждения загрузки
+	if err = checksum.Verify(up.Hash(), expected); err != nil {
+		return discard(codes.DataLoss, err)
+	}
+	sum := up.Hash().Sum(nil)
+
+	done = true
+	resp, err := s.finishSession(ctx, op, c, up, sum, reservation)
+	if err != nil {
+		return err
+	}
+	return stream.SendAndClose(resp)
+}
+
+// finishSession переносит принятый файл сессии из staging директории в хранилище.
+// Забирает up: при ошибке сессия сохраняется для продолжения или удаляется, если продолжить ее нельзя
+func (s *FileServiceServer) finishSession(ctx context.Context, op string, c *caller, up *session.Upload, sum []byte, reservation *quota.Reservation) (*file_transfer.UploadFileResponse, error) {
+	filename := up.Session.Filename
+
+	name, unlock, err := s.resolveConflict(ctx, filename, up.Session.OnConflict)
+	if err != nil {
+		if code := status.Code(err); code == codes.AlreadyExists || code == codes.FailedPrecondition {
+			// сохранить файл по этому пути нельзя: сессию продолжить нельзя
+			if discardErr := up.Discard(); discardErr != nil {
+				log.Printf("%s: filename:%s. failed to discard session: %v", op, filename, discardErr)
+			}
+			s.releaseSessionQuota(up.Session.ID)
+		} else if closeErr := up.Close(); closeErr != nil {
+			log.Printf("%s: filename:%s. failed to close session: %v", op, filename, closeErr)
+		}
+		return nil, err
+	}
+	defer unlock()
+	// Файл считается новым, если не заменяет файл самого клиента
+	// Файл учитывается за создавшим сессию клиентом, за ним же зарезервировано место
+	uploader := up.Session.Owner
+	if uploader == "" {
+		uploader = c.identity
+	}
+	replaced, isReplaced := s.usageOf(ctx, name)
+	if err = reservation.Settle(isReplaced, replaced.owner); err != nil {
+		if closeErr := up.Close(); closeErr != nil {
+			log.Printf("%s: filename:%s. failed to close session: %v", op, filename, closeErr)
+		}
+		return nil, quotaError(op, c, err)
+	}
+	if err = s.archiveVersion(ctx, name); err != nil {
+		if closeErr := up.Close(); closeErr != nil {
+			log.Printf("%s: filename:%s. failed to close session: %v", op, filename, closeErr)
+		}
+		return nil, err
+	}
+	err = up.Finalize(func(partPath string) error {
+		m := meta.Meta{SHA256: sum, Uploader: uploader, ContentType: meta.ContentType(name, partPath)}
+		return storage.ImportFile(ctx, s.storage, name, partPath, m)
+	})
+	if err != nil {
+		log.Printf("%s: filename:%s. failed to finalize session: %v", op, filename, err)
+		return nil, status.Errorf(codes.Internal, "failed to finalize session: %v", err)
+	}
+	if isReplaced {
+		s.releaseUsage(replaced)
+	}
+	reservation.Commit(up.Offset)
+	s.releaseSessionQuota(up.Session.ID)
+	filename = c.display(name)
+
+	log.Printf("%s: filename:%s. Upload completed, %d bytes, sha256 %s", op, filename, up.Offset, checksum.Hex(sum))
+	return &file_transfer.UploadFileResponse{
+		Message:  "File uploaded successfully!",
+		Sha256:   sum,
+		Filename: filename,
+	}, nil
+}
+
+// sessionError переводит ошибки хранилища сессий в gRPC статусы
+func sessionError(op string, err error) error {
+	switch {
+	case errors.Is(err, session.ErrSessionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, session.ErrSessionBusy):
+		return status.Error(codes.Aborted, err.Error())
+	case errors.Is(err, session.ErrInvalidOffset):
+		return status.Error(codes.OutOfRange, err.Error())
+	case errors.Is(err, session.ErrPartOverflow), errors.Is(err, session.ErrSizeRequired):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, session.ErrParallel), errors.Is(err, session.ErrNotParallel),
+		errors.Is(err, session.ErrIncomplete):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	default:
+		log.Printf("%s: session error: %v", op, err)
+		return status.Errorf(codes.Internal, "session error: %v", err)
+	}
+}
@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/quota"
+	"github.com/RVodassa/FileTransfer/internal/server/session"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// startSession начинает сессию загрузки файла name размером size от имени клиента ctx
+func startSession(t *testing.T, s *FileServiceServer, ctx context.Context, name string, size int64) string {
+	t.Helper()
+	sess, err := s.StartUploadSession(ctx, &file_transfer.StartUploadSessionRequest{Filename: name, Size: &size})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sess.SessionId
+}
+
+// Прерванная сессия продолжается с принятого сервером смещения
+func TestUploadSessionResume(t *testing.T) {
+	s, _ := newQuotaServer(t, 0)
+	ctx := clientContext("alice")
+	content := []byte("0123456789")
+	sum := sha256.Sum256(content)
+	id := startSession(t, s, ctx, "a.bin", int64(len(content)))
+
+	stream := &uploadStream{ctx: ctx, err: errDisconnected, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: id, Content: content[:5]},
+	}}
+	if err := s.UploadFile(stream); status.Code(err) != codes.Internal {
+		t.Fatalf("interrupted upload error = %v, want Internal", err)
+	}
+	sess, err := s.GetUploadSession(ctx, &file_transfer.GetUploadSessionRequest{SessionId: id})
+	if err != nil || sess.Offset != 5 {
+		t.Fatalf("GetUploadSession = %v, %v, want offset 5", sess, err)
+	}
+
+	// смещение дальше принятых данных отклоняется, сессия остается
+	stream = &uploadStream{ctx: ctx, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: id, Offset: 7, Content: content[7:]},
+	}}
+	if err = s.UploadFile(stream); status.Code(err) != codes.OutOfRange {
+		t.Fatalf("upload past committed offset error = %v, want OutOfRange", err)
+	}
+
+	// клиент продолжает с меньшего смещения: хвост принятых данных перезаписывается
+	stream = &uploadStream{ctx: ctx, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: id, Offset: 3, Content: content[3:], Sha256: sum[:]},
+	}}
+	if err = s.UploadFile(stream); err != nil {
+		t.Fatalf("resumed upload: %v", err)
+	}
+	if got := get(t, s, "a.bin"); got != string(content) {
+		t.Errorf("uploaded file = %q, want %q", got, content)
+	}
+	if _, err = s.GetUploadSession(ctx, &file_transfer.GetUploadSessionRequest{SessionId: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUploadSession after completion error = %v, want NotFound", err)
+	}
+}
+
+// Файл с неверной контрольной суммой не сохраняется, сессия удаляется вместе с резервом квоты
+func TestUploadSessionChecksumMismatch(t *testing.T) {
+	s, tracker := newQuotaServer(t, 100)
+	ctx := clientContext("alice")
+	content := []byte("0123456789")
+	sum := sha256.Sum256([]byte("something else"))
+	id := startSession(t, s, ctx, "a.bin", int64(len(content)))
+
+	stream := &uploadStream{ctx: ctx, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: id, Content: content, Sha256: sum[:]},
+	}}
+	if err := s.UploadFile(stream); status.Code(err) != codes.DataLoss {
+		t.Fatalf("upload with wrong checksum error = %v, want DataLoss", err)
+	}
+	if _, err := s.storage.Stat(context.Background(), "a.bin"); !errors.Is(err, storage.ErrNotFound) {
+		t.Errorf("Stat after checksum mismatch error = %v, want ErrNotFound", err)
+	}
+	if _, err := s.GetUploadSession(ctx, &file_transfer.GetUploadSessionRequest{SessionId: id}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUploadSession after checksum mismatch error = %v, want NotFound", err)
+	}
+	if u, _, _, _ := tracker.Usage("alice"); u != (quota.Usage{}) {
+		t.Errorf("usage after checksum mismatch = %+v, want none", u)
+	}
+}
+
+// Брошенная сессия удаляется по истечении TTL, продолжить ее нельзя
+func TestUploadSessionExpired(t *testing.T) {
+	s, tracker := newQuotaServer(t, 100)
+	s.sessionTTL = time.Hour
+	s.sessionSweepInterval = time.Hour
+	stagingDir := t.TempDir()
+	s.sessions = session.NewStore(stagingDir)
+	ctx := clientContext("alice")
+	fresh := startSession(t, s, ctx, "fresh.bin", 4)
+	expired := startSession(t, s, ctx, "expired.bin", 4)
+
+	stream := &uploadStream{ctx: ctx, err: errDisconnected, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: expired, Content: []byte("01")},
+	}}
+	if err := s.UploadFile(stream); status.Code(err) != codes.Internal {
+		t.Fatalf("interrupted upload error = %v, want Internal", err)
+	}
+	old := time.Now().Add(-2 * s.sessionTTL)
+	err := filepath.WalkDir(stagingDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasPrefix(d.Name(), expired) {
+			return err
+		}
+		return os.Chtimes(path, old, old)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// отмененный контекст: сборщик проходит сессии один раз и возвращается
+	sweepCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+	s.RunSessionSweeper(sweepCtx)
+
+	if _, err = s.GetUploadSession(ctx, &file_transfer.GetUploadSessionRequest{SessionId: expired}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetUploadSession of expired session error = %v, want NotFound", err)
+	}
+	stream = &uploadStream{ctx: ctx, reqs: []*file_transfer.UploadFileRequest{
+		{SessionId: expired, Offset: 2, Content: []byte("23")},
+	}}
+	if err = s.UploadFile(stream); status.Code(err) != codes.NotFound {
+		t.Errorf("upload to expired session error = %v, want NotFound", err)
+	}
+	if _, err = s.GetUploadSession(ctx, &file_transfer.GetUploadSessionRequest{SessionId: fresh}); err != nil {
+		t.Errorf("fresh session removed: %v", err)
+	}
+	if u, _, _, _ := tracker.Usage("alice"); u != (quota.Usage{Bytes: 4, Files: 1}) {
+		t.Errorf("usage after sweep = %+v, want only the fresh session", u)
+	}
+}
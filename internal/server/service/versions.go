@@ -0,0 +1,222 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+
+	"github.com/RVodassa/FileTransfer/internal/server/access"
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/internal/server/storage"
+	"github.com/RVodassa/FileTransfer/internal/server/versions"
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var ErrVersioningDisabled = errors.New("versioning is disabled")
+
+// ListVersions возвращает предыдущие версии файла
+func (s *FileServiceServer) ListVersions(ctx context.Context, req *file_transfer.ListVersionsRequest) (*file_transfer.ListVersionsResponse, error) {
+	const op = "server.service.ListVersions"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.listFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.listFilesSemaphore.Release(1)
+
+	if s.versions == nil {
+		return nil, status.Error(codes.FailedPrecondition, ErrVersioningDisabled.Error())
+	}
+
+	_, filename, err := s.authorize(ctx, req.Filename, access.Read)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := s.versions.List(filename)
+	if err != nil {
+		log.Printf("%s: filename:%s. failed to list versions: %v", op, filename, err)
+		return nil, status.Errorf(codes.Internal, "failed to list versions: %v", err)
+	}
+
+	resp := &file_transfer.ListVersionsResponse{}
+	for _, v := range list {
+		resp.Versions = append(resp.Versions, &file_transfer.FileVersion{
+			VersionId:    v.ID,
+			Size:         v.Size,
+			ArchivedTime: timestamppb.New(v.ArchivedAt),
+		})
+	}
+	return resp, nil
+}
+
+// RestoreVersion делает версию файла текущей. Текущий файл при этом сохраняется как версия.
+func (s *FileServiceServer) RestoreVersion(ctx context.Context, req *file_transfer.RestoreVersionRequest) (*file_transfer.RestoreVersionResponse, error) {
+	const op = "server.service.RestoreVersion"
+
+	// Ограничивает кол-во одновременных запросов
+	if err := s.manageFilesSemaphore.Acquire(ctx, 1); err != nil {
+		return nil, status.Error(codes.ResourceExhausted, ErrLimitRequest.Error())
+	}
+	defer s.manageFilesSemaphore.Release(1)
+
+	if s.versions == nil {
+		return nil, status.Error(codes.FailedPrecondition, ErrVersioningDisabled.Error())
+	}
+
+	c, filename, err := s.authorize(ctx, req.Filename, access.Write)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := s.lockPaths(ctx, filename)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	if info, statErr := s.storage.Stat(ctx, filename); statErr == nil && info.IsDir {
+		return nil, status.Error(codes.FailedPrecondition, ErrIsDirectory.Error())
+	}
+
+	tmpPath, err := s.versions.Restore(filename, req.VersionId)
+	if err != nil {
+		return nil, versionError(op, err)
+	}
+	defer os.Remove(tmpPath) // остается, только если перенести версию не удалось
+	tmpStat, err := os.Stat(tmpPath)
+	if err != nil {
+		log.Printf("%s: filename:%s. failed to restore version: %v", op, filename, err)
+		return nil, status.Errorf(codes.Internal, "failed to restore version: %v", err)
+	}
+
+	// Восстановленный файл учитывается в квоте клиента, который его восстановил, как загрузка
+	reservation, err := s.reserveQuota(ctx, op, c, filename, tmpStat.Size())
+	if err != nil {
+		return nil, err
+	}
+	defer reservation.Release()
+	replaced, isReplaced := s.usageOf(ctx, filename)
+	if err = reservation.Settle(isReplaced, replaced.owner); err != nil {
+		return nil, quotaError(op, c, err)
+	}
+
+	if err = s.archiveVersion(ctx, filename); err != nil {
+		return nil, err
+	}
+	m := meta.Read(tmpPath)
+	m.Uploader = c.identity
+	if err = storage.ImportFile(ctx, s.storage, filename, tmpPath, m); err != nil {
+		log.Printf("%s: filename:%s. failed to restore version: %v", op, filename, err)
+		return nil, status.Errorf(codes.Internal, "failed to restore version: %v", err)
+	}
+	if isReplaced {
+		s.releaseUsage(replaced)
+	}
+	reservation.Commit(tmpStat.Size())
+
+	log.Printf("%s: filename:%s. Version %s restored", op, filename, req.VersionId)
+	return &file_transfer.RestoreVersionResponse{Message: "Version restored successfully!"}, nil
+}
+
+// archiveVersion сохраняет текущий файл как версию перед его заменой или удалением.
+// Версия в квотах не учитывается, место файла освобождает вызывающий.
+// Файлы на локальном диске связываются с версией жесткой ссылкой, остальные копируются.
+// Вызывается под блокировкой filename на запись.
+func (s *FileServiceServer) archiveVersion(ctx context.Context, filename string) error {
+	const op = "server.service.archiveVersion"
+
+	if s.versions == nil {
+		return nil
+	}
+	info, err := s.storage.Stat(ctx, filename)
+	if err != nil || info.IsDir {
+		return nil // нечего сохранять
+	}
+
+	var v *versions.Version
+	if local, ok := s.storage.(storage.LocalFiles); ok {
+		v, err = s.versions.Archive(filename, info.Size, func(dst string) error {
+			return local.Link(filename, dst)
+		})
+		if err != nil {
+			log.Printf("%s: failed to link %s, copying: %v", op, filename, err)
+		}
+	}
+	if v == nil {
+		var r io.ReadCloser
+		if r, err = s.storage.Get(ctx, filename, 0, 0); err == nil {
+			v, err = s.versions.Save(filename, r, info.Meta)
+			r.Close()
+		}
+	}
+	if err != nil {
+		log.Printf("%s: failed to archive %s: %v", op, filename, err)
+		return status.Errorf(codes.Internal, "failed to archive version: %v", err)
+	}
+	log.Printf("%s: filename:%s. archived as version %s", op, filename, v.ID)
+	return nil
+}
+
+// versionPath возвращает путь к версии файла
+func (s *FileServiceServer) versionPath(filename, versionID string) (string, error) {
+	const op = "server.service.versionPath"
+
+	if s.versions == nil {
+		return "", status.Error(codes.FailedPrecondition, ErrVersioningDisabled.Error())
+	}
+	versionPath, err := s.versions.Path(filename, versionID)
+	if err != nil {
+		return "", versionError(op, err)
+	}
+	return versionPath, nil
+}
+
+// openVersion открывает версию файла на чтение с позиции start после проверки,
+// что offset не выходит за конец версии
+func (s *FileServiceServer) openVersion(op, filename, versionID string, offset, start, length int64) (io.ReadCloser, error) {
+	versionPath, err := s.versionPath(filename, versionID)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(versionPath)
+	if err != nil {
+		log.Printf("%s: failed to open version: %v", op, err)
+		return nil, status.Errorf(codes.Internal, "failed to open version: %v", err)
+	}
+	fileStat, err := f.Stat()
+	if err == nil {
+		err = checkRange(op, offset, fileStat.Size())
+	} else {
+		err = status.Errorf(codes.Internal, "failed to stat version: %v", err)
+	}
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	var r io.Reader = io.NewSectionReader(f, start, fileStat.Size()-start)
+	if length > 0 {
+		r = io.LimitReader(r, length)
+	}
+	return readCloser{Reader: r, Closer: f}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// versionError переводит ошибки хранилища версий в gRPC статусы
+func versionError(op string, err error) error {
+	if errors.Is(err, versions.ErrVersionNotFound) {
+		return status.Error(codes.NotFound, err.Error())
+	}
+	log.Printf("%s: version error: %v", op, err)
+	return status.Errorf(codes.Internal, "version error: %v", err)
+}
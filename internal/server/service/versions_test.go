@@ -0,0 +1,39 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+)
+
+// Время архивации версии передается как Timestamp с точностью до наносекунд
+func TestListVersionsTime(t *testing.T) {
+	s, _ := newQuotaServer(t, 0)
+	ctx := clientContext("alice")
+	if err := upload(t, s, ctx, "a.txt", "first"); err != nil {
+		t.Fatal(err)
+	}
+	before := time.Now()
+	if err := upload(t, s, ctx, "a.txt", "second"); err != nil {
+		t.Fatal(err)
+	}
+	after := time.Now()
+
+	resp, err := s.ListVersions(ctx, &file_transfer.ListVersionsRequest{Filename: "a.txt"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Versions) != 1 {
+		t.Fatalf("ListVersions returned %d versions, want 1", len(resp.Versions))
+	}
+	v := resp.Versions[0]
+	archived := v.ArchivedTime.AsTime()
+	if v.ArchivedTime == nil || archived.Before(before) || archived.After(after) || v.Size != 5 {
+		t.Errorf("version = %v, want 5 bytes archived between %v and %v", v, before, after)
+	}
+	if id := archived.UnixNano(); v.VersionId != fmt.Sprintf("%020d", id) {
+		t.Errorf("version id %s does not match archived time %d", v.VersionId, id)
+	}
+}
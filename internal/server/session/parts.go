@@ -0,0 +1,249 @@
+package session
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+)
+
+const (
+	rangesExt      = ".ranges" // принятые диапазоны параллельной сессии
+	checkpointSize = 16 << 20  // как часто часть сохраняет записанный диапазон
+)
+
+var ErrNotParallel = errors.New("upload session is not parallel")
+var ErrParallel = errors.New("parallel upload session accepts data only by parts")
+var ErrIncomplete = errors.New("upload session is missing parts")
+var ErrPartOverflow = errors.New("data exceeds upload part length")
+
+// Range диапазон байт файла
+type Range struct {
+	Offset int64 `json:"offset"`
+	Length int64 `json:"length"`
+}
+
+func (r Range) end() int64 {
+	return r.Offset + r.Length
+}
+
+// Ranges возвращает принятые диапазоны параллельной сессии по возрастанию смещения
+func (s *Store) Ranges(id string) ([]Range, error) {
+	if !validID(id) {
+		return nil, ErrSessionNotFound
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.readRanges(id)
+}
+
+// readRanges читает диапазоны сессии. Вызывается под s.mu
+func (s *Store) readRanges(id string) ([]Range, error) {
+	data, err := os.ReadFile(s.rangesPath(id))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var ranges []Range
+	if err = json.Unmarshal(data, &ranges); err != nil {
+		return nil, err
+	}
+	return ranges, nil
+}
+
+// addRange добавляет принятый диапазон к сессии, соседние диапазоны объединяются
+func (s *Store) addRange(id string, r Range) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ranges, err := s.readRanges(id)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(mergeRanges(append(ranges, r)))
+	if err != nil {
+		return err
+	}
+	// Через временный файл, чтобы при сбое не потерять уже принятые диапазоны
+	tmp := s.rangesPath(id) + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.rangesPath(id))
+}
+
+func (s *Store) rangesPath(id string) string {
+	return filepath.Join(s.dir, id+rangesExt)
+}
+
+// mergeRanges сортирует диапазоны и объединяет пересекающиеся и соседние
+func mergeRanges(ranges []Range) []Range {
+	slices.SortFunc(ranges, func(a, b Range) int { return cmp.Compare(a.Offset, b.Offset) })
+	var merged []Range
+	for _, r := range ranges {
+		if n := len(merged); n > 0 && r.Offset <= merged[n-1].end() {
+			merged[n-1].Length = max(merged[n-1].end(), r.end()) - merged[n-1].Offset
+			continue
+		}
+		merged = append(merged, r)
+	}
+	return merged
+}
+
+// received кол-во принятых байт в диапазонах
+func received(ranges []Range) int64 {
+	var n int64
+	for _, r := range ranges {
+		n += r.Length
+	}
+	return n
+}
+
+// OpenPart открывает запись части [offset, offset+length) параллельной сессии.
+// Части, которые не пересекаются, можно писать одновременно
+func (s *Store) OpenPart(id string, offset, length int64) (*Part, error) {
+	sess, _, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !sess.Parallel {
+		return nil, ErrNotParallel
+	}
+	r := Range{Offset: offset, Length: length}
+	if offset < 0 || length <= 0 || r.end() > *sess.Size {
+		return nil, ErrInvalidOffset
+	}
+
+	s.mu.Lock()
+	if _, ok := s.active[id]; ok {
+		s.mu.Unlock()
+		return nil, ErrSessionBusy
+	}
+	for _, p := range s.parts[id] {
+		if r.Offset < p.end() && p.Offset < r.end() {
+			s.mu.Unlock()
+			return nil, ErrSessionBusy
+		}
+	}
+	s.parts[id] = append(s.parts[id], r)
+	s.mu.Unlock()
+
+	f, err := os.OpenFile(s.partPath(id), os.O_WRONLY, 0o644)
+	if err != nil {
+		s.releasePart(id, r)
+		return nil, err
+	}
+	return &Part{Session: sess, Range: r, store: s, file: f}, nil
+}
+
+func (s *Store) releasePart(id string, r Range) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	parts := slices.DeleteFunc(s.parts[id], func(p Range) bool { return p == r })
+	if len(parts) == 0 {
+		delete(s.parts, id)
+		return
+	}
+	s.parts[id] = parts
+}
+
+// Complete открывает параллельную сессию для сохранения файла, когда приняты все части.
+// Хеш собранного файла считается заново, так как части приходили в любом порядке
+func (s *Store) Complete(id string) (*Upload, error) {
+	sess, _, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if !sess.Parallel {
+		return nil, ErrNotParallel
+	}
+
+	s.mu.Lock()
+	if _, ok := s.active[id]; ok || len(s.parts[id]) > 0 {
+		s.mu.Unlock()
+		return nil, ErrSessionBusy
+	}
+	s.active[id] = struct{}{}
+	ranges, err := s.readRanges(id)
+	s.mu.Unlock()
+	if err == nil && received(ranges) != *sess.Size {
+		err = ErrIncomplete
+	}
+	if err != nil {
+		s.release(id)
+		return nil, err
+	}
+
+	h := checksum.New()
+	f, err := os.OpenFile(s.partPath(id), os.O_RDWR, 0o644)
+	if err == nil {
+		if _, err = io.Copy(h, f); err != nil {
+			_ = f.Close()
+		}
+	}
+	if err != nil {
+		s.release(id)
+		return nil, err
+	}
+	return &Upload{Session: sess, Offset: *sess.Size, store: s, file: f, hash: h}, nil
+}
+
+// Part открытая для записи часть параллельной сессии
+type Part struct {
+	Session *Session
+	Range   Range // часть файла, которую пишет поток
+	Written int64 // сколько байт части уже записано
+	saved   int64 // сколько байт части учтено в диапазонах сессии
+	store   *Store
+	file    *os.File
+}
+
+// Write записывает данные части по смещению
+func (p *Part) Write(chunk []byte) error {
+	if p.Written+int64(len(chunk)) > p.Range.Length {
+		return ErrPartOverflow
+	}
+	n, err := p.file.WriteAt(chunk, p.Range.Offset+p.Written)
+	p.Written += int64(n)
+	if err != nil {
+		return err
+	}
+	// Записанное учитывается по ходу, чтобы после падения сервера не передавать часть заново
+	if p.Written-p.saved >= checkpointSize {
+		if err = p.store.addRange(p.Session.ID, Range{Offset: p.Range.Offset, Length: p.Written}); err != nil {
+			return err
+		}
+		p.saved = p.Written
+	}
+	return nil
+}
+
+// Close сохраняет записанные данные части, даже неполной, и освобождает ее.
+// Недостающие данные можно дописать новой частью
+func (p *Part) Close() error {
+	defer p.store.releasePart(p.Session.ID, p.Range)
+	if err := p.file.Sync(); err != nil {
+		_ = p.file.Close()
+		return err
+	}
+	if err := p.file.Close(); err != nil {
+		return err
+	}
+	if p.Written == p.saved {
+		return nil
+	}
+	return p.store.addRange(p.Session.ID, Range{Offset: p.Range.Offset, Length: p.Written})
+}
+
+// Discard отбрасывает данные части после последнего сохранения, например поврежденные при передаче
+func (p *Part) Discard() error {
+	defer p.store.releasePart(p.Session.ID, p.Range)
+	return p.file.Close()
+}
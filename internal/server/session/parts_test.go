@@ -0,0 +1,93 @@
+package session
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+)
+
+// writePart записывает часть content[offset:offset+length] параллельной сессии
+func writePart(t *testing.T, s *Store, id string, content []byte, offset, length int64) {
+	t.Helper()
+	p, err := s.OpenPart(id, offset, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Write(content[offset : offset+length]); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParallelSession(t *testing.T) {
+	s := NewStore(t.TempDir())
+	content := []byte("0123456789abcdefghij")
+	size := int64(len(content))
+
+	if _, err := s.Create("f.bin", "alice", "overwrite", nil, true); !errors.Is(err, ErrSizeRequired) {
+		t.Fatalf("create without size: got %v, want %v", err, ErrSizeRequired)
+	}
+	sess, err := s.Create("f.bin", "alice", "overwrite", &size, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Open(sess.ID, 0); !errors.Is(err, ErrParallel) {
+		t.Fatalf("sequential open: got %v, want %v", err, ErrParallel)
+	}
+
+	// Части приходят не по порядку, пересекающаяся с активной частью отклоняется
+	p, err := s.OpenPart(sess.ID, 10, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.OpenPart(sess.ID, 15, 5); !errors.Is(err, ErrSessionBusy) {
+		t.Fatalf("overlapping part: got %v, want %v", err, ErrSessionBusy)
+	}
+	if err = p.Write(content[10:]); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Write([]byte("x")); !errors.Is(err, ErrPartOverflow) {
+		t.Fatalf("write past part: got %v, want %v", err, ErrPartOverflow)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Complete(sess.ID); !errors.Is(err, ErrIncomplete) {
+		t.Fatalf("complete with missing parts: got %v, want %v", err, ErrIncomplete)
+	}
+
+	writePart(t, s, sess.ID, content, 4, 6)
+	writePart(t, s, sess.ID, content, 0, 4)
+	if _, received, err := s.Get(sess.ID); err != nil || received != size {
+		t.Fatalf("received %d, %v: want %d", received, err, size)
+	}
+
+	up, err := s.Complete(sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := sha256.Sum256(content)
+	if err = checksum.Verify(up.Hash(), want[:]); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	err = up.Finalize(func(partPath string) error {
+		got, err = os.ReadFile(partPath)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, content) {
+		t.Fatalf("assembled %q, want %q", got, content)
+	}
+	if _, _, err = s.Get(sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Fatalf("finalized session: got %v, want %v", err, ErrSessionNotFound)
+	}
+}
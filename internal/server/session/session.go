@@ -0,0 +1,300 @@
+package session
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/pkg/checksum"
+)
+
+const (
+	metaExt = ".json" // метаданные сессии
+	partExt = ".part" // принятые данные сессии
+)
+
+var ErrSessionNotFound = errors.New("upload session not found")
+var ErrSessionBusy = errors.New("upload session is already in use")
+var ErrInvalidOffset = errors.New("offset is beyond committed data")
+var ErrSizeRequired = errors.New("parallel upload session requires file size")
+
+// Session описывает сессию загрузки файла
+type Session struct {
+	ID         string    `json:"id"`
+	Filename   string    `json:"filename"`
+	Owner      string    `json:"owner,omitempty"`    // клиент, за которым резервируется место под файл
+	OnConflict string    `json:"on_conflict"`        // политика при совпадении имен
+	Size       *int64    `json:"size,omitempty"`     // заявленный клиентом размер файла
+	Parallel   bool      `json:"parallel,omitempty"` // данные принимаются частями по смещению
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Store хранит сессии загрузки и принятые данные в staging директории
+type Store struct {
+	dir    string
+	mu     sync.Mutex
+	active map[string]struct{}
+	parts  map[string][]Range // части параллельных сессий, которые сейчас пишутся
+}
+
+// NewStore возвращает хранилище сессий в директории dir
+func NewStore(dir string) *Store {
+	return &Store{
+		dir:    dir,
+		active: make(map[string]struct{}),
+		parts:  make(map[string][]Range),
+	}
+}
+
+// Create создает новую сессию загрузки клиента owner для файла filename, size - заявленный размер или nil.
+// Параллельная сессия принимает части в любом порядке, поэтому для нее размер обязателен
+func (s *Store) Create(filename, owner, onConflict string, size *int64, parallel bool) (*Session, error) {
+	const op = "server.session.Create"
+
+	if parallel && size == nil {
+		return nil, ErrSizeRequired
+	}
+
+	if err := os.MkdirAll(s.dir, os.ModePerm); err != nil {
+		log.Printf("%s: failed to create staging dir: %v", op, err)
+		return nil, err
+	}
+
+	id, err := newID()
+	if err != nil {
+		log.Printf("%s: failed to generate session id: %v", op, err)
+		return nil, err
+	}
+
+	sess := &Session{ID: id, Filename: filename, Owner: owner, OnConflict: onConflict, Size: size, Parallel: parallel, CreatedAt: time.Now()}
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.WriteFile(s.partPath(id), nil, 0o644); err == nil && parallel {
+		// части пишутся по смещению в файл заранее известного размера
+		err = os.Truncate(s.partPath(id), *size)
+	}
+	if err != nil {
+		log.Printf("%s: failed to create part file: %v", op, err)
+		_ = os.Remove(s.partPath(id))
+		return nil, err
+	}
+	if err = os.WriteFile(s.metaPath(id), data, 0o644); err != nil {
+		log.Printf("%s: failed to write session meta: %v", op, err)
+		_ = os.Remove(s.partPath(id))
+		return nil, err
+	}
+	return sess, nil
+}
+
+// Get возвращает сессию и кол-во уже принятых байт.
+// Для параллельной сессии это сумма принятых диапазонов
+func (s *Store) Get(id string) (*Session, int64, error) {
+	if !validID(id) {
+		return nil, 0, ErrSessionNotFound
+	}
+
+	data, err := os.ReadFile(s.metaPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, ErrSessionNotFound
+		}
+		return nil, 0, err
+	}
+	var sess Session
+	if err = json.Unmarshal(data, &sess); err != nil {
+		return nil, 0, fmt.Errorf("corrupted session meta: %w", err)
+	}
+	if sess.Parallel {
+		ranges, err := s.Ranges(id)
+		if err != nil {
+			return nil, 0, err
+		}
+		return &sess, received(ranges), nil
+	}
+
+	info, err := os.Stat(s.partPath(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, 0, ErrSessionNotFound
+		}
+		return nil, 0, err
+	}
+	return &sess, info.Size(), nil
+}
+
+// IDs возвращает идентификаторы всех сессий
+func (s *Store) IDs() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var ids []string
+	for _, e := range entries {
+		if id, ok := strings.CutSuffix(e.Name(), metaExt); ok && validID(id) && !e.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// Open открывает сессию для дозаписи с позиции offset.
+// Данные после offset отбрасываются.
+func (s *Store) Open(id string, offset int64) (*Upload, error) {
+	sess, committed, err := s.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if sess.Parallel {
+		return nil, ErrParallel
+	}
+	if offset < 0 || offset > committed {
+		return nil, ErrInvalidOffset
+	}
+
+	s.mu.Lock()
+	if _, ok := s.active[id]; ok {
+		s.mu.Unlock()
+		return nil, ErrSessionBusy
+	}
+	s.active[id] = struct{}{}
+	s.mu.Unlock()
+
+	// Хеш уже принятых данных нужен для проверки целостности всего файла
+	h := checksum.New()
+	f, err := os.OpenFile(s.partPath(id), os.O_RDWR, 0o644)
+	if err == nil {
+		if err = f.Truncate(offset); err == nil {
+			_, err = io.Copy(h, f)
+		}
+		if err != nil {
+			_ = f.Close()
+		}
+	}
+	if err != nil {
+		s.release(id)
+		return nil, err
+	}
+
+	return &Upload{Session: sess, Offset: offset, store: s, file: f, hash: h}, nil
+}
+
+// Remove удаляет сессию и принятые данные
+func (s *Store) Remove(id string) error {
+	if !validID(id) {
+		return ErrSessionNotFound
+	}
+	if err := os.Remove(s.partPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.rangesPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if err := os.Remove(s.metaPath(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func (s *Store) release(id string) {
+	s.mu.Lock()
+	delete(s.active, id)
+	s.mu.Unlock()
+}
+
+func (s *Store) metaPath(id string) string {
+	return filepath.Join(s.dir, id+metaExt)
+}
+
+func (s *Store) partPath(id string) string {
+	return filepath.Join(s.dir, id+partExt)
+}
+
+// Upload открытая для записи сессия
+type Upload struct {
+	Session *Session
+	Offset  int64 // текущее кол-во принятых байт
+	store   *Store
+	file    *os.File
+	hash    hash.Hash
+}
+
+// Write дописывает данные в staging файл сессии
+func (u *Upload) Write(chunk []byte) error {
+	n, err := u.file.Write(chunk)
+	u.hash.Write(chunk[:n])
+	u.Offset += int64(n)
+	return err
+}
+
+// Hash возвращает SHA-256 всех принятых данных сессии
+func (u *Upload) Hash() hash.Hash {
+	return u.hash
+}
+
+// Close сохраняет принятые данные и освобождает сессию.
+// Сессию можно продолжить позже.
+func (u *Upload) Close() error {
+	defer u.store.release(u.Session.ID)
+	if err := u.file.Sync(); err != nil {
+		_ = u.file.Close()
+		return err
+	}
+	return u.file.Close()
+}
+
+// Discard удаляет сессию вместе с принятыми данными
+func (u *Upload) Discard() error {
+	defer u.store.release(u.Session.ID)
+	_ = u.file.Close()
+	return u.store.Remove(u.Session.ID)
+}
+
+// Finalize передает принятые данные в commit и удаляет сессию.
+// commit забирает staging файл partPath, например переносит его в хранилище
+func (u *Upload) Finalize(commit func(partPath string) error) error {
+	defer u.store.release(u.Session.ID)
+
+	if err := u.file.Sync(); err != nil {
+		_ = u.file.Close()
+		return err
+	}
+	if err := u.file.Close(); err != nil {
+		return err
+	}
+	if err := commit(u.store.partPath(u.Session.ID)); err != nil {
+		return err
+	}
+	return u.store.Remove(u.Session.ID)
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validID защищает от обхода путей через идентификатор сессии
+func validID(id string) bool {
+	if len(id) != 32 {
+		return false
+	}
+	_, err := hex.DecodeString(id)
+	return err == nil
+}
@@ -0,0 +1,97 @@
+package session
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"testing"
+)
+
+// Сессия продолжается с подтвержденного смещения, данные после него отбрасываются
+func TestOpenResume(t *testing.T) {
+	s := NewStore(t.TempDir())
+	sess, err := s.Create("f.bin", "alice", "overwrite", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	up, err := s.Open(sess.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Open(sess.ID, 0); !errors.Is(err, ErrSessionBusy) {
+		t.Fatalf("second open: got %v, want %v", err, ErrSessionBusy)
+	}
+	if err = up.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if err = up.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, committed, err := s.Get(sess.ID); err != nil || committed != 10 {
+		t.Fatalf("Get = %d, %v, want 10 bytes", committed, err)
+	}
+
+	for _, offset := range []int64{-1, 11} {
+		if _, err = s.Open(sess.ID, offset); !errors.Is(err, ErrInvalidOffset) {
+			t.Errorf("open at %d: got %v, want %v", offset, err, ErrInvalidOffset)
+		}
+	}
+
+	// клиент подтвердил только 6 байт: хвост отбрасывается, хеш считается по оставшимся
+	if up, err = s.Open(sess.ID, 6); err != nil {
+		t.Fatal(err)
+	}
+	if up.Offset != 6 {
+		t.Fatalf("Offset = %d, want 6", up.Offset)
+	}
+	if err = up.Write([]byte("abcd")); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte("012345abcd")
+	sum := sha256.Sum256(want)
+	if got := up.Hash().Sum(nil); !bytes.Equal(got, sum[:]) {
+		t.Errorf("Hash = %x, want %x", got, sum)
+	}
+
+	var data []byte
+	err = up.Finalize(func(partPath string) error {
+		data, err = os.ReadFile(partPath)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("finalized data = %q, want %q", data, want)
+	}
+	if _, _, err = s.Get(sess.ID); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("Get after Finalize: got %v, want %v", err, ErrSessionNotFound)
+	}
+}
+
+// Неизвестная или чужая по формату сессия не найдена, удаленная сессия не открывается
+func TestSessionNotFound(t *testing.T) {
+	s := NewStore(t.TempDir())
+	for _, id := range []string{"", "../../etc/passwd", "0123456789abcdef0123456789abcdef"} {
+		if _, err := s.Open(id, 0); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("open %q: got %v, want %v", id, err, ErrSessionNotFound)
+		}
+	}
+
+	sess, err := s.Create("f.bin", "alice", "overwrite", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	up, err := s.Open(sess.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = up.Discard(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.Open(sess.ID, 0); !errors.Is(err, ErrSessionNotFound) {
+		t.Errorf("open after Discard: got %v, want %v", err, ErrSessionNotFound)
+	}
+}
@@ -0,0 +1,111 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Sweep удаляет сессии, в которые ничего не писали дольше ttl, вместе с принятыми данными,
+// а также файлы сессий, от которых не осталось метаданных. Сессии, которые сейчас пишутся,
+// не трогаются. Возвращает идентификаторы удаленных сессий
+func (s *Store) Sweep(ttl time.Duration) ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	// Последнее изменение любого файла сессии: данных, диапазонов или метаданных
+	lastWrite := make(map[string]time.Time)
+	for _, e := range entries {
+		id, ok := sessionFileID(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		if info.ModTime().After(lastWrite[id]) {
+			lastWrite[id] = info.ModTime()
+		}
+	}
+
+	now := time.Now()
+	var removed []string
+	for id, modTime := range lastWrite {
+		if now.Sub(modTime) < ttl || !s.acquireIdle(id) {
+			continue
+		}
+		err = s.Remove(id)
+		if err == nil {
+			err = os.Remove(s.rangesPath(id) + ".tmp")
+			if errors.Is(err, os.ErrNotExist) {
+				err = nil
+			}
+		}
+		s.release(id)
+		if err != nil {
+			return removed, err
+		}
+		removed = append(removed, id)
+	}
+	return removed, nil
+}
+
+// RunSweeper удаляет брошенные сессии раз в interval, пока ctx не отменен.
+// onExpire вызывается для каждой удаленной сессии, может быть nil
+func (s *Store) RunSweeper(ctx context.Context, interval, ttl time.Duration, onExpire func(id string)) {
+	const op = "server.session.RunSweeper"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		removed, err := s.Sweep(ttl)
+		if err != nil {
+			log.Printf("%s: failed to remove expired sessions: %v", op, err)
+		}
+		if len(removed) > 0 {
+			log.Printf("%s: removed %d expired sessions", op, len(removed))
+		}
+		if onExpire != nil {
+			for _, id := range removed {
+				onExpire(id)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// acquireIdle занимает сессию, если в нее сейчас ничего не пишется,
+// чтобы ее не открыли, пока она удаляется. Освобождается через release
+func (s *Store) acquireIdle(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.active[id]; ok || len(s.parts[id]) > 0 {
+		return false
+	}
+	s.active[id] = struct{}{}
+	return true
+}
+
+// sessionFileID возвращает идентификатор сессии по имени ее файла
+func sessionFileID(name string) (string, bool) {
+	for _, ext := range []string{metaExt, partExt, rangesExt, rangesExt + ".tmp"} {
+		if id, ok := strings.CutSuffix(name, ext); ok && validID(id) {
+			return id, true
+		}
+	}
+	return "", false
+}
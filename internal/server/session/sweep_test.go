@@ -0,0 +1,115 @@
+package session
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// age сдвигает время изменения файлов сессии id на d назад
+func age(t *testing.T, s *Store, id string, d time.Duration) {
+	t.Helper()
+	old := time.Now().Add(-d)
+	for _, path := range []string{s.metaPath(id), s.partPath(id), s.rangesPath(id)} {
+		if err := os.Chtimes(path, old, old); err != nil && !errors.Is(err, os.ErrNotExist) {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSweep(t *testing.T) {
+	const ttl = time.Hour
+	dir := t.TempDir()
+	s := NewStore(dir)
+	size := int64(8)
+
+	fresh, err := s.Create("fresh.bin", "alice", "overwrite", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	abandoned, err := s.Create("abandoned.bin", "alice", "overwrite", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	age(t, s, abandoned.ID, 2*ttl)
+
+	// параллельная сессия с принятой частью
+	parallel, err := s.Create("parallel.bin", "alice", "overwrite", &size, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writePart(t, s, parallel.ID, []byte("01234567"), 0, 4)
+	age(t, s, parallel.ID, 2*ttl)
+
+	// старая сессия, в которую сейчас пишут
+	busy, err := s.Create("busy.bin", "alice", "overwrite", nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	age(t, s, busy.ID, 2*ttl)
+	up, err := s.Open(busy.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// данные без метаданных после сбоя и посторонний файл
+	orphan := "0123456789abcdef0123456789abcdef"
+	if err = os.WriteFile(filepath.Join(dir, orphan+partExt), []byte("data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	age(t, s, orphan, 2*ttl)
+	other := filepath.Join(dir, "notes.txt")
+	if err = os.WriteFile(other, nil, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chtimes(other, time.Now().Add(-2*ttl), time.Now().Add(-2*ttl)); err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := s.Sweep(ttl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(removed)
+	want := []string{abandoned.ID, parallel.ID, orphan}
+	slices.Sort(want)
+	if !slices.Equal(removed, want) {
+		t.Fatalf("removed %v, want %v", removed, want)
+	}
+	for _, id := range want {
+		if _, _, err = s.Get(id); !errors.Is(err, ErrSessionNotFound) {
+			t.Errorf("session %s after sweep: %v, want ErrSessionNotFound", id, err)
+		}
+		for _, path := range []string{s.metaPath(id), s.partPath(id), s.rangesPath(id)} {
+			if _, err = os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("%s left after sweep", filepath.Base(path))
+			}
+		}
+	}
+	for _, id := range []string{fresh.ID, busy.ID} {
+		if _, _, err = s.Get(id); err != nil {
+			t.Errorf("session %s removed: %v", id, err)
+		}
+	}
+	if _, err = os.Stat(other); err != nil {
+		t.Errorf("unrelated file removed: %v", err)
+	}
+
+	// сессия, которую продолжали, остается, пока снова не станет брошенной
+	if err = up.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err = up.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if removed, err = s.Sweep(ttl); err != nil || len(removed) != 0 {
+		t.Fatalf("second sweep removed %v, %v, want nothing", removed, err)
+	}
+	if up, err = s.Open(busy.ID, 4); err != nil {
+		t.Fatalf("open after sweep: %v", err)
+	}
+	_ = up.Close()
+}
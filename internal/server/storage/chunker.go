@@ -0,0 +1,72 @@
+package storage
+
+import "math/bits"
+
+// Размеры чанков по умолчанию
+const (
+	DefaultMinChunkSize = 64 << 10
+	DefaultAvgChunkSize = 256 << 10
+	DefaultMaxChunkSize = 1 << 20
+)
+
+// gearTable случайные числа скользящего хеша Gear. Таблица не должна меняться:
+// иначе те же данные после перезапуска резались бы по-другому и не совпадали с прежними чанками
+var gearTable = func() (table [256]uint64) {
+	// splitmix64 с фиксированным началом
+	seed := uint64(0x46696c655472616e) // "FileTran"
+	for i := range table {
+		seed += 0x9e3779b97f4a7c15
+		z := seed
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		table[i] = z ^ (z >> 31)
+	}
+	return table
+}()
+
+// chunker находит границы чанков по содержимому (FastCDC): граница ставится там,
+// где хеш последних 64 байт дает нули под маской. Вставка данных в файл меняет
+// только чанки рядом с ней, остальные совпадают с чанками прежней версии
+type chunker struct {
+	min, avg, max int
+	// до avg граница ищется по строгой маске, после - по мягкой,
+	// поэтому размеры чанков собираются около avg
+	maskS, maskL uint64
+}
+
+// newChunker возвращает chunker для чанков от min до max байт, avg - степень двойки
+func newChunker(min, avg, max int) chunker {
+	n := bits.Len(uint(avg)) - 1
+	return chunker{min: min, avg: avg, max: max, maskS: topBits(n + 1), maskL: topBits(n - 1)}
+}
+
+// topBits маска из n старших бит. Старшие биты хеша Gear зависят от большего кол-ва байт
+func topBits(n int) uint64 {
+	return ^uint64(0) << (64 - n)
+}
+
+// cut возвращает длину первого чанка data. Если граница не найдена, а data короче max,
+// возвращает len(data): вызывающий решает, конец ли это потока
+func (c chunker) cut(data []byte) int {
+	n := len(data)
+	if n <= c.min {
+		return n
+	}
+	n = min(n, c.max)
+
+	var hash uint64
+	i := c.min
+	for normal := min(c.avg, n); i < normal; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&c.maskS == 0 {
+			return i + 1
+		}
+	}
+	for ; i < n; i++ {
+		hash = (hash << 1) + gearTable[data[i]]
+		if hash&c.maskL == 0 {
+			return i + 1
+		}
+	}
+	return n
+}
@@ -0,0 +1,649 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/bits"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+)
+
+// manifestMagic первая строка манифеста. Манифестом файл делает не она, а метка
+// meta.Meta.Chunked: обычный файл, загруженный до включения дедупликации, может начинаться так же
+const manifestMagic = "filetransfer-manifest v1\n"
+
+// maxManifestHeader длина заголовка манифеста с размером файла
+const maxManifestHeader = len(manifestMagic) + len("size \n") + 20
+
+var errNotManifest = errors.New("not a chunk manifest")
+
+// DedupOptions размеры чанков в байтах, 0 - значение по умолчанию
+type DedupOptions struct {
+	MinChunkSize int
+	// AvgChunkSize ожидаемый размер чанка, степень двойки
+	AvgChunkSize int
+	MaxChunkSize int
+}
+
+// Dedup хранит файлы по частям: поток режется на чанки по содержимому,
+// каждый уникальный чанк хранится в chunks один раз под своим SHA-256,
+// а в files вместо содержимого файла лежит манифест со списком чанков,
+// помеченный в метаданных (meta.Meta.Chunked). Файлы без метки читаются как есть.
+// Почти одинаковые файлы делят большую часть чанков.
+//
+// Ссылки на чанки считаются в памяти, при запуске - по манифестам.
+// Чанки без ссылок удаляет GC
+type Dedup struct {
+	files   Storage
+	chunks  Storage
+	chunker chunker
+
+	mu   sync.Mutex // защищает refs и удаление чанков
+	refs map[string]*chunkState
+
+	// nsMu не дает двум операциям одновременно заменить или удалить один манифест
+	// и дважды освободить его чанки
+	nsMu sync.Mutex
+}
+
+type chunkState struct {
+	refs   int64 // ссылки из манифестов и незавершенных записей
+	stored bool  // чанк уже лежит в хранилище чанков
+}
+
+// chunkRef чанк в манифесте
+type chunkRef struct {
+	hash string // SHA-256 в hex
+	size int64
+}
+
+// manifest список чанков файла по порядку
+type manifest struct {
+	size   int64
+	chunks []chunkRef
+}
+
+// NewDedup возвращает хранилище с дедупликацией поверх files (манифесты) и chunks (чанки)
+// и считает ссылки на чанки по уже сохраненным манифестам
+func NewDedup(ctx context.Context, files, chunks Storage, opts DedupOptions) (*Dedup, error) {
+	if opts.MinChunkSize == 0 {
+		opts.MinChunkSize = DefaultMinChunkSize
+	}
+	if opts.AvgChunkSize == 0 {
+		opts.AvgChunkSize = DefaultAvgChunkSize
+	}
+	if opts.MaxChunkSize == 0 {
+		opts.MaxChunkSize = DefaultMaxChunkSize
+	}
+	if err := ValidateChunkSizes(opts.MinChunkSize, opts.AvgChunkSize, opts.MaxChunkSize); err != nil {
+		return nil, err
+	}
+
+	d := &Dedup{
+		files:   files,
+		chunks:  chunks,
+		chunker: newChunker(opts.MinChunkSize, opts.AvgChunkSize, opts.MaxChunkSize),
+		refs:    make(map[string]*chunkState),
+	}
+
+	err := Walk(ctx, chunks, "", func(info Info) error {
+		if !info.IsDir {
+			d.state(path.Base(info.Name)).stored = true
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("scan chunks: %w", err)
+	}
+
+	err = Walk(ctx, files, "", func(info Info) error {
+		if info.IsDir {
+			return nil
+		}
+		m, err := d.loadManifest(ctx, info.Name)
+		switch {
+		case errors.Is(err, errNotManifest), errors.Is(err, ErrNotFound):
+			return nil
+		case err != nil:
+			return fmt.Errorf("%s: %w", info.Name, err)
+		}
+		for _, c := range m.chunks {
+			d.state(c.hash).refs++
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, fmt.Errorf("scan manifests: %w", err)
+	}
+	return d, nil
+}
+
+// ValidateChunkSizes проверяет размеры чанков: 0 < min <= avg <= max, avg - степень двойки
+func ValidateChunkSizes(minSize, avgSize, maxSize int) error {
+	if minSize <= 0 || minSize > avgSize || avgSize > maxSize {
+		return fmt.Errorf("chunk sizes must satisfy 0 < min <= avg <= max, got %d, %d, %d", minSize, avgSize, maxSize)
+	}
+	if bits.OnesCount(uint(avgSize)) != 1 || avgSize < 256 {
+		return fmt.Errorf("average chunk size must be a power of two not less than 256, got %d", avgSize)
+	}
+	return nil
+}
+
+// state возвращает счетчик чанка hash, создавая его. Вызывается под d.mu или до начала работы
+func (d *Dedup) state(hash string) *chunkState {
+	st, ok := d.refs[hash]
+	if !ok {
+		st = &chunkState{}
+		d.refs[hash] = st
+	}
+	return st
+}
+
+// chunkName путь чанка в хранилище чанков. Первые два символа хеша - директория,
+// чтобы в одной директории не было миллионов файлов
+func chunkName(hash string) string {
+	return hash[:2] + "/" + hash
+}
+
+// putChunk сохраняет чанк, если такого еще нет, и берет на него ссылку
+func (d *Dedup) putChunk(ctx context.Context, data []byte) (chunkRef, error) {
+	sum := sha256.Sum256(data)
+	ref := chunkRef{hash: hex.EncodeToString(sum[:]), size: int64(len(data))}
+
+	d.mu.Lock()
+	st := d.state(ref.hash)
+	st.refs++
+	stored := st.stored
+	d.mu.Unlock()
+	if stored {
+		return ref, nil
+	}
+
+	// Пока есть ссылка, GC чанк не тронет. Если тот же чанк пишут одновременно,
+	// запись с одинаковым содержимым просто заменит его
+	if err := d.writeChunk(ctx, ref.hash, data); err != nil {
+		d.release([]chunkRef{ref})
+		return chunkRef{}, err
+	}
+	d.mu.Lock()
+	st.stored = true
+	d.mu.Unlock()
+	return ref, nil
+}
+
+func (d *Dedup) writeChunk(ctx context.Context, hash string, data []byte) error {
+	w, err := d.chunks.Put(ctx, chunkName(hash))
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(data); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	return w.Commit(meta.Meta{})
+}
+
+// release освобождает ссылки на чанки. Чанки без ссылок остаются до GC
+func (d *Dedup) release(refs []chunkRef) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, c := range refs {
+		if st := d.refs[c.hash]; st != nil && st.refs > 0 {
+			st.refs--
+		}
+	}
+}
+
+// loadManifest читает манифест файла name. Для файла без метки манифеста возвращает errNotManifest
+func (d *Dedup) loadManifest(ctx context.Context, name string) (*manifest, error) {
+	info, err := d.files.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if info.IsDir {
+		return nil, ErrIsDir
+	}
+	if !info.Meta.Chunked {
+		return nil, errNotManifest
+	}
+	return d.readManifest(ctx, name, false)
+}
+
+// readManifest читает манифест помеченного файла name, при headerOnly - только размер файла
+func (d *Dedup) readManifest(ctx context.Context, name string, headerOnly bool) (*manifest, error) {
+	var length int64
+	if headerOnly {
+		length = int64(maxManifestHeader)
+	}
+	r, err := d.files.Get(ctx, name, 0, length)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	m, err := readManifest(r, headerOnly)
+	if errors.Is(err, errNotManifest) {
+		// метка есть, а заголовка нет: манифест поврежден
+		return nil, fmt.Errorf("corrupted chunk manifest %s", name)
+	}
+	return m, err
+}
+
+// fileSize возвращает размер содержимого файла, а не манифеста.
+// Метка манифеста нужна только Dedup и из сведений о файле убирается
+func (d *Dedup) fileSize(ctx context.Context, info *Info) error {
+	if info.NoMeta {
+		full, err := WithMeta(ctx, d.files, *info)
+		if err != nil {
+			return err
+		}
+		*info = full
+	}
+	if !info.Meta.Chunked {
+		return nil
+	}
+	m, err := d.readManifest(ctx, info.Name, true)
+	if err != nil {
+		return err
+	}
+	info.Size = m.size
+	info.Meta.Chunked = false
+	return nil
+}
+
+// marshal записывает манифест: manifestMagic, "size <размер>", затем "<hash> <size>" для каждого чанка
+func (m *manifest) marshal() []byte {
+	var buf bytes.Buffer
+	buf.Grow(maxManifestHeader + len(m.chunks)*(sha256.Size*2+10))
+	buf.WriteString(manifestMagic)
+	fmt.Fprintf(&buf, "size %d\n", m.size)
+	for _, c := range m.chunks {
+		fmt.Fprintf(&buf, "%s %d\n", c.hash, c.size)
+	}
+	return buf.Bytes()
+}
+
+// readManifest разбирает манифест, при headerOnly - только размер файла
+func readManifest(r io.Reader, headerOnly bool) (*manifest, error) {
+	br := bufio.NewReader(r)
+	magic := make([]byte, len(manifestMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != manifestMagic {
+		return nil, errNotManifest
+	}
+
+	var m manifest
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("manifest header: %w", err)
+	}
+	sizeStr, ok := strings.CutPrefix(strings.TrimSuffix(line, "\n"), "size ")
+	if !ok {
+		return nil, fmt.Errorf("manifest header: %q", line)
+	}
+	if m.size, err = strconv.ParseInt(sizeStr, 10, 64); err != nil {
+		return nil, fmt.Errorf("manifest size: %w", err)
+	}
+	if headerOnly {
+		return &m, nil
+	}
+
+	var total int64
+	for {
+		line, err = br.ReadString('\n')
+		if err == io.EOF && line == "" {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("manifest: %w", err)
+		}
+		hash, sizeStr, ok := strings.Cut(strings.TrimSuffix(line, "\n"), " ")
+		if !ok || len(hash) != sha256.Size*2 {
+			return nil, fmt.Errorf("manifest chunk: %q", line)
+		}
+		size, err := strconv.ParseInt(sizeStr, 10, 64)
+		if err != nil || size <= 0 {
+			return nil, fmt.Errorf("manifest chunk: %q", line)
+		}
+		m.chunks = append(m.chunks, chunkRef{hash: hash, size: size})
+		total += size
+	}
+	if total != m.size {
+		return nil, fmt.Errorf("manifest chunks total %d bytes, want %d", total, m.size)
+	}
+	return &m, nil
+}
+
+func (d *Dedup) Put(ctx context.Context, name string) (Writer, error) {
+	rel, err := fileName(name)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := d.files.Stat(ctx, rel); err == nil && info.IsDir {
+		return nil, ErrIsDir
+	}
+	return &dedupWriter{d: d, ctx: ctx, name: rel}, nil
+}
+
+// dedupWriter режет поток на чанки и сохраняет их по мере записи
+type dedupWriter struct {
+	d    *Dedup
+	ctx  context.Context
+	name string
+	buf  []byte   // данные, для которых граница чанка еще не найдена
+	m    manifest // сохраненные чанки, на каждый взята ссылка
+	done bool
+}
+
+func (w *dedupWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, errors.New("write after commit or abort")
+	}
+	w.buf = append(w.buf, p...)
+	// Граница ищется только в первых max байтах, поэтому до конца потока
+	// режем, только когда их набралось не меньше
+	for len(w.buf) >= w.d.chunker.max {
+		if err := w.flush(w.d.chunker.cut(w.buf)); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// flush сохраняет первые n байт буфера как чанк
+func (w *dedupWriter) flush(n int) error {
+	ref, err := w.d.putChunk(w.ctx, w.buf[:n])
+	if err != nil {
+		return err
+	}
+	w.m.chunks = append(w.m.chunks, ref)
+	w.m.size += ref.size
+	w.buf = w.buf[:copy(w.buf, w.buf[n:])]
+	return nil
+}
+
+func (w *dedupWriter) Commit(m meta.Meta) error {
+	if w.done {
+		return errors.New("commit after commit or abort")
+	}
+	w.done = true
+	for len(w.buf) > 0 {
+		if err := w.flush(w.d.chunker.cut(w.buf)); err != nil {
+			w.d.release(w.m.chunks)
+			return err
+		}
+	}
+	w.buf = nil
+	return w.d.commitManifest(w.ctx, w.name, &w.m, m)
+}
+
+func (w *dedupWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.buf = nil
+	w.d.release(w.m.chunks)
+	return nil
+}
+
+// commitManifest сохраняет манифест файла name и освобождает чанки прежней версии.
+// При ошибке освобождает чанки нового манифеста
+func (d *Dedup) commitManifest(ctx context.Context, name string, m *manifest, fm meta.Meta) error {
+	d.nsMu.Lock()
+	defer d.nsMu.Unlock()
+
+	old, err := d.loadManifest(ctx, name)
+	if err != nil && !errors.Is(err, ErrNotFound) && !errors.Is(err, errNotManifest) {
+		d.release(m.chunks)
+		return err
+	}
+
+	w, err := d.files.Put(ctx, name)
+	if err != nil {
+		d.release(m.chunks)
+		return err
+	}
+	if _, err = w.Write(m.marshal()); err != nil {
+		_ = w.Abort()
+		d.release(m.chunks)
+		return err
+	}
+	fm.Chunked = true
+	if err = w.Commit(fm); err != nil {
+		d.release(m.chunks)
+		return err
+	}
+	if old != nil {
+		d.release(old.chunks)
+	}
+	return nil
+}
+
+func (d *Dedup) Get(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	m, err := d.loadManifest(ctx, name)
+	if errors.Is(err, errNotManifest) {
+		return d.files.Get(ctx, name, offset, length)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := &chunkReader{ctx: ctx, chunks: d.chunks, left: -1}
+	if length > 0 {
+		r.left = length
+	}
+	// Пропускаем чанки до offset
+	refs := m.chunks
+	for len(refs) > 0 && offset >= refs[0].size {
+		offset -= refs[0].size
+		refs = refs[1:]
+	}
+	r.refs, r.skip = refs, offset
+	return r, nil
+}
+
+// chunkReader читает файл по манифесту, открывая чанки по очереди
+type chunkReader struct {
+	ctx    context.Context
+	chunks Storage
+	refs   []chunkRef // еще не открытые чанки
+	skip   int64      // сколько байт пропустить в первом чанке
+	left   int64      // сколько байт осталось отдать, -1 - до конца файла
+	cur    io.ReadCloser
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if r.left == 0 {
+			return 0, io.EOF
+		}
+		if r.cur == nil {
+			if len(r.refs) == 0 {
+				return 0, io.EOF
+			}
+			c := r.refs[0]
+			cur, err := r.chunks.Get(r.ctx, chunkName(c.hash), r.skip, 0)
+			if err != nil {
+				// Пропавший чанк - повреждение хранилища, а не отсутствие файла
+				return 0, fmt.Errorf("read chunk %s: %v", c.hash, err)
+			}
+			r.refs, r.skip, r.cur = r.refs[1:], 0, cur
+		}
+
+		if r.left > 0 && int64(len(p)) > r.left {
+			p = p[:r.left]
+		}
+		n, err := r.cur.Read(p)
+		if r.left > 0 {
+			r.left -= int64(n)
+		}
+		if err == io.EOF {
+			_ = r.cur.Close()
+			r.cur, err = nil, nil
+			if n == 0 {
+				continue
+			}
+		}
+		return n, err
+	}
+}
+
+func (r *chunkReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	return r.cur.Close()
+}
+
+func (d *Dedup) Stat(ctx context.Context, name string) (*Info, error) {
+	info, err := d.files.Stat(ctx, name)
+	if err != nil || info.IsDir {
+		return info, err
+	}
+	if err = d.fileSize(ctx, info); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (d *Dedup) List(ctx context.Context, dir string, fn func(Info) error) error {
+	return d.files.List(ctx, dir, func(info Info) error {
+		if !info.IsDir {
+			err := d.fileSize(ctx, &info)
+			if errors.Is(err, ErrNotFound) {
+				return nil // файл удалили во время обхода
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return fn(info)
+	})
+}
+
+func (d *Dedup) Delete(ctx context.Context, name string) error {
+	rel, err := fileName(name)
+	if err != nil {
+		return err
+	}
+
+	d.nsMu.Lock()
+	defer d.nsMu.Unlock()
+
+	old, err := d.loadManifest(ctx, rel)
+	if err != nil && !errors.Is(err, errNotManifest) {
+		if info, statErr := d.files.Stat(ctx, rel); statErr == nil && info.IsDir {
+			return ErrIsDir
+		}
+		return err
+	}
+	if err = d.files.Delete(ctx, rel); err != nil {
+		return err
+	}
+	if old != nil {
+		d.release(old.chunks)
+	}
+	return nil
+}
+
+func (d *Dedup) Rename(ctx context.Context, oldName, newName string) error {
+	d.nsMu.Lock()
+	defer d.nsMu.Unlock()
+	return d.files.Rename(ctx, oldName, newName)
+}
+
+func (d *Dedup) MakeDir(ctx context.Context, name string, parents bool) error {
+	return d.files.MakeDir(ctx, name, parents)
+}
+
+func (d *Dedup) RemoveDir(ctx context.Context, name string, recursive bool) error {
+	d.nsMu.Lock()
+	defer d.nsMu.Unlock()
+
+	var refs []chunkRef
+	if recursive {
+		err := Walk(ctx, d.files, name, func(info Info) error {
+			if info.IsDir {
+				return nil
+			}
+			m, err := d.loadManifest(ctx, info.Name)
+			switch {
+			case errors.Is(err, errNotManifest), errors.Is(err, ErrNotFound):
+			case err != nil:
+				return err
+			default:
+				refs = append(refs, m.chunks...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	if err := d.files.RemoveDir(ctx, name, recursive); err != nil {
+		return err
+	}
+	d.release(refs)
+	return nil
+}
+
+// GC удаляет чанки, на которые не ссылается ни один файл, и возвращает их кол-во и объем
+func (d *Dedup) GC(ctx context.Context) (removed int, freed int64, err error) {
+	err = Walk(ctx, d.chunks, "", func(info Info) error {
+		if info.IsDir {
+			return nil
+		}
+		hash := path.Base(info.Name)
+
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		if st := d.refs[hash]; st != nil && st.refs > 0 {
+			return nil
+		}
+		if err := d.chunks.Delete(ctx, info.Name); err != nil && !errors.Is(err, ErrNotFound) {
+			return err
+		}
+		delete(d.refs, hash)
+		removed++
+		freed += info.Size
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		err = nil // чанков еще нет
+	}
+	return removed, freed, err
+}
+
+// RunGC удаляет чанки без ссылок раз в interval до отмены ctx
+func (d *Dedup) RunGC(ctx context.Context, interval time.Duration) {
+	const op = "storage.Dedup.RunGC"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, freed, err := d.GC(ctx)
+			if err != nil {
+				log.Printf("%s: %v", op, err)
+			}
+			if removed > 0 {
+				log.Printf("%s: removed %d chunks, freed %d bytes", op, removed, freed)
+			}
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	ctx := context.Background()
+	files, chunks := NewMemory(), NewMemory()
+	opts := DedupOptions{MinChunkSize: 1 << 10, AvgChunkSize: 4 << 10, MaxChunkSize: 16 << 10}
+	d, err := NewDedup(ctx, files, chunks, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Две сборки отличаются вставкой в начале и измененным блоком в середине
+	rnd := rand.New(rand.NewSource(1))
+	v1 := make([]byte, 512<<10)
+	rnd.Read(v1)
+	v2 := append(append([]byte{}, v1[:1000]...), []byte("inserted bytes")...)
+	v2 = append(v2, v1[1000:]...)
+	rnd.Read(v2[300<<10 : 300<<10+100])
+
+	put(t, d, "build/v1.bin", string(v1))
+	n1 := len(list(t, chunks, ""))
+	put(t, d, "build/v2.bin", string(v2))
+	added := len(list(t, chunks, "")) - n1
+	if added*5 > n1 {
+		t.Errorf("second build added %d chunks to %d, want most chunks shared", added, n1)
+	}
+
+	if got := get(t, d, "build/v2.bin", 0, 0); got != string(v2) {
+		t.Fatal("Get(v2) content differs")
+	}
+	if got := get(t, d, "build/v2.bin", 100000, 70000); got != string(v2[100000:170000]) {
+		t.Error("Get(v2) range content differs")
+	}
+	if got := get(t, d, "build/v2.bin", int64(len(v2)), 0); got != "" {
+		t.Errorf("Get at end of file = %d bytes, want none", len(got))
+	}
+	info, err := d.Stat(ctx, "build/v2.bin")
+	if err != nil || info.Size != int64(len(v2)) {
+		t.Errorf("Stat = %+v, %v, want size %d", info, err, len(v2))
+	}
+
+	// Перезапуск считает ссылки по манифестам: общие чанки не удаляются
+	if d, err = NewDedup(ctx, files, chunks, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Delete(ctx, "build/v1.bin"); err != nil {
+		t.Fatal(err)
+	}
+	removed, _, err := d.GC(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if removed == 0 || removed > added+2 {
+		t.Errorf("GC removed %d chunks, want only chunks unique to v1", removed)
+	}
+	if got := get(t, d, "build/v2.bin", 0, 0); got != string(v2) {
+		t.Error("Get(v2) after GC content differs")
+	}
+
+	// Перезапись и удаление директории освобождают все чанки
+	put(t, d, "build/v2.bin", "small")
+	if err = d.RemoveDir(ctx, "build", true); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = d.GC(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range list(t, chunks, "") {
+		if info, err := chunks.Stat(ctx, name); err == nil && !info.IsDir {
+			t.Errorf("chunk %s left after all files removed", name)
+		}
+	}
+}
+
+// Файлы без манифеста, сохраненные до включения дедупликации, читаются как есть
+func TestDedupLegacyFiles(t *testing.T) {
+	ctx := context.Background()
+	files := NewMemory()
+	put(t, files, "old.txt", "plain content")
+
+	d, err := NewDedup(ctx, files, NewMemory(), DedupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, d, "old.txt", 6, 0); got != "content" {
+		t.Errorf("Get = %q, want %q", got, "content")
+	}
+	if info, err := d.Stat(ctx, "old.txt"); err != nil || info.Size != 13 {
+		t.Errorf("Stat = %+v, %v, want size 13", info, err)
+	}
+	if err = d.Delete(ctx, "old.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = d.Stat(ctx, "old.txt"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat after Delete error = %v, want ErrNotFound", err)
+	}
+}
+
+// Обычный файл, который начинается как манифест, не читается как манифест:
+// иначе он мог бы сослаться на чанки чужого файла
+func TestDedupPlainFileWithManifestMagic(t *testing.T) {
+	ctx := context.Background()
+	files, chunks := NewMemory(), NewMemory()
+	d, err := NewDedup(ctx, files, chunks, DedupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	put(t, d, "secret.txt", "secret content")
+	m, err := d.loadManifest(ctx, "secret.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := string(m.marshal())
+
+	// файл загружен в хранилище до включения дедупликации
+	put(t, files, "forged.txt", forged)
+	if d, err = NewDedup(ctx, files, chunks, DedupOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, d, "forged.txt", 0, 0); got != forged {
+		t.Errorf("Get(forged.txt) = %q, want file content as is", got)
+	}
+	if info, err := d.Stat(ctx, "forged.txt"); err != nil || info.Size != int64(len(forged)) {
+		t.Errorf("Stat(forged.txt) = %+v, %v, want size %d", info, err, len(forged))
+	}
+
+	// файл с той же первой строкой, загруженный через Dedup, тоже хранится чанками
+	put(t, d, "uploaded.txt", forged)
+	if got := get(t, d, "uploaded.txt", 0, 0); got != forged {
+		t.Errorf("Get(uploaded.txt) = %q, want uploaded content", got)
+	}
+
+	// поддельный файл не держит чанки: после удаления настоящего они уходят в GC
+	if err = d.Delete(ctx, "secret.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if removed, _, err := d.GC(ctx); err != nil || removed != len(m.chunks) {
+		t.Errorf("GC removed %d chunks, %v, want %d", removed, err, len(m.chunks))
+	}
+
+	// метка манифеста не видна снаружи
+	info, err := d.Stat(ctx, "uploaded.txt")
+	if err != nil || info.Meta.Chunked || info.Size != int64(len(forged)) {
+		t.Errorf("Stat(uploaded.txt) = %+v, %v, want unmarked file of %d bytes", info, err, len(forged))
+	}
+}
+
+func TestChunkerBoundaries(t *testing.T) {
+	c := newChunker(1<<10, 4<<10, 16<<10)
+	data := make([]byte, 1<<20)
+	rand.New(rand.NewSource(2)).Read(data)
+
+	var sizes []int
+	for rest := data; len(rest) > 0; {
+		n := c.cut(rest)
+		if n < c.min && n != len(rest) || n > c.max {
+			t.Fatalf("chunk of %d bytes outside [%d, %d]", n, c.min, c.max)
+		}
+		sizes = append(sizes, n)
+		rest = rest[n:]
+	}
+	if avg := len(data) / len(sizes); avg < 2<<10 || avg > 8<<10 {
+		t.Errorf("average chunk size %d, want about %d", avg, c.avg)
+	}
+
+	// Одинаковые данные режутся одинаково
+	if n := c.cut(bytes.Clone(data)); n != sizes[0] {
+		t.Errorf("cut = %d on equal data, want %d", n, sizes[0])
+	}
+}
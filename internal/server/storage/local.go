@@ -0,0 +1,401 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/pkg/file"
+)
+
+const readDirBatch = 256 // кол-во записей директории, читаемых за раз
+
+// Local хранит файлы в директории на локальном диске. Метаданные загрузки
+// лежат в расширенных атрибутах файлов
+type Local struct {
+	root string
+}
+
+// NewLocal возвращает хранилище в директории root. Директория создается при первой записи
+func NewLocal(root string) *Local {
+	return &Local{root: root}
+}
+
+// openEntry открывает файл или директорию name внутри хранилища только на чтение.
+// Пустое имя - корень хранилища
+func (l *Local) openEntry(name string) (*os.File, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "" {
+		d, err := l.openDir("", false)
+		if err != nil {
+			return nil, err
+		}
+		defer d.close()
+		return d.open(".", os.O_RDONLY, 0)
+	}
+	d, base, err := l.openParent(rel, false)
+	if err != nil {
+		return nil, err
+	}
+	defer d.close()
+	return d.open(base, os.O_RDONLY, 0)
+}
+
+// localError переводит ошибки файловой системы в ошибки хранилища
+func localError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, fs.ErrNotExist):
+		return ErrNotFound
+	case errors.Is(err, syscall.ENOTDIR):
+		return ErrNotDir
+	case errors.Is(err, syscall.EISDIR):
+		return ErrIsDir
+	case errors.Is(err, syscall.ENOTEMPTY):
+		return ErrNotEmpty
+	case errors.Is(err, fs.ErrExist):
+		return ErrExist
+	default:
+		return err
+	}
+}
+
+// info собирает сведения о файле name по открытому файлу f
+func (l *Local) info(name string, f *os.File) (Info, error) {
+	fileStat, err := f.Stat()
+	if err != nil {
+		return Info{}, err
+	}
+	info := Info{
+		Name:    name,
+		Size:    fileStat.Size(),
+		Mode:    fileStat.Mode(),
+		ModTime: fileStat.ModTime(),
+		IsDir:   fileStat.IsDir(),
+	}
+	if birth, ok := meta.FileBirthTime(f); ok {
+		info.CreationTime = birth
+	}
+	if info.IsDir {
+		return info, nil
+	}
+	info.Meta = meta.ReadFile(f)
+	if info.Meta.ContentType == "" {
+		info.Meta.ContentType = meta.FileContentType(name, f)
+	}
+	return info, nil
+}
+
+// Put создает скрытый staging файл рядом с итоговым, Commit переименовывает его
+func (l *Local) Put(_ context.Context, name string) (Writer, error) {
+	d, base, err := l.openParent(name, true)
+	if err != nil {
+		return nil, err
+	}
+	f, staging, err := d.createTemp(base)
+	if err != nil {
+		_ = d.close()
+		return nil, err
+	}
+	return &localWriter{dir: d, f: f, staging: staging, name: base}, nil
+}
+
+// localWriter пишет в staging файл. Директория файла остается открытой до Commit или Abort,
+// поэтому файл сохраняется в ней, даже если путь к ней подменили во время загрузки
+type localWriter struct {
+	dir     *localDir
+	f       *os.File
+	staging string
+	name    string
+	done    bool
+}
+
+func (w *localWriter) Write(p []byte) (int, error) {
+	return w.f.Write(p)
+}
+
+func (w *localWriter) Commit(m meta.Meta) error {
+	const op = "server.storage.Commit"
+
+	if w.done {
+		return errors.New("file is already closed")
+	}
+	if err := w.f.Sync(); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	// staging файл создается с правами 0600, а файлы хранилища доступны на чтение как загруженные
+	if err := w.f.Chmod(defaultFileMode); err != nil {
+		_ = w.Abort()
+		return localError(err)
+	}
+	if err := meta.WriteFile(w.f, m); err != nil {
+		log.Printf("%s: failed to write file metadata: %v", op, err)
+	}
+	if err := w.f.Close(); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	w.done = true
+	defer w.dir.close()
+	if err := w.dir.rename(w.staging, w.dir, w.name); err != nil {
+		_ = w.dir.remove(w.staging, false)
+		return err
+	}
+	// сохраняет на диске результат переименования
+	return w.dir.sync()
+}
+
+func (w *localWriter) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	_ = w.f.Close()
+	defer w.dir.close()
+	return w.dir.remove(w.staging, false)
+}
+
+// writeMeta сохраняет метаданные в файле. Хранилище работает и без них,
+// поэтому ошибка только записывается в лог
+func writeMeta(filePath string, m meta.Meta) {
+	const op = "server.storage.writeMeta"
+
+	if err := meta.Write(filePath, m); err != nil {
+		log.Printf("%s: failed to write file metadata: %v", op, err)
+	}
+}
+
+// Import переносит локальный файл в хранилище переименованием,
+// а если srcPath на другом диске - копированием
+func (l *Local) Import(ctx context.Context, name, srcPath string, m meta.Meta) error {
+	d, base, err := l.openParent(name, true)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	if kind, kindErr := d.kind(base); kindErr == nil && kind.IsDir() {
+		return ErrIsDir
+	}
+
+	writeMeta(srcPath, m)
+	err = d.importFrom(srcPath, base)
+	if errors.Is(err, syscall.EXDEV) {
+		return importCopy(ctx, l, name, srcPath, m)
+	}
+	return err
+}
+
+func (l *Local) Get(_ context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	d, base, err := l.openParent(name, false)
+	if err != nil {
+		return nil, err
+	}
+	defer d.close()
+	f, err := d.open(base, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, err
+	}
+	fileStat, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if fileStat.IsDir() {
+		_ = f.Close()
+		return nil, ErrIsDir
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if length == 0 {
+		return f, nil
+	}
+	return readCloser{Reader: io.LimitReader(f, length), Closer: f}, nil
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+func (l *Local) Stat(_ context.Context, name string) (*Info, error) {
+	f, err := l.openEntry(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := l.info(name, f)
+	if err != nil {
+		return nil, localError(err)
+	}
+	return &info, nil
+}
+
+// List читает директорию пачками, поэтому память не зависит от ее размера.
+// Символические ссылки пропускаются: хранилище по ним не переходит
+func (l *Local) List(ctx context.Context, dir string, fn func(Info) error) error {
+	const op = "server.storage.List"
+
+	rel, err := cleanName(dir)
+	if err != nil {
+		return err
+	}
+	d, err := l.openDir(rel, false)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	entriesFile, err := d.open(".", os.O_RDONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer entriesFile.Close()
+
+	for {
+		entries, err := entriesFile.ReadDir(readDirBatch)
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			// скрытые файлы - незавершенные загрузки и служебные директории
+			if strings.HasPrefix(e.Name(), file.StagingPrefix) || e.Type()&fs.ModeSymlink != 0 {
+				continue
+			}
+			name := path.Join(rel, e.Name())
+			info, infoErr := l.entryInfo(d, name, e.Name())
+			if infoErr != nil {
+				log.Printf("%s: failed to get file info: %v", op, infoErr)
+				continue // Пропускаем файл, если не удалось получить информацию
+			}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return localError(err)
+		}
+	}
+}
+
+// entryInfo собирает сведения о записи base директории d
+func (l *Local) entryInfo(d *localDir, name, base string) (Info, error) {
+	f, err := d.open(base, os.O_RDONLY, 0)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	return l.info(name, f)
+}
+
+func (l *Local) Delete(_ context.Context, name string) error {
+	d, base, err := l.openParent(name, false)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	kind, err := d.kind(base)
+	if err != nil {
+		return err
+	}
+	if kind.IsDir() {
+		return ErrIsDir
+	}
+	return d.remove(base, false)
+}
+
+func (l *Local) Rename(_ context.Context, oldName, newName string) error {
+	oldDir, oldBase, err := l.openParent(oldName, false)
+	if err != nil {
+		return err
+	}
+	defer oldDir.close()
+	if _, err = oldDir.kind(oldBase); err != nil {
+		return err
+	}
+	// проверяет новое имя до создания его директорий
+	if _, err = cleanName(newName); err != nil {
+		return err
+	}
+	newDir, newBase, err := l.openParent(newName, true)
+	if err != nil {
+		return err
+	}
+	defer newDir.close()
+	if _, err = newDir.kind(newBase); err == nil {
+		return ErrExist
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	return oldDir.rename(oldBase, newDir, newBase)
+}
+
+func (l *Local) MakeDir(_ context.Context, name string, parents bool) error {
+	rel, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		if parents {
+			return localError(os.MkdirAll(l.root, os.ModePerm))
+		}
+		return localError(os.Mkdir(l.root, os.ModePerm))
+	}
+	if parents {
+		d, err := l.openDir(rel, true)
+		if err != nil {
+			return err
+		}
+		return d.close()
+	}
+	d, base, err := l.openParent(rel, false)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	return d.mkdir(base)
+}
+
+func (l *Local) RemoveDir(_ context.Context, name string, recursive bool) error {
+	d, base, err := l.openParent(name, false)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	kind, err := d.kind(base)
+	if err != nil {
+		return err
+	}
+	if !kind.IsDir() {
+		return ErrNotDir
+	}
+	if recursive {
+		return d.removeAll(base)
+	}
+	return d.remove(base, true)
+}
+
+// Link создает жесткую ссылку dst на файл name
+func (l *Local) Link(name, dst string) error {
+	d, base, err := l.openParent(name, false)
+	if err != nil {
+		return err
+	}
+	defer d.close()
+	return d.link(base, dst)
+}
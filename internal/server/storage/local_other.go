@@ -0,0 +1,167 @@
+//go:build !unix
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/RVodassa/FileTransfer/pkg/file"
+)
+
+// localDir директория хранилища. На этой платформе операции идут по пути,
+// а символические ссылки проверяются при открытии директории
+type localDir struct {
+	path string
+}
+
+// openDir возвращает директорию rel внутри хранилища. Отклоняет пути, которые
+// через символические ссылки ведут за пределы хранилища.
+// create создает недостающие директории, включая корень хранилища
+func (l *Local) openDir(rel string, create bool) (*localDir, error) {
+	full := filepath.Join(l.root, filepath.FromSlash(rel))
+	if err := l.checkSymlinks(full); err != nil {
+		return nil, err
+	}
+	if create {
+		if err := os.MkdirAll(full, os.ModePerm); err != nil {
+			return nil, localError(err)
+		}
+	} else if dirStat, err := os.Stat(full); err != nil {
+		return nil, localError(err)
+	} else if !dirStat.IsDir() {
+		return nil, ErrNotDir
+	}
+	return &localDir{path: full}, nil
+}
+
+// openParent возвращает директорию, в которой лежит файл name, вместе с именем файла.
+// Корень хранилища не допускается
+func (l *Local) openParent(name string, create bool) (*localDir, string, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if rel == "" {
+		return nil, "", fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+	if err = l.checkSymlinks(filepath.Join(l.root, filepath.FromSlash(rel))); err != nil {
+		return nil, "", err
+	}
+	dir, base := path.Split(rel)
+	d, err := l.openDir(strings.TrimSuffix(dir, "/"), create)
+	if err != nil {
+		return nil, "", err
+	}
+	return d, base, nil
+}
+
+// checkSymlinks проверяет, что ближайший существующий предок full
+// после разрешения символических ссылок остается внутри хранилища
+func (l *Local) checkSymlinks(full string) error {
+	const op = "server.storage.checkSymlinks"
+
+	root, err := filepath.EvalSymlinks(l.root)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil // хранилище еще не создано, ссылок в нем нет
+		}
+		return fmt.Errorf("resolve data dir: %w", err)
+	}
+
+	for p := full; ; {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			if !within(root, resolved) {
+				log.Printf("%s: %s resolves outside of data dir: %s", op, full, resolved)
+				return fmt.Errorf("%w: symlink escapes data dir", ErrInvalidPath)
+			}
+			return nil
+		}
+		if errors.Is(err, syscall.ENAMETOOLONG) {
+			return fmt.Errorf("%w: path too long", ErrInvalidPath)
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("resolve path: %w", err)
+		}
+
+		parent := filepath.Dir(p)
+		if parent == p {
+			return nil
+		}
+		p = parent
+	}
+}
+
+// within проверяет, что target совпадает с root или лежит внутри него
+func within(root, target string) bool {
+	rel, err := filepath.Rel(root, target)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+func (d *localDir) close() error {
+	return nil
+}
+
+func (d *localDir) open(name string, flag int, perm os.FileMode) (*os.File, error) {
+	f, err := os.OpenFile(filepath.Join(d.path, name), flag, perm)
+	return f, localError(err)
+}
+
+func (d *localDir) createTemp(base string) (*os.File, string, error) {
+	f, err := os.CreateTemp(d.path, file.StagingPrefix+base+".*.tmp")
+	if err != nil {
+		return nil, "", localError(err)
+	}
+	return f, filepath.Base(f.Name()), nil
+}
+
+func (d *localDir) kind(name string) (fs.FileMode, error) {
+	fileStat, err := os.Lstat(filepath.Join(d.path, name))
+	if err != nil {
+		return 0, localError(err)
+	}
+	return fileStat.Mode().Type(), nil
+}
+
+func (d *localDir) mkdir(name string) error {
+	return localError(os.Mkdir(filepath.Join(d.path, name), os.ModePerm))
+}
+
+func (d *localDir) remove(name string, dir bool) error {
+	err := os.Remove(filepath.Join(d.path, name))
+	if dir && errors.Is(err, syscall.EEXIST) {
+		return ErrNotEmpty
+	}
+	return localError(err)
+}
+
+func (d *localDir) removeAll(name string) error {
+	return localError(os.RemoveAll(filepath.Join(d.path, name)))
+}
+
+func (d *localDir) rename(oldName string, to *localDir, newName string) error {
+	return localError(os.Rename(filepath.Join(d.path, oldName), filepath.Join(to.path, newName)))
+}
+
+func (d *localDir) importFrom(srcPath, name string) error {
+	return localError(os.Rename(srcPath, filepath.Join(d.path, name)))
+}
+
+func (d *localDir) link(name, dst string) error {
+	return localError(os.Link(filepath.Join(d.path, name), dst))
+}
+
+func (d *localDir) sync() error {
+	return nil
+}
@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+)
+
+// Хранилище не переходит по символическим ссылкам ни внутри, ни за пределы хранилища
+func TestLocalSymlinks(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	l := NewLocal(root)
+
+	outside := t.TempDir()
+	if err := os.WriteFile(filepath.Join(outside, "passwd"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	put(t, l, "reports/2026/q3.csv", "report")
+	if err := os.Symlink(filepath.Join(root, "reports"), filepath.Join(root, "inside")); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "stat through escape", call: func() error { _, err := l.Stat(ctx, "escape/passwd"); return err }},
+		{name: "stat escape itself", call: func() error { _, err := l.Stat(ctx, "escape"); return err }},
+		{name: "get through escape", call: func() error { _, err := l.Get(ctx, "escape/passwd", 0, 0); return err }},
+		{name: "get through inside", call: func() error { _, err := l.Get(ctx, "inside/2026/q3.csv", 0, 0); return err }},
+		{name: "put through escape", call: func() error { _, err := l.Put(ctx, "escape/new.txt"); return err }},
+		{name: "put missing child of escape", call: func() error { _, err := l.Put(ctx, "escape/new/file.txt"); return err }},
+		{name: "list escape", call: func() error { return l.List(ctx, "escape", func(Info) error { return nil }) }},
+		{name: "delete through escape", call: func() error { return l.Delete(ctx, "escape/passwd") }},
+		{name: "rename from escape", call: func() error { return l.Rename(ctx, "escape/passwd", "stolen.txt") }},
+		{name: "rename into escape", call: func() error { return l.Rename(ctx, "reports/2026/q3.csv", "escape/q3.csv") }},
+		{name: "mkdir through escape", call: func() error { return l.MakeDir(ctx, "escape/dir", true) }},
+		{name: "rmdir through escape", call: func() error { return l.RemoveDir(ctx, "escape/dir", true) }},
+		{name: "link through escape", call: func() error { return l.Link("escape/passwd", filepath.Join(t.TempDir(), "link")) }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); !errors.Is(err, ErrInvalidPath) {
+				t.Fatalf("error = %v, want ErrInvalidPath", err)
+			}
+		})
+	}
+
+	entries, err := os.ReadDir(outside)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("outside dir = %v, %v, want only passwd", entries, err)
+	}
+	if got := get(t, l, "reports/2026/q3.csv", 0, 0); got != "report" {
+		t.Errorf("file after rejected calls = %q", got)
+	}
+	// ссылки не попадают в список
+	var names []string
+	if err = l.List(ctx, "", func(info Info) error { names = append(names, info.Name); return nil }); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 || names[0] != "reports" {
+		t.Errorf("List = %v, want [reports]", names)
+	}
+}
+
+// Директория, подмененная ссылкой во время загрузки, не уводит файл за пределы хранилища
+func TestLocalPutDirSwapped(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	outside := t.TempDir()
+	l := NewLocal(root)
+
+	w, err := l.Put(ctx, "docs/a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Rename(filepath.Join(root, "docs"), filepath.Join(root, "docs.old")); err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Symlink(outside, filepath.Join(root, "docs")); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Commit(meta.Meta{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if entries, err := os.ReadDir(outside); err != nil || len(entries) != 0 {
+		t.Fatalf("outside dir = %v, %v, want empty", entries, err)
+	}
+	if got := get(t, l, "docs.old/a.txt", 0, 0); got != "data" {
+		t.Errorf("docs.old/a.txt = %q, want %q", got, "data")
+	}
+	if _, err = l.Stat(ctx, "docs/a.txt"); !errors.Is(err, ErrInvalidPath) {
+		t.Errorf("Stat through swapped dir error = %v, want ErrInvalidPath", err)
+	}
+}
+
+func FuzzLocalPut(f *testing.F) {
+	for _, seed := range []string{
+		"image.png", "reports/2026/q3.csv", "../../etc/passwd", "/etc/passwd",
+		"a/./b/../c", `..\..\x`, "a\x00b", ".staging/x", "a//b/", "..",
+	} {
+		f.Add(seed)
+	}
+
+	base := f.TempDir()
+	l := NewLocal(filepath.Join(base, "data"))
+
+	f.Fuzz(func(t *testing.T, name string) {
+		w, err := l.Put(context.Background(), name)
+		if err == nil {
+			if _, err = w.Write([]byte(name)); err == nil {
+				err = w.Commit(meta.Meta{})
+			} else {
+				_ = w.Abort()
+			}
+		}
+		if _, cleanErr := cleanName(name); cleanErr != nil && !errors.Is(err, ErrInvalidPath) {
+			t.Fatalf("Put(%q) error = %v, want ErrInvalidPath", name, err)
+		}
+		// Принятый путь всегда остается внутри хранилища
+		entries, readErr := os.ReadDir(base)
+		if readErr != nil {
+			t.Fatal(readErr)
+		}
+		if len(entries) != 1 || entries[0].Name() != "data" {
+			t.Fatalf("Put(%q) wrote outside of data dir: %v", name, entries)
+		}
+	})
+}
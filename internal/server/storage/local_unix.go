@@ -0,0 +1,219 @@
+//go:build unix
+
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math/rand/v2"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/RVodassa/FileTransfer/pkg/file"
+	"golang.org/x/sys/unix"
+)
+
+// localDir открытая директория хранилища. Записи директории открываются, переименовываются
+// и удаляются относительно ее дескриптора без перехода по символическим ссылкам,
+// поэтому подмена пути к директории после открытия не уводит за пределы хранилища
+type localDir struct {
+	f  *os.File
+	fd int
+}
+
+// openDir открывает директорию rel внутри хранилища, проходя путь по одному компоненту
+// с O_NOFOLLOW: символическая ссылка в пути отклоняется с ErrInvalidPath.
+// create создает недостающие директории, включая корень хранилища
+func (l *Local) openDir(rel string, create bool) (*localDir, error) {
+	if create {
+		if err := os.MkdirAll(l.root, os.ModePerm); err != nil {
+			return nil, localError(err)
+		}
+	}
+	// корень хранилища задан в конфиге и может быть ссылкой
+	fd, err := unix.Open(l.root, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, localError(err)
+	}
+	if rel != "" {
+		for _, name := range strings.Split(rel, "/") {
+			next, err := openDirAt(fd, name)
+			if create && errors.Is(err, unix.ENOENT) {
+				if err = unix.Mkdirat(fd, name, 0o777); err == nil || errors.Is(err, unix.EEXIST) {
+					next, err = openDirAt(fd, name)
+				}
+			}
+			_ = unix.Close(fd)
+			if err != nil {
+				return nil, atError(err)
+			}
+			fd = next
+		}
+	}
+	return newLocalDir(fd, path.Join(l.root, rel)), nil
+}
+
+func newLocalDir(fd int, name string) *localDir {
+	return &localDir{f: os.NewFile(uintptr(fd), name), fd: fd}
+}
+
+// openParent открывает директорию, в которой лежит файл name, и возвращает ее вместе с именем файла.
+// Корень хранилища не допускается
+func (l *Local) openParent(name string, create bool) (*localDir, string, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return nil, "", err
+	}
+	if rel == "" {
+		return nil, "", fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+	dir, base := path.Split(rel)
+	d, err := l.openDir(strings.TrimSuffix(dir, "/"), create)
+	if err != nil {
+		return nil, "", err
+	}
+	return d, base, nil
+}
+
+// openDirAt открывает поддиректорию name директории fd, не переходя по символической ссылке
+func openDirAt(fd int, name string) (int, error) {
+	dirfd, err := unix.Openat(fd, name, unix.O_RDONLY|unix.O_DIRECTORY|unix.O_NOFOLLOW|unix.O_CLOEXEC, 0)
+	// с O_DIRECTORY ссылка отклоняется как не директория
+	if errors.Is(err, unix.ENOTDIR) {
+		var st unix.Stat_t
+		if unix.Fstatat(fd, name, &st, unix.AT_SYMLINK_NOFOLLOW) == nil && st.Mode&unix.S_IFMT == unix.S_IFLNK {
+			return -1, unix.ELOOP
+		}
+	}
+	return dirfd, err
+}
+
+// atError переводит ошибки операций относительно директории в ошибки хранилища
+func atError(err error) error {
+	if errors.Is(err, unix.ELOOP) {
+		return fmt.Errorf("%w: symlink in path", ErrInvalidPath)
+	}
+	return localError(err)
+}
+
+func (d *localDir) close() error {
+	return d.f.Close()
+}
+
+// open открывает запись name директории. Символическая ссылка не открывается.
+// Каналы открываются без блокировки, поэтому сведения о них можно получить через Stat
+func (d *localDir) open(name string, flag int, perm os.FileMode) (*os.File, error) {
+	fd, err := unix.Openat(d.fd, name, flag|unix.O_NOFOLLOW|unix.O_CLOEXEC|unix.O_NONBLOCK, uint32(perm))
+	if err != nil {
+		return nil, atError(err)
+	}
+	// обычные файлы не бывают неблокирующими, флаг нужен только при открытии
+	if err = unix.SetNonblock(fd, false); err != nil {
+		_ = unix.Close(fd)
+		return nil, err
+	}
+	return os.NewFile(uintptr(fd), path.Join(d.f.Name(), name)), nil
+}
+
+// createTemp создает скрытый staging файл для файла base
+func (d *localDir) createTemp(base string) (*os.File, string, error) {
+	for {
+		name := file.StagingPrefix + base + "." + strconv.FormatUint(uint64(rand.Uint32()), 10) + ".tmp"
+		f, err := d.open(name, unix.O_WRONLY|unix.O_CREAT|unix.O_EXCL, 0o600)
+		if errors.Is(err, ErrExist) {
+			continue
+		}
+		return f, name, err
+	}
+}
+
+// kind возвращает тип записи name, не переходя по символической ссылке
+func (d *localDir) kind(name string) (fs.FileMode, error) {
+	var st unix.Stat_t
+	if err := unix.Fstatat(d.fd, name, &st, unix.AT_SYMLINK_NOFOLLOW); err != nil {
+		return 0, localError(err)
+	}
+	switch st.Mode & unix.S_IFMT {
+	case unix.S_IFDIR:
+		return fs.ModeDir, nil
+	case unix.S_IFLNK:
+		return fs.ModeSymlink, nil
+	default:
+		return 0, nil
+	}
+}
+
+func (d *localDir) mkdir(name string) error {
+	return localError(unix.Mkdirat(d.fd, name, 0o777))
+}
+
+// remove удаляет файл или пустую директорию name
+func (d *localDir) remove(name string, dir bool) error {
+	flags := 0
+	if dir {
+		flags = unix.AT_REMOVEDIR
+	}
+	err := unix.Unlinkat(d.fd, name, flags)
+	if dir && errors.Is(err, unix.EEXIST) {
+		return ErrNotEmpty
+	}
+	return localError(err)
+}
+
+// removeAll удаляет директорию name с содержимым. Символические ссылки удаляются,
+// но не обходятся
+func (d *localDir) removeAll(name string) error {
+	for {
+		// удаление записей меняет порядок чтения директории, поэтому каждая пачка
+		// читается из заново открытой директории
+		fd, err := openDirAt(d.fd, name)
+		if err != nil {
+			return atError(err)
+		}
+		sub := newLocalDir(fd, path.Join(d.f.Name(), name))
+		entries, readErr := sub.f.ReadDir(readDirBatch)
+		for _, e := range entries {
+			if e.IsDir() {
+				err = sub.removeAll(e.Name())
+			} else {
+				err = sub.remove(e.Name(), false)
+			}
+			if err != nil {
+				break
+			}
+		}
+		_ = sub.close()
+		if err != nil {
+			return err
+		}
+		if readErr != nil && !errors.Is(readErr, io.EOF) {
+			return localError(readErr)
+		}
+		if len(entries) == 0 {
+			return d.remove(name, true)
+		}
+	}
+}
+
+// rename переименовывает запись oldName директории d в newName директории to
+func (d *localDir) rename(oldName string, to *localDir, newName string) error {
+	return localError(unix.Renameat(d.fd, oldName, to.fd, newName))
+}
+
+// importFrom переносит файл srcPath вне хранилища в запись name переименованием
+func (d *localDir) importFrom(srcPath, name string) error {
+	return localError(unix.Renameat(unix.AT_FDCWD, srcPath, d.fd, name))
+}
+
+// link создает жесткую ссылку dst на запись name, символическая ссылка не разрешается
+func (d *localDir) link(name, dst string) error {
+	return localError(unix.Linkat(d.fd, name, unix.AT_FDCWD, dst, 0))
+}
+
+func (d *localDir) sync() error {
+	return d.f.Sync()
+}
@@ -0,0 +1,357 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+)
+
+// Memory хранит файлы в памяти процесса. Данные теряются при остановке сервера,
+// хранилище предназначено для тестов
+type Memory struct {
+	mu    sync.RWMutex
+	nodes map[string]*memNode // по пути от корня, корень не хранится
+}
+
+type memNode struct {
+	dir     bool
+	data    []byte // не изменяется после записи, новая версия файла - новый срез
+	meta    meta.Meta
+	modTime time.Time
+	created time.Time
+}
+
+// NewMemory возвращает пустое хранилище в памяти
+func NewMemory() *Memory {
+	return &Memory{nodes: make(map[string]*memNode)}
+}
+
+func (m *Memory) info(name string, n *memNode) Info {
+	info := Info{
+		Name:         name,
+		Size:         int64(len(n.data)),
+		Mode:         defaultFileMode,
+		ModTime:      n.modTime,
+		CreationTime: n.created,
+		IsDir:        n.dir,
+		Meta:         n.meta,
+	}
+	if n.dir {
+		info.Mode = defaultDirMode
+	}
+	return info
+}
+
+// lookup возвращает элемент name, корень - директория. Вызывается под m.mu
+func (m *Memory) lookup(name string) (*memNode, bool) {
+	if name == "" {
+		return &memNode{dir: true}, true
+	}
+	n, ok := m.nodes[name]
+	return n, ok
+}
+
+// checkParent проверяет, что директория для name существует. Вызывается под m.mu
+func (m *Memory) checkParent(name string) error {
+	n, ok := m.lookup(parentOf(name))
+	if !ok {
+		return ErrNotFound
+	}
+	if !n.dir {
+		return ErrNotDir
+	}
+	return nil
+}
+
+// mkdirAll создает директорию name вместе с родительскими. Вызывается под m.mu
+func (m *Memory) mkdirAll(name string) error {
+	if name == "" {
+		return nil
+	}
+	if n, ok := m.nodes[name]; ok {
+		if !n.dir {
+			return ErrNotDir
+		}
+		return nil
+	}
+	if err := m.mkdirAll(parentOf(name)); err != nil {
+		return err
+	}
+	now := time.Now()
+	m.nodes[name] = &memNode{dir: true, modTime: now, created: now}
+	return nil
+}
+
+// parentOf возвращает родительскую директорию, "" - корень
+func parentOf(name string) string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+// under проверяет, что name лежит внутри директории dir
+func under(dir, name string) bool {
+	return strings.HasPrefix(name, dir+"/")
+}
+
+func (m *Memory) Put(_ context.Context, name string) (Writer, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if rel == "" {
+		return nil, ErrIsDir
+	}
+	return &memWriter{m: m, name: rel}, nil
+}
+
+type memWriter struct {
+	m    *Memory
+	name string
+	buf  bytes.Buffer
+	done bool
+}
+
+func (w *memWriter) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, fmt.Errorf("write after commit")
+	}
+	return w.buf.Write(p)
+}
+
+func (w *memWriter) Commit(m meta.Meta) error {
+	if w.done {
+		return fmt.Errorf("file is already committed")
+	}
+	w.done = true
+
+	w.m.mu.Lock()
+	defer w.m.mu.Unlock()
+	if err := w.m.mkdirAll(parentOf(w.name)); err != nil {
+		return err
+	}
+	now := time.Now()
+	created := now
+	if n, ok := w.m.nodes[w.name]; ok {
+		if n.dir {
+			return ErrIsDir
+		}
+		created = n.created
+	}
+	w.m.nodes[w.name] = &memNode{data: w.buf.Bytes(), meta: m, modTime: now, created: created}
+	return nil
+}
+
+func (w *memWriter) Abort() error {
+	w.done = true
+	w.buf = bytes.Buffer{}
+	return nil
+}
+
+func (m *Memory) Get(_ context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	n, ok := m.lookup(rel)
+	m.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if n.dir {
+		return nil, ErrIsDir
+	}
+
+	size := int64(len(n.data))
+	start := min(offset, size)
+	end := size
+	if length > 0 {
+		end = min(start+length, size)
+	}
+	return io.NopCloser(bytes.NewReader(n.data[start:end])), nil
+}
+
+func (m *Memory) Stat(_ context.Context, name string) (*Info, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	n, ok := m.lookup(rel)
+	if !ok {
+		return nil, ErrNotFound
+	}
+	info := m.info(rel, n)
+	return &info, nil
+}
+
+// List вызывает fn без блокировки, поэтому внутри fn можно обращаться к хранилищу
+func (m *Memory) List(ctx context.Context, dir string, fn func(Info) error) error {
+	rel, err := cleanName(dir)
+	if err != nil {
+		return err
+	}
+
+	m.mu.RLock()
+	n, ok := m.lookup(rel)
+	if !ok {
+		m.mu.RUnlock()
+		return ErrNotFound
+	}
+	if !n.dir {
+		m.mu.RUnlock()
+		return ErrNotDir
+	}
+	var entries []Info
+	for name, n := range m.nodes {
+		if parentOf(name) == rel {
+			entries = append(entries, m.info(name, n))
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name < entries[j].Name })
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Memory) Delete(_ context.Context, name string) error {
+	rel, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.lookup(rel)
+	if !ok {
+		return ErrNotFound
+	}
+	if n.dir {
+		return ErrIsDir
+	}
+	delete(m.nodes, rel)
+	return nil
+}
+
+// Rename переносит файл или директорию вместе с содержимым
+func (m *Memory) Rename(_ context.Context, oldName, newName string) error {
+	oldRel, err := cleanName(oldName)
+	if err != nil {
+		return err
+	}
+	newRel, err := cleanName(newName)
+	if err != nil {
+		return err
+	}
+	if oldRel == "" || newRel == "" {
+		return fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+	if newRel == oldRel || under(oldRel, newRel) {
+		return fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPath, oldRel)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[oldRel]
+	if !ok {
+		return ErrNotFound
+	}
+	if _, ok = m.nodes[newRel]; ok {
+		return ErrExist
+	}
+	if err = m.mkdirAll(parentOf(newRel)); err != nil {
+		return err
+	}
+
+	delete(m.nodes, oldRel)
+	m.nodes[newRel] = n
+	if !n.dir {
+		return nil
+	}
+	var children []string
+	for name := range m.nodes {
+		if under(oldRel, name) {
+			children = append(children, name)
+		}
+	}
+	for _, name := range children {
+		m.nodes[newRel+strings.TrimPrefix(name, oldRel)] = m.nodes[name]
+		delete(m.nodes, name)
+	}
+	return nil
+}
+
+func (m *Memory) MakeDir(_ context.Context, name string, parents bool) error {
+	rel, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if parents {
+		return m.mkdirAll(rel)
+	}
+	if _, ok := m.lookup(rel); ok {
+		return ErrExist
+	}
+	if err = m.checkParent(rel); err != nil {
+		return err
+	}
+	now := time.Now()
+	m.nodes[rel] = &memNode{dir: true, modTime: now, created: now}
+	return nil
+}
+
+func (m *Memory) RemoveDir(_ context.Context, name string, recursive bool) error {
+	rel, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+	if rel == "" {
+		return fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[rel]
+	if !ok {
+		return ErrNotFound
+	}
+	if !n.dir {
+		return ErrNotDir
+	}
+	for child := range m.nodes {
+		if !under(rel, child) {
+			continue
+		}
+		if !recursive {
+			return ErrNotEmpty
+		}
+		delete(m.nodes, child)
+	}
+	delete(m.nodes, rel)
+	return nil
+}
@@ -0,0 +1,747 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/pkg/file"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+const (
+	DefaultS3PartSize    = 16 << 20  // размер части multipart-загрузки по умолчанию
+	DefaultS3MaxPartSize = 128 << 20 // часть целиком лежит в памяти, поэтому по умолчанию она не больше
+	MinS3PartSize        = 5 << 20   // S3 не принимает части меньше, кроме последней
+	MaxS3PartSize        = 5 << 30   // S3 не принимает части больше
+	maxS3CopySize        = 5 << 30   // объекты больше копируются по частям
+	maxS3Parts           = 10000     // S3 не принимает больше частей в одной загрузке
+	// s3MinBuffer начальный размер буфера части, дальше буфер растет по мере записи
+	s3MinBuffer = 64 << 10
+	// s3PartGrowEvery через столько частей размер части удваивается, если размер файла
+	// заранее неизвестен: так загрузка не упирается в maxS3Parts
+	s3PartGrowEvery = 1000
+)
+
+// ErrTooManyParts файл не помещается в maxS3Parts частей multipart-загрузки
+var ErrTooManyParts = errors.New("file exceeds S3 multipart upload part limit")
+
+// s3DirMarker скрытый пустой объект, который MakeDir создает в директории
+const s3DirMarker = file.StagingPrefix + "dir"
+
+// Ключи пользовательских метаданных объекта, S3 передает их в заголовках x-amz-meta-*
+const (
+	s3MetaSHA256   = "Sha256"
+	s3MetaUploader = "Uploader"
+	s3MetaChunked  = "Chunked"
+)
+
+// S3Options параметры подключения к S3-совместимому хранилищу
+type S3Options struct {
+	Endpoint string // host:port без схемы
+	Region   string
+	Bucket   string
+	// Prefix префикс ключей, под которым лежат файлы, пусто - корень бакета
+	Prefix string
+	// AccessKeyID и SecretAccessKey ключи доступа. Если AccessKeyID пустой, ключи берутся
+	// из переменных окружения AWS_*, ~/.aws/credentials или IAM-роли
+	AccessKeyID     string
+	SecretAccessKey string
+	DisableTLS      bool
+	// PathStyle адреса вида endpoint/bucket вместо bucket.endpoint
+	PathStyle bool
+	// PartSize размер части multipart-загрузки, 0 - DefaultS3PartSize
+	PartSize int64
+	// MaxPartSize наибольший размер части, до которого она растет для больших файлов,
+	// 0 - DefaultS3MaxPartSize. Ограничивает память на одну загрузку и размер файла: maxS3Parts частей
+	MaxPartSize int64
+}
+
+// S3 хранит файлы объектами в бакете S3-совместимого хранилища. Метаданные загрузки
+// лежат в пользовательских метаданных объекта.
+//
+// Директорий в S3 нет: директория существует, пока под ее префиксом есть объекты.
+// MakeDir создает в директории скрытый объект s3DirMarker, чтобы пустая директория не пропала.
+// Ключи вида "dir/" для этого не подходят: часть S3-совместимых хранилищ отрезает "/"
+type S3 struct {
+	client      *minio.Client
+	core        *minio.Core // multipart-загрузка по частям
+	bucket      string
+	prefix      string // пустой или с "/" на конце
+	partSize    int64
+	maxPartSize int64
+}
+
+// NewS3 подключается к хранилищу и проверяет, что бакет существует
+func NewS3(ctx context.Context, opts S3Options) (*S3, error) {
+	creds := credentials.NewStaticV4(opts.AccessKeyID, opts.SecretAccessKey, "")
+	if opts.AccessKeyID == "" {
+		creds = credentials.NewChainCredentials([]credentials.Provider{
+			&credentials.EnvAWS{},
+			&credentials.FileAWSCredentials{},
+			&credentials.IAM{Client: &http.Client{Transport: http.DefaultTransport}},
+		})
+	}
+	lookup := minio.BucketLookupAuto
+	if opts.PathStyle {
+		lookup = minio.BucketLookupPath
+	}
+
+	core, err := minio.NewCore(opts.Endpoint, &minio.Options{
+		Creds:        creds,
+		Secure:       !opts.DisableTLS,
+		Region:       opts.Region,
+		BucketLookup: lookup,
+	})
+	if err != nil {
+		return nil, err
+	}
+	exists, err := core.BucketExists(ctx, opts.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("check bucket %s: %w", opts.Bucket, err)
+	}
+	if !exists {
+		return nil, fmt.Errorf("bucket %s does not exist", opts.Bucket)
+	}
+
+	partSize := opts.PartSize
+	if partSize == 0 {
+		partSize = DefaultS3PartSize
+	}
+	maxPartSize := opts.MaxPartSize
+	if maxPartSize == 0 {
+		maxPartSize = DefaultS3MaxPartSize
+	}
+	maxPartSize = min(max(maxPartSize, partSize), MaxS3PartSize)
+	prefix := strings.Trim(opts.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return &S3{
+		client:      core.Client,
+		core:        core,
+		bucket:      opts.Bucket,
+		prefix:      prefix,
+		partSize:    partSize,
+		maxPartSize: maxPartSize,
+	}, nil
+}
+
+// key возвращает ключ объекта файла name
+func (s *S3) key(name string) string {
+	return s.prefix + name
+}
+
+// dirKey возвращает префикс ключей содержимого директории name
+func (s *S3) dirKey(name string) string {
+	if name == "" {
+		return s.prefix
+	}
+	return s.prefix + name + "/"
+}
+
+// markerKey возвращает ключ объекта s3DirMarker директории name
+func (s *S3) markerKey(name string) string {
+	return s.dirKey(name) + s3DirMarker
+}
+
+// s3Error переводит ошибки S3 в ошибки хранилища
+func s3Error(err error) error {
+	if err == nil {
+		return nil
+	}
+	resp := minio.ToErrorResponse(err)
+	if resp.Code == "NoSuchKey" || (resp.StatusCode == http.StatusNotFound && resp.Code != "NoSuchBucket") {
+		return ErrNotFound
+	}
+	return err
+}
+
+// s3Meta переводит метаданные загрузки в пользовательские метаданные объекта.
+// Заголовки допускают только ASCII, поэтому хеш хранится в hex, а автор загрузки экранируется
+func s3Meta(m meta.Meta) map[string]string {
+	userMeta := make(map[string]string)
+	if len(m.SHA256) > 0 {
+		userMeta[s3MetaSHA256] = hex.EncodeToString(m.SHA256)
+	}
+	if m.Uploader != "" {
+		userMeta[s3MetaUploader] = url.QueryEscape(m.Uploader)
+	}
+	if m.Chunked {
+		userMeta[s3MetaChunked] = "1"
+	}
+	return userMeta
+}
+
+// s3UserMeta возвращает пользовательское метаданное key. HEAD отдает ключи без префикса x-amz-meta-,
+// список объектов MinIO - с ним
+func s3UserMeta(obj minio.ObjectInfo, key string) string {
+	if v, ok := obj.UserMetadata[key]; ok {
+		return v
+	}
+	return obj.UserMetadata["X-Amz-Meta-"+key]
+}
+
+// objectInfo собирает сведения о файле name из сведений об объекте
+func objectInfo(name string, obj minio.ObjectInfo) *Info {
+	uploader, err := url.QueryUnescape(s3UserMeta(obj, s3MetaUploader))
+	if err != nil {
+		uploader = s3UserMeta(obj, s3MetaUploader)
+	}
+	sum, _ := hex.DecodeString(s3UserMeta(obj, s3MetaSHA256)) // пустой, если объект загружен не через сервер
+	return &Info{
+		Name:    name,
+		Size:    obj.Size,
+		Mode:    defaultFileMode,
+		ModTime: obj.LastModified,
+		Meta: meta.Meta{
+			SHA256:      sum,
+			Uploader:    uploader,
+			ContentType: obj.ContentType,
+			Chunked:     s3UserMeta(obj, s3MetaChunked) == "1",
+		},
+	}
+}
+
+// statFile возвращает сведения о файле name, директории не ищет
+func (s *S3) statFile(ctx context.Context, name string) (*Info, error) {
+	obj, err := s.client.StatObject(ctx, s.bucket, s.key(name), minio.StatObjectOptions{})
+	if err != nil {
+		return nil, s3Error(err)
+	}
+	return objectInfo(name, obj), nil
+}
+
+// statDir возвращает сведения о директории name, если под ее префиксом есть объекты
+func (s *S3) statDir(ctx context.Context, name string) (*Info, error) {
+	info := &Info{Name: name, Mode: defaultDirMode, IsDir: true}
+	if name == "" {
+		return info, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	prefix := s.dirKey(name)
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true, MaxKeys: 1}) {
+		if obj.Err != nil {
+			return nil, s3Error(obj.Err)
+		}
+		if obj.Key == s.markerKey(name) {
+			info.ModTime = obj.LastModified // время создания директории через MakeDir
+		}
+		return info, nil
+	}
+	return nil, ErrNotFound
+}
+
+// checkParents проверяет, что среди родительских директорий name нет файлов.
+// S3 позволил бы создать объект "a.txt/b" рядом с файлом "a.txt"
+func (s *S3) checkParents(ctx context.Context, name string) error {
+	for dir := parentOf(name); dir != ""; dir = parentOf(dir) {
+		_, err := s.statFile(ctx, dir)
+		if err == nil {
+			return ErrNotDir
+		}
+		if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkParent проверяет, что директория для name существует
+func (s *S3) checkParent(ctx context.Context, name string) error {
+	parent, err := s.Stat(ctx, parentOf(name))
+	if err != nil {
+		return err
+	}
+	if !parent.IsDir {
+		return ErrNotDir
+	}
+	return nil
+}
+
+// MaxFileSize наибольший файл, который помещается в maxS3Parts частей
+func (s *S3) MaxFileSize() int64 {
+	return s.maxPartSize * maxS3Parts
+}
+
+// Put накапливает данные в памяти. Файл меньше части загружается одним запросом при Commit,
+// больший - multipart-загрузкой, которая становится объектом только при Commit.
+// Размер части выбирается по SizeHint так, чтобы файл поместился в maxS3Parts частей
+func (s *S3) Put(ctx context.Context, name string) (Writer, error) {
+	rel, err := fileName(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = s.statDir(ctx, rel); err == nil {
+		return nil, ErrIsDir
+	} else if !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err = s.checkParents(ctx, rel); err != nil {
+		return nil, err
+	}
+	return &s3Writer{s: s, ctx: ctx, key: s.key(rel), partSize: s.partSize}, nil
+}
+
+type s3Writer struct {
+	s        *S3
+	ctx      context.Context // Writer не принимает контекст, поэтому сохраняется контекст Put
+	key      string
+	buf      []byte // данные текущей части
+	partSize int64  // размер текущей части
+	hint     int64  // ожидаемый размер файла, 0 - неизвестен
+	size     int64  // всего записано
+	uploadID string // пустой, пока не загружена первая часть
+	parts    []minio.CompletePart
+	done     bool
+}
+
+// SizeHint выбирает размер части, с которым файл size байт поместится в maxS3Parts частей
+func (w *s3Writer) SizeHint(size int64) {
+	if w.size > 0 || size <= 0 {
+		return
+	}
+	w.hint = size
+	w.partSize = s3PartSize(w.s.partSize, w.s.maxPartSize, size)
+}
+
+// s3PartSize возвращает размер части не меньше partSize, с которым size байт
+// помещаются в maxS3Parts частей, но не больше maxPartSize. Размер округляется до МиБ
+func s3PartSize(partSize, maxPartSize, size int64) int64 {
+	const mib = 1 << 20
+	need := (size + maxS3Parts - 1) / maxS3Parts
+	need = (need + mib - 1) / mib * mib
+	return min(max(partSize, need), maxPartSize)
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) {
+	if w.done {
+		return 0, fmt.Errorf("write after commit")
+	}
+
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), int(w.partSize)-len(w.buf))
+		w.grow(n)
+		w.buf = append(w.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		w.size += int64(n)
+		if len(w.buf) < int(w.partSize) {
+			continue
+		}
+		if err := w.uploadPart(); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// grow увеличивает буфер части под еще n байт. Буфер растет по мере записи, а не по заявленному
+// размеру файла: заявленный размер не подтвержден данными. Больше части буфер не бывает
+func (w *s3Writer) grow(n int) {
+	need := len(w.buf) + n
+	if need <= cap(w.buf) {
+		return
+	}
+	size := min(max(2*cap(w.buf), need, s3MinBuffer), int(w.partSize))
+	if w.hint > 0 {
+		size = min(size, max(int(w.hint), need)) // файл меньше части занимает только свой размер
+	}
+	buf := make([]byte, len(w.buf), size)
+	copy(buf, w.buf)
+	w.buf = buf
+}
+
+// uploadPart отправляет накопленные данные очередной частью multipart-загрузки
+func (w *s3Writer) uploadPart() error {
+	if len(w.parts) >= maxS3Parts {
+		return ErrTooManyParts
+	}
+	if w.uploadID == "" {
+		uploadID, err := w.s.core.NewMultipartUpload(w.ctx, w.s.bucket, w.key, minio.PutObjectOptions{})
+		if err != nil {
+			return err
+		}
+		w.uploadID = uploadID
+	}
+
+	sum := md5.Sum(w.buf) // см. putOptions
+	part, err := w.s.core.PutObjectPart(w.ctx, w.s.bucket, w.key, w.uploadID, len(w.parts)+1,
+		bytes.NewReader(w.buf), int64(len(w.buf)), minio.PutObjectPartOptions{
+			Md5Base64:            base64.StdEncoding.EncodeToString(sum[:]),
+			DisableContentSha256: true,
+		})
+	if err != nil {
+		return err
+	}
+	w.parts = append(w.parts, minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag})
+	w.buf = w.buf[:0]
+	if len(w.parts)%s3PartGrowEvery == 0 {
+		w.partSize = min(2*w.partSize, w.s.maxPartSize)
+	}
+	return nil
+}
+
+// putOptions дополняет opts для загрузки одним запросом. Данные уже в памяти,
+// поэтому вместо потоковой подписи, которую понимают не все S3-совместимые хранилища,
+// отправляется их MD5
+func putOptions(opts minio.PutObjectOptions) minio.PutObjectOptions {
+	opts.DisableMultipart = true
+	opts.DisableContentSha256 = true
+	opts.SendContentMd5 = true
+	return opts
+}
+
+func (w *s3Writer) Commit(m meta.Meta) error {
+	if w.done {
+		return fmt.Errorf("file is already committed")
+	}
+	w.done = true
+
+	if w.uploadID == "" {
+		_, err := w.s.client.PutObject(w.ctx, w.s.bucket, w.key, bytes.NewReader(w.buf), int64(len(w.buf)),
+			putOptions(minio.PutObjectOptions{ContentType: m.ContentType, UserMetadata: s3Meta(m)}))
+		w.buf = nil
+		return s3Error(err)
+	}
+
+	if len(w.buf) > 0 {
+		if err := w.uploadPart(); err != nil {
+			_ = w.abortUpload()
+			return err
+		}
+	}
+	w.buf = nil
+	if _, err := w.s.core.CompleteMultipartUpload(w.ctx, w.s.bucket, w.key, w.uploadID, w.parts, minio.PutObjectOptions{}); err != nil {
+		_ = w.abortUpload()
+		return err
+	}
+
+	// Метаданные multipart-загрузки задаются в ее начале, а SHA-256 известен только сейчас
+	return w.s.setMeta(w.ctx, w.key, w.size, m)
+}
+
+func (w *s3Writer) Abort() error {
+	if w.done {
+		return nil
+	}
+	w.done = true
+	w.buf = nil
+	return w.abortUpload()
+}
+
+// abortUpload удаляет загруженные части. Загрузку обычно прерывает отмена контекста,
+// поэтому запрос к S3 выполняется без нее
+func (w *s3Writer) abortUpload() error {
+	if w.uploadID == "" {
+		return nil
+	}
+	return w.s.core.AbortMultipartUpload(context.WithoutCancel(w.ctx), w.s.bucket, w.key, w.uploadID)
+}
+
+// setMeta заменяет метаданные объекта копированием объекта в самого себя.
+// При ошибке объект остается без метаданных: без SHA-256 файл нельзя проверить
+// при скачивании, поэтому загрузка считается неудачной
+func (s *S3) setMeta(ctx context.Context, key string, size int64, m meta.Meta) error {
+	const op = "server.storage.setMeta"
+
+	userMeta := s3Meta(m)
+	if m.ContentType != "" {
+		userMeta["Content-Type"] = m.ContentType // стандартный заголовок, minio не добавляет к нему x-amz-meta-
+	}
+	dst := minio.CopyDestOptions{Bucket: s.bucket, Object: key, UserMetadata: userMeta, ReplaceMetadata: true}
+	if err := s.copyObject(ctx, dst, key, size); err != nil {
+		log.Printf("%s: failed to write file metadata: %v", op, err)
+		return fmt.Errorf("write file metadata: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error) {
+	rel, err := fileName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts minio.GetObjectOptions
+	if offset > 0 || length > 0 {
+		end := int64(0) // до конца объекта
+		if length > 0 {
+			end = offset + length - 1
+		}
+		if err = opts.SetRange(offset, end); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPath, err)
+		}
+	}
+
+	body, _, _, err := s.core.GetObject(ctx, s.bucket, s.key(rel), opts)
+	if minio.ToErrorResponse(err).Code == "InvalidRange" {
+		return io.NopCloser(bytes.NewReader(nil)), nil // offset совпадает с концом файла
+	}
+	err = s3Error(err)
+	if errors.Is(err, ErrNotFound) {
+		if _, dirErr := s.statDir(ctx, rel); dirErr == nil {
+			return nil, ErrIsDir
+		}
+	}
+	return body, err
+}
+
+func (s *S3) Stat(ctx context.Context, name string) (*Info, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return nil, err
+	}
+	if rel != "" {
+		info, err := s.statFile(ctx, rel)
+		if !errors.Is(err, ErrNotFound) {
+			return info, err
+		}
+	}
+	return s.statDir(ctx, rel)
+}
+
+// List берет размер и время изменения файлов из списка объектов. Метаданные загрузки в списке
+// возвращает только MinIO, у остальных хранилищ файлы помечаются NoMeta и дополняются через WithMeta
+func (s *S3) List(ctx context.Context, dir string, fn func(Info) error) error {
+	const op = "server.storage.List"
+
+	rel, err := cleanName(dir)
+	if err != nil {
+		return err
+	}
+	if rel != "" {
+		info, err := s.Stat(ctx, rel)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir {
+			return ErrNotDir
+		}
+	}
+
+	listCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	prefix := s.dirKey(rel)
+	opts := minio.ListObjectsOptions{Prefix: prefix, WithMetadata: true}
+	for obj := range s.client.ListObjects(listCtx, s.bucket, opts) {
+		if obj.Err != nil {
+			return s3Error(obj.Err)
+		}
+		base, isDir := strings.CutSuffix(strings.TrimPrefix(obj.Key, prefix), "/")
+		// пустое имя - объект "dir/" самой директории, скрытые - служебные
+		if base == "" || strings.HasPrefix(base, file.StagingPrefix) {
+			continue
+		}
+		name := path.Join(rel, base)
+		if clean, err := CleanPath(name); err != nil || clean != name {
+			log.Printf("%s: skipping object with invalid name %q", op, obj.Key)
+			continue
+		}
+
+		info := &Info{Name: name, Mode: defaultDirMode, IsDir: true}
+		if !isDir {
+			info = objectInfo(name, obj)
+			info.NoMeta = obj.UserMetadata == nil
+		}
+		if err = fn(*info); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
+
+func (s *S3) Delete(ctx context.Context, name string) error {
+	rel, err := fileName(name)
+	if err != nil {
+		return err
+	}
+	if _, err = s.statFile(ctx, rel); err != nil {
+		if errors.Is(err, ErrNotFound) {
+			if _, dirErr := s.statDir(ctx, rel); dirErr == nil {
+				return ErrIsDir
+			}
+		}
+		return err
+	}
+	return s3Error(s.client.RemoveObject(ctx, s.bucket, s.key(rel), minio.RemoveObjectOptions{}))
+}
+
+// Rename копирует объекты и удаляет старые: переименования в S3 нет.
+// Директория переносится по одному объекту, поэтому перенос не атомарный
+func (s *S3) Rename(ctx context.Context, oldName, newName string) error {
+	oldRel, err := fileName(oldName)
+	if err != nil {
+		return err
+	}
+	newRel, err := fileName(newName)
+	if err != nil {
+		return err
+	}
+	if newRel == oldRel || under(oldRel, newRel) {
+		return fmt.Errorf("%w: cannot move %s into itself", ErrInvalidPath, oldRel)
+	}
+
+	info, err := s.Stat(ctx, oldRel)
+	if err != nil {
+		return err
+	}
+	if _, err = s.Stat(ctx, newRel); err == nil {
+		return ErrExist
+	} else if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if err = s.checkParents(ctx, newRel); err != nil {
+		return err
+	}
+
+	if !info.IsDir {
+		if err = s.copyObject(ctx, minio.CopyDestOptions{Bucket: s.bucket, Object: s.key(newRel)}, s.key(oldRel), info.Size); err != nil {
+			return err
+		}
+		return s3Error(s.client.RemoveObject(ctx, s.bucket, s.key(oldRel), minio.RemoveObjectOptions{}))
+	}
+
+	oldPrefix, newPrefix := s.dirKey(oldRel), s.dirKey(newRel)
+	objects, err := s.listObjects(ctx, oldPrefix, 0)
+	if err != nil {
+		return err
+	}
+	for _, obj := range objects {
+		dst := minio.CopyDestOptions{Bucket: s.bucket, Object: newPrefix + strings.TrimPrefix(obj.Key, oldPrefix)}
+		if err = s.copyObject(ctx, dst, obj.Key, obj.Size); err != nil {
+			return err
+		}
+	}
+	return s.removeObjects(ctx, objects)
+}
+
+// copyObject копирует объект srcKey размера size в dst, метаданные копируются,
+// если dst не задает новые. Большие объекты копируются по частям
+func (s *S3) copyObject(ctx context.Context, dst minio.CopyDestOptions, srcKey string, size int64) error {
+	src := minio.CopySrcOptions{Bucket: s.bucket, Object: srcKey}
+	var err error
+	if size <= maxS3CopySize {
+		_, err = s.client.CopyObject(ctx, dst, src)
+	} else {
+		_, err = s.client.ComposeObject(ctx, dst, src)
+	}
+	return s3Error(err)
+}
+
+// listObjects возвращает все объекты под префиксом, но не больше limit, 0 - без ограничения
+func (s *S3) listObjects(ctx context.Context, prefix string, limit int) ([]minio.ObjectInfo, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var objects []minio.ObjectInfo
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{Prefix: prefix, Recursive: true}) {
+		if obj.Err != nil {
+			return nil, s3Error(obj.Err)
+		}
+		objects = append(objects, obj)
+		if len(objects) == limit {
+			break
+		}
+	}
+	return objects, nil
+}
+
+// removeObjects удаляет объекты пачками и возвращает первую ошибку
+func (s *S3) removeObjects(ctx context.Context, objects []minio.ObjectInfo) error {
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, obj := range objects {
+			select {
+			case objectsCh <- obj:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var firstErr error
+	for removeErr := range s.client.RemoveObjects(ctx, s.bucket, objectsCh, minio.RemoveObjectsOptions{}) {
+		if firstErr == nil {
+			firstErr = removeErr.Err
+		}
+	}
+	if firstErr == nil {
+		firstErr = ctx.Err()
+	}
+	return firstErr
+}
+
+func (s *S3) MakeDir(ctx context.Context, name string, parents bool) error {
+	rel, err := cleanName(name)
+	if err != nil {
+		return err
+	}
+
+	info, err := s.Stat(ctx, rel)
+	switch {
+	case err == nil && parents && info.IsDir:
+		return nil
+	case err == nil && parents:
+		return ErrNotDir
+	case err == nil:
+		return ErrExist
+	case !errors.Is(err, ErrNotFound):
+		return err
+	}
+
+	if parents {
+		err = s.checkParents(ctx, rel)
+	} else {
+		err = s.checkParent(ctx, rel)
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = s.client.PutObject(ctx, s.bucket, s.markerKey(rel), bytes.NewReader(nil), 0, putOptions(minio.PutObjectOptions{}))
+	return s3Error(err)
+}
+
+func (s *S3) RemoveDir(ctx context.Context, name string, recursive bool) error {
+	rel, err := fileName(name)
+	if err != nil {
+		return err
+	}
+	info, err := s.Stat(ctx, rel)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir {
+		return ErrNotDir
+	}
+
+	limit := 0
+	if !recursive {
+		limit = 2 // s3DirMarker и еще один
+	}
+	objects, err := s.listObjects(ctx, s.dirKey(rel), limit)
+	if err != nil {
+		return err
+	}
+	if !recursive && (len(objects) > 1 || (len(objects) == 1 && objects[0].Key != s.markerKey(rel))) {
+		return ErrNotEmpty
+	}
+	return s.removeObjects(ctx, objects)
+}
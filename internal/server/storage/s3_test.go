@@ -0,0 +1,296 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+// newTestS3 запускает S3 в памяти процесса и подключается к нему
+func newTestS3(t *testing.T, prefix string, partSize int64) *S3 {
+	t.Helper()
+	return newTestS3Handler(t, prefix, partSize, nil)
+}
+
+// newTestS3Handler как newTestS3, wrap оборачивает обработчик запросов S3, может быть nil
+func newTestS3Handler(t *testing.T, prefix string, partSize int64, wrap func(http.Handler) http.Handler) *S3 {
+	t.Helper()
+	backend := s3mem.New()
+	if err := backend.CreateBucket("files"); err != nil {
+		t.Fatal(err)
+	}
+	handler := gofakes3.New(backend, gofakes3.WithLogger(gofakes3.DiscardLog())).Server()
+	if wrap != nil {
+		handler = wrap(handler)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	st, err := NewS3(context.Background(), S3Options{
+		Endpoint:        strings.TrimPrefix(server.URL, "http://"),
+		Region:          "us-east-1",
+		Bucket:          "files",
+		Prefix:          prefix,
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+		DisableTLS:      true,
+		PathStyle:       true,
+		PartSize:        partSize,
+	})
+	if err != nil {
+		t.Fatalf("NewS3: %v", err)
+	}
+	return st
+}
+
+// Файл больше части загружается по частям и получает метаданные после Commit
+func TestS3Multipart(t *testing.T) {
+	ctx := context.Background()
+	st := newTestS3(t, "data", MinS3PartSize)
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), (2*MinS3PartSize+1024)/16)
+	sum := sha256.Sum256(content)
+	w, err := st.Put(ctx, "big/file.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(content); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	if _, err = st.Stat(ctx, "big/file.bin"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat before Commit error = %v, want ErrNotFound", err)
+	}
+	if err = w.Commit(meta.Meta{SHA256: sum[:], Uploader: "алиса", ContentType: "application/x-test"}); err != nil {
+		t.Fatalf("Commit: %v", err)
+	}
+
+	info, err := st.Stat(ctx, "big/file.bin")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != int64(len(content)) || !bytes.Equal(info.Meta.SHA256, sum[:]) ||
+		info.Meta.Uploader != "алиса" || info.Meta.ContentType != "application/x-test" {
+		t.Errorf("Stat = %+v, want %d bytes with metadata", info, len(content))
+	}
+	offset := int64(MinS3PartSize - 8)
+	if got := get(t, st, "big/file.bin", offset, 16); got != string(content[offset:offset+16]) {
+		t.Errorf("Get across parts = %q, want %q", got, content[offset:offset+16])
+	}
+	if got := get(t, st, "big/file.bin", int64(len(content)), 0); got != "" {
+		t.Errorf("Get at end of file = %q, want empty", got)
+	}
+
+	// Прерванная загрузка не трогает прежнее содержимое
+	if w, err = st.Put(ctx, "big/file.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write(content[:MinS3PartSize+1]); err != nil {
+		t.Fatal(err)
+	}
+	if err = w.Abort(); err != nil {
+		t.Fatalf("Abort: %v", err)
+	}
+	if info, err = st.Stat(ctx, "big/file.bin"); err != nil || info.Size != int64(len(content)) {
+		t.Errorf("Stat after Abort = %+v, %v, want previous file", info, err)
+	}
+
+	if _, err = st.Put(ctx, "big/file.bin/nested"); !errors.Is(err, ErrNotDir) {
+		t.Errorf("Put under file error = %v, want ErrNotDir", err)
+	}
+}
+
+// List берет размер и время изменения из списка объектов, без HEAD на каждый файл.
+// Метаданные загрузки дополняет WithMeta
+func TestS3List(t *testing.T) {
+	ctx := context.Background()
+	var heads atomic.Int64
+	st := newTestS3Handler(t, "data", 0, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				heads.Add(1)
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+	put(t, st, "docs/a.txt", "alpha")
+	put(t, st, "docs/b.txt", "bravo!")
+	if err := st.MakeDir(ctx, "docs/empty", false); err != nil {
+		t.Fatal(err)
+	}
+
+	heads.Store(0)
+	var infos []Info
+	err := st.List(ctx, "", func(info Info) error {
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = st.List(ctx, "docs", func(info Info) error {
+		infos = append(infos, info)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// HEAD только на проверку директории docs, не на файлы
+	if n := heads.Load(); n > 1 {
+		t.Errorf("List made %d HEAD requests, want at most 1", n)
+	}
+
+	sizes := map[string]int64{"docs/a.txt": 5, "docs/b.txt": 6}
+	var files int
+	for _, info := range infos {
+		want, ok := sizes[info.Name]
+		if !ok {
+			if !info.IsDir {
+				t.Errorf("unexpected file %q", info.Name)
+			}
+			continue
+		}
+		files++
+		if info.IsDir || info.Size != want || info.ModTime.IsZero() {
+			t.Errorf("List %q = %+v, want file of %d bytes with modification time", info.Name, info, want)
+		}
+		full, err := WithMeta(ctx, st, info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if full.Meta.Uploader != "alice" || full.Size != want || full.NoMeta {
+			t.Errorf("WithMeta(%q) = %+v, want uploader alice", info.Name, full)
+		}
+	}
+	if files != len(sizes) {
+		t.Errorf("List returned %d files, want %d", files, len(sizes))
+	}
+}
+
+// Метка манифеста хранится в метаданных объекта, список без метаданных дополняется ими
+func TestS3Dedup(t *testing.T) {
+	ctx := context.Background()
+	files := newTestS3(t, "data", 0)
+	d, err := NewDedup(ctx, files, newTestS3(t, "chunks", 0), DedupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := strings.Repeat("dedup content ", 100)
+	put(t, d, "docs/a.txt", content)
+	plain := manifestMagic + "size 3\n"
+	put(t, files, "docs/plain.txt", plain)
+
+	if info, err := files.Stat(ctx, "docs/a.txt"); err != nil || !info.Meta.Chunked {
+		t.Fatalf("manifest Stat = %+v, %v, want chunked", info, err)
+	}
+	if got := get(t, d, "docs/a.txt", 0, 0); got != content {
+		t.Errorf("Get = %q, want %q", got, content)
+	}
+	if got := get(t, d, "docs/plain.txt", 0, 0); got != plain {
+		t.Errorf("Get(plain) = %q, want %q", got, plain)
+	}
+	sizes := map[string]int64{"docs/a.txt": int64(len(content)), "docs/plain.txt": int64(len(plain))}
+	err = d.List(ctx, "docs", func(info Info) error {
+		if want := sizes[info.Name]; info.Size != want || info.Meta.Chunked {
+			t.Errorf("List %q = %+v, want %d bytes without manifest mark", info.Name, info, want)
+		}
+		delete(sizes, info.Name)
+		return nil
+	})
+	if err != nil || len(sizes) != 0 {
+		t.Errorf("List error %v, files not listed: %v", err, sizes)
+	}
+}
+
+// Размер части выбирается так, чтобы файл поместился в maxS3Parts частей
+func TestS3PartSize(t *testing.T) {
+	tests := []struct {
+		name        string
+		partSize    int64
+		maxPartSize int64
+		size        int64
+		want        int64
+	}{
+		{name: "small file", partSize: DefaultS3PartSize, maxPartSize: DefaultS3MaxPartSize, size: 1 << 20, want: DefaultS3PartSize},
+		{name: "fits default parts", partSize: DefaultS3PartSize, maxPartSize: DefaultS3MaxPartSize, size: maxS3Parts * DefaultS3PartSize, want: DefaultS3PartSize},
+		{name: "one byte over", partSize: DefaultS3PartSize, maxPartSize: DefaultS3MaxPartSize, size: maxS3Parts*DefaultS3PartSize + 1, want: DefaultS3PartSize + 1<<20},
+		{name: "1 TiB", partSize: MinS3PartSize, maxPartSize: DefaultS3MaxPartSize, size: 1 << 40, want: 105 << 20},
+		{name: "capped by max part size", partSize: DefaultS3PartSize, maxPartSize: DefaultS3MaxPartSize, size: 1 << 62, want: DefaultS3MaxPartSize},
+		{name: "capped by S3", partSize: DefaultS3PartSize, maxPartSize: MaxS3PartSize, size: 1 << 62, want: MaxS3PartSize},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s3PartSize(tt.partSize, tt.maxPartSize, tt.size)
+			if got != tt.want {
+				t.Fatalf("s3PartSize(%d, %d, %d) = %d, want %d", tt.partSize, tt.maxPartSize, tt.size, got, tt.want)
+			}
+			if got < tt.maxPartSize && (tt.size+got-1)/got > maxS3Parts {
+				t.Fatalf("%d bytes do not fit %d parts of %d bytes", tt.size, maxS3Parts, got)
+			}
+		})
+	}
+
+	st := newTestS3(t, "", MinS3PartSize)
+	if got := st.MaxFileSize(); got != DefaultS3MaxPartSize*maxS3Parts {
+		t.Errorf("MaxFileSize = %d, want %d", got, int64(DefaultS3MaxPartSize*maxS3Parts))
+	}
+	w, err := st.Put(context.Background(), "small.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetSizeHint(w, 1024)
+	if _, err = w.Write([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+	// буфер файла меньше части не больше самого файла
+	if sw := w.(*s3Writer); cap(sw.buf) != 1024 || sw.partSize != MinS3PartSize {
+		t.Errorf("buffer cap %d, part size %d, want 1024 and %d", cap(sw.buf), sw.partSize, MinS3PartSize)
+	}
+	if err = w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Заявленный размер выбирает размер части, но память под часть выделяется по мере записи
+func TestS3WriterBuffer(t *testing.T) {
+	st := newTestS3(t, "", MinS3PartSize)
+	w, err := st.Put(context.Background(), "huge.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Abort()
+	SetSizeHint(w, 1<<50)
+	sw := w.(*s3Writer)
+	if sw.partSize != DefaultS3MaxPartSize {
+		t.Fatalf("part size %d, want %d", sw.partSize, DefaultS3MaxPartSize)
+	}
+
+	chunk := bytes.Repeat([]byte("x"), 1024)
+	if _, err = w.Write(chunk); err != nil {
+		t.Fatal(err)
+	}
+	if cap(sw.buf) > s3MinBuffer {
+		t.Fatalf("buffer cap %d after 1 KiB, want at most %d", cap(sw.buf), s3MinBuffer)
+	}
+
+	// буфер растет вдвое по мере записи и не превышает часть
+	written := len(chunk)
+	for written < 1<<20 {
+		if _, err = w.Write(chunk); err != nil {
+			t.Fatal(err)
+		}
+		written += len(chunk)
+	}
+	if cap(sw.buf) < written || cap(sw.buf) > 2*written {
+		t.Fatalf("buffer cap %d after %d bytes, want at most twice the data", cap(sw.buf), written)
+	}
+}
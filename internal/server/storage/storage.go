@@ -0,0 +1,264 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+	"github.com/RVodassa/FileTransfer/pkg/file"
+)
+
+var ErrNotFound = errors.New("file not found")
+var ErrExist = errors.New("file already exists")
+var ErrIsDir = errors.New("is a directory")
+var ErrNotDir = errors.New("not a directory")
+var ErrNotEmpty = errors.New("directory is not empty")
+var ErrInvalidPath = errors.New("invalid path")
+
+// SkipDir возвращается из функции обхода Walk, чтобы не заходить в директорию
+var SkipDir = fs.SkipDir
+
+const (
+	maxPathLen = 4096 // PATH_MAX
+	maxNameLen = 255  // NAME_MAX
+)
+
+// Права, которые показывают хранилища без прав доступа к файлам
+const (
+	defaultFileMode = 0o644
+	defaultDirMode  = fs.ModeDir | 0o755
+)
+
+// Info сведения о файле или директории в хранилище
+type Info struct {
+	Name         string // путь от корня хранилища, разделитель - "/"
+	Size         int64
+	Mode         fs.FileMode
+	ModTime      time.Time
+	CreationTime time.Time // нулевое, если хранилище его не знает
+	IsDir        bool
+	Meta         meta.Meta // метаданные загрузки, у директорий пустые
+	// NoMeta - List не получил метаданные загрузки вместе со списком (S3), Meta пустые.
+	// Полные сведения возвращает WithMeta
+	NoMeta bool
+}
+
+// Writer принимает содержимое файла. Файл появляется в хранилище только после Commit,
+// до этого прежнее содержимое остается доступным
+type Writer interface {
+	io.Writer
+	// Commit сохраняет файл с метаданными m, заменяя прежний
+	Commit(m meta.Meta) error
+	// Abort отменяет запись. После Commit ничего не делает
+	Abort() error
+}
+
+// SizeHinter Writer, которому полезно заранее знать размер файла, например чтобы выбрать
+// размер частей загрузки
+type SizeHinter interface {
+	// SizeHint сообщает ожидаемый размер файла, вызывается до первой записи
+	SizeHint(size int64)
+}
+
+// SetSizeHint сообщает w ожидаемый размер файла, если w его учитывает. size 0 - неизвестен
+func SetSizeHint(w Writer, size int64) {
+	if h, ok := w.(SizeHinter); ok && size > 0 {
+		h.SizeHint(size)
+	}
+}
+
+// SizeLimiter хранилище, которое не может сохранить файл больше MaxFileSize байт
+type SizeLimiter interface {
+	MaxFileSize() int64
+}
+
+// MaxFileSize возвращает наибольший размер файла в st, 0 - без ограничения
+func MaxFileSize(st Storage) int64 {
+	if l, ok := st.(SizeLimiter); ok {
+		return l.MaxFileSize()
+	}
+	return 0
+}
+
+// Storage хранилище файлов сервера. Пути задаются от корня хранилища через "/",
+// пустой путь - корень. Скрытые имена (с file.StagingPrefix) зарезервированы
+// под служебные файлы и в List не попадают
+type Storage interface {
+	// Put начинает запись файла name, недостающие директории создаются
+	Put(ctx context.Context, name string) (Writer, error)
+	// Get читает length байт файла name начиная с offset, length 0 - до конца файла
+	Get(ctx context.Context, name string, offset, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, name string) (*Info, error)
+	// List вызывает fn для каждого элемента директории dir без обхода вложенных.
+	// Метаданные загрузки файлов могут отсутствовать, см. Info.NoMeta
+	List(ctx context.Context, dir string, fn func(Info) error) error
+	// Delete удаляет файл. Директории удаляются через RemoveDir
+	Delete(ctx context.Context, name string) error
+	// Rename переименовывает файл, newName не должен существовать
+	Rename(ctx context.Context, oldName, newName string) error
+	MakeDir(ctx context.Context, name string, parents bool) error
+	// RemoveDir удаляет директорию, непустую - только при recursive
+	RemoveDir(ctx context.Context, name string, recursive bool) error
+}
+
+// Importer реализуют хранилища, которые могут забрать готовый локальный файл
+// без копирования, например переименованием
+type Importer interface {
+	Import(ctx context.Context, name, srcPath string, m meta.Meta) error
+}
+
+// LocalFiles реализуют хранилища, файлы которых лежат на локальном диске
+type LocalFiles interface {
+	// Link создает жесткую ссылку dst на файл name
+	Link(name, dst string) error
+}
+
+// ImportFile переносит локальный файл srcPath в хранилище под именем name.
+// Если хранилище не умеет забирать файлы, содержимое копируется, а srcPath удаляется
+func ImportFile(ctx context.Context, st Storage, name, srcPath string, m meta.Meta) error {
+	if imp, ok := st.(Importer); ok {
+		return imp.Import(ctx, name, srcPath, m)
+	}
+
+	return importCopy(ctx, st, name, srcPath, m)
+}
+
+// importCopy копирует srcPath в хранилище и удаляет его
+func importCopy(ctx context.Context, st Storage, name, srcPath string, m meta.Meta) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	w, err := st.Put(ctx, name)
+	if err != nil {
+		return err
+	}
+	if srcStat, statErr := src.Stat(); statErr == nil {
+		SetSizeHint(w, srcStat.Size())
+	}
+	if _, err = io.Copy(w, src); err != nil {
+		_ = w.Abort()
+		return err
+	}
+	if err = w.Commit(m); err != nil {
+		return err
+	}
+	return os.Remove(srcPath)
+}
+
+// WithMeta дополняет сведения о файле из List метаданными загрузки, если List их не вернул
+func WithMeta(ctx context.Context, st Storage, info Info) (Info, error) {
+	if !info.NoMeta {
+		return info, nil
+	}
+	full, err := st.Stat(ctx, info.Name)
+	if err != nil {
+		return info, err
+	}
+	return *full, nil
+}
+
+// Walk обходит директорию dir и все вложенные. Если fn возвращает SkipDir
+// для директории, ее содержимое пропускается
+func Walk(ctx context.Context, st Storage, dir string, fn func(Info) error) error {
+	return st.List(ctx, dir, func(info Info) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fn(info)
+		if errors.Is(err, SkipDir) {
+			return nil
+		}
+		if err != nil || !info.IsDir {
+			return err
+		}
+		err = Walk(ctx, st, info.Name, fn)
+		if errors.Is(err, ErrNotFound) {
+			return nil // директорию удалили во время обхода
+		}
+		return err
+	})
+}
+
+// CleanPath проверяет путь вида "reports/2026/q3.csv" и возвращает его очищенную форму.
+// Отклоняет пустые и абсолютные пути, "..", NUL и управляющие символы и скрытые имена
+func CleanPath(name string) (string, error) {
+	if name == "" {
+		return "", errors.New("empty path")
+	}
+	if len(name) > maxPathLen {
+		return "", errors.New("path too long")
+	}
+	for _, r := range name {
+		switch {
+		case r == 0:
+			return "", errors.New("NUL byte in path")
+		case r == unicode.ReplacementChar:
+			return "", errors.New("path is not valid UTF-8")
+		case unicode.IsControl(r):
+			return "", errors.New("control character in path")
+		case r == '\\':
+			// обратный слэш - разделитель путей в Windows
+			return "", errors.New("backslash in path")
+		}
+	}
+	if path.IsAbs(name) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", errors.New("absolute path")
+	}
+
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			return "", errors.New("parent directory reference")
+		}
+		if len(part) > maxNameLen {
+			return "", errors.New("name too long")
+		}
+		if strings.HasPrefix(part, file.StagingPrefix) {
+			return "", errors.New("hidden name")
+		}
+	}
+
+	rel := path.Clean(name)
+	if rel == "." {
+		return "", errors.New("empty path")
+	}
+	return rel, nil
+}
+
+// cleanName как CleanPath, но пустой путь означает корень хранилища
+func cleanName(name string) (string, error) {
+	if name == "" {
+		return "", nil
+	}
+	rel, err := CleanPath(name)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidPath, err)
+	}
+	return rel, nil
+}
+
+// fileName как cleanName, но корень хранилища не допускается
+func fileName(name string) (string, error) {
+	rel, err := cleanName(name)
+	if err != nil {
+		return "", err
+	}
+	if rel == "" {
+		return "", fmt.Errorf("%w: empty path", ErrInvalidPath)
+	}
+	return rel, nil
+}
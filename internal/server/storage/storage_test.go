@@ -0,0 +1,160 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+)
+
+// Все хранилища должны вести себя одинаково
+func TestStorage(t *testing.T) {
+	backends := map[string]func(t *testing.T) Storage{
+		"local":  func(t *testing.T) Storage { return NewLocal(t.TempDir()) },
+		"memory": func(t *testing.T) Storage { return NewMemory() },
+		"s3":     func(t *testing.T) Storage { return newTestS3(t, "", 0) },
+		"dedup": func(t *testing.T) Storage {
+			d, err := NewDedup(context.Background(), NewMemory(), NewMemory(), DedupOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return d
+		},
+	}
+	for name, newStorage := range backends {
+		t.Run(name, func(t *testing.T) {
+			testStorage(t, newStorage(t))
+		})
+	}
+}
+
+func put(t *testing.T, st Storage, name, content string) {
+	t.Helper()
+	w, err := st.Put(context.Background(), name)
+	if err != nil {
+		t.Fatalf("Put(%q): %v", name, err)
+	}
+	if _, err = io.WriteString(w, content); err != nil {
+		t.Fatalf("Write(%q): %v", name, err)
+	}
+	if err = w.Commit(meta.Meta{Uploader: "alice"}); err != nil {
+		t.Fatalf("Commit(%q): %v", name, err)
+	}
+}
+
+func get(t *testing.T, st Storage, name string, offset, length int64) string {
+	t.Helper()
+	r, err := st.Get(context.Background(), name, offset, length)
+	if err != nil {
+		t.Fatalf("Get(%q): %v", name, err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll(%q): %v", name, err)
+	}
+	return string(data)
+}
+
+func list(t *testing.T, st Storage, dir string) []string {
+	t.Helper()
+	var names []string
+	err := Walk(context.Background(), st, dir, func(info Info) error {
+		names = append(names, info.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk(%q): %v", dir, err)
+	}
+	return names
+}
+
+func testStorage(t *testing.T, st Storage) {
+	ctx := context.Background()
+
+	put(t, st, "reports/2026/q3.csv", "a,b,c")
+	put(t, st, "image.png", "png")
+
+	if got := get(t, st, "reports/2026/q3.csv", 0, 0); got != "a,b,c" {
+		t.Errorf("Get = %q, want %q", got, "a,b,c")
+	}
+	if got := get(t, st, "reports/2026/q3.csv", 2, 2); got != "b," {
+		t.Errorf("Get range = %q, want %q", got, "b,")
+	}
+
+	info, err := st.Stat(ctx, "reports/2026/q3.csv")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Size != 5 || info.IsDir || info.Meta.Uploader != "alice" {
+		t.Errorf("Stat = %+v, want 5 byte file uploaded by alice", info)
+	}
+	if info, err = st.Stat(ctx, "reports"); err != nil || !info.IsDir {
+		t.Errorf("Stat(reports) = %+v, %v, want directory", info, err)
+	}
+	if _, err = st.Stat(ctx, "missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Stat(missing) error = %v, want ErrNotFound", err)
+	}
+
+	// Незавершенная запись не видна, а после Abort ничего не остается
+	w, err := st.Put(ctx, "image.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.Write([]byte("partial")); err != nil {
+		t.Fatal(err)
+	}
+	if got := get(t, st, "image.png", 0, 0); got != "png" {
+		t.Errorf("Get during Put = %q, want previous content", got)
+	}
+	if err = w.Abort(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"image.png", "reports", "reports/2026", "reports/2026/q3.csv"}
+	if got := list(t, st, ""); !equal(got, want) {
+		t.Errorf("Walk = %v, want %v", got, want)
+	}
+
+	if err = st.Rename(ctx, "image.png", "reports/image.png"); err != nil {
+		t.Fatalf("Rename: %v", err)
+	}
+	if err = st.Rename(ctx, "reports/image.png", "reports/2026/q3.csv"); !errors.Is(err, ErrExist) {
+		t.Errorf("Rename onto existing file error = %v, want ErrExist", err)
+	}
+
+	if err = st.MakeDir(ctx, "empty", false); err != nil {
+		t.Fatalf("MakeDir: %v", err)
+	}
+	if info, err = st.Stat(ctx, "empty"); err != nil || !info.IsDir {
+		t.Errorf("Stat(empty) = %+v, %v, want directory", info, err)
+	}
+	if err = st.MakeDir(ctx, "empty", false); !errors.Is(err, ErrExist) {
+		t.Errorf("MakeDir existing error = %v, want ErrExist", err)
+	}
+	if err = st.MakeDir(ctx, "a/b", false); !errors.Is(err, ErrNotFound) {
+		t.Errorf("MakeDir without parent error = %v, want ErrNotFound", err)
+	}
+	if err = st.Delete(ctx, "reports"); !errors.Is(err, ErrIsDir) {
+		t.Errorf("Delete directory error = %v, want ErrIsDir", err)
+	}
+	if err = st.RemoveDir(ctx, "reports", false); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("RemoveDir non-empty error = %v, want ErrNotEmpty", err)
+	}
+	if err = st.RemoveDir(ctx, "reports", true); err != nil {
+		t.Fatalf("RemoveDir recursive: %v", err)
+	}
+	if err = st.Delete(ctx, "reports/image.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete removed file error = %v, want ErrNotFound", err)
+	}
+	if got := list(t, st, ""); !equal(got, []string{"empty"}) {
+		t.Errorf("Walk after RemoveDir = %v, want [empty]", got)
+	}
+}
+
+func equal(got, want []string) bool {
+	slices.Sort(got)
+	return slices.Equal(got, want)
+}
@@ -0,0 +1,281 @@
+package versions
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+)
+
+// pathFile хранит путь файла, которому принадлежат версии
+const pathFile = "path"
+
+var ErrVersionNotFound = errors.New("version not found")
+
+// Version сохраненная версия файла
+type Version struct {
+	ID         string
+	Size       int64
+	ArchivedAt time.Time
+}
+
+// Store хранит предыдущие версии файлов.
+// Версии файла лежат в dir/<sha256 пути файла>/<id>, id - время архивации в наносекундах.
+type Store struct {
+	dir  string
+	now  func() time.Time                    // подменяется в тестах
+	link func(oldname, newname string) error // подменяется в тестах
+}
+
+// NewStore возвращает хранилище версий в директории dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, now: time.Now, link: os.Link}
+}
+
+// Archive сохраняет файл rel размером size как версию без копирования:
+// link создает жесткую ссылку dst на файл. Если ссылку создать нельзя,
+// например хранилище на другом диске, версию сохраняет Save
+func (s *Store) Archive(rel string, size int64, link func(dst string) error) (*Version, error) {
+	dir, err := s.prepare(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	id := newID(now)
+	if err = link(filepath.Join(dir, id)); err != nil {
+		return nil, err
+	}
+	return &Version{ID: id, Size: size, ArchivedAt: now}, nil
+}
+
+// Save сохраняет содержимое r с метаданными m как версию файла rel.
+// Используется, если файл лежит не на локальном диске
+func (s *Store) Save(rel string, r io.Reader, m meta.Meta) (*Version, error) {
+	const op = "server.versions.Save"
+
+	dir, err := s.prepare(rel)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	id := newID(now)
+	versionPath := filepath.Join(dir, id)
+	size, err := writeFile(versionPath, r)
+	if err != nil {
+		log.Printf("%s: failed to archive %s: %v", op, rel, err)
+		return nil, err
+	}
+	if err = meta.Write(versionPath, m); err != nil {
+		log.Printf("%s: failed to write version metadata: %v", op, err)
+	}
+	return &Version{ID: id, Size: size, ArchivedAt: now}, nil
+}
+
+// prepare создает директорию версий файла rel и возвращает ее путь
+func (s *Store) prepare(rel string) (string, error) {
+	const op = "server.versions.prepare"
+
+	dir := s.fileDir(rel)
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Printf("%s: failed to create versions dir: %v", op, err)
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, pathFile), []byte(rel), 0o644); err != nil {
+		log.Printf("%s: failed to write versions path: %v", op, err)
+		return "", err
+	}
+	return dir, nil
+}
+
+// List возвращает версии файла rel, новые первыми
+func (s *Store) List(rel string) ([]Version, error) {
+	entries, err := os.ReadDir(s.fileDir(rel))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var versions []Version
+	for _, e := range entries {
+		archivedAt, ok := parseID(e.Name())
+		if !ok || e.IsDir() {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		versions = append(versions, Version{ID: e.Name(), Size: info.Size(), ArchivedAt: archivedAt})
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].ID > versions[j].ID })
+	return versions, nil
+}
+
+// Path возвращает путь к версии id файла rel
+func (s *Store) Path(rel, id string) (string, error) {
+	if _, ok := parseID(id); !ok {
+		return "", ErrVersionNotFound
+	}
+	versionPath := filepath.Join(s.fileDir(rel), id)
+	if _, err := os.Stat(versionPath); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", ErrVersionNotFound
+		}
+		return "", err
+	}
+	return versionPath, nil
+}
+
+// Restore копирует версию id файла rel в скрытый файл рядом с версией
+// и возвращает его путь. Версия остается в истории.
+func (s *Store) Restore(rel, id string) (string, error) {
+	versionPath, err := s.Path(rel, id)
+	if err != nil {
+		return "", err
+	}
+
+	tmpPath := filepath.Join(filepath.Dir(versionPath), fmt.Sprintf(".%s.restore", id))
+	_ = os.Remove(tmpPath)
+	if err = s.linkOrCopy(versionPath, tmpPath); err != nil {
+		return "", err
+	}
+	return tmpPath, nil
+}
+
+// Prune удаляет версии сверх keepLast самых новых и старше maxAge.
+// Нулевое значение отключает соответствующее правило.
+func (s *Store) Prune(keepLast int, maxAge time.Duration) (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	now := s.now()
+	var removed int
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, e.Name())
+		rel, err := os.ReadFile(filepath.Join(dir, pathFile))
+		if err != nil {
+			continue
+		}
+		versions, err := s.List(string(rel))
+		if err != nil {
+			return removed, err
+		}
+
+		for i, v := range versions {
+			expired := maxAge > 0 && now.Sub(v.ArchivedAt) > maxAge
+			extra := keepLast > 0 && i >= keepLast
+			if !expired && !extra {
+				continue
+			}
+			if err = os.Remove(filepath.Join(dir, v.ID)); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return removed, err
+			}
+			removed++
+		}
+
+		if remaining, _ := s.List(string(rel)); len(remaining) == 0 {
+			_ = os.RemoveAll(dir)
+		}
+	}
+	return removed, nil
+}
+
+// RunPruner периодически применяет правила хранения версий, пока ctx не отменен
+func (s *Store) RunPruner(ctx context.Context, interval time.Duration, keepLast int, maxAge time.Duration) {
+	const op = "server.versions.RunPruner"
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		removed, err := s.Prune(keepLast, maxAge)
+		if err != nil {
+			log.Printf("%s: failed to prune versions: %v", op, err)
+		} else if removed > 0 {
+			log.Printf("%s: pruned %d versions", op, removed)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Store) fileDir(rel string) string {
+	sum := sha256.Sum256([]byte(rel))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// newID возвращает сортируемый по времени идентификатор версии
+func newID(t time.Time) string {
+	return fmt.Sprintf("%020d", t.UnixNano())
+}
+
+func parseID(id string) (time.Time, bool) {
+	if len(id) != 20 {
+		return time.Time{}, false
+	}
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
+
+// linkOrCopy создает жесткую ссылку dst на src, а если это невозможно - копию
+func (s *Store) linkOrCopy(src, dst string) error {
+	if err := s.link(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	_, err = writeFile(dst, in)
+	return err
+}
+
+// writeFile создает файл dst с содержимым r. При ошибке файл удаляется
+func writeFile(dst string, r io.Reader) (int64, error) {
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(out, r)
+	if err == nil {
+		err = out.Sync()
+	}
+	if err != nil {
+		_ = out.Close()
+		_ = os.Remove(dst)
+		return 0, err
+	}
+	return n, out.Close()
+}
@@ -0,0 +1,182 @@
+package versions
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/RVodassa/FileTransfer/internal/server/meta"
+)
+
+// archiveAt сохраняет content как версию файла rel, заархивированную в момент at
+func archiveAt(t *testing.T, s *Store, rel, content string, at time.Time) *Version {
+	t.Helper()
+	s.now = func() time.Time { return at }
+	v, err := s.Save(rel, strings.NewReader(content), meta.Meta{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// ids возвращает идентификаторы версий файла rel, новые первыми
+func ids(t *testing.T, s *Store, rel string) []string {
+	t.Helper()
+	list, err := s.List(rel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, v := range list {
+		out = append(out, v.ID)
+	}
+	return out
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+	const day = 24 * time.Hour
+	ages := []time.Duration{5 * day, 3 * day, day, time.Hour} // от старых к новым
+
+	tests := []struct {
+		name     string
+		keepLast int
+		maxAge   time.Duration
+		kept     int // сколько самых новых версий останется
+	}{
+		{name: "no rules", kept: 4},
+		{name: "keep last", keepLast: 2, kept: 2},
+		{name: "keep last above count", keepLast: 10, kept: 4},
+		{name: "keep days", maxAge: 2 * day, kept: 2},
+		{name: "keep days keeps all", maxAge: 6 * day, kept: 4},
+		{name: "keep last stricter", keepLast: 1, maxAge: 4 * day, kept: 1},
+		{name: "keep days stricter", keepLast: 3, maxAge: 2 * day, kept: 2},
+		{name: "all expired", maxAge: time.Minute, kept: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(t.TempDir())
+			var want []string
+			for _, rel := range []string{"a.txt", "docs/b.txt"} {
+				var fileIDs []string
+				for _, age := range ages {
+					fileIDs = append(fileIDs, archiveAt(t, s, rel, rel, now.Add(-age)).ID)
+				}
+				slices.Reverse(fileIDs)
+				want = append(want, fileIDs[:tt.kept]...)
+			}
+
+			s.now = func() time.Time { return now }
+			removed, err := s.Prune(tt.keepLast, tt.maxAge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wantRemoved := 2 * (len(ages) - tt.kept); removed != wantRemoved {
+				t.Errorf("Prune removed %d versions, want %d", removed, wantRemoved)
+			}
+			got := append(ids(t, s, "a.txt"), ids(t, s, "docs/b.txt")...)
+			if !slices.Equal(got, want) {
+				t.Errorf("versions after Prune = %v, want %v", got, want)
+			}
+
+			// директория файла без версий удаляется
+			entries, err := os.ReadDir(s.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wantDirs := min(tt.kept, 1) * 2; len(entries) != wantDirs {
+				t.Errorf("%d version dirs after Prune, want %d", len(entries), wantDirs)
+			}
+		})
+	}
+}
+
+// Archive связывает версию с файлом жесткой ссылкой, а если это невозможно - версия сохраняется копией
+func TestArchive(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "a.txt")
+	if err := os.WriteFile(filePath, []byte("first"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fileStat, err := os.Stat(filePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 3, 10, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name   string
+		link   func(oldname, newname string) error
+		linked bool
+	}{
+		{name: "hard link", link: os.Link, linked: true},
+		{name: "copy", link: func(string, string) error { return errors.New("cross-device link") }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewStore(t.TempDir())
+			s.now = func() time.Time { return at }
+			s.link = tt.link
+
+			v, err := s.Archive("a.txt", fileStat.Size(), func(dst string) error { return tt.link(filePath, dst) })
+			if err != nil {
+				// как и сервис, сохраняет копию, если ссылку создать нельзя
+				f, openErr := os.Open(filePath)
+				if openErr != nil {
+					t.Fatal(openErr)
+				}
+				v, err = s.Save("a.txt", f, meta.Meta{})
+				f.Close()
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if v.Size != 5 || !v.ArchivedAt.Equal(at) || v.ID != newID(at) {
+				t.Errorf("Archive = %+v, want 5 bytes archived at %v", v, at)
+			}
+			versionPath, err := s.Path("a.txt", v.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(versionPath)
+			if err != nil || string(data) != "first" {
+				t.Fatalf("version content = %q, %v, want %q", data, err, "first")
+			}
+			versionStat, err := os.Stat(versionPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if linked := os.SameFile(fileStat, versionStat); linked != tt.linked {
+				t.Errorf("version linked to file = %v, want %v", linked, tt.linked)
+			}
+
+			// восстановление не забирает версию из истории
+			tmpPath, err := s.Restore("a.txt", v.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if data, err = os.ReadFile(tmpPath); err != nil || string(data) != "first" {
+				t.Errorf("restored content = %q, %v, want %q", data, err, "first")
+			}
+			if got := ids(t, s, "a.txt"); !slices.Equal(got, []string{v.ID}) {
+				t.Errorf("versions after Restore = %v, want %v", got, []string{v.ID})
+			}
+		})
+	}
+}
+
+func TestPathNotFound(t *testing.T) {
+	s := NewStore(t.TempDir())
+	v := archiveAt(t, s, "a.txt", "data", time.Unix(1700000000, 0))
+	for _, id := range []string{"", "../a.txt", "00000000000000000001", v.ID + "0"} {
+		if _, err := s.Path("a.txt", id); !errors.Is(err, ErrVersionNotFound) {
+			t.Errorf("Path(%q) error = %v, want ErrVersionNotFound", id, err)
+		}
+	}
+	if _, err := s.Path("b.txt", v.ID); !errors.Is(err, ErrVersionNotFound) {
+		t.Errorf("Path of other file error = %v, want ErrVersionNotFound", err)
+	}
+}
@@ -0,0 +1,51 @@
+package checksum
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"hash/crc32"
+)
+
+var ErrMismatch = errors.New("checksum mismatch")
+
+var castagnoli = crc32.MakeTable(crc32.Castagnoli)
+
+// Chunk возвращает CRC32C части файла
+func Chunk(content []byte) uint32 {
+	return crc32.Checksum(content, castagnoli)
+}
+
+// VerifyChunk сверяет CRC32C части файла, если он передан
+func VerifyChunk(content []byte, crc *uint32) error {
+	if crc == nil {
+		return nil
+	}
+	if Chunk(content) != *crc {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// New возвращает SHA-256 хеш для всего файла
+func New() hash.Hash {
+	return sha256.New()
+}
+
+// Verify сверяет SHA-256 файла, если ожидаемое значение передано
+func Verify(h hash.Hash, expected []byte) error {
+	if len(expected) == 0 {
+		return nil
+	}
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// Hex возвращает хеш в виде строки для логов
+func Hex(sum []byte) string {
+	return hex.EncodeToString(sum)
+}
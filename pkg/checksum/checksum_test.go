@@ -0,0 +1,65 @@
+package checksum
+
+import (
+	"crypto/sha256"
+	"errors"
+	"testing"
+)
+
+func TestVerifyChunk(t *testing.T) {
+	content := []byte("123456789")
+	// контрольное значение CRC32C (Castagnoli) для "123456789"
+	if got := Chunk(content); got != 0xe3069283 {
+		t.Fatalf("Chunk = %#x, want %#x", got, 0xe3069283)
+	}
+
+	crc := Chunk(content)
+	wrong := crc ^ 1
+	tests := []struct {
+		name    string
+		content []byte
+		crc     *uint32
+		wantErr error
+	}{
+		{name: "match", content: content, crc: &crc},
+		{name: "not sent", content: content, crc: nil},
+		{name: "wrong crc", content: content, crc: &wrong, wantErr: ErrMismatch},
+		{name: "corrupted content", content: []byte("123456780"), crc: &crc, wantErr: ErrMismatch},
+		{name: "empty chunk", content: nil, crc: new(uint32)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := VerifyChunk(tt.content, tt.crc); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyChunk error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	content := []byte("file content")
+	sum := sha256.Sum256(content)
+	other := sha256.Sum256([]byte("other content"))
+
+	tests := []struct {
+		name     string
+		expected []byte
+		wantErr  error
+	}{
+		{name: "match", expected: sum[:]},
+		{name: "not sent", expected: nil},
+		{name: "mismatch", expected: other[:], wantErr: ErrMismatch},
+		{name: "truncated", expected: sum[:16], wantErr: ErrMismatch},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := New()
+			// файл хешируется по частям, как при передаче
+			h.Write(content[:5])
+			h.Write(content[5:])
+			if err := Verify(h, tt.expected); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
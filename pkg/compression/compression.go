@@ -0,0 +1,274 @@
+package compression
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/grpc/metadata"
+)
+
+// Header заголовок ответа UploadFile с алгоритмом, который выбрал сервер
+const Header = "compression"
+
+// MaxChunkSize максимальный размер распакованной части, защищает от "zip-бомб"
+const MaxChunkSize = 4 << 20
+
+// Уровни сжатия по умолчанию
+const (
+	DefaultGzipLevel = gzip.DefaultCompression
+	DefaultZstdLevel = 3
+)
+
+var ErrUnsupported = errors.New("unsupported compression")
+var ErrChunkTooLarge = errors.New("decompressed chunk is too large")
+
+// Levels уровни сжатия: gzip от 1 до 9, zstd от 1 до 22
+type Levels struct {
+	Gzip int
+	Zstd int
+}
+
+// Validate проверяет уровни сжатия, 0 заменяется уровнем по умолчанию
+func (l *Levels) Validate() error {
+	if l.Gzip == 0 {
+		l.Gzip = DefaultGzipLevel
+	}
+	if l.Zstd == 0 {
+		l.Zstd = DefaultZstdLevel
+	}
+	if l.Gzip != gzip.DefaultCompression && (l.Gzip < gzip.BestSpeed || l.Gzip > gzip.BestCompression) {
+		return fmt.Errorf("gzip_level must be from %d to %d", gzip.BestSpeed, gzip.BestCompression)
+	}
+	if l.Zstd < 1 || l.Zstd > 22 {
+		return fmt.Errorf("zstd_level must be from 1 to 22")
+	}
+	return nil
+}
+
+// Parse разбирает название алгоритма: gzip, zstd или none
+func Parse(name string) (pb.Compression, error) {
+	switch name {
+	case "", "none":
+		return pb.Compression_COMPRESSION_NONE, nil
+	case "gzip":
+		return pb.Compression_COMPRESSION_GZIP, nil
+	case "zstd":
+		return pb.Compression_COMPRESSION_ZSTD, nil
+	default:
+		return 0, fmt.Errorf("invalid compression %q: want gzip, zstd or none", name)
+	}
+}
+
+// Name возвращает название алгоритма для логов и заголовка
+func Name(alg pb.Compression) string {
+	switch alg {
+	case pb.Compression_COMPRESSION_GZIP:
+		return "gzip"
+	case pb.Compression_COMPRESSION_ZSTD:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// FromHeader возвращает алгоритм из заголовка ответа, без заголовка - none
+func FromHeader(md metadata.MD) pb.Compression {
+	values := md.Get(Header)
+	if len(values) == 0 {
+		return pb.Compression_COMPRESSION_NONE
+	}
+	alg, err := Parse(values[0])
+	if err != nil {
+		return pb.Compression_COMPRESSION_NONE
+	}
+	return alg
+}
+
+// Negotiate выбирает первый поддерживаемый алгоритм из предложенных клиентом
+func Negotiate(accept []pb.Compression) pb.Compression {
+	for _, alg := range accept {
+		switch alg {
+		case pb.Compression_COMPRESSION_GZIP, pb.Compression_COMPRESSION_ZSTD:
+			return alg
+		}
+	}
+	return pb.Compression_COMPRESSION_NONE
+}
+
+// compressedTypes типы содержимого, которые уже сжаты, кроме image/*, audio/* и video/*
+var compressedTypes = map[string]bool{
+	"application/gzip":             true,
+	"application/x-gzip":           true,
+	"application/zip":              true,
+	"application/zstd":             true,
+	"application/x-bzip2":          true,
+	"application/x-xz":             true,
+	"application/x-7z-compressed":  true,
+	"application/x-rar-compressed": true,
+	"application/vnd.rar":          true,
+	"application/pdf":              true,
+	"application/wasm":             true,
+	"font/woff":                    true,
+	"font/woff2":                   true,
+}
+
+// Compressible сообщает, есть ли смысл сжимать файл name. Тип содержимого определяется
+// по расширению, а если не вышло - по первым байтам head. Несжатые изображения (bmp, svg) сжимаются
+func Compressible(name string, head []byte) bool {
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if contentType == "" && len(head) > 0 {
+		contentType = http.DetectContentType(head)
+	}
+	contentType, _, _ = strings.Cut(contentType, ";")
+	switch {
+	case contentType == "image/bmp", contentType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(contentType, "image/"), strings.HasPrefix(contentType, "audio/"),
+		strings.HasPrefix(contentType, "video/"):
+		return false
+	default:
+		return !compressedTypes[contentType]
+	}
+}
+
+// Codec сжимает и распаковывает части файла. Безопасен для использования из нескольких горутин
+type Codec struct {
+	gzipLevel   int
+	gzipWriters sync.Pool // *gzip.Writer уровня gzipLevel
+	gzipReaders sync.Pool // *gzip.Reader
+	zstdEnc     *zstd.Encoder
+	zstdDec     *zstd.Decoder
+}
+
+// New возвращает Codec с уровнями сжатия levels
+func New(levels Levels) (*Codec, error) {
+	if err := levels.Validate(); err != nil {
+		return nil, err
+	}
+	enc, err := zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(levels.Zstd)), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	dec, err := zstd.NewReader(nil, zstd.WithDecoderMaxMemory(MaxChunkSize), zstd.WithDecoderConcurrency(0))
+	if err != nil {
+		return nil, err
+	}
+	return &Codec{gzipLevel: levels.Gzip, zstdEnc: enc, zstdDec: dec}, nil
+}
+
+// Encode сжимает chunk алгоритмом alg, результат дописывается в dst (может быть nil).
+// Если сжатие не уменьшает размер, вернет chunk как есть и none: несжимаемые части передаются без сжатия
+func (c *Codec) Encode(alg pb.Compression, chunk, dst []byte) ([]byte, pb.Compression, error) {
+	var out []byte
+	switch alg {
+	case pb.Compression_COMPRESSION_NONE:
+		return chunk, alg, nil
+	case pb.Compression_COMPRESSION_GZIP:
+		buf := bytes.NewBuffer(dst)
+		w, err := c.gzipWriter(buf)
+		if err != nil {
+			return nil, 0, err
+		}
+		defer c.gzipWriters.Put(w)
+		if _, err = w.Write(chunk); err != nil {
+			return nil, 0, err
+		}
+		if err = w.Close(); err != nil {
+			return nil, 0, err
+		}
+		out = buf.Bytes()
+	case pb.Compression_COMPRESSION_ZSTD:
+		out = c.zstdEnc.EncodeAll(chunk, dst)
+	default:
+		return nil, 0, ErrUnsupported
+	}
+	if len(out) >= len(chunk) {
+		return chunk, pb.Compression_COMPRESSION_NONE, nil
+	}
+	return out, alg, nil
+}
+
+// Decode распаковывает content, сжатый алгоритмом alg, результат дописывается в dst (может быть nil)
+func (c *Codec) Decode(alg pb.Compression, content, dst []byte) ([]byte, error) {
+	switch alg {
+	case pb.Compression_COMPRESSION_NONE:
+		return content, nil
+	case pb.Compression_COMPRESSION_GZIP:
+		r, err := c.gzipReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, err
+		}
+		defer c.gzipReaders.Put(r)
+		buf := bytes.NewBuffer(dst)
+		if _, err = buf.ReadFrom(io.LimitReader(r, MaxChunkSize+1)); err != nil {
+			return nil, err
+		}
+		if buf.Len() > MaxChunkSize {
+			return nil, ErrChunkTooLarge
+		}
+		return buf.Bytes(), nil
+	case pb.Compression_COMPRESSION_ZSTD:
+		out, err := c.zstdDec.DecodeAll(content, dst)
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return nil, ErrChunkTooLarge
+		}
+		return out, err
+	default:
+		return nil, ErrUnsupported
+	}
+}
+
+// gzipWriter вернет gzip.Writer из пула, который пишет в w
+func (c *Codec) gzipWriter(w io.Writer) (*gzip.Writer, error) {
+	if zw, ok := c.gzipWriters.Get().(*gzip.Writer); ok {
+		zw.Reset(w)
+		return zw, nil
+	}
+	return gzip.NewWriterLevel(w, c.gzipLevel)
+}
+
+// gzipReader вернет gzip.Reader из пула, который читает r
+func (c *Codec) gzipReader(r io.Reader) (*gzip.Reader, error) {
+	if zr, ok := c.gzipReaders.Get().(*gzip.Reader); ok {
+		if err := zr.Reset(r); err != nil {
+			c.gzipReaders.Put(zr)
+			return nil, err
+		}
+		return zr, nil
+	}
+	return gzip.NewReader(r)
+}
+
+// Stats считает переданные байты до и после сжатия. Безопасен для нескольких потоков
+type Stats struct {
+	raw  atomic.Int64
+	wire atomic.Int64
+}
+
+// Add учитывает часть: raw - размер данных файла, wire - размер при передаче
+func (s *Stats) Add(raw, wire int) {
+	s.raw.Add(int64(raw))
+	s.wire.Add(int64(wire))
+}
+
+// String описывает степень сжатия для логов
+func (s *Stats) String() string {
+	raw, wire := s.raw.Load(), s.wire.Load()
+	ratio := 1.0
+	if wire > 0 {
+		ratio = float64(raw) / float64(wire)
+	}
+	return fmt.Sprintf("%d bytes sent as %d, ratio %.2f", raw, wire, ratio)
+}
@@ -0,0 +1,84 @@
+package compression
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	pb "github.com/RVodassa/FileTransfer/pkg/protos/gen/file_transfer"
+)
+
+func TestCodec(t *testing.T) {
+	codec, err := New(Levels{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := bytes.Repeat([]byte("id,name,size\n1,report.csv,1024\n"), 4096)
+	random := make([]byte, 64<<10)
+	if _, err = rand.Read(random); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, alg := range []pb.Compression{pb.Compression_COMPRESSION_GZIP, pb.Compression_COMPRESSION_ZSTD} {
+		t.Run(Name(alg), func(t *testing.T) {
+			// результат дописывается в переданный буфер, как у буферов из пула
+			content, used, err := codec.Encode(alg, text, make([]byte, 0, len(text)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if used != alg || len(content) >= len(text) {
+				t.Fatalf("text encoded with %s to %d of %d bytes", Name(used), len(content), len(text))
+			}
+			got, err := codec.Decode(used, content, make([]byte, 0, len(text)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, text) {
+				t.Fatal("decoded content differs")
+			}
+
+			// несжимаемые данные передаются как есть
+			content, used, err = codec.Encode(alg, random, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if used != pb.Compression_COMPRESSION_NONE || !bytes.Equal(content, random) {
+				t.Fatalf("random data encoded with %s", Name(used))
+			}
+
+			// распакованная часть не может быть больше MaxChunkSize
+			bomb, _, err := codec.Encode(alg, make([]byte, MaxChunkSize+1), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = codec.Decode(alg, bomb, nil); !errors.Is(err, ErrChunkTooLarge) {
+				t.Fatalf("decode oversized chunk: got %v, want %v", err, ErrChunkTooLarge)
+			}
+		})
+	}
+}
+
+func TestCompressible(t *testing.T) {
+	tests := []struct {
+		name string
+		head []byte
+		want bool
+	}{
+		{name: "report.csv", want: true},
+		{name: "notes.txt", want: true},
+		{name: "backup.tar", want: true},
+		{name: "diagram.svg", want: true},
+		{name: "archive.zip"},
+		{name: "photo.jpg"},
+		{name: "movie.mp4"},
+		{name: "logs.gz"},
+		{name: "data", head: []byte("\x1f\x8b\x08\x00")},
+		{name: "data", head: []byte("plain text without extension"), want: true},
+	}
+	for _, tt := range tests {
+		if got := Compressible(tt.name, tt.head); got != tt.want {
+			t.Errorf("Compressible(%q, %q) = %v, want %v", tt.name, tt.head, got, tt.want)
+		}
+	}
+}
@@ -8,10 +8,15 @@ import (
 	"path/filepath"
 )
 
+// StagingPrefix начало имени скрытого staging файла
+const StagingPrefix = "."
+
 type File struct {
-	FilePath   string
-	buffer     *bytes.Buffer
-	OutputFile *os.File
+	FilePath    string // итоговый путь файла
+	StagingPath string // скрытый файл, в который идет запись
+	buffer      *bytes.Buffer
+	OutputFile  *os.File
+	committed   bool
 }
 
 func NewFile() *File {
@@ -20,19 +25,22 @@ func NewFile() *File {
 	}
 }
 
+// SetFile создает скрытый staging файл рядом с итоговым.
+// Итоговый файл не меняется до вызова Commit.
 func (f *File) SetFile(fileName, path string) error {
 	err := os.MkdirAll(path, os.ModePerm)
 	if err != nil {
-		log.Printf("error creating dir: %s", f.FilePath)
+		log.Printf("error creating dir: %s", path)
 		return err
 	}
 
 	f.FilePath = filepath.Join(path, fileName)
-	file, err := os.Create(f.FilePath)
+	file, err := os.CreateTemp(path, StagingPrefix+fileName+".*.tmp")
 	if err != nil {
-		log.Printf("error creating file: %s", f.FilePath)
+		log.Printf("error creating staging file for: %s", f.FilePath)
 		return err
 	}
+	f.StagingPath = file.Name()
 	f.OutputFile = file
 	return nil
 }
@@ -45,9 +53,44 @@ func (f *File) Write(chunk []byte) error {
 	return err
 }
 
-func (f *File) Close() error {
+// Commit сбрасывает данные на диск и атомарно переименовывает staging файл в итоговый
+func (f *File) Commit() error {
 	if f.OutputFile == nil {
+		return fmt.Errorf("output file is not set")
+	}
+	if err := f.OutputFile.Sync(); err != nil {
+		log.Printf("error syncing file: %s", f.StagingPath)
+		return err
+	}
+	if err := f.OutputFile.Close(); err != nil {
+		log.Printf("error closing file: %s", f.StagingPath)
+		return err
+	}
+	if err := os.Rename(f.StagingPath, f.FilePath); err != nil {
+		log.Printf("error renaming %s to %s", f.StagingPath, f.FilePath)
+		return err
+	}
+	f.committed = true
+	return syncDir(filepath.Dir(f.FilePath))
+}
+
+// Close закрывает файл. Если Commit не был вызван, staging файл удаляется,
+// а итоговый файл остается прежним.
+func (f *File) Close() error {
+	if f.OutputFile == nil || f.committed {
 		return nil
 	}
-	return f.OutputFile.Close()
+	_ = f.OutputFile.Close()
+	f.committed = true // повторный Close ничего не делает
+	return os.Remove(f.StagingPath)
+}
+
+// syncDir сохраняет на диске результат переименования
+func syncDir(path string) error {
+	d, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
@@ -1,4 +1,10 @@
+// protoc --go_out=. --go-grpc_out=. protos/file_transfer.proto
+
 // Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             v3.14.0
+// source: pkg/protos/file_transfer.proto
 
 package file_transfer
 
@@ -11,16 +17,49 @@ import (
 
 // This is a compile-time assertion to ensure that this generated file
 // is compatible with the grpc package it is being compiled against.
-// Requires gRPC-Go v1.32.0 or later.
-const _ = grpc.SupportPackageIsVersion7
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	FileTransfer_UploadFile_FullMethodName            = "/file_transfer.FileTransfer/UploadFile"
+	FileTransfer_ListFiles_FullMethodName             = "/file_transfer.FileTransfer/ListFiles"
+	FileTransfer_StreamListFiles_FullMethodName       = "/file_transfer.FileTransfer/StreamListFiles"
+	FileTransfer_GetFile_FullMethodName               = "/file_transfer.FileTransfer/GetFile"
+	FileTransfer_StartUploadSession_FullMethodName    = "/file_transfer.FileTransfer/StartUploadSession"
+	FileTransfer_GetUploadSession_FullMethodName      = "/file_transfer.FileTransfer/GetUploadSession"
+	FileTransfer_CompleteUploadSession_FullMethodName = "/file_transfer.FileTransfer/CompleteUploadSession"
+	FileTransfer_DeleteFile_FullMethodName            = "/file_transfer.FileTransfer/DeleteFile"
+	FileTransfer_RenameFile_FullMethodName            = "/file_transfer.FileTransfer/RenameFile"
+	FileTransfer_StatFile_FullMethodName              = "/file_transfer.FileTransfer/StatFile"
+	FileTransfer_MakeDir_FullMethodName               = "/file_transfer.FileTransfer/MakeDir"
+	FileTransfer_RemoveDir_FullMethodName             = "/file_transfer.FileTransfer/RemoveDir"
+	FileTransfer_ListVersions_FullMethodName          = "/file_transfer.FileTransfer/ListVersions"
+	FileTransfer_RestoreVersion_FullMethodName        = "/file_transfer.FileTransfer/RestoreVersion"
+	FileTransfer_GetUsage_FullMethodName              = "/file_transfer.FileTransfer/GetUsage"
+)
 
 // FileTransferClient is the client API for FileTransfer service.
 //
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type FileTransferClient interface {
-	UploadFile(ctx context.Context, opts ...grpc.CallOption) (FileTransfer_UploadFileClient, error)
-	ListFiles(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ListFilesResponse, error)
-	GetFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (FileTransfer_GetFileClient, error)
+	UploadFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadFileRequest, UploadFileResponse], error)
+	ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error)
+	// StreamListFiles отдает FileInfo по мере обхода директорий в порядке файловой системы.
+	// Поддерживает фильтры ListFilesRequest, сортировка и пагинация не поддерживаются
+	StreamListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileInfo], error)
+	GetFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetFileResponse], error)
+	StartUploadSession(ctx context.Context, in *StartUploadSessionRequest, opts ...grpc.CallOption) (*UploadSession, error)
+	GetUploadSession(ctx context.Context, in *GetUploadSessionRequest, opts ...grpc.CallOption) (*UploadSession, error)
+	// CompleteUploadSession сохраняет файл параллельной сессии, когда приняты все части
+	CompleteUploadSession(ctx context.Context, in *CompleteUploadSessionRequest, opts ...grpc.CallOption) (*UploadFileResponse, error)
+	DeleteFile(ctx context.Context, in *DeleteFileRequest, opts ...grpc.CallOption) (*DeleteFileResponse, error)
+	RenameFile(ctx context.Context, in *RenameFileRequest, opts ...grpc.CallOption) (*RenameFileResponse, error)
+	StatFile(ctx context.Context, in *StatFileRequest, opts ...grpc.CallOption) (*FileInfo, error)
+	MakeDir(ctx context.Context, in *MakeDirRequest, opts ...grpc.CallOption) (*MakeDirResponse, error)
+	RemoveDir(ctx context.Context, in *RemoveDirRequest, opts ...grpc.CallOption) (*RemoveDirResponse, error)
+	ListVersions(ctx context.Context, in *ListVersionsRequest, opts ...grpc.CallOption) (*ListVersionsResponse, error)
+	RestoreVersion(ctx context.Context, in *RestoreVersionRequest, opts ...grpc.CallOption) (*RestoreVersionResponse, error)
+	GetUsage(ctx context.Context, in *GetUsageRequest, opts ...grpc.CallOption) (*GetUsageResponse, error)
 }
 
 type fileTransferClient struct {
@@ -31,105 +70,256 @@ func NewFileTransferClient(cc grpc.ClientConnInterface) FileTransferClient {
 	return &fileTransferClient{cc}
 }
 
-func (c *fileTransferClient) UploadFile(ctx context.Context, opts ...grpc.CallOption) (FileTransfer_UploadFileClient, error) {
-	stream, err := c.cc.NewStream(ctx, &FileTransfer_ServiceDesc.Streams[0], "/file_transfer.FileTransfer/UploadFile", opts...)
+func (c *fileTransferClient) UploadFile(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[UploadFileRequest, UploadFileResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileTransfer_ServiceDesc.Streams[0], FileTransfer_UploadFile_FullMethodName, cOpts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &fileTransferUploadFileClient{stream}
+	x := &grpc.GenericClientStream[UploadFileRequest, UploadFileResponse]{ClientStream: stream}
 	return x, nil
 }
 
-type FileTransfer_UploadFileClient interface {
-	Send(*UploadFileRequest) error
-	CloseAndRecv() (*UploadFileResponse, error)
-	grpc.ClientStream
-}
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileTransfer_UploadFileClient = grpc.ClientStreamingClient[UploadFileRequest, UploadFileResponse]
 
-type fileTransferUploadFileClient struct {
-	grpc.ClientStream
+func (c *fileTransferClient) ListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (*ListFilesResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListFilesResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_ListFiles_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (x *fileTransferUploadFileClient) Send(m *UploadFileRequest) error {
-	return x.ClientStream.SendMsg(m)
+func (c *fileTransferClient) StreamListFiles(ctx context.Context, in *ListFilesRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[FileInfo], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileTransfer_ServiceDesc.Streams[1], FileTransfer_StreamListFiles_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ListFilesRequest, FileInfo]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
 }
 
-func (x *fileTransferUploadFileClient) CloseAndRecv() (*UploadFileResponse, error) {
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileTransfer_StreamListFilesClient = grpc.ServerStreamingClient[FileInfo]
+
+func (c *fileTransferClient) GetFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[GetFileResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &FileTransfer_ServiceDesc.Streams[2], FileTransfer_GetFile_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetFileRequest, GetFileResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
 	if err := x.ClientStream.CloseSend(); err != nil {
 		return nil, err
 	}
-	m := new(UploadFileResponse)
-	if err := x.ClientStream.RecvMsg(m); err != nil {
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileTransfer_GetFileClient = grpc.ServerStreamingClient[GetFileResponse]
+
+func (c *fileTransferClient) StartUploadSession(ctx context.Context, in *StartUploadSessionRequest, opts ...grpc.CallOption) (*UploadSession, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadSession)
+	err := c.cc.Invoke(ctx, FileTransfer_StartUploadSession_FullMethodName, in, out, cOpts...)
+	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return out, nil
 }
 
-func (c *fileTransferClient) ListFiles(ctx context.Context, in *Empty, opts ...grpc.CallOption) (*ListFilesResponse, error) {
-	out := new(ListFilesResponse)
-	err := c.cc.Invoke(ctx, "/file_transfer.FileTransfer/ListFiles", in, out, opts...)
+func (c *fileTransferClient) GetUploadSession(ctx context.Context, in *GetUploadSessionRequest, opts ...grpc.CallOption) (*UploadSession, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadSession)
+	err := c.cc.Invoke(ctx, FileTransfer_GetUploadSession_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
 	return out, nil
 }
 
-func (c *fileTransferClient) GetFile(ctx context.Context, in *GetFileRequest, opts ...grpc.CallOption) (FileTransfer_GetFileClient, error) {
-	stream, err := c.cc.NewStream(ctx, &FileTransfer_ServiceDesc.Streams[1], "/file_transfer.FileTransfer/GetFile", opts...)
+func (c *fileTransferClient) CompleteUploadSession(ctx context.Context, in *CompleteUploadSessionRequest, opts ...grpc.CallOption) (*UploadFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UploadFileResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_CompleteUploadSession_FullMethodName, in, out, cOpts...)
 	if err != nil {
 		return nil, err
 	}
-	x := &fileTransferGetFileClient{stream}
-	if err := x.ClientStream.SendMsg(in); err != nil {
+	return out, nil
+}
+
+func (c *fileTransferClient) DeleteFile(ctx context.Context, in *DeleteFileRequest, opts ...grpc.CallOption) (*DeleteFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteFileResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_DeleteFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
 		return nil, err
 	}
-	if err := x.ClientStream.CloseSend(); err != nil {
+	return out, nil
+}
+
+func (c *fileTransferClient) RenameFile(ctx context.Context, in *RenameFileRequest, opts ...grpc.CallOption) (*RenameFileResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RenameFileResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_RenameFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
 		return nil, err
 	}
-	return x, nil
+	return out, nil
+}
+
+func (c *fileTransferClient) StatFile(ctx context.Context, in *StatFileRequest, opts ...grpc.CallOption) (*FileInfo, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FileInfo)
+	err := c.cc.Invoke(ctx, FileTransfer_StatFile_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileTransferClient) MakeDir(ctx context.Context, in *MakeDirRequest, opts ...grpc.CallOption) (*MakeDirResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(MakeDirResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_MakeDir_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *fileTransferClient) RemoveDir(ctx context.Context, in *RemoveDirRequest, opts ...grpc.CallOption) (*RemoveDirResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RemoveDirResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_RemoveDir_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-type FileTransfer_GetFileClient interface {
-	Recv() (*GetFileResponse, error)
-	grpc.ClientStream
+func (c *fileTransferClient) ListVersions(ctx context.Context, in *ListVersionsRequest, opts ...grpc.CallOption) (*ListVersionsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListVersionsResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_ListVersions_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-type fileTransferGetFileClient struct {
-	grpc.ClientStream
+func (c *fileTransferClient) RestoreVersion(ctx context.Context, in *RestoreVersionRequest, opts ...grpc.CallOption) (*RestoreVersionResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RestoreVersionResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_RestoreVersion_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
 }
 
-func (x *fileTransferGetFileClient) Recv() (*GetFileResponse, error) {
-	m := new(GetFileResponse)
-	if err := x.ClientStream.RecvMsg(m); err != nil {
+func (c *fileTransferClient) GetUsage(ctx context.Context, in *GetUsageRequest, opts ...grpc.CallOption) (*GetUsageResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetUsageResponse)
+	err := c.cc.Invoke(ctx, FileTransfer_GetUsage_FullMethodName, in, out, cOpts...)
+	if err != nil {
 		return nil, err
 	}
-	return m, nil
+	return out, nil
 }
 
 // FileTransferServer is the server API for FileTransfer service.
 // All implementations must embed UnimplementedFileTransferServer
-// for forward compatibility
+// for forward compatibility.
 type FileTransferServer interface {
-	UploadFile(FileTransfer_UploadFileServer) error
-	ListFiles(context.Context, *Empty) (*ListFilesResponse, error)
-	GetFile(*GetFileRequest, FileTransfer_GetFileServer) error
+	UploadFile(grpc.ClientStreamingServer[UploadFileRequest, UploadFileResponse]) error
+	ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error)
+	// StreamListFiles отдает FileInfo по мере обхода директорий в порядке файловой системы.
+	// Поддерживает фильтры ListFilesRequest, сортировка и пагинация не поддерживаются
+	StreamListFiles(*ListFilesRequest, grpc.ServerStreamingServer[FileInfo]) error
+	GetFile(*GetFileRequest, grpc.ServerStreamingServer[GetFileResponse]) error
+	StartUploadSession(context.Context, *StartUploadSessionRequest) (*UploadSession, error)
+	GetUploadSession(context.Context, *GetUploadSessionRequest) (*UploadSession, error)
+	// CompleteUploadSession сохраняет файл параллельной сессии, когда приняты все части
+	CompleteUploadSession(context.Context, *CompleteUploadSessionRequest) (*UploadFileResponse, error)
+	DeleteFile(context.Context, *DeleteFileRequest) (*DeleteFileResponse, error)
+	RenameFile(context.Context, *RenameFileRequest) (*RenameFileResponse, error)
+	StatFile(context.Context, *StatFileRequest) (*FileInfo, error)
+	MakeDir(context.Context, *MakeDirRequest) (*MakeDirResponse, error)
+	RemoveDir(context.Context, *RemoveDirRequest) (*RemoveDirResponse, error)
+	ListVersions(context.Context, *ListVersionsRequest) (*ListVersionsResponse, error)
+	RestoreVersion(context.Context, *RestoreVersionRequest) (*RestoreVersionResponse, error)
+	GetUsage(context.Context, *GetUsageRequest) (*GetUsageResponse, error)
 	mustEmbedUnimplementedFileTransferServer()
 }
 
-// UnimplementedFileTransferServer must be embedded to have forward compatible implementations.
-type UnimplementedFileTransferServer struct {
-}
+// UnimplementedFileTransferServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedFileTransferServer struct{}
 
-func (UnimplementedFileTransferServer) UploadFile(FileTransfer_UploadFileServer) error {
+func (UnimplementedFileTransferServer) UploadFile(grpc.ClientStreamingServer[UploadFileRequest, UploadFileResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method UploadFile not implemented")
 }
-func (UnimplementedFileTransferServer) ListFiles(context.Context, *Empty) (*ListFilesResponse, error) {
+func (UnimplementedFileTransferServer) ListFiles(context.Context, *ListFilesRequest) (*ListFilesResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method ListFiles not implemented")
 }
-func (UnimplementedFileTransferServer) GetFile(*GetFileRequest, FileTransfer_GetFileServer) error {
+func (UnimplementedFileTransferServer) StreamListFiles(*ListFilesRequest, grpc.ServerStreamingServer[FileInfo]) error {
+	return status.Errorf(codes.Unimplemented, "method StreamListFiles not implemented")
+}
+func (UnimplementedFileTransferServer) GetFile(*GetFileRequest, grpc.ServerStreamingServer[GetFileResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method GetFile not implemented")
 }
+func (UnimplementedFileTransferServer) StartUploadSession(context.Context, *StartUploadSessionRequest) (*UploadSession, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StartUploadSession not implemented")
+}
+func (UnimplementedFileTransferServer) GetUploadSession(context.Context, *GetUploadSessionRequest) (*UploadSession, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUploadSession not implemented")
+}
+func (UnimplementedFileTransferServer) CompleteUploadSession(context.Context, *CompleteUploadSessionRequest) (*UploadFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CompleteUploadSession not implemented")
+}
+func (UnimplementedFileTransferServer) DeleteFile(context.Context, *DeleteFileRequest) (*DeleteFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteFile not implemented")
+}
+func (UnimplementedFileTransferServer) RenameFile(context.Context, *RenameFileRequest) (*RenameFileResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RenameFile not implemented")
+}
+func (UnimplementedFileTransferServer) StatFile(context.Context, *StatFileRequest) (*FileInfo, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method StatFile not implemented")
+}
+func (UnimplementedFileTransferServer) MakeDir(context.Context, *MakeDirRequest) (*MakeDirResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method MakeDir not implemented")
+}
+func (UnimplementedFileTransferServer) RemoveDir(context.Context, *RemoveDirRequest) (*RemoveDirResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RemoveDir not implemented")
+}
+func (UnimplementedFileTransferServer) ListVersions(context.Context, *ListVersionsRequest) (*ListVersionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListVersions not implemented")
+}
+func (UnimplementedFileTransferServer) RestoreVersion(context.Context, *RestoreVersionRequest) (*RestoreVersionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreVersion not implemented")
+}
+func (UnimplementedFileTransferServer) GetUsage(context.Context, *GetUsageRequest) (*GetUsageResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetUsage not implemented")
+}
 func (UnimplementedFileTransferServer) mustEmbedUnimplementedFileTransferServer() {}
+func (UnimplementedFileTransferServer) testEmbeddedByValue()                      {}
 
 // UnsafeFileTransferServer may be embedded to opt out of forward compatibility for this service.
 // Use of this interface is not recommended, as added methods to FileTransferServer will
@@ -139,72 +329,259 @@ type UnsafeFileTransferServer interface {
 }
 
 func RegisterFileTransferServer(s grpc.ServiceRegistrar, srv FileTransferServer) {
+	// If the following call pancis, it indicates UnimplementedFileTransferServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
 	s.RegisterService(&FileTransfer_ServiceDesc, srv)
 }
 
 func _FileTransfer_UploadFile_Handler(srv interface{}, stream grpc.ServerStream) error {
-	return srv.(FileTransferServer).UploadFile(&fileTransferUploadFileServer{stream})
+	return srv.(FileTransferServer).UploadFile(&grpc.GenericServerStream[UploadFileRequest, UploadFileResponse]{ServerStream: stream})
 }
 
-type FileTransfer_UploadFileServer interface {
-	SendAndClose(*UploadFileResponse) error
-	Recv() (*UploadFileRequest, error)
-	grpc.ServerStream
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileTransfer_UploadFileServer = grpc.ClientStreamingServer[UploadFileRequest, UploadFileResponse]
+
+func _FileTransfer_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListFilesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).ListFiles(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_ListFiles_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).ListFiles(ctx, req.(*ListFilesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type fileTransferUploadFileServer struct {
-	grpc.ServerStream
+func _FileTransfer_StreamListFiles_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ListFilesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileTransferServer).StreamListFiles(m, &grpc.GenericServerStream[ListFilesRequest, FileInfo]{ServerStream: stream})
 }
 
-func (x *fileTransferUploadFileServer) SendAndClose(m *UploadFileResponse) error {
-	return x.ServerStream.SendMsg(m)
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileTransfer_StreamListFilesServer = grpc.ServerStreamingServer[FileInfo]
+
+func _FileTransfer_GetFile_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetFileRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(FileTransferServer).GetFile(m, &grpc.GenericServerStream[GetFileRequest, GetFileResponse]{ServerStream: stream})
 }
 
-func (x *fileTransferUploadFileServer) Recv() (*UploadFileRequest, error) {
-	m := new(UploadFileRequest)
-	if err := x.ServerStream.RecvMsg(m); err != nil {
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type FileTransfer_GetFileServer = grpc.ServerStreamingServer[GetFileResponse]
+
+func _FileTransfer_StartUploadSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StartUploadSessionRequest)
+	if err := dec(in); err != nil {
 		return nil, err
 	}
-	return m, nil
+	if interceptor == nil {
+		return srv.(FileTransferServer).StartUploadSession(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_StartUploadSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).StartUploadSession(ctx, req.(*StartUploadSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func _FileTransfer_ListFiles_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Empty)
+func _FileTransfer_GetUploadSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUploadSessionRequest)
 	if err := dec(in); err != nil {
 		return nil, err
 	}
 	if interceptor == nil {
-		return srv.(FileTransferServer).ListFiles(ctx, in)
+		return srv.(FileTransferServer).GetUploadSession(ctx, in)
 	}
 	info := &grpc.UnaryServerInfo{
 		Server:     srv,
-		FullMethod: "/file_transfer.FileTransfer/ListFiles",
+		FullMethod: FileTransfer_GetUploadSession_FullMethodName,
 	}
 	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(FileTransferServer).ListFiles(ctx, req.(*Empty))
+		return srv.(FileTransferServer).GetUploadSession(ctx, req.(*GetUploadSessionRequest))
 	}
 	return interceptor(ctx, in, info, handler)
 }
 
-func _FileTransfer_GetFile_Handler(srv interface{}, stream grpc.ServerStream) error {
-	m := new(GetFileRequest)
-	if err := stream.RecvMsg(m); err != nil {
-		return err
+func _FileTransfer_CompleteUploadSession_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CompleteUploadSessionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).CompleteUploadSession(ctx, in)
 	}
-	return srv.(FileTransferServer).GetFile(m, &fileTransferGetFileServer{stream})
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_CompleteUploadSession_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).CompleteUploadSession(ctx, req.(*CompleteUploadSessionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type FileTransfer_GetFileServer interface {
-	Send(*GetFileResponse) error
-	grpc.ServerStream
+func _FileTransfer_DeleteFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).DeleteFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_DeleteFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).DeleteFile(ctx, req.(*DeleteFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-type fileTransferGetFileServer struct {
-	grpc.ServerStream
+func _FileTransfer_RenameFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RenameFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).RenameFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_RenameFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).RenameFile(ctx, req.(*RenameFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
-func (x *fileTransferGetFileServer) Send(m *GetFileResponse) error {
-	return x.ServerStream.SendMsg(m)
+func _FileTransfer_StatFile_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(StatFileRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).StatFile(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_StatFile_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).StatFile(ctx, req.(*StatFileRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileTransfer_MakeDir_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MakeDirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).MakeDir(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_MakeDir_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).MakeDir(ctx, req.(*MakeDirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileTransfer_RemoveDir_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RemoveDirRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).RemoveDir(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_RemoveDir_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).RemoveDir(ctx, req.(*RemoveDirRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileTransfer_ListVersions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListVersionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).ListVersions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_ListVersions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).ListVersions(ctx, req.(*ListVersionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileTransfer_RestoreVersion_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreVersionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).RestoreVersion(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_RestoreVersion_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).RestoreVersion(ctx, req.(*RestoreVersionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _FileTransfer_GetUsage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetUsageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(FileTransferServer).GetUsage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: FileTransfer_GetUsage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(FileTransferServer).GetUsage(ctx, req.(*GetUsageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
 }
 
 // FileTransfer_ServiceDesc is the grpc.ServiceDesc for FileTransfer service.
@@ -218,6 +595,50 @@ var FileTransfer_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "ListFiles",
 			Handler:    _FileTransfer_ListFiles_Handler,
 		},
+		{
+			MethodName: "StartUploadSession",
+			Handler:    _FileTransfer_StartUploadSession_Handler,
+		},
+		{
+			MethodName: "GetUploadSession",
+			Handler:    _FileTransfer_GetUploadSession_Handler,
+		},
+		{
+			MethodName: "CompleteUploadSession",
+			Handler:    _FileTransfer_CompleteUploadSession_Handler,
+		},
+		{
+			MethodName: "DeleteFile",
+			Handler:    _FileTransfer_DeleteFile_Handler,
+		},
+		{
+			MethodName: "RenameFile",
+			Handler:    _FileTransfer_RenameFile_Handler,
+		},
+		{
+			MethodName: "StatFile",
+			Handler:    _FileTransfer_StatFile_Handler,
+		},
+		{
+			MethodName: "MakeDir",
+			Handler:    _FileTransfer_MakeDir_Handler,
+		},
+		{
+			MethodName: "RemoveDir",
+			Handler:    _FileTransfer_RemoveDir_Handler,
+		},
+		{
+			MethodName: "ListVersions",
+			Handler:    _FileTransfer_ListVersions_Handler,
+		},
+		{
+			MethodName: "RestoreVersion",
+			Handler:    _FileTransfer_RestoreVersion_Handler,
+		},
+		{
+			MethodName: "GetUsage",
+			Handler:    _FileTransfer_GetUsage_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -225,6 +646,11 @@ var FileTransfer_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _FileTransfer_UploadFile_Handler,
 			ClientStreams: true,
 		},
+		{
+			StreamName:    "StreamListFiles",
+			Handler:       _FileTransfer_StreamListFiles_Handler,
+			ServerStreams: true,
+		},
 		{
 			StreamName:    "GetFile",
 			Handler:       _FileTransfer_GetFile_Handler,
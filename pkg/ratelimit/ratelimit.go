@@ -0,0 +1,203 @@
+// Package ratelimit ограничение скорости передачи файлов по алгоритму token bucket
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// ParseRate разбирает скорость в байтах в секунду: число с необязательным суффиксом
+// K, M или G (степени 1024), например 512K или 10M. 0 или пустая строка - без ограничения
+func ParseRate(s string) (int64, error) {
+	num := strings.TrimSpace(s)
+	if num == "" {
+		return 0, nil
+	}
+	mult := int64(1)
+	switch num[len(num)-1] {
+	case 'k', 'K':
+		mult = 1 << 10
+	case 'm', 'M':
+		mult = 1 << 20
+	case 'g', 'G':
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		num = num[:len(num)-1]
+	}
+	v, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || v < 0 || v > math.MaxInt64/mult {
+		return 0, fmt.Errorf("invalid rate %q: want bytes per second, e.g. 512K or 10M", s)
+	}
+	return v * mult, nil
+}
+
+// NewBucket возвращает token bucket на bytesPerSec байт в секунду, nil - без ограничения.
+// Bucket вмещает секунду передачи: после простоя столько можно отправить сразу
+func NewBucket(bytesPerSec int64) *rate.Limiter {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSec), int(min(bytesPerSec, math.MaxInt32)))
+}
+
+// Limiter ограничивает передачу несколькими bucket сразу, например общим и на клиента.
+// nil - без ограничения
+type Limiter struct {
+	buckets []*rate.Limiter
+}
+
+// New возвращает Limiter из buckets, nil среди них пропускаются. Без ограничений вернет nil
+func New(buckets ...*rate.Limiter) *Limiter {
+	var l Limiter
+	for _, b := range buckets {
+		if b != nil {
+			l.buckets = append(l.buckets, b)
+		}
+	}
+	if len(l.buckets) == 0 {
+		return nil
+	}
+	return &l
+}
+
+// Wait ждет, пока все bucket позволят передать n байт, или отмены ctx.
+// Часть больше bucket забирается из него по частям. Если ожидание не успевает
+// до дедлайна ctx, Wait сразу возвращает ошибку
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil {
+		return nil
+	}
+	now := time.Now()
+	delay, reservations := l.reserve(now, n)
+	if delay == 0 {
+		return nil
+	}
+	cancel := func() {
+		for _, r := range reservations {
+			r.CancelAt(time.Now())
+		}
+	}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(now.Add(delay)) {
+		cancel()
+		return fmt.Errorf("rate: wait of %v would exceed context deadline", delay)
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// неиспользованные байты возвращаются в bucket
+		cancel()
+		return ctx.Err()
+	}
+}
+
+// reserve забирает n байт из всех bucket на момент now и возвращает, сколько нужно
+// подождать до передачи. Bucket ждут одновременно, поэтому ожидание - наибольшее из них
+func (l *Limiter) reserve(now time.Time, n int) (time.Duration, []*rate.Reservation) {
+	var (
+		delay        time.Duration
+		reservations []*rate.Reservation
+	)
+	for _, b := range l.buckets {
+		for rest := n; rest > 0; {
+			part := min(rest, b.Burst())
+			r := b.ReserveN(now, part)
+			reservations = append(reservations, r)
+			delay = max(delay, r.DelayFrom(now))
+			rest -= part
+		}
+	}
+	return delay, reservations
+}
+
+// Release освобождает bucket, взятый из Group
+type Release func()
+
+// groupIdleGrace сколько bucket без передач хранится после того, как снова наполнился
+const groupIdleGrace = 10 * time.Second
+
+// Group bucket с одной скоростью для каждого ключа (клиента или IP-адреса).
+// Bucket общий для всех одновременных передач ключа и остается после них, чтобы
+// следующая передача не получила полный bucket заново. Bucket без передач удаляется,
+// когда наполнился и не отличается от нового
+type Group struct {
+	bytesPerSec int64
+	idleTTL     time.Duration    // время наполнения bucket и groupIdleGrace
+	now         func() time.Time // подменяется в тестах
+	mu          sync.Mutex
+	buckets     map[string]*groupBucket
+	lastSweep   time.Time
+}
+
+type groupBucket struct {
+	bucket    *rate.Limiter
+	refs      int
+	idleSince time.Time // когда завершилась последняя передача, если refs 0
+}
+
+// NewGroup возвращает Group на bytesPerSec байт в секунду для каждого ключа, nil - без ограничения
+func NewGroup(bytesPerSec int64) *Group {
+	if bytesPerSec <= 0 {
+		return nil
+	}
+	burst := min(bytesPerSec, math.MaxInt32)
+	return &Group{
+		bytesPerSec: bytesPerSec,
+		idleTTL:     time.Duration(float64(burst)/float64(bytesPerSec)*float64(time.Second)) + groupIdleGrace,
+		now:         time.Now,
+		buckets:     make(map[string]*groupBucket),
+	}
+}
+
+// Acquire вернет bucket ключа key, после передачи его нужно освободить через Release.
+// Для nil Group и пустого key вернет nil
+func (g *Group) Acquire(key string) (*rate.Limiter, Release) {
+	if g == nil || key == "" {
+		return nil, func() {}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.sweep(g.now())
+	gb, ok := g.buckets[key]
+	if !ok {
+		gb = &groupBucket{bucket: NewBucket(g.bytesPerSec)}
+		g.buckets[key] = gb
+	}
+	gb.refs++
+
+	var once sync.Once
+	return gb.bucket, func() {
+		once.Do(func() {
+			g.mu.Lock()
+			defer g.mu.Unlock()
+			if gb.refs--; gb.refs == 0 {
+				gb.idleSince = g.now()
+			}
+		})
+	}
+}
+
+// sweep удаляет bucket без передач дольше idleTTL. Проверяет не чаще раза в idleTTL,
+// чтобы Acquire не обходил все bucket каждый раз. Вызывается под g.mu
+func (g *Group) sweep(now time.Time) {
+	if now.Sub(g.lastSweep) < g.idleTTL {
+		return
+	}
+	g.lastSweep = now
+	for key, gb := range g.buckets {
+		if gb.refs == 0 && now.Sub(gb.idleSince) >= g.idleTTL {
+			delete(g.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int64
+		wantErr bool
+	}{
+		{in: "0"},
+		{in: "1500", want: 1500},
+		{in: "512K", want: 512 << 10},
+		{in: "10M", want: 10 << 20},
+		{in: "2g", want: 2 << 30},
+		{in: ""},
+		{in: "-1M", wantErr: true},
+		{in: "10MB", wantErr: true},
+		{in: "fast", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseRate(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d, error %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if New(nil, NewBucket(0)) != nil {
+		t.Fatal("limiter without buckets is not nil")
+	}
+	var unlimited *Limiter
+	if err := unlimited.Wait(context.Background(), 1<<30); err != nil {
+		t.Fatal(err)
+	}
+
+	// bucket полон на старте, дальше 64 KB/s; второй bucket в 4 раза быстрее
+	// и ожидание не увеличивает
+	const bytesPerSec = 64 << 10
+	l := New(NewBucket(bytesPerSec), NewBucket(4*bytesPerSec))
+	now := time.Now()
+	tests := []struct {
+		n    int
+		want time.Duration
+	}{
+		{n: bytesPerSec, want: 0},
+		{n: bytesPerSec / 2, want: 500 * time.Millisecond},
+		{n: 2 * bytesPerSec, want: 2500 * time.Millisecond}, // часть больше bucket
+	}
+	for _, tt := range tests {
+		delay, _ := l.reserve(now, tt.n)
+		if diff := delay - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Fatalf("reserve(%d) delay = %v, want %v", tt.n, delay, tt.want)
+		}
+	}
+	// через секунду в bucket снова секунда трафика
+	later := now.Add(3500 * time.Millisecond)
+	if delay, _ := l.reserve(later, bytesPerSec); delay > time.Millisecond {
+		t.Fatalf("delay after refill = %v, want 0", delay)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	const bytesPerSec = 64 << 10
+	b := NewBucket(bytesPerSec)
+	l := New(b)
+	if err := l.Wait(context.Background(), bytesPerSec); err != nil {
+		t.Fatal(err)
+	}
+
+	// ожидание дольше дедлайна сразу возвращает ошибку, байты остаются в bucket
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := l.Wait(ctx, bytesPerSec); err == nil || ctx.Err() != nil {
+		t.Fatalf("Wait error = %v, want immediate deadline error", err)
+	}
+	if tokens := b.TokensAt(start); tokens < -1 {
+		t.Fatalf("%.0f tokens after rejected wait, want reservation canceled", tokens)
+	}
+
+	// отмена ctx прерывает ожидание
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := l.Wait(ctx, bytesPerSec); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Wait with canceled context error = %v", err)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	if b, release := (*Group)(nil).Acquire("alice"); b != nil {
+		t.Fatal("nil group returned a bucket")
+	} else {
+		release()
+	}
+
+	g := NewGroup(1 << 20)
+	now := time.Now()
+	g.now = func() time.Time { return now }
+
+	a1, release1 := g.Acquire("alice")
+	a2, release2 := g.Acquire("alice")
+	b, releaseB := g.Acquire("bob")
+	if a1 != a2 || a1 == b {
+		t.Fatal("transfers of one client must share a bucket, different clients must not")
+	}
+	release1()
+	release1() // повторное освобождение ничего не делает
+	release2()
+	releaseB()
+
+	// следующая передача продолжает с тем же bucket и не получает новую секунду трафика
+	if !a1.AllowN(now, 1<<20) {
+		t.Fatal("fresh bucket is not full")
+	}
+	a3, release3 := g.Acquire("alice")
+	if a3 != a1 {
+		t.Fatal("idle bucket was dropped right after transfer")
+	}
+	if a3.AllowN(now, 1<<20) {
+		t.Fatal("sequential transfer got a full bucket again")
+	}
+	release3()
+
+	// bucket без передач удаляется, когда наполнился
+	now = now.Add(g.idleTTL - time.Millisecond)
+	g.Acquire("carol")
+	if len(g.buckets) != 3 {
+		t.Fatalf("%d buckets before idle TTL, want 3", len(g.buckets))
+	}
+	now = now.Add(g.idleTTL)
+	_, releaseC := g.Acquire("carol")
+	if _, ok := g.buckets["alice"]; ok || len(g.buckets) != 1 {
+		t.Fatalf("buckets after idle TTL = %v, want only carol", g.buckets)
+	}
+	releaseC()
+}
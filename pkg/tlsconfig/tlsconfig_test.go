@@ -0,0 +1,255 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testCA удостоверяющий центр для тестовых сертификатов
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue выпускает сертификат для localhost и возвращает сертификат и ключ в PEM
+func (ca *testCA) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile записывает data в файл name в dir и сдвигает время изменения вперед,
+// чтобы Watch заметил замену независимо от точности времени файловой системы
+func writeFile(t *testing.T, dir, name string, data []byte) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if stat, err := os.Stat(path); err == nil {
+		modTime := stat.ModTime().Add(time.Second)
+		if err = os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return path
+}
+
+// handshake выполняет TLS-рукопожатие клиента и сервера через loopback и возвращает ошибку клиента или сервера
+func handshake(t *testing.T, server, client *tls.Config) error {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverErr <- err
+			return
+		}
+		defer conn.Close()
+		serverErr <- tls.Server(conn, server).HandshakeContext(ctx)
+	}()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tlsConn := tls.Client(conn, client)
+	err = tlsConn.HandshakeContext(ctx)
+	if err == nil {
+		// в TLS 1.3 сервер проверяет сертификат клиента после того, как клиент завершил рукопожатие
+		_ = tlsConn.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+		_, _ = tlsConn.Read(make([]byte, 1))
+	}
+	conn.Close()
+	if sErr := <-serverErr; sErr != nil && err == nil {
+		err = sErr
+	}
+	return err
+}
+
+func newReloader(t *testing.T, certFile, keyFile, caFile string) *Reloader {
+	t.Helper()
+	r, err := NewReloader(certFile, keyFile, caFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestHandshake(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	ca := newTestCA(t, "ca")
+	other := newTestCA(t, "other")
+	serverCert, serverKey := ca.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	clientCert, clientKey := ca.issue(t, "client", x509.ExtKeyUsageClientAuth)
+	strangerCert, strangerKey := other.issue(t, "stranger", x509.ExtKeyUsageClientAuth)
+
+	caFile := writeFile(t, dir, "ca.pem", ca.pem)
+	otherCAFile := writeFile(t, dir, "other.pem", other.pem)
+	server := newReloader(t, writeFile(t, dir, "server.pem", serverCert), writeFile(t, dir, "server.key", serverKey), caFile)
+	client := newReloader(t, writeFile(t, dir, "client.pem", clientCert), writeFile(t, dir, "client.key", clientKey), caFile)
+
+	tests := []struct {
+		name       string
+		clientAuth tls.ClientAuthType
+		client     *Reloader
+		serverName string
+		ok         bool
+	}{
+		{name: "mTLS", clientAuth: tls.RequireAndVerifyClientCert, client: client, serverName: "localhost", ok: true},
+		{name: "server auth only", clientAuth: tls.NoClientCert, client: newReloader(t, "", "", caFile), serverName: "localhost", ok: true},
+		{name: "wrong CA", clientAuth: tls.NoClientCert, client: newReloader(t, "", "", otherCAFile), serverName: "localhost"},
+		{name: "wrong server name", clientAuth: tls.NoClientCert, client: client, serverName: "example.com"},
+		{name: "missing client certificate", clientAuth: tls.RequireAndVerifyClientCert, client: newReloader(t, "", "", caFile), serverName: "localhost"},
+		{
+			name:       "client certificate from other CA",
+			clientAuth: tls.RequireAndVerifyClientCert,
+			client:     newReloader(t, writeFile(t, dir, "stranger.pem", strangerCert), writeFile(t, dir, "stranger.key", strangerKey), caFile),
+			serverName: "localhost",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handshake(t, server.ServerConfig(tt.clientAuth), tt.client.ClientConfig(tt.serverName))
+			if tt.ok && err != nil {
+				t.Fatalf("handshake failed: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("handshake succeeded, want error")
+			}
+		})
+	}
+}
+
+// Сертификаты и CA, замененные на диске, применяются к следующему рукопожатию
+func TestWatchReload(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+
+	dir := t.TempDir()
+	oldCA := newTestCA(t, "old")
+	newCA := newTestCA(t, "new")
+	serverCert, serverKey := oldCA.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	certFile := writeFile(t, dir, "server.pem", serverCert)
+	keyFile := writeFile(t, dir, "server.key", serverKey)
+	server := newReloader(t, certFile, keyFile, "")
+	clientCAFile := writeFile(t, dir, "client-ca.pem", oldCA.pem)
+	client := newReloader(t, "", "", clientCAFile)
+	oldClient := newReloader(t, "", "", writeFile(t, dir, "old-ca.pem", oldCA.pem))
+
+	serverConfig := server.ServerConfig(tls.NoClientCert)
+	clientConfig := client.ClientConfig("localhost")
+	if err := handshake(t, serverConfig, clientConfig); err != nil {
+		t.Fatalf("handshake before reload: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Watch(ctx, 10*time.Millisecond)
+	go client.Watch(ctx, 10*time.Millisecond)
+
+	prevCert, prevPool := server.Certificate(), client.CertPool()
+	serverCert, serverKey = newCA.issue(t, "server", x509.ExtKeyUsageServerAuth)
+	writeFile(t, dir, "server.pem", serverCert)
+	writeFile(t, dir, "server.key", serverKey)
+	writeFile(t, dir, "client-ca.pem", newCA.pem)
+	deadline := time.Now().Add(5 * time.Second)
+	for server.Certificate() == prevCert || client.CertPool() == prevPool {
+		if time.Now().After(deadline) {
+			t.Fatal("certificates were not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// конфиги созданы до замены, но рукопожатие видит новые файлы
+	if err := handshake(t, serverConfig, clientConfig); err != nil {
+		t.Fatalf("handshake after reload: %v", err)
+	}
+	if err := handshake(t, serverConfig, oldClient.ClientConfig("localhost")); err == nil {
+		t.Fatal("client trusting only the old CA accepted the new certificate")
+	}
+
+	// поврежденный файл не заменяет загруженный сертификат
+	prevCert = server.Certificate()
+	writeFile(t, dir, "server.pem", []byte("garbage"))
+	time.Sleep(50 * time.Millisecond)
+	if server.Certificate() != prevCert {
+		t.Fatal("invalid certificate replaced the loaded one")
+	}
+	if err := handshake(t, serverConfig, clientConfig); err != nil {
+		t.Fatalf("handshake after failed reload: %v", err)
+	}
+}
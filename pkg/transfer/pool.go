@@ -0,0 +1,70 @@
+package transfer
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// Буферы делятся на классы по степеням двойки от 4 KB до MaxChunkSize, у каждого класса свой пул.
+// Пулы общие для всех передач процесса
+const (
+	minBufferShift = 12
+	maxBufferShift = 22 // 1<<maxBufferShift == MaxChunkSize
+)
+
+var buffers [maxBufferShift - minBufferShift + 1]sync.Pool
+
+// bufferClass вернет класс буфера размером size
+func bufferClass(size int) int {
+	if size <= 1<<minBufferShift {
+		return 0
+	}
+	return bits.Len(uint(size-1)) - minBufferShift
+}
+
+// GetBuffer вернет буфер длиной size из общего пула. Буфер возвращается в пул через PutBuffer
+func GetBuffer(size int) *[]byte {
+	class := bufferClass(size)
+	if class >= len(buffers) {
+		b := make([]byte, size)
+		return &b
+	}
+	if b, ok := buffers[class].Get().(*[]byte); ok {
+		*b = (*b)[:size]
+		return b
+	}
+	b := make([]byte, size, 1<<(class+minBufferShift))
+	return &b
+}
+
+// PutBuffer возвращает буфер в пул, после этого буфер использовать нельзя.
+// Буферы не из GetBuffer пропускаются
+func PutBuffer(b *[]byte) {
+	class := bufferClass(cap(*b))
+	if class >= len(buffers) || cap(*b) != 1<<(class+minBufferShift) {
+		return
+	}
+	buffers[class].Put(b)
+}
+
+// Buffer буфер для сжатых или распакованных частей. Берется из пула при первом использовании,
+// поэтому передачи без сжатия его не занимают
+type Buffer struct {
+	b *[]byte
+}
+
+// Bytes вернет пустой срез емкостью MaxChunkSize
+func (b *Buffer) Bytes() []byte {
+	if b.b == nil {
+		b.b = GetBuffer(MaxChunkSize)
+	}
+	return (*b.b)[:0]
+}
+
+// Release возвращает буфер в пул
+func (b *Buffer) Release() {
+	if b.b != nil {
+		PutBuffer(b.b)
+		b.b = nil
+	}
+}
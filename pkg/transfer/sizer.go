@@ -0,0 +1,117 @@
+package transfer
+
+import (
+	"io"
+	"math/bits"
+	"time"
+)
+
+const (
+	// targetInterval сколько должна занимать обработка и отправка одной части:
+	// на быстрых каналах части растут, чтобы не тратить время на накладные расходы сообщений,
+	// на медленных - уменьшаются, чтобы обрыв и отмена теряли меньше данных
+	targetInterval = 100 * time.Millisecond
+	adjustEvery    = 4    // через сколько частей пересчитывается размер
+	rateWeight     = 0.25 // вес новой части в скользящей средней скорости
+)
+
+// Sizer подбирает размер следующей части одной передачи по скорости отправки прошлых частей и RTT.
+// Не безопасен для использования из нескольких горутин
+type Sizer struct {
+	settings Settings
+	size     int
+	rtt      time.Duration
+	rate     float64 // байт в секунду
+	samples  int
+}
+
+// NewSizer возвращает Sizer, нулевые размеры в settings заменяются значениями по умолчанию
+func NewSizer(settings Settings) *Sizer {
+	settings.setDefaults()
+	return &Sizer{settings: settings, size: settings.Size}
+}
+
+// Size вернет размер следующей части
+func (z *Sizer) Size() int {
+	return z.size
+}
+
+// SetRTT задает измеренное время ответа сервера. На каналах с большой задержкой
+// отправка части занимает не меньше RTT, чтобы сообщения не дробились мельче окна
+func (z *Sizer) SetRTT(rtt time.Duration) {
+	z.rtt = rtt
+}
+
+// Observe учитывает, что часть из n байт обработана и отправлена за d
+func (z *Sizer) Observe(n int, d time.Duration) {
+	if !z.settings.Adaptive || n <= 0 {
+		return
+	}
+	rate := float64(n) / max(d, time.Microsecond).Seconds()
+	if z.samples == 0 {
+		z.rate = rate
+	} else {
+		z.rate += rateWeight * (rate - z.rate)
+	}
+	z.samples++
+	if z.samples%adjustEvery != 0 {
+		return
+	}
+
+	target := max(targetInterval, z.rtt)
+	want := int(min(z.rate*target.Seconds(), float64(z.settings.Max)))
+	// размер меняется не больше чем вдвое за раз, чтобы одна медленная часть его не обрушила
+	want = min(max(want, z.size/2), z.size*2)
+	// степени двойки совпадают с классами пула и не дают размеру дрожать
+	if want > 0 {
+		want = 1 << (bits.Len(uint(want)) - 1)
+	}
+	z.size = min(max(want, z.settings.Min), z.settings.Max)
+}
+
+// Reader читает данные частями, размер которых подбирает Sizer, в буферы из общего пула
+type Reader struct {
+	r     io.Reader
+	sizer *Sizer
+	buf   *[]byte
+	n     int       // размер прошлой части
+	start time.Time // когда была запрошена прошлая часть
+}
+
+// NewReader возвращает Reader, после передачи буфер возвращается в пул через Release
+func NewReader(r io.Reader, sizer *Sizer) *Reader {
+	return &Reader{r: r, sizer: sizer}
+}
+
+// Next вернет следующую часть, после последней - io.EOF. Часть действительна до следующего вызова.
+// Время между вызовами считается временем обработки и отправки прошлой части
+func (r *Reader) Next() ([]byte, error) {
+	now := time.Now()
+	if r.n > 0 {
+		r.sizer.Observe(r.n, now.Sub(r.start))
+	}
+	r.start = now
+
+	if size := r.sizer.Size(); r.buf == nil || len(*r.buf) != size {
+		r.Release()
+		r.buf = GetBuffer(size)
+	}
+	n, err := io.ReadFull(r.r, *r.buf)
+	r.n = n
+	switch {
+	case err == io.ErrUnexpectedEOF:
+		// последняя неполная часть, следующий вызов вернет io.EOF
+		return (*r.buf)[:n], nil
+	case err != nil:
+		return nil, err
+	}
+	return (*r.buf)[:n], nil
+}
+
+// Release возвращает буфер в пул
+func (r *Reader) Release() {
+	if r.buf != nil {
+		PutBuffer(r.buf)
+		r.buf = nil
+	}
+}
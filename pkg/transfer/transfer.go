@@ -0,0 +1,60 @@
+// Package transfer размер частей при передаче файлов и общий пул буферов для них
+package transfer
+
+import (
+	"fmt"
+
+	"github.com/RVodassa/FileTransfer/pkg/compression"
+)
+
+// Границы размера части файла в одном сообщении
+const (
+	MinChunkSize = 4 << 10
+	// MaxChunkSize совпадает с пределом распаковки, иначе сжатую часть нельзя будет принять
+	MaxChunkSize = compression.MaxChunkSize
+	// MaxMessageSize предел размера сообщения gRPC: часть максимального размера и остальные поля
+	MaxMessageSize = MaxChunkSize + 64<<10
+)
+
+// Размеры по умолчанию
+const (
+	DefaultChunkSize    = 1 << 20
+	DefaultMinChunkSize = 64 << 10
+	DefaultMaxChunkSize = MaxChunkSize
+)
+
+// Settings размер частей передачи. Без Adaptive все части размера Size,
+// в адаптивном режиме размер начинается с Size и меняется от Min до Max
+type Settings struct {
+	Size     int
+	Adaptive bool
+	Min      int
+	Max      int
+}
+
+// setDefaults заменяет нулевые размеры значениями по умолчанию
+func (s *Settings) setDefaults() {
+	if s.Size == 0 {
+		s.Size = DefaultChunkSize
+	}
+	if s.Min == 0 {
+		s.Min = min(DefaultMinChunkSize, s.Size)
+	}
+	if s.Max == 0 {
+		s.Max = max(DefaultMaxChunkSize, s.Size)
+	}
+}
+
+// Validate проверяет размеры, 0 заменяется значением по умолчанию
+func (s *Settings) Validate() error {
+	s.setDefaults()
+	for _, size := range []int{s.Size, s.Min, s.Max} {
+		if size < MinChunkSize || size > MaxChunkSize {
+			return fmt.Errorf("chunk sizes must be from %d to %d bytes", MinChunkSize, MaxChunkSize)
+		}
+	}
+	if s.Min > s.Size || s.Size > s.Max {
+		return fmt.Errorf("min_chunk_size <= chunk_size <= max_chunk_size required")
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package transfer
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSizer(t *testing.T) {
+	settings := Settings{Size: 1 << 20, Min: 64 << 10, Max: 4 << 20}
+
+	// без adaptive размер постоянный
+	z := NewSizer(settings)
+	for i := 0; i < 16; i++ {
+		z.Observe(1<<20, time.Microsecond)
+	}
+	if z.Size() != 1<<20 {
+		t.Fatalf("fixed size changed to %d", z.Size())
+	}
+
+	settings.Adaptive = true
+	tests := []struct {
+		name string
+		rate float64 // байт в секунду
+		rtt  time.Duration
+		want int
+	}{
+		{name: "fast link grows to max", rate: 1 << 30, want: 4 << 20},
+		{name: "slow link shrinks to min", rate: 64 << 10, want: 64 << 10},
+		{name: "chunk takes targetInterval", rate: 5 << 20, want: 512 << 10},
+		{name: "high rtt keeps chunks larger", rate: 5 << 20, rtt: 400 * time.Millisecond, want: 2 << 20},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			z := NewSizer(settings)
+			z.SetRTT(tt.rtt)
+			for i := 0; i < 64; i++ {
+				n := z.Size()
+				z.Observe(n, time.Duration(float64(n)/tt.rate*float64(time.Second)))
+			}
+			if z.Size() != tt.want {
+				t.Fatalf("size = %d, want %d", z.Size(), tt.want)
+			}
+		})
+	}
+}
+
+func TestReader(t *testing.T) {
+	data := bytes.Repeat([]byte("0123456789"), 100_000)
+	z := NewSizer(Settings{Size: 64 << 10, Adaptive: true, Min: 4 << 10, Max: 256 << 10})
+	r := NewReader(bytes.NewReader(data), z)
+	defer r.Release()
+
+	var got []byte
+	for {
+		chunk, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chunk) == 0 || len(chunk) > 256<<10 {
+			t.Fatalf("chunk of %d bytes", len(chunk))
+		}
+		got = append(got, chunk...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("read data differs")
+	}
+}
+
+func TestSettingsValidate(t *testing.T) {
+	var s Settings
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Size != DefaultChunkSize || s.Min != DefaultMinChunkSize || s.Max != DefaultMaxChunkSize {
+		t.Fatalf("defaults not applied: %+v", s)
+	}
+	for _, s := range []Settings{
+		{Size: MaxChunkSize + 1},
+		{Size: 1 << 20, Min: 1 << 10},
+		{Size: 1 << 20, Min: 2 << 20},
+		{Size: 2 << 20, Max: 1 << 20},
+	} {
+		if err := s.Validate(); err == nil {
+			t.Errorf("Validate(%+v) = nil, want error", s)
+		}
+	}
+}
+
+func TestBufferPool(t *testing.T) {
+	if 1<<maxBufferShift != MaxChunkSize {
+		t.Fatalf("maxBufferShift does not match MaxChunkSize")
+	}
+	b := GetBuffer(100 << 10)
+	if len(*b) != 100<<10 || cap(*b) != 128<<10 {
+		t.Fatalf("len %d cap %d, want len %d cap %d", len(*b), cap(*b), 100<<10, 128<<10)
+	}
+	PutBuffer(b)
+
+	// буфер того же класса переиспользуется без выделения памяти
+	allocs := testing.AllocsPerRun(100, func() {
+		PutBuffer(GetBuffer(120 << 10))
+	})
+	if allocs > 0 {
+		t.Fatalf("%.0f allocations per pooled buffer", allocs)
+	}
+}